@@ -0,0 +1,212 @@
+package quickjs
+
+import (
+	"context"
+	"errors"
+)
+
+// abortScript defines the AbortController and AbortSignal globals, unless a script has set them already, and returns the functions linking signals to Go contexts:
+// link(id) returns a new signal, linked under the id if it is not 0, and abort(id, name, message) aborts the linked signal
+// with an error of the name and message.
+const abortScript = `(() => {
+	const state = Symbol("state");
+	const illegal = Symbol("illegal");
+	const newError = (name, message) => {
+		const error = new Error(message);
+		error.name = name;
+		return error;
+	};
+
+	const abortSignal = (signal, reason) => {
+		const s = signal[state];
+		if (s.aborted) {
+			return;
+		}
+		s.aborted = true;
+		s.reason = reason === undefined ? newError("AbortError", "This operation was aborted") : reason;
+
+		const event = { type: "abort", target: signal, currentTarget: signal };
+		const listeners = s.listeners;
+		s.listeners = [];
+		let error;
+		const dispatch = (listener) => {
+			try {
+				typeof listener === "function" ? listener.call(signal, event) : listener.handleEvent(event);
+			} catch (e) {
+				if (error === undefined) {
+					error = { e };
+				}
+			}
+		};
+		if (typeof signal.onabort === "function") {
+			dispatch(signal.onabort);
+		}
+		listeners.forEach(dispatch);
+		if (error !== undefined) {
+			throw error.e;
+		}
+	};
+
+	class AbortSignal {
+		constructor(key) {
+			if (key !== illegal) {
+				throw new TypeError("Illegal constructor");
+			}
+			Object.defineProperty(this, state, { value: { aborted: false, reason: undefined, listeners: [] } });
+			this.onabort = null;
+		}
+		get aborted() {
+			return this[state].aborted;
+		}
+		get reason() {
+			return this[state].reason;
+		}
+		throwIfAborted() {
+			if (this[state].aborted) {
+				throw this[state].reason;
+			}
+		}
+		addEventListener(type, listener) {
+			const s = this[state];
+			if (type !== "abort" || listener == null || s.aborted || s.listeners.includes(listener)) {
+				return;
+			}
+			s.listeners.push(listener);
+		}
+		removeEventListener(type, listener) {
+			const listeners = this[state].listeners;
+			const i = listeners.indexOf(listener);
+			if (type === "abort" && i >= 0) {
+				listeners.splice(i, 1);
+			}
+		}
+		get [Symbol.toStringTag]() {
+			return "AbortSignal";
+		}
+		static abort(reason) {
+			const signal = new AbortSignal(illegal);
+			abortSignal(signal, reason);
+			return signal;
+		}
+		static timeout(ms) {
+			const signal = new AbortSignal(illegal);
+			setTimeout(() => abortSignal(signal, newError("TimeoutError", "The operation timed out")), ms);
+			return signal;
+		}
+	}
+
+	class AbortController {
+		constructor() {
+			Object.defineProperty(this, state, { value: new AbortSignal(illegal) });
+		}
+		get signal() {
+			return this[state];
+		}
+		abort(reason) {
+			abortSignal(this[state], reason);
+		}
+		get [Symbol.toStringTag]() {
+			return "AbortController";
+		}
+	}
+
+	for (const ctor of [AbortSignal, AbortController]) {
+		const desc = Object.getOwnPropertyDescriptor(globalThis, ctor.name);
+		if (desc === undefined || !("value" in desc)) {
+			Object.defineProperty(globalThis, ctor.name, { value: ctor, writable: true, configurable: true });
+		}
+	}
+
+	const linked = new Map();
+	return {
+		link(id) {
+			const signal = new AbortSignal(illegal);
+			if (id !== 0) {
+				linked.set(id, signal);
+			}
+			return signal;
+		},
+		abort(id, name, message) {
+			const signal = linked.get(id);
+			if (signal !== undefined) {
+				linked.delete(id);
+				abortSignal(signal, newError(name, message));
+			}
+		},
+	};
+})()`
+
+// installAbort evaluates abortScript, once; it installs the AbortController and AbortSignal globals on first use, see lazyGlobals.
+func (ctx *Context) installAbort() error {
+	if ctx.abortLinks != nil {
+		return nil
+	}
+	links, err := ctx.eval(abortScript, EvalFileName("<abort>"))
+	if err != nil {
+		return err
+	}
+	links.keep()
+	ctx.abortLinks = &links
+	return nil
+}
+
+// NewAbortSignalFromContext returns a new AbortSignal aborted when the Go context is done, so that the cancellation of
+// a request, for instance, propagates to the scripts listening to the signal. The reason of the abort is an Error named
+// TimeoutError if the deadline of the Go context is exceeded, or else AbortError, with the message of its error.
+//
+// The abort runs as a job scheduled on the context, see Schedule, so it does not interrupt a running script and,
+// without WithDedicatedThread, waits for the next Loop. The signal is kept until the Go context is done, or the context reset or closed.
+func (ctx *Context) NewAbortSignalFromContext(goctx context.Context) (Value, error) {
+	if err := ctx.installAbort(); err != nil {
+		return ctx.Undefined(), err
+	}
+	var id int64
+	if goctx.Done() != nil {
+		ctx.abortSeq++
+		id = ctx.abortSeq
+	}
+	idValue := ctx.Int64(id)
+	signal := ctx.abortLinks.Call("link", idValue)
+	if signal.IsException() {
+		return signal, ctx.exceptionError()
+	}
+	if id == 0 {
+		return signal, nil
+	}
+
+	if err := goctx.Err(); err != nil {
+		if err := ctx.abortLink(id, err); err != nil {
+			signal.Free()
+			return ctx.Undefined(), err
+		}
+		return signal, nil
+	}
+	go func() {
+		select {
+		case <-goctx.Done():
+			ctx.schedule(job{run: func(ctx *Context) {
+				if err := ctx.abortLink(id, goctx.Err()); err != nil {
+					ctx.reportUncaught(err.(*Error))
+				}
+			}}, ctx.jobQueue.done)
+		case <-ctx.jobQueue.done:
+		}
+	}()
+	return signal, nil
+}
+
+// abortLink aborts the signal linked to a Go context under the id, returning the exception thrown by its listeners.
+func (ctx *Context) abortLink(id int64, err error) error {
+	name := "AbortError"
+	if errors.Is(err, context.DeadlineExceeded) {
+		name = "TimeoutError"
+	}
+	args := []Value{ctx.Int64(id), ctx.String(name), ctx.String(err.Error())}
+	defer freeValues(args)
+	ret := ctx.abortLinks.Call("abort", args...)
+	defer ret.Free()
+	if ret.IsException() {
+		return ctx.exceptionError()
+	}
+	return nil
+}
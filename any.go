@@ -0,0 +1,297 @@
+package quickjs
+
+/*
+#include "bridge.h"
+*/
+import "C"
+import (
+	"errors"
+	"fmt"
+	"math"
+	"reflect"
+	"time"
+	"unsafe"
+)
+
+// NumberMode selects the Go type of the numbers converted by ToAny.
+type NumberMode int
+
+const (
+	// NumberFloat64 converts the numbers to float64, as Unmarshal does into interface{}.
+	NumberFloat64 NumberMode = iota
+	// NumberInt64 converts the integers within ±(2^53-1) to int64, and the other numbers to float64.
+	NumberInt64
+)
+
+// MapMode selects the Go type of the Map objects converted by ToAny.
+type MapMode int
+
+const (
+	// MapStringKeys converts Maps to map[string]interface{}, with their string and number keys as strings; the other keys fail.
+	MapStringKeys MapMode = iota
+	// MapAnyKeys converts Maps to map[interface{}]interface{}, with their keys converted like their values;
+	// the keys converted to slices or maps fail.
+	MapAnyKeys
+)
+
+// DateMode selects the Go type of the Date objects converted by ToAny.
+type DateMode int
+
+const (
+	// DateTime converts Dates to time.Time in UTC; invalid Dates fail.
+	DateTime DateMode = iota
+	// DateISOString converts Dates to the string of their toISOString method; invalid Dates fail.
+	DateISOString
+	// DateMillis converts Dates to the float64 milliseconds since the Unix epoch, NaN for invalid Dates.
+	DateMillis
+)
+
+// TypedArrayMode selects the Go type of the typed arrays converted by ToAny.
+type TypedArrayMode int
+
+const (
+	// TypedArraySlice converts typed arrays to a slice of their element type, e.g. []float32 for a Float32Array
+	// and []int64 for a BigInt64Array.
+	TypedArraySlice TypedArrayMode = iota
+	// TypedArrayBytes converts typed arrays to a copy of the bytes they view, in the byte order of the host.
+	TypedArrayBytes
+	// TypedArrayNumbers converts typed arrays to []interface{}, with their elements converted like numbers and BigInts.
+	TypedArrayNumbers
+)
+
+// AnyOption configures ToAny.
+type AnyOption func(*anyOptions)
+
+type anyOptions struct {
+	numbers     NumberMode
+	maps        MapMode
+	dates       DateMode
+	typedArrays TypedArrayMode
+}
+
+// AnyNumbers sets how ToAny converts numbers; default is NumberFloat64.
+func AnyNumbers(mode NumberMode) AnyOption {
+	return func(options *anyOptions) {
+		options.numbers = mode
+	}
+}
+
+// AnyMaps sets how ToAny converts Map objects; default is MapStringKeys.
+func AnyMaps(mode MapMode) AnyOption {
+	return func(options *anyOptions) {
+		options.maps = mode
+	}
+}
+
+// AnyDates sets how ToAny converts Date objects; default is DateTime.
+func AnyDates(mode DateMode) AnyOption {
+	return func(options *anyOptions) {
+		options.dates = mode
+	}
+}
+
+// AnyTypedArrays sets how ToAny converts typed arrays; default is TypedArraySlice.
+func AnyTypedArrays(mode TypedArrayMode) AnyOption {
+	return func(options *anyOptions) {
+		options.typedArrays = mode
+	}
+}
+
+// typedArrayElems maps the constructor names of the typed arrays to the Go type of their elements.
+var typedArrayElems = map[string]reflect.Type{
+	"Int8Array":         reflect.TypeOf(int8(0)),
+	"Uint8Array":        reflect.TypeOf(uint8(0)),
+	"Uint8ClampedArray": reflect.TypeOf(uint8(0)),
+	"Int16Array":        reflect.TypeOf(int16(0)),
+	"Uint16Array":       reflect.TypeOf(uint16(0)),
+	"Int32Array":        reflect.TypeOf(int32(0)),
+	"Uint32Array":       reflect.TypeOf(uint32(0)),
+	"BigInt64Array":     reflect.TypeOf(int64(0)),
+	"BigUint64Array":    reflect.TypeOf(uint64(0)),
+	"Float32Array":      reflect.TypeOf(float32(0)),
+	"Float64Array":      reflect.TypeOf(float64(0)),
+}
+
+// ToAny converts the value to Go like Unmarshal into interface{}, without a reflect target, as configured by the options:
+//   - null and undefined become nil, booleans bool, BigInts *big.Int and strings string;
+//   - numbers become float64, or int64 for integers, see AnyNumbers;
+//   - arrays and Sets become []interface{}, ArrayBuffers and DataViews []byte;
+//   - Maps become map[string]interface{} or map[interface{}]interface{}, see AnyMaps;
+//   - Dates become time.Time, string or float64, see AnyDates;
+//   - typed arrays become a slice of their element type, []byte or []interface{}, see AnyTypedArrays;
+//   - the other objects become map[string]interface{} of their own enumerable properties.
+//
+// Symbols and functions fail, as values nested deeper than Unmarshal converts, e.g. cyclic ones, do.
+func (v Value) ToAny(opts ...AnyOption) (interface{}, error) {
+	options := &UnmarshalOptions{any: &anyOptions{}}
+	for _, opt := range opts {
+		opt(options.any)
+	}
+	return v.toInterface(options)
+}
+
+// toAny converts the kinds which ToAny converts unlike Unmarshal into interface{}, reporting whether it did.
+func (v Value) toAny(options *UnmarshalOptions) (interface{}, bool, error) {
+	modes := options.any
+	switch v.Kind() {
+	case KindNumber:
+		f := v.Float64()
+		if modes.numbers == NumberInt64 && f == math.Trunc(f) && math.Abs(f) <= maxSafeInteger {
+			return int64(f), true, nil
+		}
+		return f, true, nil
+	case KindDate:
+		val, err := v.dateToAny(modes.dates)
+		return val, true, err
+	case KindMap:
+		val, err := v.mapToAny(options)
+		return val, true, err
+	case KindSet:
+		out := []interface{}{}
+		err := v.iterateToAny(func(elem *Value) error {
+			val, err := elem.elemToAny(options)
+			out = append(out, val)
+			return err
+		})
+		return out, true, err
+	case KindTypedArray:
+		val, err := v.typedArrayToAny(options)
+		return val, true, err
+	case KindDataView:
+		val, err := v.viewedBytes()
+		return val, true, err
+	}
+	return nil, false, nil
+}
+
+// elemToAny converts a nested value, counting its depth.
+func (v Value) elemToAny(options *UnmarshalOptions) (interface{}, error) {
+	var out interface{}
+	err := v.unmarshal(reflect.ValueOf(&out).Elem(), options)
+	return out, err
+}
+
+// iterateToAny calls fn with the values of the iterable until it fails.
+func (v Value) iterateToAny(fn func(elem *Value) error) error {
+	var err error
+	if iterErr := v.Iterate(func(elem *Value) bool {
+		err = fn(elem)
+		return err == nil
+	}); iterErr != nil {
+		return iterErr
+	}
+	return err
+}
+
+func (v Value) dateToAny(mode DateMode) (interface{}, error) {
+	ret := v.Call("getTime")
+	defer ret.Free()
+	if ret.IsException() {
+		return nil, v.ctx.exceptionError()
+	}
+	ms := ret.Float64()
+	switch {
+	case mode == DateMillis:
+		return ms, nil
+	case math.IsNaN(ms):
+		return nil, errors.New("quickjs: cannot convert an invalid Date")
+	case mode == DateISOString:
+		str := v.Call("toISOString")
+		defer str.Free()
+		if str.IsException() {
+			return nil, v.ctx.exceptionError()
+		}
+		return str.String(), nil
+	}
+	return time.UnixMilli(int64(ms)).UTC(), nil
+}
+
+func (v Value) mapToAny(options *UnmarshalOptions) (interface{}, error) {
+	byString := map[string]interface{}{}
+	byAny := map[interface{}]interface{}{}
+	err := v.iterateToAny(func(entry *Value) error {
+		key, elem := entry.GetIdx(0), entry.GetIdx(1)
+		defer key.Free()
+		defer elem.Free()
+		val, err := elem.elemToAny(options)
+		if err != nil {
+			return err
+		}
+		if options.any.maps == MapAnyKeys {
+			k, err := key.elemToAny(options)
+			if err != nil {
+				return err
+			}
+			if k != nil && !reflect.TypeOf(k).Comparable() {
+				return fmt.Errorf("quickjs: cannot convert Map key of type %s to a Go map key", key.typeName())
+			}
+			byAny[k] = val
+			return nil
+		}
+		if !key.IsString() && !key.IsNumber() {
+			return fmt.Errorf("quickjs: cannot convert Map key of type %s to string", key.typeName())
+		}
+		byString[key.String()] = val
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if options.any.maps == MapAnyKeys {
+		return byAny, nil
+	}
+	return byString, nil
+}
+
+func (v Value) typedArrayToAny(options *UnmarshalOptions) (interface{}, error) {
+	elemType, ok := typedArrayElems[builtinClasses.typedArrays[C.JS_GetClassID(v.ref)]]
+	switch {
+	case options.any.typedArrays == TypedArrayBytes:
+		return v.viewedBytes()
+	case options.any.typedArrays == TypedArrayNumbers || !ok:
+		n := v.Len()
+		if err := v.ctx.checkArrayLength(n); err != nil {
+			return nil, err
+		}
+		out := make([]interface{}, n)
+		for i := range out {
+			elem := v.GetIdx(int64(i))
+			val, err := elem.elemToAny(options)
+			elem.Free()
+			if err != nil {
+				return nil, err
+			}
+			out[i] = val
+		}
+		return out, nil
+	}
+	buf, err := v.viewedBytes()
+	if err != nil {
+		return nil, err
+	}
+	n := len(buf) / int(elemType.Size())
+	out := reflect.MakeSlice(reflect.SliceOf(elemType), n, n)
+	if n > 0 {
+		copy(unsafe.Slice((*byte)(out.UnsafePointer()), len(buf)), buf)
+	}
+	return out.Interface(), nil
+}
+
+// viewedBytes returns a copy of the bytes viewed by the typed array or DataView.
+func (v Value) viewedBytes() ([]byte, error) {
+	buffer := v.Get("buffer")
+	defer buffer.Free()
+	offset, length := v.Get("byteOffset").Int64(), v.Get("byteLength").Int64()
+	if err := v.ctx.checkArrayLength(length); err != nil {
+		return nil, err
+	}
+	var size C.size_t
+	ptr := C.JS_GetArrayBuffer(v.ctx.ref, &size, buffer.ref)
+	if ptr == nil {
+		return nil, v.ctx.exceptionError()
+	}
+	if offset < 0 || length < 0 || offset+length > int64(size) {
+		return nil, errors.New("quickjs: view exceeds its ArrayBuffer")
+	}
+	return C.GoBytes(unsafe.Add(unsafe.Pointer(ptr), offset), C.int(length)), nil
+}
@@ -0,0 +1,59 @@
+package quickjs
+
+/*
+#include "bridge.h"
+*/
+import "C"
+
+// InternAtom returns the atom of the property name, created once per context and kept until it is closed,
+// so that code accessing the same properties repeatedly, e.g. with GetAtom in a loop, skips converting the name each time.
+// The atom is owned by the context and must not be freed; it remains valid across Reset.
+func (ctx *Context) InternAtom(name string) *Atom {
+	if atom, ok := ctx.atoms[name]; ok {
+		return atom
+	}
+	atom := ctx.Atom(name)
+	if ctx.atoms == nil {
+		ctx.atoms = make(map[string]*Atom)
+	}
+	ctx.atoms[name] = &atom
+	return &atom
+}
+
+// freeAtoms frees the atoms interned by the context and the one of Symbol.iterator.
+func (ctx *Context) freeAtoms() {
+	for _, atom := range ctx.atoms {
+		atom.Free()
+	}
+	ctx.atoms = nil
+	if ctx.iteratorAtom != nil {
+		ctx.iteratorAtom.Free()
+		ctx.iteratorAtom = nil
+	}
+}
+
+// GetAtom returns the value of the property named by the atom.
+func (v Value) GetAtom(a *Atom) Value {
+	v.checkFreed()
+	return v.ctx.newValue(C.JS_GetProperty(v.ctx.ref, v.ref, a.ref))
+}
+
+// SetAtom sets the value of the property named by the atom, taking ownership of val.
+func (v Value) SetAtom(a *Atom, val Value) {
+	v.checkFreed()
+	if v.ctx.dropForeign(val) {
+		return
+	}
+	val.untrack()
+	C.JS_SetProperty(v.ctx.ref, v.ref, a.ref, val.ref)
+}
+
+// HasAtom returns true if the value has the property named by the atom.
+func (v Value) HasAtom(a *Atom) bool {
+	return C.JS_HasProperty(v.ctx.ref, v.ref, a.ref) == 1
+}
+
+// DeleteAtom deletes the property named by the atom.
+func (v Value) DeleteAtom(a *Atom) bool {
+	return C.JS_DeleteProperty(v.ctx.ref, v.ref, a.ref, C.int(1)) == 1
+}
@@ -0,0 +1,52 @@
+package quickjs
+
+import (
+	"fmt"
+	"time"
+)
+
+// WithAtomics will enable or disable the Atomics and SharedArrayBuffer globals of new contexts; default is true.
+func WithAtomics(atomics bool) Option {
+	return func(o *Options) {
+		o.disableAtomics = !atomics
+	}
+}
+
+// WithAtomicsWaitLimit will bound the duration of a single Atomics.wait() call; default is 0, unbounded.
+// A wait exceeding the limit returns "timed-out" as if the script had passed the limit as timeout.
+// Use WithCanBlock(false) to make Atomics.wait() throw instead.
+func WithAtomicsWaitLimit(limit time.Duration) Option {
+	return func(o *Options) {
+		o.atomicsWaitLimit = limit
+	}
+}
+
+// setupAtomics applies the runtime's Atomics options to a new context.
+func (ctx *Context) setupAtomics() error {
+	options := ctx.runtime.options
+	if options.disableAtomics {
+		ret, err := ctx.eval(`delete globalThis.Atomics; delete globalThis.SharedArrayBuffer;`, EvalFileName("<atomics>"))
+		ret.Free()
+		return err
+	}
+
+	if options.atomicsWaitLimit > 0 {
+		code := fmt.Sprintf(`((limit) => {
+			const originalWait = Atomics.wait;
+			Object.defineProperty(Atomics, "wait", {
+				value: function wait(typedArray, index, value, timeout) {
+					timeout = timeout === undefined ? Infinity : Number(timeout);
+					if (Number.isNaN(timeout) || timeout > limit) {
+						timeout = limit;
+					}
+					return originalWait.call(Atomics, typedArray, index, value, timeout);
+				},
+			});
+		})(%g)`, float64(options.atomicsWaitLimit)/float64(time.Millisecond))
+		ret, err := ctx.eval(code, EvalFileName("<atomics>"))
+		ret.Free()
+		return err
+	}
+
+	return nil
+}
@@ -0,0 +1,62 @@
+package quickjs
+
+/*
+#include "bridge.h"
+*/
+import "C"
+import (
+	"runtime"
+	"sync"
+)
+
+// freeQueue holds the values released by Go finalizers until the context can free them on its own thread.
+type freeQueue struct {
+	mu     sync.Mutex
+	refs   []C.JSValue
+	closed bool
+}
+
+func (q *freeQueue) push(ref C.JSValue) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if q.closed {
+		return
+	}
+	q.refs = append(q.refs, ref)
+}
+
+func (q *freeQueue) take() []C.JSValue {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	refs := q.refs
+	q.refs = nil
+	return refs
+}
+
+func (q *freeQueue) close() {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.closed = true
+}
+
+// AutoFree returns a heap copy of the value which is freed automatically once it becomes unreachable in Go.
+//
+// Go finalizers run on their own goroutine, so the value is only queued there and freed by the owning context
+// the next time it runs Eval, Await, Loop, FreePending or Close. The tradeoffs are:
+//   - the JS object lives until both the Go GC and the context get around to it, so memory is reclaimed later than with Free;
+//   - the returned value must not be freed manually, nor stored with Set/SetIdx, which take ownership;
+//   - Close frees the queued values, but values still reachable from Go at that point are never freed.
+func (v Value) AutoFree() *Value {
+	p := &Value{ctx: v.ctx, ref: v.ref}
+	runtime.SetFinalizer(p, func(p *Value) {
+		p.ctx.freeQueue.push(p.ref)
+	})
+	return p
+}
+
+// FreePending frees the values released by Go finalizers of AutoFree values.
+func (ctx *Context) FreePending() {
+	for _, ref := range ctx.freeQueue.take() {
+		Value{ctx: ctx, ref: ref}.Free()
+	}
+}
@@ -0,0 +1,186 @@
+package quickjs
+
+/*
+#include "bridge.h"
+*/
+import "C"
+import (
+	"fmt"
+	"os"
+	"time"
+)
+
+// awaitJobBudget is the number of promise jobs run at most by each round of Await before it turns to the scheduled jobs and timers.
+const awaitJobBudget = 64
+
+// WithMaxAwaitIterations will set the maximum number of rounds of the event loop run by Await, EvalAwait and Module.Await
+// for a promise, see AwaitMaxIterations; default is 0, no limit.
+func WithMaxAwaitIterations(max int) Option {
+	return func(o *Options) {
+		o.maxAwait = max
+	}
+}
+
+// AwaitOption configures Await and AwaitAll.
+type AwaitOption func(*awaitOptions)
+
+type awaitOptions struct {
+	maxIterations int
+	iterations    int // the rounds run so far
+}
+
+// AwaitMaxIterations sets the maximum number of rounds of the event loop run while waiting, overriding WithMaxAwaitIterations;
+// past it, the wait throws a RangeError, e.g. to stop a script chaining promise jobs forever. Each round runs up to 64 promise jobs,
+// one job queued by Schedule and one timer due, or waits for the next timer or scheduled job. Use 0 to remove the limit.
+func AwaitMaxIterations(max int) AwaitOption {
+	return func(options *awaitOptions) {
+		options.maxIterations = max
+	}
+}
+
+// newAwaitOptions returns the options of the runtime overridden by opts.
+func (ctx *Context) newAwaitOptions(opts []AwaitOption) *awaitOptions {
+	options := &awaitOptions{maxIterations: ctx.runtime.options.maxAwait}
+	for _, opt := range opts {
+		opt(options)
+	}
+	return options
+}
+
+// await waits for the promise with the options of the runtime, see awaitWith.
+func (ctx *Context) await(promise C.JSValue) C.JSValue {
+	return ctx.awaitWith(promise, ctx.newAwaitOptions(nil))
+}
+
+// awaitWith waits for the promise like js_std_await, taking ownership of it, but runs the event loop in rounds interleaving
+// the promise jobs, the jobs queued by Schedule and the timers, so that none of them starves the others, see awaitRound;
+// when none is ready, it waits for the next one, see awaitIdle.
+func (ctx *Context) awaitWith(promise C.JSValue, options *awaitOptions) C.JSValue {
+	for ctx.pending(promise) {
+		options.iterations++
+		if max := options.maxIterations; max > 0 && options.iterations > max {
+			C.JS_FreeValue(ctx.ref, promise)
+			exception := ctx.ThrowRangeError("maximum await iterations of %d exceeded", max)
+			exception.untrack()
+			return exception.ref
+		}
+		if ctx.awaitRound(promise) {
+			continue
+		}
+		if !ctx.awaitIdle(promise) {
+			C.JS_FreeValue(ctx.ref, promise)
+			exception := ctx.ThrowError(ErrContextClosed)
+			exception.untrack()
+			return exception.ref
+		}
+	}
+	return C.js_std_await(ctx.ref, promise)
+}
+
+// pending reports whether the promise is pending.
+func (ctx *Context) pending(promise C.JSValue) bool {
+	return C.JS_PromiseState(ctx.ref, promise) == C.JS_PROMISE_PENDING
+}
+
+// awaitRound runs the promise jobs pending, up to awaitJobBudget, then the next job queued by Schedule, then the next timer due
+// if no promise job is left, as timers run after the promise jobs, or if the budget was used up, so that endless promise jobs do not
+// starve the timers; it stops once the promise settles, and reports whether it ran anything.
+// It reports the exceptions of the jobs like uncaught exceptions, and prints the ones of timers left unhandled by SetUncaughtExceptionHandler.
+func (ctx *Context) awaitRound(promise C.JSValue) bool {
+	ran, exhausted := false, true
+	for i := 0; i < awaitJobBudget; i++ {
+		if !ctx.executePendingJob() {
+			exhausted = false
+			break
+		}
+		ran = true
+	}
+	if !ctx.pending(promise) {
+		return true
+	}
+	if j, ok := ctx.jobQueue.poll(); ok {
+		j.run(ctx)
+		ran = true
+	}
+	if !ctx.pending(promise) || !exhausted && C.JS_IsJobPending(ctx.runtime.ref) != 0 {
+		return true
+	}
+	if delay, ok := ctx.nextTimer(); ok && delay == 0 {
+		if err := ctx.fireTimer(); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+		}
+		ran = true
+	}
+	return ran
+}
+
+// awaitIdle waits for the next work when nothing is ready: it fires the next virtual timer of a deterministic context at once,
+// or else waits for the next timer or scheduled job, whichever comes first. Without timers, it first runs the event loop of the engine
+// for the handlers of the os module, e.g. os.setReadHandler. It reports false if the context is closed while waiting.
+func (ctx *Context) awaitIdle(promise C.JSValue) bool {
+	if ctx.fireVirtualTimer() {
+		return true
+	}
+	var timeout <-chan time.Time
+	if delay, ok := ctx.nextTimer(); ok {
+		timer := time.NewTimer(delay)
+		defer timer.Stop()
+		timeout = timer.C
+	} else {
+		C.js_std_loop(ctx.ref)
+		if !ctx.pending(promise) {
+			return true
+		}
+	}
+	if j, ok := ctx.jobQueue.nextUntil(timeout); ok {
+		j.run(ctx)
+		return true
+	}
+	if timeout == nil {
+		return false
+	}
+	if err := ctx.fireTimer(); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+	}
+	return true
+}
+
+// AwaitAll waits for the values like Await, taking ownership of them, and returns their results in order, which must be freed;
+// a nil value results in undefined. As the event loop runs for all of them while waiting for the first, they all make progress meanwhile,
+// and the iterations of AwaitMaxIterations are counted for the whole call. If a value is rejected, the results so far and the values
+// left are freed, and the first rejection in order is returned.
+func (ctx *Context) AwaitAll(values []*Value, opts ...AwaitOption) (vals []Value, err error) {
+	if t := ctx.runtime.thread; t.remote() {
+		t.do(func() { vals, err = ctx.AwaitAll(values, opts...) })
+		return vals, err
+	}
+	if err := ctx.checkGoroutine(); err != nil {
+		return nil, err
+	}
+	defer ctx.enter()()
+	ctx.FreePending()
+	options := ctx.newAwaitOptions(opts)
+	vals = make([]Value, 0, len(values))
+	for i, v := range values {
+		if v == nil {
+			vals = append(vals, ctx.Undefined())
+			continue
+		}
+		v.untrack()
+		val := ctx.newValue(ctx.awaitWith(v.ref, options))
+		if val.IsException() {
+			err := ctx.Exception()
+			for _, val := range vals {
+				val.Free()
+			}
+			for _, v := range values[i+1:] {
+				if v != nil {
+					v.Free()
+				}
+			}
+			return nil, err
+		}
+		vals = append(vals, val)
+	}
+	return vals, nil
+}
@@ -0,0 +1,73 @@
+package quickjs
+
+/*
+#include "bridge.h"
+*/
+import "C"
+import (
+	"fmt"
+	"unsafe"
+)
+
+// EvalBatch evaluates the codes in order with a single transition into the engine, and returns their results,
+// which must be freed by the caller. It stops at the first exception, returning the results so far and
+// an error naming the index of the failed code. The bytecode cache is not used; EvalAwait waits for each result in turn.
+func (ctx *Context) EvalBatch(codes []string, opts ...EvalOption) ([]Value, error) {
+	if err := ctx.checkGoroutine(); err != nil {
+		return nil, err
+	}
+	opts = ctx.strictOptions(opts)
+	options := newEvalOptions(opts)
+	if options.await {
+		results := make([]Value, 0, len(codes))
+		for i, code := range codes {
+			val, err := ctx.Eval(code, opts...)
+			if err != nil {
+				val.Free()
+				return results, fmt.Errorf("batch[%d]: %w", i, err)
+			}
+			results = append(results, val)
+		}
+		return results, nil
+	}
+
+	defer ctx.enter()()
+	defer ctx.withOrigin(options.origin)()
+	ctx.FreePending()
+	if len(codes) == 0 {
+		return nil, nil
+	}
+
+	// copy the codes to one NUL separated C buffer
+	size := 0
+	for _, code := range codes {
+		size += len(code) + 1
+	}
+	buf := unsafe.Slice((*byte)(C.malloc(C.size_t(size))), size)
+	defer C.free(unsafe.Pointer(&buf[0]))
+	ptrs := make([]*C.char, len(codes))
+	lens := make([]C.size_t, len(codes))
+	offset := 0
+	for i, code := range codes {
+		copy(buf[offset:], code)
+		buf[offset+len(code)] = 0
+		ptrs[i] = (*C.char)(unsafe.Pointer(&buf[offset]))
+		lens[i] = C.size_t(len(code))
+		offset += len(code) + 1
+	}
+
+	filenamePtr := C.CString(options.filename)
+	defer C.free(unsafe.Pointer(filenamePtr))
+
+	refs := make([]C.JSValue, len(codes))
+	n := int(C.EvalBatch(ctx.ref, &ptrs[0], &lens[0], C.int(len(codes)), filenamePtr, options.flags(), &refs[0]))
+
+	results := make([]Value, n)
+	for i := range results {
+		results[i] = ctx.newValue(refs[i])
+	}
+	if n < len(codes) {
+		return results, fmt.Errorf("batch[%d]: %w", n, ctx.exceptionError())
+	}
+	return results, nil
+}
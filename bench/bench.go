@@ -0,0 +1,117 @@
+// Package bench holds reproducible benchmarks of the common operations of the quickjs runtime,
+// and compares their results against a baseline, so that performance-sensitive changes can be validated.
+//
+// Run the benchmarks with go test:
+//
+//	go test -bench . github.com/buke/quickjs-go/bench
+//
+// or from a program, e.g. to record a baseline with WriteResults and check a later build against it with Compare:
+//
+//	results := bench.Run(bench.Benchmarks())
+//	for _, r := range bench.Compare(baseline, results, 0.1) {
+//		fmt.Println(r)
+//	}
+package bench
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"testing"
+)
+
+// Benchmark is a named benchmark function.
+type Benchmark struct {
+	Name string
+	F    func(b *testing.B)
+}
+
+// Benchmarks returns the benchmarks of the package: Eval, function calls between Go and JS in both directions,
+// Marshal and Unmarshal of a typical payload, method dispatch on class instances and array buffer copies.
+func Benchmarks() []Benchmark {
+	return []Benchmark{
+		{Name: "Eval", F: benchmarkEval},
+		{Name: "CallJS", F: benchmarkCallJS},
+		{Name: "CallGo", F: benchmarkCallGo},
+		{Name: "Marshal", F: benchmarkMarshal},
+		{Name: "Unmarshal", F: benchmarkUnmarshal},
+		{Name: "MethodDispatch", F: benchmarkMethodDispatch},
+		{Name: "ArrayBufferCopy", F: benchmarkArrayBufferCopy},
+	}
+}
+
+// Result is the result of a benchmark.
+type Result struct {
+	Name        string  `json:"name"`
+	NsPerOp     float64 `json:"ns_per_op"`
+	AllocsPerOp int64   `json:"allocs_per_op"`
+	BytesPerOp  int64   `json:"bytes_per_op"`
+}
+
+// Run runs the benchmarks with testing.Benchmark, for the duration of the -test.benchtime flag, 1s by default.
+func Run(benchmarks []Benchmark) []Result {
+	results := make([]Result, 0, len(benchmarks))
+	for _, bm := range benchmarks {
+		r := testing.Benchmark(bm.F)
+		results = append(results, Result{
+			Name:        bm.Name,
+			NsPerOp:     float64(r.T.Nanoseconds()) / float64(r.N),
+			AllocsPerOp: r.AllocsPerOp(),
+			BytesPerOp:  r.AllocedBytesPerOp(),
+		})
+	}
+	return results
+}
+
+// WriteResults writes the results as JSON, e.g. to record a baseline.
+func WriteResults(w io.Writer, results []Result) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(results)
+}
+
+// ReadResults reads results written by WriteResults.
+func ReadResults(r io.Reader) ([]Result, error) {
+	var results []Result
+	if err := json.NewDecoder(r).Decode(&results); err != nil {
+		return nil, fmt.Errorf("bench: cannot read results: %w", err)
+	}
+	return results, nil
+}
+
+// Regression is a benchmark slower than its baseline.
+type Regression struct {
+	Name     string
+	Baseline float64 // ns/op
+	Current  float64 // ns/op
+}
+
+// Ratio returns the time of the current result relative to the baseline, e.g. 1.25 for 25% slower.
+func (r Regression) Ratio() float64 {
+	return r.Current / r.Baseline
+}
+
+func (r Regression) String() string {
+	return fmt.Sprintf("%s: %.1f ns/op -> %.1f ns/op (%+.1f%%)", r.Name, r.Baseline, r.Current, (r.Ratio()-1)*100)
+}
+
+// Compare returns the results slower than their baseline by more than the threshold, e.g. 0.1 for 10%,
+// in the order of the results; results without a baseline are skipped.
+func Compare(baseline, results []Result, threshold float64) []Regression {
+	base := make(map[string]float64, len(baseline))
+	for _, r := range baseline {
+		base[r.Name] = r.NsPerOp
+	}
+
+	var regressions []Regression
+	for _, r := range results {
+		ns, ok := base[r.Name]
+		if !ok || ns <= 0 {
+			continue
+		}
+		if r.NsPerOp > ns*(1+threshold) {
+			regressions = append(regressions, Regression{Name: r.Name, Baseline: ns, Current: r.NsPerOp})
+		}
+	}
+	return regressions
+}
@@ -0,0 +1,64 @@
+package bench_test
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/buke/quickjs-go/bench"
+	"github.com/stretchr/testify/require"
+)
+
+func BenchmarkQuickJS(b *testing.B) {
+	for _, bm := range bench.Benchmarks() {
+		b.Run(bm.Name, bm.F)
+	}
+}
+
+func TestCompare(t *testing.T) {
+	baseline := []bench.Result{
+		{Name: "Eval", NsPerOp: 1000},
+		{Name: "Marshal", NsPerOp: 2000},
+		{Name: "Unmarshal", NsPerOp: 3000},
+	}
+	results := []bench.Result{
+		{Name: "Eval", NsPerOp: 1250},
+		{Name: "Marshal", NsPerOp: 2100},
+		{Name: "Unmarshal", NsPerOp: 2000},
+		{Name: "CallGo", NsPerOp: 500},
+	}
+
+	regressions := bench.Compare(baseline, results, 0.1)
+	require.Len(t, regressions, 1)
+	require.EqualValues(t, "Eval", regressions[0].Name)
+	require.InDelta(t, 1.25, regressions[0].Ratio(), 1e-9)
+	require.EqualValues(t, "Eval: 1000.0 ns/op -> 1250.0 ns/op (+25.0%)", regressions[0].String())
+
+	require.Len(t, bench.Compare(baseline, results, 0.3), 0)
+
+	var buf bytes.Buffer
+	require.NoError(t, bench.WriteResults(&buf, results))
+	read, err := bench.ReadResults(&buf)
+	require.NoError(t, err)
+	require.EqualValues(t, results, read)
+
+	_, err = bench.ReadResults(bytes.NewBufferString("{"))
+	require.Error(t, err)
+}
+
+func TestBenchmarks(t *testing.T) {
+	for _, bm := range bench.Benchmarks() {
+		bm := bm
+		t.Run(bm.Name, func(t *testing.T) {
+			ran := false
+			testing.Benchmark(func(b *testing.B) {
+				// a single iteration checks that the benchmark runs
+				if b.N > 1 {
+					b.SkipNow()
+				}
+				bm.F(b)
+				ran = !b.Failed()
+			})
+			require.True(t, ran)
+		})
+	}
+}
@@ -0,0 +1,185 @@
+package bench
+
+import (
+	"testing"
+
+	"github.com/buke/quickjs-go"
+)
+
+// payload is a typical payload exchanged between Go and scripts.
+type payload struct {
+	ID       int64             `json:"id"`
+	Name     string            `json:"name"`
+	Active   bool              `json:"active"`
+	Score    float64           `json:"score"`
+	Tags     []string          `json:"tags"`
+	Metadata map[string]string `json:"metadata"`
+	Items    []payloadItem     `json:"items"`
+}
+
+type payloadItem struct {
+	SKU      string  `json:"sku"`
+	Quantity int     `json:"quantity"`
+	Price    float64 `json:"price"`
+}
+
+func newPayload() payload {
+	return payload{
+		ID:       42,
+		Name:     "order",
+		Active:   true,
+		Score:    0.75,
+		Tags:     []string{"new", "priority", "export"},
+		Metadata: map[string]string{"source": "web", "region": "eu"},
+		Items: []payloadItem{
+			{SKU: "A-1", Quantity: 2, Price: 9.99},
+			{SKU: "B-2", Quantity: 1, Price: 24.5},
+			{SKU: "C-3", Quantity: 5, Price: 1.25},
+		},
+	}
+}
+
+// withContext runs the benchmark with a new context, creating it before the timer starts.
+func withContext(b *testing.B, f func(ctx *quickjs.Context)) {
+	rt := quickjs.NewRuntime()
+	defer rt.Close()
+	ctx := rt.NewContext()
+	defer ctx.Close()
+
+	b.ReportAllocs()
+	f(ctx)
+}
+
+// mustEval evaluates the setup code of a benchmark.
+func mustEval(b *testing.B, ctx *quickjs.Context, code string) quickjs.Value {
+	ret, err := ctx.Eval(code)
+	if err != nil {
+		b.Fatal(err)
+	}
+	return ret
+}
+
+func benchmarkEval(b *testing.B) {
+	withContext(b, func(ctx *quickjs.Context) {
+		b.ResetTimer()
+		for i := 0; i < b.N; i++ {
+			ret, err := ctx.Eval(`1 + 2`)
+			if err != nil {
+				b.Fatal(err)
+			}
+			ret.Free()
+		}
+	})
+}
+
+func benchmarkCallJS(b *testing.B) {
+	withContext(b, func(ctx *quickjs.Context) {
+		add := mustEval(b, ctx, `(a, b) => a + b`)
+		defer add.Free()
+
+		b.ResetTimer()
+		for i := 0; i < b.N; i++ {
+			ret := ctx.Invoke(add, ctx.Null(), ctx.Int32(1), ctx.Int32(2))
+			if ret.IsException() {
+				b.Fatal(ctx.Exception())
+			}
+			ret.Free()
+		}
+	})
+}
+
+func benchmarkCallGo(b *testing.B) {
+	withContext(b, func(ctx *quickjs.Context) {
+		ctx.Globals().Set("add", ctx.Function(func(ctx *quickjs.Context, this quickjs.Value, args []quickjs.Value) quickjs.Value {
+			return ctx.Float64(args[0].Float64() + args[1].Float64())
+		}))
+		loop := mustEval(b, ctx, `(n) => { let sum = 0; for (let i = 0; i < n; i++) { sum = add(sum, 1); } return sum; }`)
+		defer loop.Free()
+
+		b.ResetTimer()
+		ret := ctx.Invoke(loop, ctx.Null(), ctx.Int64(int64(b.N)))
+		if ret.IsException() {
+			b.Fatal(ctx.Exception())
+		}
+		ret.Free()
+	})
+}
+
+func benchmarkMarshal(b *testing.B) {
+	withContext(b, func(ctx *quickjs.Context) {
+		p := newPayload()
+
+		b.ResetTimer()
+		for i := 0; i < b.N; i++ {
+			val, err := ctx.Marshal(p)
+			if err != nil {
+				b.Fatal(err)
+			}
+			val.Free()
+		}
+	})
+}
+
+func benchmarkUnmarshal(b *testing.B) {
+	withContext(b, func(ctx *quickjs.Context) {
+		val, err := ctx.Marshal(newPayload())
+		if err != nil {
+			b.Fatal(err)
+		}
+		defer val.Free()
+
+		b.ResetTimer()
+		for i := 0; i < b.N; i++ {
+			var p payload
+			if err := val.Unmarshal(&p); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+}
+
+func benchmarkMethodDispatch(b *testing.B) {
+	withContext(b, func(ctx *quickjs.Context) {
+		ctx.Globals().Set("area", ctx.Function(func(ctx *quickjs.Context, this quickjs.Value, args []quickjs.Value) quickjs.Value {
+			width, height := this.Get("width"), this.Get("height")
+			defer width.Free()
+			defer height.Free()
+			return ctx.Float64(width.Float64() * height.Float64())
+		}))
+		rect := mustEval(b, ctx, `
+			class Rect {
+				constructor(width, height) { this.width = width; this.height = height; }
+			}
+			Rect.prototype.area = area;
+			new Rect(3, 4)`)
+		defer rect.Free()
+
+		b.ResetTimer()
+		for i := 0; i < b.N; i++ {
+			ret := rect.Call("area")
+			if ret.IsException() {
+				b.Fatal(ctx.Exception())
+			}
+			ret.Free()
+		}
+	})
+}
+
+func benchmarkArrayBufferCopy(b *testing.B) {
+	withContext(b, func(ctx *quickjs.Context) {
+		data := make([]byte, 64<<10)
+		for i := range data {
+			data[i] = byte(i)
+		}
+		b.SetBytes(int64(2 * len(data)))
+
+		b.ResetTimer()
+		for i := 0; i < b.N; i++ {
+			buf := ctx.ArrayBuffer(data)
+			if _, err := buf.ToByteArray(uint(len(data))); err != nil {
+				b.Fatal(err)
+			}
+			buf.Free()
+		}
+	})
+}
@@ -0,0 +1,213 @@
+package quickjs
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"regexp"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// classNamePattern matches the names of classes given to BindJSClass: identifiers, or paths of identifiers.
+var classNamePattern = regexp.MustCompile(`^[A-Za-z_$][\w$]*(\.[A-Za-z_$][\w$]*)*$`)
+
+// BindJSClass constructs an instance of a class defined by scripts, e.g. a plugin, with the Go arguments converted by Marshal,
+// and binds the function fields of the struct pointed to by target to its methods, see BindJSObject.
+// The class is named as in the global scope, e.g. "Plugin" for a class declared by a script, or "plugins.Plugin".
+// The returned instance must be freed once target is no longer used.
+func (ctx *Context) BindJSClass(className string, target interface{}, args ...interface{}) (Value, error) {
+	if !classNamePattern.MatchString(className) {
+		return ctx.Undefined(), fmt.Errorf("quickjs: invalid class name %q", className)
+	}
+	ctor, err := ctx.eval(`typeof `+className+` === "undefined" ? undefined : `+className, EvalFileName("<bind>"))
+	defer ctor.Free()
+	if err != nil {
+		return ctx.Undefined(), err
+	}
+	if !ctor.IsConstructor() {
+		return ctx.Undefined(), fmt.Errorf("quickjs: %s is not a class", className)
+	}
+
+	jsArgs, err := ctx.marshalArgs(args)
+	defer freeValues(jsArgs)
+	if err != nil {
+		return ctx.Undefined(), err
+	}
+	obj := ctor.CallConstructor(jsArgs...)
+	if obj.IsException() {
+		return obj, ctx.exceptionError()
+	}
+	if err := ctx.BindJSObject(obj, target); err != nil {
+		obj.Free()
+		return ctx.Undefined(), err
+	}
+	return obj, nil
+}
+
+// BindJSObject sets the function fields of the struct pointed to by target to functions calling the methods of the object,
+// so that Go code can use objects defined by scripts through a typed API:
+//
+//	type Emitter struct {
+//		On   func(event string, listener quickjs.Value) error
+//		Emit func(event string, args ...interface{}) (bool, error)
+//	}
+//
+// A field calls the method named by its json tag, or else by its name with a lowercase first letter, e.g. emit for Emit;
+// fields tagged "-" and fields which are not functions are skipped, and a missing method fails the binding.
+// The arguments are converted by Marshal, and the result of the method, awaited if it is a promise, by Unmarshal into
+// the first result of the function, if any. A last result of type error reports the exceptions; without it they panic.
+// The functions must be called while the object is alive, from the goroutine of the context.
+func (ctx *Context) BindJSObject(obj Value, target interface{}) error {
+	rv := reflect.ValueOf(target)
+	if rv.Kind() != reflect.Pointer || rv.Elem().Kind() != reflect.Struct {
+		return errors.New("quickjs: bind target must be a pointer to a struct")
+	}
+	if !obj.IsObject() {
+		return errors.New("quickjs: bind source must be an object")
+	}
+
+	st := rv.Elem().Type()
+	for i := 0; i < st.NumField(); i++ {
+		f := st.Field(i)
+		if !f.IsExported() || f.Type.Kind() != reflect.Func {
+			continue
+		}
+		name := bindMethodName(f)
+		if name == "" {
+			continue
+		}
+		method := obj.Get(name)
+		isFunction := method.IsFunction()
+		method.Free()
+		if !isFunction {
+			return fmt.Errorf("quickjs: object has no method %s for field %s", name, f.Name)
+		}
+		if err := checkBindSignature(f.Type); err != nil {
+			return fmt.Errorf("quickjs: cannot bind field %s: %w", f.Name, err)
+		}
+		rv.Elem().Field(i).Set(ctx.bindMethod(obj, name, f.Type))
+	}
+	return nil
+}
+
+// bindMethodName returns the name of the method bound to the field, or "" to skip it.
+func bindMethodName(f reflect.StructField) string {
+	tag := f.Tag.Get("json")
+	if tag == "-" {
+		return ""
+	}
+	if name, _, _ := strings.Cut(tag, ","); name != "" {
+		return name
+	}
+	r, size := utf8.DecodeRuneInString(f.Name)
+	return string(unicode.ToLower(r)) + f.Name[size:]
+}
+
+// checkBindSignature checks that the results of the function type are supported by BindJSObject.
+func checkBindSignature(ft reflect.Type) error {
+	switch {
+	case ft.NumOut() > 2:
+		return errors.New("too many results")
+	case ft.NumOut() == 2 && ft.Out(1) != errorType:
+		return errors.New("the second result is not an error")
+	}
+	return nil
+}
+
+// bindMethod returns a function of type ft calling the method of the object.
+func (ctx *Context) bindMethod(obj Value, name string, ft reflect.Type) reflect.Value {
+	hasError := ft.NumOut() > 0 && ft.Out(ft.NumOut()-1) == errorType
+	var resultType reflect.Type
+	if ft.NumOut() == 2 || ft.NumOut() == 1 && !hasError {
+		resultType = ft.Out(0)
+	}
+
+	return reflect.MakeFunc(ft, func(in []reflect.Value) []reflect.Value {
+		args := make([]interface{}, 0, len(in))
+		for i, arg := range in {
+			if ft.IsVariadic() && i == len(in)-1 {
+				for j := 0; j < arg.Len(); j++ {
+					args = append(args, arg.Index(j).Interface())
+				}
+				continue
+			}
+			args = append(args, arg.Interface())
+		}
+
+		var result reflect.Value
+		if resultType != nil {
+			result = reflect.New(resultType)
+		}
+		err := ctx.callMethod(obj, name, result, args)
+		if err != nil && !hasError {
+			panic(err)
+		}
+
+		out := make([]reflect.Value, 0, 2)
+		if resultType != nil {
+			out = append(out, result.Elem())
+		}
+		if hasError {
+			errValue := reflect.Zero(errorType)
+			if err != nil {
+				errValue = reflect.ValueOf(&err).Elem()
+			}
+			out = append(out, errValue)
+		}
+		return out
+	})
+}
+
+// callMethod calls the method of the object with the Go arguments, awaiting its result if it is a promise,
+// and stores the result converted by Unmarshal in result, a pointer, if valid.
+func (ctx *Context) callMethod(obj Value, name string, result reflect.Value, args []interface{}) error {
+	method := obj.Get(name)
+	defer method.Free()
+	if !method.IsFunction() {
+		return fmt.Errorf("quickjs: object has no method %s", name)
+	}
+
+	jsArgs, err := ctx.marshalArgs(args)
+	defer freeValues(jsArgs)
+	if err != nil {
+		return err
+	}
+	ret := ctx.Invoke(method, obj, jsArgs...)
+	if ret.IsException() {
+		return ctx.exceptionError()
+	}
+	if ret.IsPromise() {
+		// Await takes ownership of the promise
+		ret.untrack()
+		if ret, err = ctx.Await(ret); err != nil {
+			return err
+		}
+	}
+	defer ret.Free()
+	if !result.IsValid() {
+		return nil
+	}
+	return ret.Unmarshal(result.Interface())
+}
+
+// marshalArgs converts the Go arguments of a call with Marshal; the values must be freed even on error.
+func (ctx *Context) marshalArgs(args []interface{}) ([]Value, error) {
+	jsArgs := make([]Value, 0, len(args))
+	for _, arg := range args {
+		jsArg, err := ctx.Marshal(arg)
+		if err != nil {
+			return jsArgs, err
+		}
+		jsArgs = append(jsArgs, jsArg)
+	}
+	return jsArgs, nil
+}
+
+// freeValues frees the values.
+func freeValues(values []Value) {
+	for _, v := range values {
+		v.Free()
+	}
+}
@@ -0,0 +1,257 @@
+package quickjs
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// BlobSource is the data of a Blob made by NewBlob or NewFile, read each time a script reads the blob or one of its slices.
+// *bytes.Reader, *strings.Reader and *io.SectionReader implement it, so a []byte is given as bytes.NewReader(data)
+// and an io.ReaderAt of known size as io.NewSectionReader(r, 0, size).
+type BlobSource interface {
+	io.ReaderAt
+	Size() int64
+}
+
+// blobScript returns the function defining the Blob and File globals, unless a script has set them already,
+// given the Go functions converting strings to UTF-8 ArrayBuffers and back; it returns the functions making
+// the blobs of Go sources: blob(read, size, type) and file(read, size, type, name, lastModified),
+// where read(start, end) returns the bytes of the range as an ArrayBuffer.
+const blobScript = `((encode, decode) => {
+	const state = Symbol("state");
+	const readAll = (blob) => {
+		const s = blob[state];
+		return s.size === 0 ? new ArrayBuffer(0) : s.read(s.start, s.start + s.size);
+	};
+	const normalizeType = (type) => {
+		type = type === undefined ? "" : String(type);
+		return /^[\x20-\x7e]*$/.test(type) ? type.toLowerCase() : "";
+	};
+	const relative = (index, size, fallback) => {
+		if (index === undefined) {
+			return fallback;
+		}
+		index = Math.trunc(Number(index)) || 0;
+		return index < 0 ? Math.max(size + index, 0) : Math.min(index, size);
+	};
+	const toBuffer = (part) => {
+		if (part instanceof Blob) {
+			return readAll(part);
+		}
+		if (part instanceof ArrayBuffer) {
+			return part;
+		}
+		if (ArrayBuffer.isView(part)) {
+			return part.buffer.slice(part.byteOffset, part.byteOffset + part.byteLength);
+		}
+		part = String(part);
+		return part === "" ? new ArrayBuffer(0) : encode(part);
+	};
+	const init = (blob, s) => {
+		Object.defineProperty(blob, state, { value: s });
+		return blob;
+	};
+
+	class Blob {
+		constructor(parts = [], options = {}) {
+			if (typeof parts !== "object" || parts === null || typeof parts[Symbol.iterator] !== "function") {
+				throw new TypeError("Blob parts must be a sequence");
+			}
+			const buffers = Array.from(parts, toBuffer);
+			const bytes = new Uint8Array(buffers.reduce((size, b) => size + b.byteLength, 0));
+			let offset = 0;
+			for (const b of buffers) {
+				bytes.set(new Uint8Array(b), offset);
+				offset += b.byteLength;
+			}
+			const buffer = bytes.buffer;
+			init(this, { read: (start, end) => buffer.slice(start, end), start: 0, size: buffer.byteLength, type: normalizeType(options.type) });
+		}
+		get size() {
+			return this[state].size;
+		}
+		get type() {
+			return this[state].type;
+		}
+		arrayBuffer() {
+			return new Promise((resolve) => resolve(readAll(this)));
+		}
+		bytes() {
+			return this.arrayBuffer().then((buffer) => new Uint8Array(buffer));
+		}
+		text() {
+			return this.arrayBuffer().then((buffer) => buffer.byteLength === 0 ? "" : decode(buffer));
+		}
+		slice(start, end, contentType) {
+			const s = this[state];
+			const from = relative(start, s.size, 0);
+			const to = relative(end, s.size, s.size);
+			const size = Math.max(to - from, 0);
+			return init(Object.create(Blob.prototype), { read: s.read, start: s.start + from, size, type: normalizeType(contentType) });
+		}
+		get [Symbol.toStringTag]() {
+			return "Blob";
+		}
+	}
+
+	class File extends Blob {
+		constructor(parts, name, options = {}) {
+			if (arguments.length < 2) {
+				throw new TypeError("File requires a name");
+			}
+			super(parts, options);
+			const s = this[state];
+			s.name = String(name);
+			s.lastModified = options.lastModified === undefined ? Date.now() : Number(options.lastModified);
+		}
+		get name() {
+			return this[state].name;
+		}
+		get lastModified() {
+			return this[state].lastModified;
+		}
+		get [Symbol.toStringTag]() {
+			return "File";
+		}
+	}
+
+	for (const ctor of [Blob, File]) {
+		const desc = Object.getOwnPropertyDescriptor(globalThis, ctor.name);
+		if (desc === undefined || !("value" in desc)) {
+			Object.defineProperty(globalThis, ctor.name, { value: ctor, writable: true, configurable: true });
+		}
+	}
+
+	return {
+		blob(read, size, type) {
+			return init(Object.create(Blob.prototype), { read, start: 0, size, type: normalizeType(type) });
+		},
+		file(read, size, type, name, lastModified) {
+			return init(Object.create(File.prototype), { read, start: 0, size, type: normalizeType(type), name, lastModified });
+		},
+	};
+})`
+
+// installBlobs evaluates blobScript, once.
+func (ctx *Context) installBlobs() error {
+	if ctx.blobs != nil {
+		return nil
+	}
+	define, err := ctx.eval(blobScript, EvalFileName("<blob>"))
+	if err != nil {
+		return err
+	}
+	defer define.Free()
+
+	encode := ctx.NamedFunction("encode", 1, func(ctx *Context, this Value, args []Value) Value {
+		return ctx.ArrayBuffer([]byte(args[0].String()))
+	})
+	decode := ctx.NamedFunction("decode", 1, func(ctx *Context, this Value, args []Value) Value {
+		data, err := args[0].ToByteArray(uint(args[0].ByteLen()))
+		if err != nil {
+			return ctx.ThrowError(err)
+		}
+		return ctx.String(strings.ToValidUTF8(string(data), "�"))
+	})
+	defer encode.Free()
+	defer decode.Free()
+
+	blobs := ctx.Invoke(define, ctx.Null(), encode, decode)
+	if blobs.IsException() {
+		return ctx.exceptionError()
+	}
+	blobs.keep()
+	ctx.blobs = &blobs
+	return nil
+}
+
+// NewBlob returns a Blob of the content type, e.g. "text/plain", reading its data from the source,
+// so that scripts expecting browser-like blobs work against the data of the host. The Blob and File globals
+// also let scripts make blobs of their own data, e.g. new Blob(["text"]), or slices of Go blobs, which share their source.
+//
+// The scripts read blobs with arrayBuffer(), bytes() and text(), which read the range of the blob from the source
+// on the goroutine of the context before returning a promise; a read error, or a short read, rejects it.
+func (ctx *Context) NewBlob(src BlobSource, contentType string) (Value, error) {
+	read := ctx.blobReader(src)
+	size := ctx.Int64(src.Size())
+	typ := ctx.String(contentType)
+	return ctx.newBlob("blob", read, size, typ)
+}
+
+// NewFile returns a File, i.e. a Blob with a name and a modification time, reading its data from the source, see NewBlob.
+func (ctx *Context) NewFile(src BlobSource, name, contentType string, lastModified time.Time) (Value, error) {
+	read := ctx.blobReader(src)
+	size := ctx.Int64(src.Size())
+	typ := ctx.String(contentType)
+	fileName := ctx.String(name)
+	modified := ctx.Int64(lastModified.UnixMilli())
+	return ctx.newBlob("file", read, size, typ, fileName, modified)
+}
+
+// NewFileFromPath returns a File of the file at the path, named by its base name and reading its data from it, see NewBlob.
+// The file is opened for each read, so it is not kept open; it should not change while scripts use the File.
+func (ctx *Context) NewFileFromPath(path, contentType string) (Value, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return ctx.Undefined(), err
+	}
+	if !info.Mode().IsRegular() {
+		return ctx.Undefined(), fmt.Errorf("quickjs: %s is not a regular file", path)
+	}
+	return ctx.NewFile(&pathSource{path: path, size: info.Size()}, filepath.Base(path), contentType, info.ModTime())
+}
+
+// newBlob calls the maker of blobScript with the arguments, which it frees.
+func (ctx *Context) newBlob(maker string, args ...Value) (Value, error) {
+	defer freeValues(args)
+	if err := ctx.installBlobs(); err != nil {
+		return ctx.Undefined(), err
+	}
+	blob := ctx.blobs.Call(maker, args...)
+	if blob.IsException() {
+		return blob, ctx.exceptionError()
+	}
+	return blob, nil
+}
+
+// blobReader returns the read function of blobScript reading the source.
+func (ctx *Context) blobReader(src BlobSource) Value {
+	return ctx.NamedFunction("read", 2, func(ctx *Context, this Value, args []Value) Value {
+		start, end := args[0].Int64(), args[1].Int64()
+		buf := make([]byte, end-start)
+		n, err := src.ReadAt(buf, start)
+		if n == len(buf) {
+			err = nil
+		} else if err == nil || errors.Is(err, io.EOF) {
+			err = io.ErrUnexpectedEOF
+		}
+		if err != nil {
+			return ctx.ThrowError(err)
+		}
+		return ctx.ArrayBuffer(buf)
+	})
+}
+
+// pathSource is the BlobSource of NewFileFromPath.
+type pathSource struct {
+	path string
+	size int64
+}
+
+func (s *pathSource) Size() int64 {
+	return s.size
+}
+
+func (s *pathSource) ReadAt(p []byte, off int64) (int, error) {
+	f, err := os.Open(s.path)
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+	return f.ReadAt(p, off)
+}
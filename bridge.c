@@ -13,10 +13,32 @@ JSValue ThrowReferenceError(JSContext *ctx, const char *fmt) { return JS_ThrowRe
 JSValue ThrowRangeError(JSContext *ctx, const char *fmt) { return JS_ThrowRangeError(ctx, "%s", fmt); }
 JSValue ThrowInternalError(JSContext *ctx, const char *fmt) { return JS_ThrowInternalError(ctx, "%s", fmt); }
 
+// ThrowInterrupted throws the uncatchable error of an interrupted execution, like the engine when the interrupt handler returns non-zero.
+JSValue ThrowInterrupted(JSContext *ctx) {
+	JS_ThrowInternalError(ctx, "interrupted");
+	JSValue exception = JS_GetException(ctx);
+	JS_SetUncatchableError(ctx, exception, 1);
+	return JS_Throw(ctx, exception);
+}
+
 int ValueGetTag(JSValueConst v) {
 	return JS_VALUE_GET_TAG(v);
 }
 
+void *ValueGetPtr(JSValueConst v) {
+	if (!JS_VALUE_HAS_REF_COUNT(v)) {
+		return NULL;
+	}
+	return JS_VALUE_GET_PTR(v);
+}
+
+int ValueRefCount(JSValueConst v) {
+	if (!JS_VALUE_HAS_REF_COUNT(v)) {
+		return -1;
+	}
+	return ((JSRefCountHeader *)JS_VALUE_GET_PTR(v))->ref_count;
+}
+
 JSValue InvokeProxy(JSContext *ctx, JSValueConst this_val, int argc, JSValueConst *argv) {
 	 return goProxy(ctx, this_val, argc, argv);
 }
@@ -25,39 +47,275 @@ JSValue InvokeAsyncProxy(JSContext *ctx, JSValueConst this_val, int argc, JSValu
 	return goAsyncProxy(ctx, this_val, argc, argv);
 }
 
-int interruptHandler(JSRuntime *rt, void *handlerArgs) {
-	return goInterruptHandler(rt, handlerArgs);
+int interruptHandler(JSRuntime *rt, void *opaque) {
+	return goInterruptHandler(rt, (uintptr_t)opaque);
+}
+
+void SetInterruptHandler(JSRuntime *rt, uintptr_t handle){
+	JS_SetInterruptHandler(rt, &interruptHandler, (void *)handle);
+}
+
+void SetContextHandle(JSContext *ctx, uintptr_t handle) {
+	JS_SetContextOpaque(ctx, (void *)handle);
+}
+
+uintptr_t GetContextHandle(JSContext *ctx) {
+	return (uintptr_t)JS_GetContextOpaque(ctx);
+}
+
+static void promiseRejectionTracker(JSContext *ctx, JSValueConst promise, JSValueConst reason, JS_BOOL is_handled, void *opaque) {
+	goPromiseRejectionTracker(ctx, promise, reason, is_handled);
+}
+
+void SetPromiseRejectionTracker(JSRuntime *rt, int enable) {
+	JS_SetHostPromiseRejectionTracker(rt, enable ? promiseRejectionTracker : NULL, NULL);
+}
+
+int EvalBatch(JSContext *ctx, char **codes, size_t *lens, int n, const char *filename, int flags, JSValue *results) {
+	for (int i = 0; i < n; i++) {
+		int codeFlags = flags;
+		if (JS_DetectModule(codes[i], lens[i])) {
+			codeFlags |= JS_EVAL_TYPE_MODULE;
+		}
+		results[i] = JS_Eval(ctx, codes[i], lens[i], filename, codeFlags);
+		if (JS_IsException(results[i])) {
+			return i;
+		}
+	}
+	return n;
+}
+
+static JSValue fastFunctionTrampoline(JSContext *ctx, JSValueConst this_val, int argc, JSValueConst *argv, int magic, JSValue *func_data) {
+	return goFastFunction(ctx, JS_VALUE_GET_INT(func_data[0]), argc, argv);
+}
+
+JSValue NewFastFunction(JSContext *ctx, int32_t id, int length) {
+	JSValue data = JS_NewInt32(ctx, id);
+	return JS_NewCFunctionData(ctx, fastFunctionTrampoline, length, 0, 1, &data);
+}
+
+static JSValue reportUncaughtException(JSContext *ctx, JSValueConst this_val, int argc, JSValueConst *argv) {
+	return JS_NewBool(ctx, goUncaughtException(ctx, argc > 0 ? argv[0] : JS_UNDEFINED));
+}
+
+JSValue NewUncaughtExceptionReporter(JSContext *ctx) {
+	return JS_NewCFunction(ctx, reportUncaughtException, "reportError", 1);
+}
+
+static JSValue installLazyGlobal(JSContext *ctx, JSValueConst this_val, int argc, JSValueConst *argv) {
+	return goInstallLazyGlobal(ctx, argc > 0 ? argv[0] : JS_UNDEFINED);
+}
+
+JSValue NewLazyGlobalInstaller(JSContext *ctx) {
+	return JS_NewCFunction(ctx, installLazyGlobal, "install", 1);
+}
+
+static JSValue runMicrotask(JSContext *ctx, int argc, JSValueConst *argv) {
+	return JS_Call(ctx, argv[0], JS_UNDEFINED, 0, NULL);
+}
+
+static JSValue enqueueMicrotask(JSContext *ctx, JSValueConst this_val, int argc, JSValueConst *argv) {
+	if (argc < 1 || !JS_IsFunction(ctx, argv[0])) {
+		return JS_ThrowTypeError(ctx, "not a function");
+	}
+	if (JS_EnqueueJob(ctx, runMicrotask, 1, argv) < 0) {
+		return JS_EXCEPTION;
+	}
+	return JS_UNDEFINED;
+}
+
+JSValue NewMicrotaskEnqueuer(JSContext *ctx) {
+	return JS_NewCFunction(ctx, enqueueMicrotask, "enqueue", 1);
+}
+
+// InitStdHandlers initializes the timers and handlers of quickjs-libc once per runtime.
+void InitStdHandlers(JSRuntime *rt) {
+	if (JS_GetRuntimeOpaque(rt) == NULL) {
+		js_std_init_handlers(rt);
+	}
+}
+
+// FreeStdHandlers frees the pending timers and handlers, which would otherwise keep objects alive when the runtime is freed.
+void FreeStdHandlers(JSRuntime *rt) {
+	if (JS_GetRuntimeOpaque(rt) != NULL) {
+		js_std_free_handlers(rt);
+	}
+}
+
+JSValue GetModuleNamespace(JSContext *ctx, JSValueConst module) {
+	return JS_GetModuleNamespace(ctx, JS_VALUE_GET_PTR(module));
+}
+
+JSAtom GetModuleName(JSContext *ctx, JSValueConst module) {
+	return JS_GetModuleName(ctx, JS_VALUE_GET_PTR(module));
+}
+
+// normalizeModuleName resolves the name of a module like the default normalizer of the engine, relative to the base module.
+// It refuses the std and os modules to the contexts whose code generation from strings is disabled, see SetEvalEnabled,
+// as their std.evalScript, std.loadScript and os.Worker evaluate code.
+static char *normalizeModuleName(JSContext *ctx, const char *base_name, const char *name, void *opaque) {
+	if ((strcmp(name, "std") == 0 || strcmp(name, "os") == 0) && goModuleBlocked(ctx)) {
+		JS_ThrowTypeError(ctx, "module '%s' disallowed for this context", name);
+		return NULL;
+	}
+	if (name[0] != '.') {
+		return js_strdup(ctx, name);
+	}
+
+	const char *p = strrchr(base_name, '/');
+	size_t len = p ? p - base_name : 0;
+	size_t cap = len + strlen(name) + 2;
+	char *filename = js_malloc(ctx, cap);
+	if (!filename) {
+		return NULL;
+	}
+	memcpy(filename, base_name, len);
+	filename[len] = '\0';
+
+	// only the leading '.' and '..' are resolved
+	const char *r = name;
+	for (;;) {
+		if (r[0] == '.' && r[1] == '/') {
+			r += 2;
+		} else if (r[0] == '.' && r[1] == '.' && r[2] == '/') {
+			// remove the last path element of filename, unless it is '.' or '..'
+			if (filename[0] == '\0') {
+				break;
+			}
+			char *last = strrchr(filename, '/');
+			last = last ? last + 1 : filename;
+			if (strcmp(last, ".") == 0 || strcmp(last, "..") == 0) {
+				break;
+			}
+			if (last > filename) {
+				last--;
+			}
+			*last = '\0';
+			r += 3;
+		} else {
+			break;
+		}
+	}
+	if (filename[0] != '\0') {
+		strcat(filename, "/");
+	}
+	strcat(filename, r);
+	return filename;
+}
+
+// SetModuleLoader sets the module normalizer of the runtime, and the loader of module files if moduleImport is set.
+void SetModuleLoader(JSRuntime *rt, int moduleImport) {
+	JS_SetModuleLoaderFunc(rt, normalizeModuleName, moduleImport ? js_module_loader : NULL, NULL);
+}
+
+static JSClassID weakRefSentinelClassID;
+
+static void weakRefSentinelFinalizer(JSRuntime *rt, JSValue val) {
+	goWeakRefFinalizer((uintptr_t)JS_GetOpaque(val, weakRefSentinelClassID));
+}
+
+static JSClassID hostDataSentinelClassID;
+
+static void hostDataSentinelFinalizer(JSRuntime *rt, JSValue val) {
+	goHostDataFinalizer((uintptr_t)JS_GetOpaque(val, hostDataSentinelClassID));
+}
+
+static JSClassID functionHandleClassID;
+
+static void functionHandleFinalizer(JSRuntime *rt, JSValue val) {
+	goFunctionHandleFinalizer((uintptr_t)JS_GetOpaque(val, functionHandleClassID));
+}
+
+static JSClassID proxyClassID;
+
+void InitClassIDs() {
+	JS_NewClassID(&weakRefSentinelClassID);
+	JS_NewClassID(&hostDataSentinelClassID);
+	JS_NewClassID(&functionHandleClassID);
+
+	// the class ID of proxies is internal to the engine: it is read from a proxy of a runtime of its own, which no script can tamper with
+	JSRuntime *rt = JS_NewRuntime();
+	JSContext *ctx = JS_NewContext(rt);
+	const char *code = "new Proxy({}, {})";
+	JSValue proxy = JS_Eval(ctx, code, strlen(code), "<proxy>", JS_EVAL_TYPE_GLOBAL);
+	proxyClassID = JS_GetClassID(proxy);
+	JS_FreeValue(ctx, proxy);
+	JS_FreeContext(ctx);
+	JS_FreeRuntime(rt);
+}
+
+// IsProxy returns whether the value is a Proxy, whose internal methods run the traps of scripts.
+int IsProxy(JSValueConst v) {
+	return JS_VALUE_GET_TAG(v) == JS_TAG_OBJECT && JS_GetClassID(v) == proxyClassID;
 }
 
-void SetInterruptHandler(JSRuntime *rt, void *handlerArgs){
-	JS_SetInterruptHandler(rt, &interruptHandler, handlerArgs);
+static JSClassDef weakRefSentinelClass = {
+	"WeakRefSentinel",
+	.finalizer = weakRefSentinelFinalizer,
+};
+
+JSValue NewWeakRefSentinel(JSContext *ctx, uintptr_t handle) {
+	JSRuntime *rt = JS_GetRuntime(ctx);
+	if (!JS_IsRegisteredClass(rt, weakRefSentinelClassID)) {
+		JS_NewClass(rt, weakRefSentinelClassID, &weakRefSentinelClass);
+	}
+	JSValue obj = JS_NewObjectClass(ctx, weakRefSentinelClassID);
+	if (JS_IsException(obj)) {
+		return obj;
+	}
+	JS_SetOpaque(obj, (void *)handle);
+	return obj;
 }
 
-typedef struct {
-    time_t start;
-    time_t timeout;
-} TimeoutStruct;
+static JSClassDef hostDataSentinelClass = {
+	"HostDataSentinel",
+	.finalizer = hostDataSentinelFinalizer,
+};
 
-int timeoutHandler(JSRuntime *rt, void *opaque) {
-    TimeoutStruct* ts = (TimeoutStruct*)opaque;
-    time_t timeout = ts->timeout;
-    time_t start = ts->start;
-	if (timeout <= 0) {
-		return 0;
+JSValue NewHostDataSentinel(JSContext *ctx, uintptr_t handle) {
+	JSRuntime *rt = JS_GetRuntime(ctx);
+	if (!JS_IsRegisteredClass(rt, hostDataSentinelClassID)) {
+		JS_NewClass(rt, hostDataSentinelClassID, &hostDataSentinelClass);
 	}
+	JSValue obj = JS_NewObjectClass(ctx, hostDataSentinelClassID);
+	if (JS_IsException(obj)) {
+		return obj;
+	}
+	JS_SetOpaque(obj, (void *)handle);
+	return obj;
+}
+
+static JSClassDef functionHandleClass = {
+	"FunctionHandle",
+	.finalizer = functionHandleFinalizer,
+};
 
-	time_t now = time(NULL);
-	if (now - start > timeout) {
-		free(ts);
-		return 1;
+// NewFunctionHandle returns the object holding the handle of the Go function of a host function, captured by its JS wrapper,
+// whose finalizer runs when the wrapper is collected.
+JSValue NewFunctionHandle(JSContext *ctx, uintptr_t handle) {
+	JSRuntime *rt = JS_GetRuntime(ctx);
+	if (!JS_IsRegisteredClass(rt, functionHandleClassID)) {
+		JS_NewClass(rt, functionHandleClassID, &functionHandleClass);
 	}
+	JSValue obj = JS_NewObjectClass(ctx, functionHandleClassID);
+	if (JS_IsException(obj)) {
+		return obj;
+	}
+	JS_SetOpaque(obj, (void *)handle);
+	return obj;
+}
 
-	return 0;
+// GetFunctionHandle returns the handle held by an object of NewFunctionHandle, or 0.
+uintptr_t GetFunctionHandle(JSValueConst obj) {
+	return (uintptr_t)JS_GetOpaque(obj, functionHandleClassID);
 }
 
-void SetExecuteTimeout(JSRuntime *rt, time_t timeout){
-    TimeoutStruct* ts = malloc(sizeof(TimeoutStruct));
-    ts->start = time(NULL);
-    ts->timeout = timeout;
-    JS_SetInterruptHandler(rt, &timeoutHandler, ts);
-}
\ No newline at end of file
+// GetHostDataHandle returns the handle held by a host data sentinel, or 0.
+uintptr_t GetHostDataHandle(JSValueConst obj) {
+	return (uintptr_t)JS_GetOpaque(obj, hostDataSentinelClassID);
+}
+
+// GetWeakRefHandle returns the handle held by a weak reference sentinel, or 0.
+uintptr_t GetWeakRefHandle(JSValueConst obj) {
+	return (uintptr_t)JS_GetOpaque(obj, weakRefSentinelClassID);
+}
@@ -12,64 +12,223 @@ import (
 import "C"
 
 //export goProxy
-func goProxy(ctx *C.JSContext, thisVal C.JSValueConst, argc C.int, argv *C.JSValueConst) C.JSValue {
+func goProxy(ctx *C.JSContext, thisVal C.JSValueConst, argc C.int, argv *C.JSValueConst) (ret C.JSValue) {
 	refs := unsafe.Slice(argv, argc) // Go 1.17 and later
 
 	// get the function
-	fnHandler := C.int64_t(0)
-	C.JS_ToInt64(ctx, &fnHandler, refs[0])
-	fn := cgo.Handle(fnHandler).Value().(func(ctx *Context, this Value, args []Value) Value)
+	host := cgo.Handle(C.GetFunctionHandle(refs[0])).Value().(*storedHandle).value.(*hostFunction)
 
 	// get ctx
 	ctxHandler := C.int64_t(0)
 	C.JS_ToInt64(ctx, &ctxHandler, refs[1])
 	ctxOrigin := cgo.Handle(ctxHandler).Value().(*Context)
+	defer ctxOrigin.recoverPanic(&ret)
 
-	// refs[0] is the id, refs[1] is the ctx
+	// refs[0] is the function handle, refs[1] is the ctx
 	args := make([]Value, len(refs)-2)
 	for i := 0; i < len(args); i++ {
-		args[i].ctx = ctxOrigin
-		args[i].ref = refs[2+i]
+		args[i] = ctxOrigin.borrow(refs[2+i])
 	}
 
-	result := fn(ctxOrigin, Value{ctx: ctxOrigin, ref: thisVal}, args)
+	if exception, ok := ctxOrigin.countHostCall(); ok {
+		return exception
+	}
+	if exception, ok := ctxOrigin.enterBridge(); ok {
+		return exception
+	}
+	defer ctxOrigin.exitBridge()
+	start := ctxOrigin.callStart()
+	result := host.fn(ctxOrigin, ctxOrigin.borrow(thisVal), args)
+	ctxOrigin.observeCall(host.name, len(args), start, result)
+	result.untrack()
 
 	return result.ref
 }
 
 //export goAsyncProxy
-func goAsyncProxy(ctx *C.JSContext, thisVal C.JSValueConst, argc C.int, argv *C.JSValueConst) C.JSValue {
+func goAsyncProxy(ctx *C.JSContext, thisVal C.JSValueConst, argc C.int, argv *C.JSValueConst) (ret C.JSValue) {
 	refs := unsafe.Slice(argv, argc) // Go 1.17 and later
 
 	// get the function
-	fnHandler := C.int64_t(0)
-	C.JS_ToInt64(ctx, &fnHandler, refs[0])
-	asyncFn := cgo.Handle(fnHandler).Value().(func(ctx *Context, this Value, promise Value, args []Value) Value)
+	host := cgo.Handle(C.GetFunctionHandle(refs[0])).Value().(*storedHandle).value.(*hostAsyncFunction)
 
 	// get ctx
 	ctxHandler := C.int64_t(0)
 	C.JS_ToInt64(ctx, &ctxHandler, refs[1])
 	ctxOrigin := cgo.Handle(ctxHandler).Value().(*Context)
+	defer ctxOrigin.recoverPanic(&ret)
 
 	args := make([]Value, len(refs)-2)
 	for i := 0; i < len(args); i++ {
-		args[i].ctx = ctxOrigin
-		args[i].ref = refs[2+i]
+		args[i] = ctxOrigin.borrow(refs[2+i])
 	}
 	promise := args[0]
 
-	result := asyncFn(ctxOrigin, Value{ctx: ctxOrigin, ref: thisVal}, promise, args[1:])
+	if exception, ok := ctxOrigin.countHostCall(); ok {
+		return exception
+	}
+	if exception, ok := ctxOrigin.enterBridge(); ok {
+		return exception
+	}
+	defer ctxOrigin.exitBridge()
+	start := ctxOrigin.callStart()
+	result := host.fn(ctxOrigin, ctxOrigin.borrow(thisVal), promise, args[1:])
+	ctxOrigin.observeCall(host.name, len(args)-1, start, result)
+	result.untrack()
 	return result.ref
 
 }
 
 //export goInterruptHandler
-func goInterruptHandler(rt *C.JSRuntime, handlerArgs unsafe.Pointer) C.int {
-	handlerArgsStruct := (*C.handlerArgs)(handlerArgs)
+func goInterruptHandler(rt *C.JSRuntime, handle C.uintptr_t) (ret C.int) {
+	state := cgo.Handle(handle).Value().(*interruptState)
+	current := state.current
+	// a panicking handler interrupts the execution
+	defer func() {
+		if r := recover(); r != nil {
+			if current != nil && current.runtime.options.repanic {
+				panic(r)
+			}
+			ret = 1
+		}
+	}()
+	return C.int(state.interrupt())
+}
+
+//export goWeakRefFinalizer
+func goWeakRefFinalizer(handle C.uintptr_t) {
+	if handle == 0 {
+		return
+	}
+	h := cgo.Handle(handle)
+	h.Value().(*weakTarget).alive = false
+	h.Delete()
+}
+
+//export goFunctionHandleFinalizer
+func goFunctionHandleFinalizer(handle C.uintptr_t) {
+	if handle == 0 {
+		return
+	}
+	cgo.Handle(handle).Value().(*storedHandle).orphan()
+}
+
+//export goHostDataFinalizer
+func goHostDataFinalizer(handle C.uintptr_t) {
+	if handle == 0 {
+		return
+	}
+	h := cgo.Handle(handle)
+	h.Value().(*hostData).finalize()
+	h.Delete()
+}
+
+// contextFromRef returns the Context registered as opaque of the JSContext, or nil.
+func contextFromRef(ref *C.JSContext) *Context {
+	handle := C.GetContextHandle(ref)
+	if handle == 0 {
+		return nil
+	}
+	return cgo.Handle(handle).Value().(*Context)
+}
+
+//export goModuleBlocked
+func goModuleBlocked(ctx *C.JSContext) C.int {
+	ctxOrigin := contextFromRef(ctx)
+	if ctxOrigin == nil || ctxOrigin.EvalEnabled() {
+		return C.int(0)
+	}
+	return C.int(1)
+}
 
-	hFn := cgo.Handle(handlerArgsStruct.fn)
-	hFnValue := hFn.Value().(InterruptHandler)
-	// defer hFn.Delete()
+//export goPromiseRejectionTracker
+func goPromiseRejectionTracker(ctx *C.JSContext, promise C.JSValueConst, reason C.JSValueConst, isHandled C.int) {
+	ctxOrigin := contextFromRef(ctx)
+	if ctxOrigin == nil {
+		return
+	}
+	if ctxOrigin.runtime.options.promiseRejectionHandler == nil {
+		if logger := ctxOrigin.runtime.options.logger; logger != nil && isHandled == 0 {
+			logger.Log(LogLevelWarn, "quickjs: unhandled promise rejection", errorFields(ctxOrigin.borrow(reason).toError()))
+		}
+		return
+	}
+	// there is no script to throw to, so a panicking handler is ignored
+	defer ctxOrigin.recoverPanic(nil)
+	ctxOrigin.runtime.options.promiseRejectionHandler(ctxOrigin, ctxOrigin.borrow(promise), ctxOrigin.borrow(reason), isHandled != 0)
+}
+
+//export goUncaughtException
+func goUncaughtException(ctx *C.JSContext, exception C.JSValueConst) (handled C.int) {
+	ctxOrigin := contextFromRef(ctx)
+	if ctxOrigin == nil {
+		return C.int(0)
+	}
+	if ctxOrigin.uncaughtExceptionHandler == nil {
+		if logger := ctxOrigin.runtime.options.logger; logger != nil {
+			logger.Log(LogLevelError, "quickjs: uncaught exception", errorFields(ctxOrigin.borrow(exception).toError()))
+			return C.int(1)
+		}
+		return C.int(0)
+	}
+	// a panicking handler leaves the exception unhandled, so it is rethrown
+	defer ctxOrigin.recoverPanic(nil)
+	ctxOrigin.uncaughtExceptionHandler(ctxOrigin.borrow(exception).toError())
+	return C.int(1)
+}
+
+//export goInstallLazyGlobal
+func goInstallLazyGlobal(ctx *C.JSContext, name C.JSValueConst) (ret C.JSValue) {
+	ctxOrigin := contextFromRef(ctx)
+	if ctxOrigin == nil {
+		msg := C.CString("context closed")
+		defer C.free(unsafe.Pointer(msg))
+		return C.ThrowInternalError(ctx, msg)
+	}
+	defer ctxOrigin.recoverPanic(&ret)
+	if err := ctxOrigin.installLazyGlobal(ctxOrigin.borrow(name).String()); err != nil {
+		exception := ctxOrigin.ThrowError(err)
+		exception.untrack()
+		return exception.ref
+	}
+	return C.JS_NewUndefined()
+}
+
+//export goFastFunction
+func goFastFunction(ctx *C.JSContext, id C.int32_t, argc C.int, argv *C.JSValueConst) (ret C.JSValue) {
+	ctxOrigin := contextFromRef(ctx)
+	if ctxOrigin == nil {
+		return C.JS_NewUndefined()
+	}
+	defer ctxOrigin.recoverPanic(&ret)
+	entry := lookupFastFunction(FastFunctionID(id))
+	if exception, ok := ctxOrigin.countHostCall(); ok {
+		return exception
+	}
+	if exception, ok := ctxOrigin.enterBridge(); ok {
+		return exception
+	}
+	defer ctxOrigin.exitBridge()
+	start := ctxOrigin.callStart()
+	result := entry.fn(ctxOrigin, FastArgs{ctx: ctxOrigin, refs: unsafe.Slice(argv, argc)})
+	ctxOrigin.observeCall(entry.name, int(argc), start, result)
+	result.untrack()
+	return result.ref
+}
 
-	return C.int(hFnValue())
+// recoverPanic recovers a panic of a Go callback, which would otherwise crash the process while unwinding through C.
+// Unless the runtime re-panics, it stores an InternalError thrown in its place in result, if not nil.
+func (ctx *Context) recoverPanic(result *C.JSValue) {
+	r := recover()
+	if r == nil {
+		return
+	}
+	if ctx.runtime.options.repanic {
+		panic(r)
+	}
+	if result != nil {
+		exception := ctx.ThrowInternalError("panic in Go callback: %v", r)
+		exception.untrack()
+		*result = exception.ref
+	}
 }
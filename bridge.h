@@ -13,17 +13,40 @@ extern JSValue ThrowTypeError(JSContext *ctx, const char *fmt) ;
 extern JSValue ThrowReferenceError(JSContext *ctx, const char *fmt) ;
 extern JSValue ThrowRangeError(JSContext *ctx, const char *fmt) ;
 extern JSValue ThrowInternalError(JSContext *ctx, const char *fmt) ;
+extern JSValue ThrowInterrupted(JSContext *ctx);
 int JS_DeletePropertyInt64(JSContext *ctx, JSValueConst obj, int64_t idx, int flags);
 
 extern JSValue InvokeProxy(JSContext *ctx, JSValueConst this_val, int argc, JSValueConst *argv);
 extern JSValue InvokeAsyncProxy(JSContext *ctx, JSValueConst this_val, int argc, JSValueConst *argv);
 
 extern int ValueGetTag(JSValueConst v);
+extern void *ValueGetPtr(JSValueConst v);
+extern int ValueRefCount(JSValueConst v);
 
-typedef struct {
-    uintptr_t fn;
-} handlerArgs;
+extern void SetInterruptHandler(JSRuntime *rt, uintptr_t handle);
 
-extern void SetInterruptHandler(JSRuntime *rt, void *handlerArgs);
+extern void SetContextHandle(JSContext *ctx, uintptr_t handle);
+extern uintptr_t GetContextHandle(JSContext *ctx);
 
-extern void SetExecuteTimeout(JSRuntime *rt, time_t timeout);
\ No newline at end of file
+extern void SetPromiseRejectionTracker(JSRuntime *rt, int enable);
+extern JSValue NewUncaughtExceptionReporter(JSContext *ctx);
+extern JSValue NewMicrotaskEnqueuer(JSContext *ctx);
+extern JSValue NewLazyGlobalInstaller(JSContext *ctx);
+extern JSValue NewFastFunction(JSContext *ctx, int32_t id, int length);
+extern int EvalBatch(JSContext *ctx, char **codes, size_t *lens, int n, const char *filename, int flags, JSValue *results);
+
+extern void InitStdHandlers(JSRuntime *rt);
+extern void FreeStdHandlers(JSRuntime *rt);
+
+extern JSValue GetModuleNamespace(JSContext *ctx, JSValueConst module);
+extern JSAtom GetModuleName(JSContext *ctx, JSValueConst module);
+
+extern void InitClassIDs();
+extern int IsProxy(JSValueConst v);
+extern JSValue NewWeakRefSentinel(JSContext *ctx, uintptr_t handle);
+extern JSValue NewHostDataSentinel(JSContext *ctx, uintptr_t handle);
+extern uintptr_t GetHostDataHandle(JSValueConst obj);
+extern uintptr_t GetWeakRefHandle(JSValueConst obj);
+extern void SetModuleLoader(JSRuntime *rt, int moduleImport);
+extern JSValue NewFunctionHandle(JSContext *ctx, uintptr_t handle);
+extern uintptr_t GetFunctionHandle(JSValueConst obj);
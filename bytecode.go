@@ -0,0 +1,88 @@
+package quickjs
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"unsafe"
+)
+
+//go:generate sh -c "printf '// Code generated from deps/quickjs/VERSION by go generate; DO NOT EDIT.\n\npackage quickjs\n\n// QuickJSVersion is the version of the QuickJS engine bundled with this package, the one of deps/quickjs/VERSION.\nconst QuickJSVersion = \"%s\"\n' $(cat deps/quickjs/VERSION) > version.go"
+
+var (
+	// ErrBytecodeInvalid is returned when the bytecode has no valid header, e.g. it was not produced by Compile.
+	ErrBytecodeInvalid = errors.New("invalid bytecode header")
+	// ErrBytecodeVersionMismatch is returned when the bytecode was produced by another engine version or platform.
+	ErrBytecodeVersionMismatch = errors.New("bytecode version mismatch")
+	// ErrBytecodeChecksum is returned when the bytecode payload is truncated or corrupted.
+	ErrBytecodeChecksum = errors.New("bytecode checksum mismatch")
+)
+
+// The bytecode produced by Compile is prefixed with a small header:
+//
+//	magic "QJSB" | format version (1 byte) | flags (1 byte) | engine version length (1 byte) | engine version | crc32 of payload (4 bytes, LE) | payload
+const (
+	bytecodeMagic         = "QJSB"
+	bytecodeFormatVersion = 1
+
+	bytecodeFlagModule    = 1 << 0
+	bytecodeFlagBigEndian = 1 << 1
+)
+
+func nativeBigEndian() bool {
+	x := uint16(1)
+	return *(*byte)(unsafe.Pointer(&x)) == 0
+}
+
+// wrapBytecode prefixes the raw engine bytecode with the versioned header.
+func wrapBytecode(payload []byte, module bool) []byte {
+	flags := byte(0)
+	if module {
+		flags |= bytecodeFlagModule
+	}
+	if nativeBigEndian() {
+		flags |= bytecodeFlagBigEndian
+	}
+
+	buf := bytes.NewBuffer(make([]byte, 0, len(bytecodeMagic)+3+len(QuickJSVersion)+4+len(payload)))
+	buf.WriteString(bytecodeMagic)
+	buf.WriteByte(bytecodeFormatVersion)
+	buf.WriteByte(flags)
+	buf.WriteByte(byte(len(QuickJSVersion)))
+	buf.WriteString(QuickJSVersion)
+	var sum [4]byte
+	binary.LittleEndian.PutUint32(sum[:], crc32.ChecksumIEEE(payload))
+	buf.Write(sum[:])
+	buf.Write(payload)
+	return buf.Bytes()
+}
+
+// unwrapBytecode validates the header and returns the raw engine bytecode and whether it is a module.
+func unwrapBytecode(buf []byte) ([]byte, bool, error) {
+	if len(buf) < len(bytecodeMagic)+3 || string(buf[:len(bytecodeMagic)]) != bytecodeMagic {
+		return nil, false, ErrBytecodeInvalid
+	}
+	buf = buf[len(bytecodeMagic):]
+	format, flags, versionLen := buf[0], buf[1], int(buf[2])
+	buf = buf[3:]
+	if format != bytecodeFormatVersion {
+		return nil, false, fmt.Errorf("%w: format %d, expected %d", ErrBytecodeVersionMismatch, format, bytecodeFormatVersion)
+	}
+	if len(buf) < versionLen+4 {
+		return nil, false, ErrBytecodeInvalid
+	}
+	if version := string(buf[:versionLen]); version != QuickJSVersion {
+		return nil, false, fmt.Errorf("%w: built by QuickJS %s, engine is %s", ErrBytecodeVersionMismatch, version, QuickJSVersion)
+	}
+	if (flags&bytecodeFlagBigEndian != 0) != nativeBigEndian() {
+		return nil, false, fmt.Errorf("%w: byte order differs from this platform", ErrBytecodeVersionMismatch)
+	}
+	buf = buf[versionLen:]
+	sum, payload := binary.LittleEndian.Uint32(buf[:4]), buf[4:]
+	if len(payload) == 0 || crc32.ChecksumIEEE(payload) != sum {
+		return nil, false, ErrBytecodeChecksum
+	}
+	return payload, flags&bytecodeFlagModule != 0, nil
+}
@@ -0,0 +1,171 @@
+package quickjs
+
+/*
+#include "bridge.h"
+*/
+import "C"
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"os"
+	"path/filepath"
+	"sync"
+	"unsafe"
+)
+
+// BytecodeCache stores compiled bytecode by content hash, so repeated Eval and Compile of identical sources skip the compiler.
+// Implementations must be safe for concurrent use, as a cache may be shared by several runtimes.
+type BytecodeCache interface {
+	// Get returns the bytecode stored with the key.
+	Get(key string) ([]byte, bool)
+	// Put stores the bytecode with the key.
+	Put(key string, bytecode []byte)
+}
+
+// BytecodeCacheKey returns the cache key of the given source, filename and eval flags.
+func BytecodeCacheKey(code string, filename string, flags int) string {
+	h := sha256.New()
+	var buf [8]byte
+	binary.LittleEndian.PutUint64(buf[:], uint64(flags))
+	h.Write(buf[:])
+	binary.LittleEndian.PutUint64(buf[:], uint64(len(filename)))
+	h.Write(buf[:])
+	h.Write([]byte(filename))
+	h.Write([]byte(code))
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// MemoryBytecodeCache is an in-memory BytecodeCache.
+type MemoryBytecodeCache struct {
+	mu      sync.RWMutex
+	entries map[string][]byte
+}
+
+// NewMemoryBytecodeCache returns an empty in-memory bytecode cache.
+func NewMemoryBytecodeCache() *MemoryBytecodeCache {
+	return &MemoryBytecodeCache{entries: make(map[string][]byte)}
+}
+
+// Get returns a copy of the bytecode stored with the key, so the caller may change it.
+func (c *MemoryBytecodeCache) Get(key string) ([]byte, bool) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	buf, ok := c.entries[key]
+	if !ok {
+		return nil, false
+	}
+	return append([]byte(nil), buf...), true
+}
+
+// Put stores a copy of the bytecode with the key, so the caller may keep using the bytecode.
+func (c *MemoryBytecodeCache) Put(key string, bytecode []byte) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.entries[key] = append([]byte(nil), bytecode...)
+}
+
+// Len returns the number of cached entries.
+func (c *MemoryBytecodeCache) Len() int {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return len(c.entries)
+}
+
+// FileBytecodeCache is a BytecodeCache persisting each entry as a file in a directory.
+//
+// The directory must be trusted, i.e. writable only by the host: the entries are loaded into the engine, whose bytecode reader
+// is not safe against crafted input, and the checksum of their header only detects accidental corruption, not tampering.
+type FileBytecodeCache struct {
+	dir string
+}
+
+// NewFileBytecodeCache returns a bytecode cache stored in dir, creating the directory if needed.
+func NewFileBytecodeCache(dir string) (*FileBytecodeCache, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+	return &FileBytecodeCache{dir: dir}, nil
+}
+
+// Get returns the bytecode stored with the key.
+func (c *FileBytecodeCache) Get(key string) ([]byte, bool) {
+	buf, err := os.ReadFile(c.path(key))
+	if err != nil {
+		return nil, false
+	}
+	return buf, true
+}
+
+// Put stores the bytecode with the key. Errors are ignored, the entry is simply compiled again next time.
+func (c *FileBytecodeCache) Put(key string, bytecode []byte) {
+	tmp, err := os.CreateTemp(c.dir, key+".*.tmp")
+	if err != nil {
+		return
+	}
+	_, err = tmp.Write(bytecode)
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(tmp.Name(), c.path(key))
+	}
+	if err != nil {
+		os.Remove(tmp.Name())
+	}
+}
+
+func (c *FileBytecodeCache) path(key string) string {
+	return filepath.Join(c.dir, key+".qjsc")
+}
+
+// SetBytecodeCache sets the bytecode cache used by Eval and Compile; use nil to disable caching.
+func (ctx *Context) SetBytecodeCache(cache BytecodeCache) {
+	ctx.bytecodeCache = cache
+}
+
+// BytecodeCache returns the bytecode cache of the context.
+func (ctx *Context) BytecodeCache() BytecodeCache {
+	return ctx.bytecodeCache
+}
+
+// readCachedBytecode reads a cached function; a stale or corrupted entry reports false and is replaced by the caller.
+func (ctx *Context) readCachedBytecode(buf []byte) (C.JSValue, bool) {
+	cbuf := C.CBytes(buf)
+	defer C.free(cbuf)
+	obj := C.JS_ReadObject(ctx.ref, (*C.uint8_t)(cbuf), C.size_t(len(buf)), C.JS_READ_OBJ_BYTECODE)
+	if C.JS_IsException(obj) == 1 {
+		C.JS_FreeValue(ctx.ref, C.JS_GetException(ctx.ref))
+		return obj, false
+	}
+	return obj, true
+}
+
+// evalCached evaluates a global script from the bytecode cache, compiling and storing it on a miss.
+// It also reports whether the cache was hit.
+func (ctx *Context) evalCached(code string, codePtr *C.char, filename string, filenamePtr *C.char, cFlag C.int) (C.JSValue, bool) {
+	key := BytecodeCacheKey(code, filename, int(cFlag))
+	if buf, ok := ctx.bytecodeCache.Get(key); ok {
+		if buf, _, err := unwrapBytecode(buf); err == nil {
+			if obj, ok := ctx.readCachedBytecode(buf); ok {
+				return C.JS_EvalFunction(ctx.ref, obj), true
+			}
+		}
+	}
+
+	obj := C.JS_Eval(ctx.ref, codePtr, C.size_t(len(code)), filenamePtr, cFlag|C.JS_EVAL_FLAG_COMPILE_ONLY)
+	if C.JS_IsException(obj) == 1 {
+		return obj, false
+	}
+
+	var size C.size_t
+	ptr := C.JS_WriteObject(ctx.ref, &size, obj, C.JS_WRITE_OBJ_BYTECODE)
+	if ptr != nil {
+		ctx.bytecodeCache.Put(key, wrapBytecode(C.GoBytes(unsafe.Pointer(ptr), C.int(size)), false))
+		C.js_free(ctx.ref, unsafe.Pointer(ptr))
+	} else {
+		C.JS_FreeValue(ctx.ref, C.JS_GetException(ctx.ref))
+	}
+
+	return C.JS_EvalFunction(ctx.ref, obj), false
+}
@@ -0,0 +1,72 @@
+package quickjs
+
+/*
+#include "bridge.h"
+*/
+import "C"
+import "errors"
+
+// CallArgs calls the function with Go arguments converted by Marshal, and returns its result converted by Unmarshal into interface{}.
+// A nil this calls the function with undefined as this. An exception thrown by the function is returned as an *Error.
+func (v Value) CallArgs(this *Value, args ...interface{}) (interface{}, error) {
+	var out interface{}
+	err := v.CallInto(&out, this, args...)
+	return out, err
+}
+
+// CallInto calls the function like CallArgs, and stores its result converted by Unmarshal in the value pointed to by out.
+// A nil out discards the result.
+func (v Value) CallInto(out interface{}, this *Value, args ...interface{}) error {
+	if !v.IsFunction() {
+		return errors.New("quickjs: value is not a function")
+	}
+
+	jsArgs, err := v.ctx.marshalArgs(args)
+	defer freeValues(jsArgs)
+	if err != nil {
+		return err
+	}
+
+	thisVal := v.ctx.Undefined()
+	if this != nil {
+		thisVal = *this
+	}
+	ret := v.ctx.Invoke(v, thisVal, jsArgs...)
+	defer ret.Free()
+	if ret.IsException() {
+		return v.ctx.exceptionError()
+	}
+	if out == nil {
+		return nil
+	}
+	return ret.Unmarshal(out)
+}
+
+// As returns the value converted by Unmarshal into T.
+func As[T any](v *Value, opts ...UnmarshalOption) (T, error) {
+	var out T
+	if v == nil {
+		return out, errors.New("quickjs: As requires a non-nil value")
+	}
+	err := v.Unmarshal(&out, opts...)
+	return out, err
+}
+
+// Call calls the function with undefined as this and the Go arguments converted by Marshal, and returns its result converted by Unmarshal into T;
+// see CallInto, and Value.Call to call a method.
+func Call[T any](fn *Value, args ...interface{}) (T, error) {
+	var out T
+	if fn == nil {
+		return out, errors.New("quickjs: value is not a function")
+	}
+	err := fn.CallInto(&out, nil, args...)
+	return out, err
+}
+
+// exceptionError takes the pending exception of the context as an *Error, whatever the type of the thrown value.
+func (ctx *Context) exceptionError() error {
+	defer ctx.liftMemoryLimit()()
+	exception := ctx.newValue(C.JS_GetException(ctx.ref))
+	defer exception.Free()
+	return ctx.observeException(exception.toError())
+}
@@ -0,0 +1,130 @@
+package quickjs
+
+/*
+#include "bridge.h"
+*/
+import "C"
+
+// cloneScript returns the function defining the structuredClone global, given the Go function detaching ArrayBuffers.
+// It clones like the structured clone algorithm of HTML: primitives, plain objects and arrays with their own enumerable
+// properties, wrappers of primitives, Date, RegExp, Map, Set, errors, ArrayBuffers and their views, preserving shared and
+// circular references; other objects are cloned as plain objects, and functions, symbols, promises and weak collections
+// throw an Error named DataCloneError. The ArrayBuffers of the transfer option are moved to the clone and detached.
+const cloneScript = `((detach) => {
+	const dataCloneError = (message) => {
+		const error = new Error(message);
+		error.name = "DataCloneError";
+		return error;
+	};
+	const errors = { Error, EvalError, RangeError, ReferenceError, SyntaxError, TypeError, URIError };
+	const uncloneable = [Promise, WeakMap, WeakSet, Symbol];
+	if (typeof WeakRef === "function") {
+		uncloneable.push(WeakRef);
+	}
+
+	const structuredClone = function structuredClone(value, options) {
+		const transfer = options == null || options.transfer === undefined ? [] : Array.from(options.transfer);
+		const memo = new Map();
+		for (const buffer of transfer) {
+			if (!(buffer instanceof ArrayBuffer)) {
+				throw dataCloneError("Value not transferable");
+			}
+			if (memo.has(buffer)) {
+				throw dataCloneError("ArrayBuffer is duplicated in the transfer list");
+			}
+			memo.set(buffer, buffer.slice(0));
+		}
+
+		const properties = (from, to) => {
+			for (const key of Object.keys(from)) {
+				to[key] = clone(from[key]);
+			}
+			return to;
+		};
+		const clone = (v) => {
+			if (typeof v === "function" || typeof v === "symbol") {
+				throw dataCloneError(String(typeof v === "function" ? v.name || "function" : v.toString()) + " could not be cloned");
+			}
+			if (typeof v !== "object" || v === null) {
+				return v;
+			}
+			if (memo.has(v)) {
+				return memo.get(v);
+			}
+			if (uncloneable.some((ctor) => v instanceof ctor)) {
+				throw dataCloneError(Object.prototype.toString.call(v) + " could not be cloned");
+			}
+
+			let copy;
+			if (Array.isArray(v)) {
+				copy = new Array(v.length);
+				memo.set(v, copy);
+				return properties(v, copy);
+			} else if (v instanceof Boolean || v instanceof Number || v instanceof String || v instanceof BigInt) {
+				copy = Object(v.valueOf());
+			} else if (v instanceof Date) {
+				copy = new Date(v.getTime());
+			} else if (v instanceof RegExp) {
+				copy = new RegExp(v.source, v.flags);
+			} else if (v instanceof ArrayBuffer) {
+				copy = v.slice(0);
+			} else if (ArrayBuffer.isView(v)) {
+				const buffer = clone(v.buffer);
+				copy = v instanceof DataView ? new DataView(buffer, v.byteOffset, v.byteLength) : new v.constructor(buffer, v.byteOffset, v.length);
+			} else if (v instanceof Map) {
+				copy = new Map();
+				memo.set(v, copy);
+				v.forEach((value, key) => copy.set(clone(key), clone(value)));
+				return copy;
+			} else if (v instanceof Set) {
+				copy = new Set();
+				memo.set(v, copy);
+				v.forEach((value) => copy.add(clone(value)));
+				return copy;
+			} else if (v instanceof Error) {
+				const name = v.name;
+				copy = new (Object.prototype.hasOwnProperty.call(errors, name) ? errors[name] : Error)();
+				memo.set(v, copy);
+				for (const key of ["message", "cause", "stack"]) {
+					if (Object.prototype.hasOwnProperty.call(v, key)) {
+						Object.defineProperty(copy, key, { value: key === "cause" ? clone(v[key]) : String(v[key]), writable: true, configurable: true });
+					}
+				}
+				return copy;
+			} else {
+				copy = {};
+				memo.set(v, copy);
+				return properties(v, copy);
+			}
+			memo.set(v, copy);
+			return copy;
+		};
+
+		const result = clone(value);
+		transfer.forEach(detach);
+		return result;
+	};
+	Object.defineProperty(globalThis, "structuredClone", { value: structuredClone, writable: true, configurable: true });
+})`
+
+// installStructuredClone evaluates cloneScript.
+func (ctx *Context) installStructuredClone() error {
+	define, err := ctx.eval(cloneScript, EvalFileName("<clone>"))
+	if err != nil {
+		return err
+	}
+	defer define.Free()
+
+	detach := ctx.NamedFunction("detach", 1, func(ctx *Context, this Value, args []Value) Value {
+		C.JS_DetachArrayBuffer(ctx.ref, args[0].ref)
+		return ctx.Undefined()
+	})
+	defer detach.Free()
+
+	ret := ctx.Invoke(define, ctx.Null(), detach)
+	defer ret.Free()
+	if ret.IsException() {
+		return ctx.exceptionError()
+	}
+	return nil
+}
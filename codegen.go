@@ -0,0 +1,67 @@
+package quickjs
+
+// blockCodegenScript replaces eval and the Function constructors with functions throwing an EvalError.
+// It returns a function restoring the original intrinsics, which is only reachable from Go.
+const blockCodegenScript = `(() => {
+	const message = "Code generation from strings disallowed for this context";
+	const block = (original) => {
+		const blocked = function () { throw new EvalError(message); };
+		Object.defineProperty(blocked, "name", { value: original.name });
+		Object.defineProperty(blocked, "length", { value: original.length });
+		blocked.prototype = original.prototype;
+		return blocked;
+	};
+	const originalEval = globalThis.eval;
+	const originalFunction = globalThis.Function;
+	const prototypes = [
+		Function.prototype,
+		Object.getPrototypeOf(async function () {}),
+		Object.getPrototypeOf(function* () {}),
+		Object.getPrototypeOf(async function* () {}),
+	];
+	const constructors = prototypes.map((proto) => proto.constructor);
+	const blocked = constructors.map(block);
+
+	globalThis.eval = block(originalEval);
+	globalThis.Function = blocked[0];
+	prototypes.forEach((proto, i) => Object.defineProperty(proto, "constructor", { value: blocked[i] }));
+
+	return () => {
+		globalThis.eval = originalEval;
+		globalThis.Function = originalFunction;
+		prototypes.forEach((proto, i) => Object.defineProperty(proto, "constructor", { value: constructors[i] }));
+	};
+})()`
+
+// SetEvalEnabled enables or disables code generation from strings for scripts of the context.
+// When disabled, eval() (direct and indirect), new Function() and the async/generator function constructors throw an EvalError,
+// and importing the std and os modules, whose evalScript, loadScript and Worker evaluate code, throws a TypeError.
+// Otherwise, code evaluated from Go with Eval, EvalFile and EvalBytecode is not affected.
+func (ctx *Context) SetEvalEnabled(enabled bool) error {
+	if enabled == ctx.EvalEnabled() {
+		return nil
+	}
+
+	if enabled {
+		ret := ctx.Invoke(*ctx.codegenRestore, ctx.Null())
+		defer ret.Free()
+		if ret.IsException() {
+			return ctx.Exception()
+		}
+		ctx.codegenRestore.Free()
+		ctx.codegenRestore = nil
+		return nil
+	}
+
+	restore, err := ctx.eval(blockCodegenScript, EvalFileName("<codegen>"))
+	if err != nil {
+		return err
+	}
+	ctx.codegenRestore = &restore
+	return nil
+}
+
+// EvalEnabled returns true if scripts of the context may generate code from strings.
+func (ctx *Context) EvalEnabled() bool {
+	return ctx.codegenRestore == nil
+}
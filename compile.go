@@ -0,0 +1,41 @@
+package quickjs
+
+import "context"
+
+// compileResult is the outcome of a compilation run by CompileContext.
+type compileResult struct {
+	bytecode []byte
+	err      error
+}
+
+// CompileContext compiles the code like Compile, but returns the error of goCtx as soon as it is done.
+//
+// The engine does not poll the interrupt handler while parsing, so a huge source cannot be interrupted in place.
+// Instead, the code is compiled on its own goroutine in a throwaway runtime, with the memory limit, maximum stack size
+// and bytecode cache of the context's runtime; bytecode does not depend on the runtime which compiled it.
+// On cancellation the goroutine is abandoned: it frees its runtime once the compilation ends, and its result is dropped.
+func (ctx *Context) CompileContext(goCtx context.Context, code string, opts ...EvalOption) ([]byte, error) {
+	if err := goCtx.Err(); err != nil {
+		return nil, err
+	}
+
+	options := ctx.runtime.options
+	opts = ctx.strictOptions(opts)
+	done := make(chan compileResult, 1)
+	go func() {
+		rt := NewRuntime(WithMemoryLimit(options.memoryLimit), WithMaxStackSize(options.maxStackSize), WithBytecodeCache(ctx.bytecodeCache), WithFeatures(options.features))
+		defer rt.Close()
+		compileCtx := rt.NewContext()
+		defer compileCtx.Close()
+
+		bytecode, err := compileCtx.Compile(code, opts...)
+		done <- compileResult{bytecode: bytecode, err: err}
+	}()
+
+	select {
+	case result := <-done:
+		return result.bytecode, result.err
+	case <-goCtx.Done():
+		return nil, goCtx.Err()
+	}
+}
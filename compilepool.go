@@ -0,0 +1,78 @@
+package quickjs
+
+import (
+	"fmt"
+	"runtime"
+	"sync"
+)
+
+// CompileSource is a source compiled by a CompilePool; an empty filename uses the default of Compile.
+type CompileSource struct {
+	Code     string
+	Filename string
+}
+
+// CompilePool compiles many sources concurrently, each worker using its own throwaway runtime.
+// As bytecode does not depend on the runtime which compiled it, the results can be loaded by any context
+// with EvalBytecode or LoadModuleBytecode, e.g. to speed up the startup of an application with hundreds of scripts.
+type CompilePool struct {
+	workers int
+	opts    []Option
+}
+
+// NewCompilePool returns a pool of the given number of workers, or runtime.NumCPU() if workers is not positive,
+// creating their runtimes with the options, e.g. WithMemoryLimit or WithBytecodeCache.
+func NewCompilePool(workers int, opts ...Option) *CompilePool {
+	if workers <= 0 {
+		workers = runtime.NumCPU()
+	}
+	return &CompilePool{workers: workers, opts: opts}
+}
+
+// Compile compiles the sources, like Context.Compile, and returns their bytecode in the same order.
+// All the sources are compiled; if some fail, the error of the first one is returned, along with the other results.
+func (p *CompilePool) Compile(sources []CompileSource) ([][]byte, error) {
+	results := make([][]byte, len(sources))
+	errs := make([]error, len(sources))
+
+	indexes := make(chan int)
+	var wg sync.WaitGroup
+	workers := p.workers
+	if workers > len(sources) {
+		workers = len(sources)
+	}
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			rt := NewRuntime(p.opts...)
+			defer rt.Close()
+			ctx := rt.NewContext()
+			defer ctx.Close()
+
+			for i := range indexes {
+				var opts []EvalOption
+				if sources[i].Filename != "" {
+					opts = append(opts, EvalFileName(sources[i].Filename))
+				}
+				results[i], errs[i] = ctx.Compile(sources[i].Code, opts...)
+			}
+		}()
+	}
+	for i := range sources {
+		indexes <- i
+	}
+	close(indexes)
+	wg.Wait()
+
+	for i, err := range errs {
+		if err == nil {
+			continue
+		}
+		if sources[i].Filename == "" {
+			return results, fmt.Errorf("compile source %d: %w", i, err)
+		}
+		return results, fmt.Errorf("compile %s: %w", sources[i].Filename, err)
+	}
+	return results, nil
+}
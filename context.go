@@ -1,9 +1,12 @@
 package quickjs
 
 import (
+	"errors"
 	"fmt"
+	"math/big"
 	"os"
 	"runtime/cgo"
+	"sync/atomic"
 	"unsafe"
 )
 
@@ -17,9 +20,59 @@ import "C"
 type Context struct {
 	runtime    *Runtime
 	ref        *C.JSContext
+	handle     cgo.Handle
 	globals    *Value
 	proxy      *Value
 	asyncProxy *Value
+	tracker    *valueTracker
+	freed      *freedValues
+	freeQueue  *freeQueue
+	jobQueue   *jobQueue
+
+	bytecodeCache            BytecodeCache
+	codegenRestore           *Value
+	timers                   *Value // see wrapTimersScript
+	abortLinks               *Value // see abortScript
+	abortSeq                 int64
+	thenables                *Value // see thenableScript
+	thenableSeq              int64
+	streams                  *Value // see streamScript
+	blobs                    *Value // see blobScript
+	streamOps                int64  // the stream operations in progress, see startStreamOp
+	errorClasses             map[string]Value
+	uncaughtExceptionHandler func(*Error)
+	interruptHandler         ContextInterruptHandler
+	tag                      interface{}
+	userData                 interface{}
+	origin                   string // the origin of the code running, see EvalOrigin
+	owner                    uint64
+	running                  int
+	closed                   bool
+	setupErr                 error // see discardSetup
+	strict                   bool
+	locale                   *Locale
+	storage                  *storageState
+	randomSource             func() float64
+	randomInstaller          *Value
+	clock                    *virtualClock // see WithDeterministicMode
+	globalFallback           GlobalFallbackHandler
+	globalFallbackInstalled  bool
+	lockdown                 *lockdownOptions // see Lockdown
+	pollutionHandler         PollutionHandler
+	pollutionRestore         *Value
+	realms                   map[*Realm]struct{}
+	localeInstaller          *Value
+	atoms                    map[string]*Atom
+	weakRefSlot              *Value // see privateSlot
+	hostDataSlot             *Value
+	iteratorAtom             *Atom                  // Symbol.iterator, see Iterate
+	hostData                 map[*hostData]struct{} // the Go data attached to live objects
+	hostDataSeq              uint64
+	handles                  map[int64]*handleEntry // the Go objects of the handles not released, see NewHandleObject
+	handleSeq                int64
+	handleStore              handleStore
+	closeHooks               []func(*Context)
+	resetHooks               []func(*Context)
 }
 
 // Runtime returns the runtime of the context.
@@ -28,20 +81,119 @@ func (ctx *Context) Runtime() *Runtime {
 }
 
 // Free will free context and all associated objects.
+// The OnClose functions are called first, then the Go data still attached to live objects is finalized, see SetGoObject;
+// the jobs still queued are dropped and the pending timers never run, see CloseWithTimeout.
 func (ctx *Context) Close() {
-	if ctx.proxy != nil {
-		ctx.proxy.Free()
+	if t := ctx.runtime.thread; t.remote() {
+		t.do(ctx.Close)
+		return
+	}
+	ctx.checkClose()
+	ctx.closeJobs()
+	ctx.runCloseHooks()
+	ctx.finalizeHostData()
+	ctx.FreePending()
+	ctx.freeQueue.close()
+
+	if ctx.tracker != nil {
+		if report := ctx.tracker.report(); report.Total > 0 {
+			if handler := ctx.runtime.options.leakHandler; handler != nil {
+				handler(report)
+			} else if logger := ctx.runtime.options.logger; logger != nil {
+				logger.Log(LogLevelWarn, "quickjs: values not freed", map[string]interface{}{"total": report.Total, "report": report.String()})
+			} else {
+				fmt.Fprint(os.Stderr, report)
+			}
+		}
+		ctx.tracker = nil
 	}
 
-	if ctx.asyncProxy != nil {
-		ctx.asyncProxy.Free()
-	}
+	ctx.closeRealms()
+	ctx.freeInternals()
+	ctx.freeAtoms()
+	ctx.freeSlots()
+	C.SetContextHandle(ctx.ref, 0)
+	C.JS_FreeContext(ctx.ref)
+	ctx.ReleaseOrphanedHandles()
+	ctx.handle.Delete()
+	ctx.closed = true
+}
+
+// setup binds the context handle and applies the runtime options to the global object.
+// The bytecode cache is disabled meanwhile, so the setup scripts are not cached.
+func (ctx *Context) setup() error {
+	C.SetContextHandle(ctx.ref, C.uintptr_t(ctx.handle))
 
-	if ctx.globals != nil {
-		ctx.globals.Free()
+	cache := ctx.bytecodeCache
+	ctx.bytecodeCache = nil
+	defer func() { ctx.bytecodeCache = cache }()
+
+	if err := ctx.setupAtomics(); err != nil {
+		return err
+	}
+	if err := ctx.setupDeterministic(); err != nil {
+		return err
+	}
+	if err := ctx.setupUncaughtExceptions(); err != nil {
+		return err
+	}
+	if err := ctx.defineLazyGlobals(); err != nil {
+		return err
+	}
+	ctx.globalFallbackInstalled = false
+	if ctx.globalFallback != nil {
+		if err := ctx.installGlobalFallback(); err != nil {
+			return err
+		}
+	}
+	if ctx.pollutionHandler != nil {
+		if err := ctx.installPollution(); err != nil {
+			return err
+		}
+	}
+	if ctx.randomSource != nil {
+		if err := ctx.SetRandomSource(ctx.randomSource); err != nil {
+			return err
+		}
 	}
+	if ctx.storage != nil {
+		if err := ctx.installStorage(); err != nil {
+			return err
+		}
+	}
+	if ctx.locale != nil {
+		return ctx.SetLocale(ctx.locale)
+	}
+	return nil
+}
 
+// discardSetup replaces the JSContext whose setup failed, e.g. out of memory under a tight memory limit, by a raw one
+// without any intrinsics nor the eval of code, so that the context fails closed: the settings the setup applies, such as
+// the removal of Atomics or the deterministic mode, may be missing, so the context refuses to evaluate code, returning the error.
+func (ctx *Context) discardSetup(err error) {
+	ctx.FreePending()
+	ctx.freeInternals()
+	C.SetContextHandle(ctx.ref, 0)
 	C.JS_FreeContext(ctx.ref)
+	// the functions of the setup scripts keep the JSContext until they are collected
+	C.JS_RunGC(ctx.runtime.ref)
+	ctx.ref = C.JS_NewContextRaw(ctx.runtime.ref)
+	C.SetContextHandle(ctx.ref, C.uintptr_t(ctx.handle))
+	ctx.setupErr = fmt.Errorf("quickjs: context setup failed: %w", err)
+}
+
+// freeInternals frees the values held by the context itself.
+func (ctx *Context) freeInternals() {
+	for _, v := range []**Value{&ctx.proxy, &ctx.asyncProxy, &ctx.codegenRestore, &ctx.pollutionRestore, &ctx.timers, &ctx.abortLinks, &ctx.thenables, &ctx.streams, &ctx.blobs, &ctx.localeInstaller, &ctx.randomInstaller, &ctx.globals} {
+		if *v != nil {
+			(*v).Free()
+			*v = nil
+		}
+	}
+	for _, cls := range ctx.errorClasses {
+		cls.Free()
+	}
+	ctx.errorClasses = nil
 }
 
 // Null return a null value.
@@ -60,9 +212,13 @@ func (ctx *Context) Uninitialized() Value {
 }
 
 // Error returns a new exception value with given message.
+// An error wrapping another one, as returned by errors.Unwrap, gets the wrapped error as its cause property, recursively.
 func (ctx *Context) Error(err error) Value {
-	val := Value{ctx: ctx, ref: C.JS_NewError(ctx.ref)}
-	val.Set("message", ctx.String(err.Error()))
+	val := ctx.newValue(C.JS_NewError(ctx.ref))
+	val.Set("message", ctx.newString(err.Error()))
+	if wrapped := errors.Unwrap(err); wrapped != nil {
+		ctx.defineHidden(val, "cause", ctx.Error(wrapped))
+	}
 	return val
 }
 
@@ -92,12 +248,29 @@ func (ctx *Context) Uint32(v uint32) Value {
 
 // BigInt64 returns a int64 value with given uint64.
 func (ctx *Context) BigInt64(v int64) Value {
-	return Value{ctx: ctx, ref: C.JS_NewBigInt64(ctx.ref, C.int64_t(v))}
+	return ctx.newValue(C.JS_NewBigInt64(ctx.ref, C.int64_t(v)))
+}
+
+// BigInt returns a BigInt value with given big.Int, which may exceed 64 bits.
+func (ctx *Context) BigInt(v *big.Int) Value {
+	if v.IsInt64() {
+		return ctx.BigInt64(v.Int64())
+	}
+	// the engine has no API to create a BigInt from limbs, so parse it as a hexadecimal literal
+	literal := "0x" + new(big.Int).Abs(v).Text(16) + "n"
+	if v.Sign() < 0 {
+		literal = "-" + literal
+	}
+	literalPtr := C.CString(literal)
+	defer C.free(unsafe.Pointer(literalPtr))
+	filenamePtr := C.CString("<bigint>")
+	defer C.free(unsafe.Pointer(filenamePtr))
+	return ctx.newValue(C.JS_Eval(ctx.ref, literalPtr, C.size_t(len(literal)), filenamePtr, C.JS_EVAL_TYPE_GLOBAL))
 }
 
 // BigUint64 returns a uint64 value with given uint64.
 func (ctx *Context) BigUint64(v uint64) Value {
-	return Value{ctx: ctx, ref: C.JS_NewBigUint64(ctx.ref, C.uint64_t(v))}
+	return ctx.newValue(C.JS_NewBigUint64(ctx.ref, C.uint64_t(v)))
 }
 
 // Float64 returns a float64 value with given float64.
@@ -106,20 +279,46 @@ func (ctx *Context) Float64(v float64) Value {
 }
 
 // String returns a string value with given string.
+// A string longer than WithMaxStringLength throws a *LimitError instead.
 func (ctx *Context) String(v string) Value {
+	if err := ctx.checkStringLength(len(v)); err != nil {
+		return ctx.ThrowError(err)
+	}
+	return ctx.newString(v)
+}
+
+// newString returns a string value with given string, whatever its length, e.g. for the messages of errors.
+func (ctx *Context) newString(v string) Value {
 	ptr := C.CString(v)
 	defer C.free(unsafe.Pointer(ptr))
-	return Value{ctx: ctx, ref: C.JS_NewString(ctx.ref, ptr)}
+	return ctx.newValue(C.JS_NewStringLen(ctx.ref, ptr, C.size_t(len(v))))
+}
+
+// NewStringLen returns a string value decoded from the UTF-8 bytes, which the engine reads in place instead of from a C copy,
+// e.g. for the large buffers read from files or sockets; it keeps NUL bytes, and replaces invalid sequences as String does.
+// Like String, it throws a *LimitError for more bytes than WithMaxStringLength.
+func (ctx *Context) NewStringLen(b []byte) Value {
+	if err := ctx.checkStringLength(len(b)); err != nil {
+		return ctx.ThrowError(err)
+	}
+	if len(b) == 0 {
+		return ctx.String("")
+	}
+	return ctx.newValue(C.JS_NewStringLen(ctx.ref, (*C.char)(unsafe.Pointer(&b[0])), C.size_t(len(b))))
 }
 
 // ArrayBuffer returns a string value with given binary data.
+// A buffer longer than WithMaxArrayLength throws a *LimitError instead.
 func (ctx *Context) ArrayBuffer(binaryData []byte) Value {
-	return Value{ctx: ctx, ref: C.JS_NewArrayBufferCopy(ctx.ref, (*C.uchar)(&binaryData[0]), C.size_t(len(binaryData)))}
+	if err := ctx.checkArrayLength(int64(len(binaryData))); err != nil {
+		return ctx.ThrowError(err)
+	}
+	return ctx.newValue(C.JS_NewArrayBufferCopy(ctx.ref, (*C.uchar)(&binaryData[0]), C.size_t(len(binaryData))))
 }
 
 // Object returns a new object value.
 func (ctx *Context) Object() Value {
-	return Value{ctx: ctx, ref: C.JS_NewObject(ctx.ref)}
+	return ctx.newValue(C.JS_NewObject(ctx.ref))
 }
 
 // ParseJson parses given json string and returns a object value.
@@ -130,65 +329,84 @@ func (ctx *Context) ParseJSON(v string) Value {
 	filenamePtr := C.CString("")
 	defer C.free(unsafe.Pointer(filenamePtr))
 
-	return Value{ctx: ctx, ref: C.JS_ParseJSON(ctx.ref, ptr, C.size_t(len(v)), filenamePtr)}
+	return ctx.newValue(C.JS_ParseJSON(ctx.ref, ptr, C.size_t(len(v)), filenamePtr))
 }
 
 // Array returns a new array value.
 func (ctx *Context) Array() *Array {
-	val := Value{ctx: ctx, ref: C.JS_NewArray(ctx.ref)}
+	val := ctx.newValue(C.JS_NewArray(ctx.ref))
 	return NewQjsArray(val, ctx)
 }
 
 func (ctx *Context) Map() *Map {
 	ctor := ctx.Globals().Get("Map")
 	defer ctor.Free()
-	val := Value{ctx: ctx, ref: C.JS_CallConstructor(ctx.ref, ctor.ref, 0, nil)}
+	val := ctx.newValue(C.JS_CallConstructor(ctx.ref, ctor.ref, 0, nil))
 	return NewQjsMap(val, ctx)
 }
 
 func (ctx *Context) Set() *Set {
 	ctor := ctx.Globals().Get("Set")
 	defer ctor.Free()
-	val := Value{ctx: ctx, ref: C.JS_CallConstructor(ctx.ref, ctor.ref, 0, nil)}
+	val := ctx.newValue(C.JS_CallConstructor(ctx.ref, ctor.ref, 0, nil))
 	return NewQjsSet(val, ctx)
 }
 
 // Function returns a js function value with given function template.
 func (ctx *Context) Function(fn func(ctx *Context, this Value, args []Value) Value) Value {
+	return ctx.proxyFunction(&hostFunction{fn: fn})
+}
+
+// proxyFunction returns a js function calling the host function through the proxy.
+func (ctx *Context) proxyFunction(host *hostFunction) Value {
+	return ctx.proxyFunctionIn(ctx.ref, host)
+}
+
+// proxyFunctionIn is proxyFunction creating the function in the JSContext, the one of the context or of one of its realms.
+func (ctx *Context) proxyFunctionIn(ref *C.JSContext, host *hostFunction) Value {
 	if ctx.proxy == nil {
-		ctx.proxy = &Value{
-			ctx: ctx,
-			ref: C.JS_NewCFunction(ctx.ref, (*C.JSCFunction)(unsafe.Pointer(C.InvokeProxy)), nil, C.int(0)),
-		}
+		proxy := ctx.hold(C.JS_NewCFunction(ctx.ref, (*C.JSCFunction)(unsafe.Pointer(C.InvokeProxy)), nil, C.int(0)))
+		ctx.proxy = &proxy
 	}
 
-	fnHandler := ctx.Int64(int64(cgo.NewHandle(fn)))
-	ctxHandler := ctx.Int64(int64(cgo.NewHandle(ctx)))
+	fnHandler, err := ctx.newFunctionHandle(HandleFunction, host.name, host)
+	if err != nil {
+		return ctx.ThrowError(err)
+	}
+	defer fnHandler.Free()
+	ctxHandler := ctx.Int64(int64(ctx.handle))
 	args := []C.JSValue{ctx.proxy.ref, fnHandler.ref, ctxHandler.ref}
 
-	val, err := ctx.Eval(`(proxy, fnHandler, ctx) => function() { return proxy.call(this, fnHandler, ctx, ...arguments); }`)
+	val, err := ctx.evalIn(ref, "(proxy, fnHandler, ctx) => function() { return "+hostFunctionMarker+"...arguments); }", nil)
 	defer val.Free()
 	if err != nil {
 		panic(err)
 	}
 
-	return Value{ctx: ctx, ref: C.JS_Call(ctx.ref, val.ref, ctx.Null().ref, C.int(len(args)), &args[0])}
+	return ctx.newValue(C.JS_Call(ctx.ref, val.ref, ctx.Null().ref, C.int(len(args)), &args[0]))
 }
 
 // AsyncFunction returns a js async function value with given function template.
 func (ctx *Context) AsyncFunction(asyncFn func(ctx *Context, this Value, promise Value, args []Value) Value) Value {
+	return ctx.asyncProxyFunction(&hostAsyncFunction{fn: asyncFn})
+}
+
+// asyncProxyFunction returns a js async function calling the host function through the async proxy.
+func (ctx *Context) asyncProxyFunction(host *hostAsyncFunction) Value {
 	if ctx.asyncProxy == nil {
-		ctx.asyncProxy = &Value{
-			ctx: ctx,
-			ref: C.JS_NewCFunction(ctx.ref, (*C.JSCFunction)(unsafe.Pointer(C.InvokeAsyncProxy)), nil, C.int(0)),
-		}
+		asyncProxy := ctx.hold(C.JS_NewCFunction(ctx.ref, (*C.JSCFunction)(unsafe.Pointer(C.InvokeAsyncProxy)), nil, C.int(0)))
+		ctx.asyncProxy = &asyncProxy
 	}
 
-	fnHandler := ctx.Int64(int64(cgo.NewHandle(asyncFn)))
-	ctxHandler := ctx.Int64(int64(cgo.NewHandle(ctx)))
+	fnHandler, err := ctx.newFunctionHandle(HandleAsyncFunction, host.name, host)
+	if err != nil {
+		return ctx.ThrowError(err)
+	}
+	defer fnHandler.Free()
+	ctxHandler := ctx.Int64(int64(ctx.handle))
 	args := []C.JSValue{ctx.asyncProxy.ref, fnHandler.ref, ctxHandler.ref}
 
-	val, err := ctx.Eval(`(proxy, fnHandler, ctx) => async function(...arguments) {
+	val, err := ctx.eval(`(proxy, fnHandler, ctx) => async function(...arguments) {
 		let resolve, reject;
 		const promise = new Promise((resolve_, reject_) => {
 		  resolve = resolve_;
@@ -197,7 +415,7 @@ func (ctx *Context) AsyncFunction(asyncFn func(ctx *Context, this Value, promise
 		promise.resolve = resolve;
 		promise.reject = reject;
 
-		proxy.call(this, fnHandler, ctx, promise,  ...arguments);
+		` + hostFunctionMarker + `promise,  ...arguments);
 		return await promise;
 	}`)
 	defer val.Free()
@@ -205,7 +423,7 @@ func (ctx *Context) AsyncFunction(asyncFn func(ctx *Context, this Value, promise
 		panic(err)
 	}
 
-	return Value{ctx: ctx, ref: C.JS_Call(ctx.ref, val.ref, ctx.Null().ref, C.int(len(args)), &args[0])}
+	return ctx.newValue(C.JS_Call(ctx.ref, val.ref, ctx.Null().ref, C.int(len(args)), &args[0]))
 }
 
 // InterruptHandler is a function type for interrupt handler.
@@ -213,11 +431,10 @@ func (ctx *Context) AsyncFunction(asyncFn func(ctx *Context, this Value, promise
 type InterruptHandler func() int
 
 // SetInterruptHandler sets a interrupt handler.
+// The handler applies to the whole runtime; use SetContextInterruptHandler for a handler specific to the context.
 func (ctx *Context) SetInterruptHandler(handler InterruptHandler) {
-	handlerArgs := C.handlerArgs{
-		fn: (C.uintptr_t)(cgo.NewHandle(handler)),
-	}
-	C.SetInterruptHandler(ctx.runtime.ref, unsafe.Pointer(&handlerArgs))
+	ctx.runtime.interrupts.handler = handler
+	ctx.runtime.interrupts.install(ctx.runtime.ref)
 }
 
 // Atom returns a new Atom value with given string.
@@ -232,16 +449,30 @@ func (ctx *Context) AtomIdx(idx int64) Atom {
 	return Atom{ctx: ctx, ref: C.JS_NewAtomUInt32(ctx.ref, C.uint32_t(idx))}
 }
 
-// Invoke invokes a function with given this value and arguments.
-func (ctx *Context) Invoke(fn Value, this Value, args ...Value) Value {
+// Invoke invokes a function with given this value and arguments; it does not take ownership of them.
+func (ctx *Context) Invoke(fn Value, this Value, args ...Value) (ret Value) {
+	if t := ctx.runtime.thread; t.remote() {
+		t.do(func() { ret = ctx.Invoke(fn, this, args...) })
+		return ret
+	}
+	if exception, ok := ctx.throwGoroutine(); ok {
+		return exception
+	}
+	if exception, ok := ctx.throwForeign(fn, this); ok {
+		return exception
+	}
+	if exception, ok := ctx.throwForeign(args...); ok {
+		return exception
+	}
+	defer ctx.enter()()
 	cargs := []C.JSValue{}
 	for _, x := range args {
 		cargs = append(cargs, x.ref)
 	}
 	if len(cargs) == 0 {
-		return Value{ctx: ctx, ref: C.JS_Call(ctx.ref, fn.ref, this.ref, 0, nil)}
+		return ctx.newValue(C.JS_Call(ctx.ref, fn.ref, this.ref, 0, nil))
 	}
-	return Value{ctx: ctx, ref: C.JS_Call(ctx.ref, fn.ref, this.ref, C.int(len(cargs)), &cargs[0])}
+	return ctx.newValue(C.JS_Call(ctx.ref, fn.ref, this.ref, C.int(len(cargs)), &cargs[0]))
 }
 
 type EvalOptions struct {
@@ -252,10 +483,44 @@ type EvalOptions struct {
 	js_eval_flag_compile_only bool
 	filename                  string
 	await                     bool
+	origin                    string
 }
 
 type EvalOption func(*EvalOptions)
 
+func newEvalOptions(opts []EvalOption) EvalOptions {
+	options := EvalOptions{
+		js_eval_type_global: true,
+		filename:            "<input>",
+		await:               false,
+	}
+	for _, fn := range opts {
+		fn(&options)
+	}
+	return options
+}
+
+// flags returns the JS_Eval flags of the options.
+func (options EvalOptions) flags() C.int {
+	cFlag := C.int(0)
+	if options.js_eval_type_global {
+		cFlag |= C.JS_EVAL_TYPE_GLOBAL
+	}
+	if options.js_eval_type_module {
+		cFlag |= C.JS_EVAL_TYPE_MODULE
+	}
+	if options.js_eval_flag_strict {
+		cFlag |= C.JS_EVAL_FLAG_STRICT
+	}
+	if options.js_eval_flag_strip {
+		cFlag |= C.JS_EVAL_FLAG_STRIP
+	}
+	if options.js_eval_flag_compile_only {
+		cFlag |= C.JS_EVAL_FLAG_COMPILE_ONLY
+	}
+	return cFlag
+}
+
 func EvalFlagGlobal(global bool) EvalOption {
 	return func(flags *EvalOptions) {
 		flags.js_eval_type_global = global
@@ -298,35 +563,74 @@ func EvalAwait(await bool) EvalOption {
 	}
 }
 
-// Eval returns a js value with given code.
-// Need call Free() `quickjs.Value`'s returned by `Eval()` and `EvalFile()` and `EvalBytecode()`.
-// func (ctx *Context) Eval(code string) (Value, error) { return ctx.EvalFile(code, "code") }
-func (ctx *Context) Eval(code string, opts ...EvalOption) (Value, error) {
-	options := EvalOptions{
-		js_eval_type_global: true,
-		filename:            "<input>",
-		await:               false,
-	}
-	for _, fn := range opts {
-		fn(&options)
+// EvalOrigin sets the origin of the code, e.g. the tenant it comes from, so that its failures and resource use can be attributed:
+// the origin is set on the errors of the code and in the info of the hooks and of the interrupt handler while it runs.
+// The code run by the code, e.g. by host functions, has the same origin unless given its own; the jobs run later by Loop,
+// such as the promise reactions and timers, have none.
+func EvalOrigin(origin string) EvalOption {
+	return func(flags *EvalOptions) {
+		flags.origin = origin
 	}
+}
 
-	cFlag := C.int(0)
-	if options.js_eval_type_global {
-		cFlag |= C.JS_EVAL_TYPE_GLOBAL
+// withOrigin makes the origin the one of the code run until the returned function is called; an empty origin keeps the current one.
+func (ctx *Context) withOrigin(origin string) func() {
+	outer := ctx.origin
+	if origin != "" {
+		ctx.origin = origin
 	}
-	if options.js_eval_type_module {
-		cFlag |= C.JS_EVAL_TYPE_MODULE
+	return func() { ctx.origin = outer }
+}
+
+// originOf returns the origin of the code evaluated with the options.
+func (ctx *Context) originOf(options EvalOptions) string {
+	if options.origin != "" {
+		return options.origin
 	}
-	if options.js_eval_flag_strict {
-		cFlag |= C.JS_EVAL_FLAG_STRICT
+	return ctx.origin
+}
+
+// Eval returns a js value with given code.
+// Need call Free() `quickjs.Value`'s returned by `Eval()` and `EvalFile()` and `EvalBytecode()`.
+// func (ctx *Context) Eval(code string) (Value, error) { return ctx.EvalFile(code, "code") }
+func (ctx *Context) Eval(code string, opts ...EvalOption) (val Value, err error) {
+	if t := ctx.runtime.thread; t.remote() {
+		t.do(func() { val, err = ctx.Eval(code, opts...) })
+		return val, err
 	}
-	if options.js_eval_flag_strip {
-		cFlag |= C.JS_EVAL_FLAG_STRIP
+	if err := ctx.checkGoroutine(); err != nil {
+		return ctx.Undefined(), err
 	}
-	if options.js_eval_flag_compile_only {
-		cFlag |= C.JS_EVAL_FLAG_COMPILE_ONLY
+	opts = ctx.strictOptions(opts)
+	options := newEvalOptions(opts)
+	info := EvalInfo{Context: ctx, Filename: options.filename, Origin: ctx.originOf(options), Compile: options.flags()&C.JS_EVAL_FLAG_COMPILE_ONLY != 0}
+	return observeEval(info, func(info *EvalInfo) (Value, error) {
+		return ctx.evalCode(code, &info.CacheHit, opts...)
+	})
+}
+
+// eval is Eval without the goroutine check and the hooks, for the scripts run by the package itself.
+func (ctx *Context) eval(code string, opts ...EvalOption) (Value, error) {
+	return ctx.evalCode(code, nil, opts...)
+}
+
+// evalCode evaluates the code, reporting in cacheHit, if not nil, whether the bytecode cache was hit.
+func (ctx *Context) evalCode(code string, cacheHit *bool, opts ...EvalOption) (Value, error) {
+	return ctx.evalIn(ctx.ref, code, cacheHit, opts...)
+}
+
+// evalIn is evalCode in the global environment of the JSContext, the one of the context or of one of its realms;
+// the bytecode cache is only used for the context.
+func (ctx *Context) evalIn(ref *C.JSContext, code string, cacheHit *bool, opts ...EvalOption) (Value, error) {
+	if ctx.setupErr != nil {
+		return ctx.Undefined(), ctx.setupErr
 	}
+	defer ctx.enter()()
+	ctx.FreePending()
+
+	options := newEvalOptions(opts)
+	defer ctx.withOrigin(options.origin)()
+	cFlag := options.flags()
 
 	codePtr := C.CString(code)
 	defer C.free(unsafe.Pointer(codePtr))
@@ -338,12 +642,21 @@ func (ctx *Context) Eval(code string, opts ...EvalOption) (Value, error) {
 		cFlag |= C.JS_EVAL_TYPE_MODULE
 	}
 
-	var val Value
-	if options.await {
-		val = Value{ctx: ctx, ref: C.js_std_await(ctx.ref, C.JS_Eval(ctx.ref, codePtr, C.size_t(len(code)), filenamePtr, cFlag))}
+	var ret C.JSValue
+	if ctx.bytecodeCache != nil && ref == ctx.ref && cFlag&(C.JS_EVAL_TYPE_MODULE|C.JS_EVAL_FLAG_COMPILE_ONLY) == 0 {
+		var hit bool
+		ret, hit = ctx.evalCached(code, codePtr, options.filename, filenamePtr, cFlag)
+		if cacheHit != nil {
+			*cacheHit = hit
+		}
 	} else {
-		val = Value{ctx: ctx, ref: C.JS_Eval(ctx.ref, codePtr, C.size_t(len(code)), filenamePtr, cFlag)}
+		ret = C.JS_Eval(ref, codePtr, C.size_t(len(code)), filenamePtr, cFlag)
 	}
+	if options.await {
+		ret = ctx.await(ret)
+	}
+
+	val := ctx.newValue(ret)
 	if val.IsException() {
 		return val, ctx.Exception()
 	}
@@ -364,6 +677,10 @@ func (ctx *Context) EvalFile(filePath string, opts ...EvalOption) (Value, error)
 
 // LoadModule returns a js value with given code and module name.
 func (ctx *Context) LoadModule(code string, moduleName string) (Value, error) {
+	if err := ctx.checkGoroutine(); err != nil {
+		return ctx.Undefined(), err
+	}
+	defer ctx.enter()()
 	codePtr := C.CString(code)
 	defer C.free(unsafe.Pointer(codePtr))
 
@@ -372,6 +689,9 @@ func (ctx *Context) LoadModule(code string, moduleName string) (Value, error) {
 
 	cFlag := C.JS_EVAL_TYPE_MODULE | C.JS_EVAL_FLAG_COMPILE_ONLY
 	cVal := C.JS_Eval(ctx.ref, codePtr, C.size_t(len(code)), filenamePtr, C.int(cFlag))
+	if C.JS_IsException(cVal) == 1 {
+		return ctx.Null(), ctx.Exception()
+	}
 	if C.ValueGetTag(cVal) != C.JS_TAG_MODULE {
 		return ctx.Null(), fmt.Errorf("not a module")
 	}
@@ -380,9 +700,9 @@ func (ctx *Context) LoadModule(code string, moduleName string) (Value, error) {
 		return ctx.Null(), fmt.Errorf("resolve module failed")
 	}
 	C.js_module_set_import_meta(ctx.ref, cVal, 0, 1)
-	cVal = C.js_std_await(ctx.ref, cVal)
+	cVal = ctx.await(cVal)
 
-	return Value{ctx: ctx, ref: cVal}, nil
+	return ctx.newValue(cVal), nil
 }
 
 // LoadModuleFile returns a js value with given file path and module name.
@@ -401,7 +721,20 @@ func (ctx *Context) CompileModule(filePath string, moduleName string, opts ...Ev
 }
 
 // LoadModuleByteCode returns a js value with given bytecode and module name.
+// The bytecode must have been produced by CompileModule; bytecode from another engine version returns ErrBytecodeVersionMismatch.
 func (ctx *Context) LoadModuleBytecode(buf []byte) (Value, error) {
+	if err := ctx.checkGoroutine(); err != nil {
+		return ctx.Undefined(), err
+	}
+	defer ctx.enter()()
+	buf, module, err := unwrapBytecode(buf)
+	if err != nil {
+		return ctx.Null(), err
+	}
+	if !module {
+		return ctx.Null(), fmt.Errorf("not a module")
+	}
+
 	cbuf := C.CBytes(buf)
 	cVal := C.JS_ReadObject(ctx.ref, (*C.uint8_t)(cbuf), C.size_t(len(buf)), C.JS_READ_OBJ_BYTECODE)
 	defer C.js_free(ctx.ref, unsafe.Pointer(cbuf))
@@ -416,22 +749,32 @@ func (ctx *Context) LoadModuleBytecode(buf []byte) (Value, error) {
 		return ctx.Null(), fmt.Errorf("resolve module failed")
 	}
 	C.js_module_set_import_meta(ctx.ref, cVal, 0, 1)
-	cVal = C.js_std_await(ctx.ref, cVal)
+	cVal = ctx.await(cVal)
 
-	return Value{ctx: ctx, ref: cVal}, nil
+	return ctx.newValue(cVal), nil
 }
 
 // EvalBytecode returns a js value with given bytecode.
 // Need call Free() `quickjs.Value`'s returned by `Eval()` and `EvalFile()` and `EvalBytecode()`.
+// The bytecode must have been produced by Compile; bytecode from another engine version returns ErrBytecodeVersionMismatch.
 func (ctx *Context) EvalBytecode(buf []byte) (Value, error) {
+	if err := ctx.checkGoroutine(); err != nil {
+		return ctx.Undefined(), err
+	}
+	defer ctx.enter()()
+	buf, _, err := unwrapBytecode(buf)
+	if err != nil {
+		return ctx.Null(), err
+	}
+
 	cbuf := C.CBytes(buf)
-	obj := Value{ctx: ctx, ref: C.JS_ReadObject(ctx.ref, (*C.uint8_t)(cbuf), C.size_t(len(buf)), C.JS_READ_OBJ_BYTECODE)}
+	obj := ctx.borrow(C.JS_ReadObject(ctx.ref, (*C.uint8_t)(cbuf), C.size_t(len(buf)), C.JS_READ_OBJ_BYTECODE))
 	defer C.js_free(ctx.ref, unsafe.Pointer(cbuf))
 	if obj.IsException() {
 		return obj, ctx.Exception()
 	}
 
-	val := Value{ctx: ctx, ref: C.JS_EvalFunction(ctx.ref, obj.ref)}
+	val := ctx.newValue(C.JS_EvalFunction(ctx.ref, obj.ref))
 	if val.IsException() {
 		return val, ctx.Exception()
 	}
@@ -440,9 +783,34 @@ func (ctx *Context) EvalBytecode(buf []byte) (Value, error) {
 }
 
 // Compile returns a compiled bytecode with given code.
+// The bytecode is prefixed with a header recording the engine version, which EvalBytecode and LoadModuleBytecode validate.
+// If a bytecode cache is set, the bytecode is looked up in and stored to the cache.
 func (ctx *Context) Compile(code string, opts ...EvalOption) ([]byte, error) {
-	opts = append(opts, EvalFlagCompileOnly(true))
-	val, err := ctx.Eval(code, opts...)
+	opts = append(ctx.strictOptions(opts), EvalFlagCompileOnly(true))
+	options := newEvalOptions(opts)
+	info := EvalInfo{Context: ctx, Filename: options.filename, Origin: ctx.originOf(options), Compile: true}
+	return observeEval(info, func(info *EvalInfo) ([]byte, error) {
+		return ctx.compile(code, &info.CacheHit, opts...)
+	})
+}
+
+// compile compiles the code for Compile, reporting in cacheHit whether the bytecode cache was hit.
+func (ctx *Context) compile(code string, cacheHit *bool, opts ...EvalOption) ([]byte, error) {
+	var key string
+	if ctx.bytecodeCache != nil {
+		options := newEvalOptions(opts)
+		key = BytecodeCacheKey(code, options.filename, int(options.flags()&^C.JS_EVAL_FLAG_COMPILE_ONLY))
+		if buf, ok := ctx.bytecodeCache.Get(key); ok {
+			*cacheHit = true
+			// the caller owns the bytecode returned, which must not alias the cached one
+			return append([]byte(nil), buf...), nil
+		}
+	}
+
+	if err := ctx.checkGoroutine(); err != nil {
+		return nil, err
+	}
+	val, err := ctx.eval(code, opts...)
 	if err != nil {
 		return nil, err
 	}
@@ -455,8 +823,11 @@ func (ctx *Context) Compile(code string, opts ...EvalOption) ([]byte, error) {
 		return nil, ctx.Exception()
 	}
 
-	ret := make([]byte, C.int(kSize))
-	copy(ret, C.GoBytes(unsafe.Pointer(ptr), C.int(kSize)))
+	ret := wrapBytecode(C.GoBytes(unsafe.Pointer(ptr), C.int(kSize)), C.ValueGetTag(val.ref) == C.JS_TAG_MODULE)
+
+	if ctx.bytecodeCache != nil {
+		ctx.bytecodeCache.Put(key, ret)
+	}
 
 	return ret, nil
 }
@@ -479,20 +850,19 @@ func (ctx *Context) CompileFile(filePath string, opts ...EvalOption) ([]byte, er
 	return ctx.Compile(string(b), opts...)
 }
 
-// Global returns a context's global object.
+// Globals returns a context's global object, which the context owns: it must not be freed.
 func (ctx *Context) Globals() Value {
 	if ctx.globals == nil {
-		ctx.globals = &Value{
-			ctx: ctx,
-			ref: C.JS_GetGlobalObject(ctx.ref),
-		}
+		globals := ctx.hold(C.JS_GetGlobalObject(ctx.ref))
+		ctx.globals = &globals
 	}
 	return *ctx.globals
 }
 
-// Throw returns a context's exception value.
+// Throw returns a context's exception value, taking ownership of v.
 func (ctx *Context) Throw(v Value) Value {
-	return Value{ctx: ctx, ref: C.JS_Throw(ctx.ref, v.ref)}
+	v.untrack()
+	return ctx.newValue(C.JS_Throw(ctx.ref, v.ref))
 }
 
 // ThrowError returns a context's exception value with given error message.
@@ -505,7 +875,7 @@ func (ctx *Context) ThrowSyntaxError(format string, args ...interface{}) Value {
 	cause := fmt.Sprintf(format, args...)
 	causePtr := C.CString(cause)
 	defer C.free(unsafe.Pointer(causePtr))
-	return Value{ctx: ctx, ref: C.ThrowSyntaxError(ctx.ref, causePtr)}
+	return ctx.newValue(C.ThrowSyntaxError(ctx.ref, causePtr))
 }
 
 // ThrowTypeError returns a context's exception value with given error message.
@@ -513,7 +883,7 @@ func (ctx *Context) ThrowTypeError(format string, args ...interface{}) Value {
 	cause := fmt.Sprintf(format, args...)
 	causePtr := C.CString(cause)
 	defer C.free(unsafe.Pointer(causePtr))
-	return Value{ctx: ctx, ref: C.ThrowTypeError(ctx.ref, causePtr)}
+	return ctx.newValue(C.ThrowTypeError(ctx.ref, causePtr))
 }
 
 // ThrowReferenceError returns a context's exception value with given error message.
@@ -521,7 +891,7 @@ func (ctx *Context) ThrowReferenceError(format string, args ...interface{}) Valu
 	cause := fmt.Sprintf(format, args...)
 	causePtr := C.CString(cause)
 	defer C.free(unsafe.Pointer(causePtr))
-	return Value{ctx: ctx, ref: C.ThrowReferenceError(ctx.ref, causePtr)}
+	return ctx.newValue(C.ThrowReferenceError(ctx.ref, causePtr))
 }
 
 // ThrowRangeError returns a context's exception value with given error message.
@@ -529,7 +899,7 @@ func (ctx *Context) ThrowRangeError(format string, args ...interface{}) Value {
 	cause := fmt.Sprintf(format, args...)
 	causePtr := C.CString(cause)
 	defer C.free(unsafe.Pointer(causePtr))
-	return Value{ctx: ctx, ref: C.ThrowRangeError(ctx.ref, causePtr)}
+	return ctx.newValue(C.ThrowRangeError(ctx.ref, causePtr))
 }
 
 // ThrowInternalError returns a context's exception value with given error message.
@@ -537,24 +907,64 @@ func (ctx *Context) ThrowInternalError(format string, args ...interface{}) Value
 	cause := fmt.Sprintf(format, args...)
 	causePtr := C.CString(cause)
 	defer C.free(unsafe.Pointer(causePtr))
-	return Value{ctx: ctx, ref: C.ThrowInternalError(ctx.ref, causePtr)}
+	return ctx.newValue(C.ThrowInternalError(ctx.ref, causePtr))
 }
 
-// Exception returns a context's exception value.
+// Exception takes a context's exception value as an *Error, whatever the type of the thrown value; it returns nil if no exception is pending.
 func (ctx *Context) Exception() error {
-	val := Value{ctx: ctx, ref: C.JS_GetException(ctx.ref)}
+	defer ctx.liftMemoryLimit()()
+	val := ctx.newValue(C.JS_GetException(ctx.ref))
 	defer val.Free()
-	return val.Error()
+	if val.IsUninitialized() {
+		return nil
+	}
+	return ctx.observeException(val.toError())
 }
 
-// Loop runs the context's event loop.
+// Loop runs the jobs queued by Schedule and EvalAsync, then the context's event loop.
+// It also waits for the reads and writes of streams in progress, see NewReadableStreamSize.
 func (ctx *Context) Loop() {
-	C.js_std_loop(ctx.ref)
+	if t := ctx.runtime.thread; t.remote() {
+		t.do(ctx.Loop)
+		return
+	}
+	defer ctx.enter()()
+	ctx.FreePending()
+	ctx.runJobs()
+	for {
+		for ctx.executePendingJob() {
+		}
+		C.js_std_loop(ctx.ref)
+		if ctx.fireVirtualTimer() {
+			continue
+		}
+		if atomic.LoadInt64(&ctx.streamOps) == 0 {
+			return
+		}
+		j, ok := ctx.jobQueue.next()
+		if !ok {
+			return
+		}
+		j.run(ctx)
+		ctx.runJobs()
+	}
 }
 
 // Wait for a promise and execute pending jobs while waiting for it. Return the promise result or JS_EXCEPTION in case of promise rejection.
-func (ctx *Context) Await(v Value) (Value, error) {
-	val := Value{ctx: ctx, ref: C.js_std_await(ctx.ref, v.ref)}
+// While the promise is pending, it runs the promise jobs, the jobs queued by Schedule and the timers in turn, so that none starves the others;
+// when none is ready, it waits for the next timer or scheduled job, so a promise which nothing settles blocks it unless AwaitMaxIterations is given.
+// It takes ownership of v.
+func (ctx *Context) Await(v Value, opts ...AwaitOption) (val Value, err error) {
+	if t := ctx.runtime.thread; t.remote() {
+		t.do(func() { val, err = ctx.Await(v, opts...) })
+		return val, err
+	}
+	if err := ctx.checkGoroutine(); err != nil {
+		return ctx.Undefined(), err
+	}
+	defer ctx.enter()()
+	ctx.FreePending()
+	val = ctx.newValue(ctx.awaitWith(v.ref, ctx.newAwaitOptions(opts)))
 	if val.IsException() {
 		return val, ctx.Exception()
 	}
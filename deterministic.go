@@ -0,0 +1,147 @@
+package quickjs
+
+/*
+#include "bridge.h"
+*/
+import "C"
+import (
+	"fmt"
+	"math/rand"
+	"os"
+	"time"
+)
+
+// DeterministicMode makes the scripts of a runtime's contexts replayable byte for byte, see WithDeterministicMode.
+type DeterministicMode struct {
+	// Seed seeds the Math.random generator of each context, overriding WithRandomSource.
+	Seed int64
+	// Start is the time of the virtual clock of each new context; the zero Time starts it at the Unix epoch.
+	Start time.Time
+}
+
+// WithDeterministicMode will run the runtime's contexts on a virtual clock with a seeded Math.random, so that a script run
+// twice with the same inputs behaves the same, as rules engines and replicated state machines require:
+//
+//   - Date.now, new Date() and Date() read the virtual clock, and performance.now the virtual time elapsed since the context was created;
+//     the clock only moves by AdvanceClock or by firing timers.
+//   - setTimeout schedules virtual timers, fired in order of due time, then of creation, by Loop, Await and EvalAwait:
+//     when no job is left they advance the clock to the next timer at once instead of waiting for it.
+//   - Math.random returns the numbers of a generator seeded with the Seed, see SetRandomSource.
+//
+// The order of properties, promise jobs and collections is already deterministic in the engine. The mode does not cover
+// what the host brings in: the jobs scheduled from other goroutines, see Schedule, the os and std modules, nor the time zone
+// of the host, which the local-time methods of Date depend on; the UTC methods do not.
+func WithDeterministicMode(mode DeterministicMode) Option {
+	return func(o *Options) {
+		o.deterministic = &mode
+	}
+}
+
+// virtualClock is the clock of a deterministic context.
+type virtualClock struct {
+	start, now time.Time
+}
+
+// deterministicScript returns the function replacing Date, setTimeout and clearTimeout by their virtual versions
+// and defining performance.now, given the Go functions returning the virtual time in milliseconds since the epoch,
+// and elapsed since the context was created.
+const deterministicScript = `((clock, elapsed) => {
+	const OriginalDate = Date;
+	const VirtualDate = function Date(...args) {
+		if (new.target === undefined) {
+			return new OriginalDate(clock()).toString();
+		}
+		return Reflect.construct(OriginalDate, args.length === 0 ? [clock()] : args, new.target);
+	};
+	Object.defineProperty(VirtualDate, "prototype", { value: OriginalDate.prototype });
+	Object.defineProperty(VirtualDate, "length", { value: 7 });
+	for (const name of ["parse", "UTC"]) {
+		Object.defineProperty(VirtualDate, name, { value: OriginalDate[name], writable: true, configurable: true });
+	}
+	Object.defineProperty(VirtualDate, "now", { value: function now() { return clock(); }, writable: true, configurable: true });
+	Object.defineProperty(OriginalDate.prototype, "constructor", { value: VirtualDate, writable: true, configurable: true });
+	Object.defineProperty(globalThis, "Date", { value: VirtualDate, writable: true, configurable: true });
+
+	Object.defineProperty(globalThis, "performance", { value: { now: elapsed }, writable: true, configurable: true });
+
+	// the timers are kept by the wrapper of wrapTimersScript, which fires them
+	let seq = 0;
+	globalThis.setTimeout = function setTimeout(func) {
+		if (typeof func !== "function") {
+			throw new TypeError("not a function");
+		}
+		return ++seq;
+	};
+	globalThis.clearTimeout = function clearTimeout(timer) {};
+})`
+
+// setupDeterministic installs the virtual clock of a deterministic context, before the timers are wrapped.
+func (ctx *Context) setupDeterministic() error {
+	if ctx.clock == nil {
+		return nil
+	}
+	install, err := ctx.eval(deterministicScript, EvalFileName("<deterministic>"))
+	if err != nil {
+		return err
+	}
+	defer install.Free()
+
+	clock := ctx.NamedFunction("clock", 0, func(ctx *Context, this Value, args []Value) Value {
+		return ctx.Int64(ctx.clock.now.UnixMilli())
+	})
+	elapsed := ctx.NamedFunction("now", 0, func(ctx *Context, this Value, args []Value) Value {
+		return ctx.Float64(float64(ctx.clock.now.Sub(ctx.clock.start)) / float64(time.Millisecond))
+	})
+	defer clock.Free()
+	defer elapsed.Free()
+
+	ret := ctx.Invoke(install, ctx.Null(), clock, elapsed)
+	defer ret.Free()
+	if ret.IsException() {
+		return ctx.exceptionError()
+	}
+	return nil
+}
+
+// newDeterministic makes the context deterministic in the mode.
+func (ctx *Context) newDeterministic(mode *DeterministicMode) {
+	start := mode.Start
+	if start.IsZero() {
+		start = time.UnixMilli(0)
+	}
+	ctx.clock = &virtualClock{start: start, now: start}
+	ctx.randomSource = rand.New(rand.NewSource(mode.Seed)).Float64
+}
+
+// Now returns the time of the context: the time of its virtual clock with WithDeterministicMode, or else the current time.
+func (ctx *Context) Now() time.Time {
+	if ctx.clock == nil {
+		return time.Now()
+	}
+	return ctx.clock.now
+}
+
+// AdvanceClock moves the virtual clock of a deterministic context forward by d, without firing the timers now due,
+// which the next Loop fires; it does nothing unless the runtime was created WithDeterministicMode.
+func (ctx *Context) AdvanceClock(d time.Duration) {
+	if ctx.clock != nil && d > 0 {
+		ctx.clock.now = ctx.clock.now.Add(d)
+	}
+}
+
+// fireVirtualTimer advances the virtual clock of a deterministic context to its next timer and fires it, reporting whether
+// there was one; like the event loop, it prints the exceptions left unhandled by SetUncaughtExceptionHandler.
+func (ctx *Context) fireVirtualTimer() bool {
+	if ctx.clock == nil {
+		return false
+	}
+	delay, ok := ctx.nextTimer()
+	if !ok {
+		return false
+	}
+	ctx.AdvanceClock(delay)
+	if err := ctx.fireTimer(); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+	}
+	return true
+}
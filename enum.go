@@ -0,0 +1,139 @@
+package quickjs
+
+/*
+#include "bridge.h"
+*/
+import "C"
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"strconv"
+	"unsafe"
+)
+
+// integer is the constraint of the Go types of enums.
+type integer interface {
+	~int | ~int8 | ~int16 | ~int32 | ~int64 | ~uint | ~uint8 | ~uint16 | ~uint32 | ~uint64
+}
+
+// enumMembers are the names and values of an enum given to UnmarshalEnum.
+type enumMembers struct {
+	values map[string]int64
+	names  map[int64]string
+}
+
+// NewEnum returns a frozen object mapping the names of the members to their values and back, like TypeScript enums:
+// for members {"Red": 0, "Green": 1} the object is {Red: 0, Green: 1, 0: "Red", 1: "Green"}.
+// The members are a map from names to values of any integer type, or a []string numbering the names from 0.
+// Of several names with the same value, the reverse mapping holds the first in alphabetical order.
+func (ctx *Context) NewEnum(members interface{}) (Value, error) {
+	values, err := enumValues(members)
+	if err != nil {
+		return ctx.Undefined(), err
+	}
+
+	names := make([]string, 0, len(values))
+	for name := range values {
+		names = append(names, name)
+	}
+	sort.Slice(names, func(i, j int) bool {
+		return values[names[i]] < values[names[j]] || values[names[i]] == values[names[j]] && names[i] < names[j]
+	})
+
+	obj := ctx.Object()
+	for _, name := range names {
+		value := values[name]
+		ctx.defineFrozen(obj, name, ctx.Int64(value))
+		ctx.defineFrozen(obj, strconv.FormatInt(value, 10), ctx.String(name))
+	}
+	C.JS_PreventExtensions(ctx.ref, obj.ref)
+	return obj, nil
+}
+
+// enumValues converts the members of NewEnum to a map from names to values.
+func enumValues(members interface{}) (map[string]int64, error) {
+	if names, ok := members.([]string); ok {
+		values := make(map[string]int64, len(names))
+		for i, name := range names {
+			if _, ok := values[name]; ok {
+				return nil, fmt.Errorf("quickjs: duplicate enum member %s", name)
+			}
+			values[name] = int64(i)
+		}
+		return values, nil
+	}
+
+	rv := reflect.ValueOf(members)
+	if rv.Kind() != reflect.Map || rv.Type().Key().Kind() != reflect.String {
+		return nil, fmt.Errorf("quickjs: cannot make an enum of %T", members)
+	}
+	values := make(map[string]int64, rv.Len())
+	iter := rv.MapRange()
+	for iter.Next() {
+		value := iter.Value()
+		switch value.Kind() {
+		case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+			values[iter.Key().String()] = value.Int()
+		case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+			if value.Uint() > maxSafeInteger {
+				return nil, fmt.Errorf("quickjs: enum member %s is out of range", iter.Key().String())
+			}
+			values[iter.Key().String()] = int64(value.Uint())
+		default:
+			return nil, fmt.Errorf("quickjs: cannot make an enum of %T", members)
+		}
+	}
+	return values, nil
+}
+
+// defineFrozen defines an enumerable, non-writable and non-configurable property of the object, taking ownership of val.
+func (ctx *Context) defineFrozen(obj Value, name string, val Value) {
+	namePtr := C.CString(name)
+	defer C.free(unsafe.Pointer(namePtr))
+	val.untrack()
+	C.JS_DefinePropertyValueStr(ctx.ref, obj.ref, namePtr, val.ref, C.JS_PROP_ENUMERABLE)
+}
+
+// UnmarshalEnum makes Unmarshal convert to the type T the members of the enum, given either by name or by value,
+// e.g. "Green" or 1 for members {"Red": 0, "Green": 1}; other values fail to unmarshal.
+func UnmarshalEnum[T integer](members map[string]T) UnmarshalOption {
+	enum := &enumMembers{values: make(map[string]int64, len(members)), names: make(map[int64]string, len(members))}
+	for name, value := range members {
+		enum.values[name] = int64(value)
+		enum.names[int64(value)] = name
+	}
+	return func(options *UnmarshalOptions) {
+		if options.enums == nil {
+			options.enums = make(map[reflect.Type]*enumMembers)
+		}
+		options.enums[reflect.TypeOf(T(0))] = enum
+	}
+}
+
+// unmarshalEnum stores in rv the member of the enum given by the value.
+func (v Value) unmarshalEnum(rv reflect.Value, enum *enumMembers) error {
+	var value int64
+	switch {
+	case v.IsString():
+		var ok bool
+		if value, ok = enum.values[v.String()]; !ok {
+			return fmt.Errorf("quickjs: %q is not a member of enum %s", v.String(), rv.Type())
+		}
+	case v.IsNumber():
+		f := v.Float64()
+		value = int64(f)
+		if _, ok := enum.names[value]; !ok || float64(value) != f {
+			return fmt.Errorf("quickjs: %v is not a member of enum %s", f, rv.Type())
+		}
+	default:
+		return v.unmarshalTypeError(rv.Type())
+	}
+
+	if rv.CanInt() {
+		rv.SetInt(value)
+	} else {
+		rv.SetUint(uint64(value))
+	}
+	return nil
+}
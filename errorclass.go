@@ -0,0 +1,65 @@
+package quickjs
+
+// errorClassScript creates a subclass of Error named after its argument.
+const errorClassScript = `(name) => {
+	const cls = class extends Error {};
+	Object.defineProperty(cls, "name", { value: name, configurable: true });
+	Object.defineProperty(cls.prototype, "name", { value: name, writable: true, configurable: true });
+	return cls;
+}`
+
+// NewErrorClass defines a global subclass of Error with the name, e.g. "QuotaError", and returns its constructor, which must be freed.
+// Scripts can construct and catch its errors with instanceof, and Go code can throw them with ThrowCustomError.
+// Like other globals, the class is dropped by Reset.
+func (ctx *Context) NewErrorClass(name string) (Value, error) {
+	factory, err := ctx.eval(errorClassScript, EvalFileName("<error class>"))
+	if err != nil {
+		return ctx.Undefined(), err
+	}
+	defer factory.Free()
+
+	nameVal := ctx.String(name)
+	defer nameVal.Free()
+	cls := ctx.Invoke(factory, ctx.Null(), nameVal)
+	if cls.IsException() {
+		return cls, ctx.exceptionError()
+	}
+
+	if ctx.errorClasses == nil {
+		ctx.errorClasses = make(map[string]Value)
+	}
+	if old, ok := ctx.errorClasses[name]; ok {
+		old.Free()
+	}
+	// the registry belongs to the context, so it is not reported as a leak
+	stored := cls.dup()
+	stored.keep()
+	ctx.errorClasses[name] = stored
+	ctx.Globals().Set(name, cls.dup())
+	return cls, nil
+}
+
+// ThrowCustomError returns a context's exception value with an error of the class defined by NewErrorClass,
+// with the message and the properties converted by Marshal, e.g. the limit that was exceeded.
+func (ctx *Context) ThrowCustomError(name string, message string, props map[string]interface{}) Value {
+	cls, ok := ctx.errorClasses[name]
+	if !ok {
+		return ctx.ThrowTypeError("quickjs: error class %s is not defined", name)
+	}
+
+	msg := ctx.String(message)
+	defer msg.Free()
+	err := cls.CallConstructor(msg)
+	if err.IsException() {
+		return err
+	}
+	for _, key := range sortedKeys(props) {
+		val, marshalErr := ctx.Marshal(props[key])
+		if marshalErr != nil {
+			err.Free()
+			return ctx.ThrowTypeError("%s: %s", key, marshalErr)
+		}
+		err.Set(key, val)
+	}
+	return ctx.Throw(err)
+}
@@ -0,0 +1,176 @@
+package quickjs
+
+import (
+	"errors"
+	"sync"
+)
+
+// eventEmitterScript returns the emitter object shared by Go and scripts, with the usual on, once, off, emit and listenerCount methods.
+const eventEmitterScript = `(() => {
+	const listeners = new Map();
+	const emitter = {
+		on(event, listener) {
+			if (typeof listener !== "function") {
+				throw new TypeError("listener is not a function");
+			}
+			if (!listeners.has(event)) {
+				listeners.set(event, []);
+			}
+			listeners.get(event).push(listener);
+			return emitter;
+		},
+		once(event, listener) {
+			const wrapper = function (...args) {
+				emitter.off(event, wrapper);
+				return listener.apply(this, args);
+			};
+			wrapper.listener = listener;
+			return emitter.on(event, wrapper);
+		},
+		off(event, listener) {
+			const list = listeners.get(event);
+			if (list) {
+				const i = list.findIndex((l) => l === listener || l.listener === listener);
+				if (i >= 0) {
+					list.splice(i, 1);
+				}
+				if (list.length === 0) {
+					listeners.delete(event);
+				}
+			}
+			return emitter;
+		},
+		emit(event, ...args) {
+			const list = listeners.get(event);
+			if (!list) {
+				return false;
+			}
+			for (const listener of [...list]) {
+				listener.apply(emitter, args);
+			}
+			return true;
+		},
+		listenerCount(event) {
+			const list = listeners.get(event);
+			return list ? list.length : 0;
+		},
+	};
+	return emitter;
+})()`
+
+// EventEmitter is an event emitter shared by Go and scripts, so that host code can publish events, e.g. a configuration change,
+// which scripts subscribe to, and the other way around. Scripts use the object returned by Value, with the methods
+// on(event, listener), once(event, listener), off(event, listener), emit(event, ...args) and listenerCount(event).
+type EventEmitter struct {
+	ctx *Context
+	obj Value
+
+	mu      sync.Mutex
+	pending int // the emits scheduled and not run yet, which keep the object alive
+	freed   bool
+}
+
+// NewEventEmitter returns a new event emitter, which must be freed.
+func (ctx *Context) NewEventEmitter() (*EventEmitter, error) {
+	obj, err := ctx.eval(eventEmitterScript, EvalFileName("<events>"))
+	if err != nil {
+		return nil, err
+	}
+	return &EventEmitter{ctx: ctx, obj: obj}, nil
+}
+
+// Value returns a new reference to the object of the emitter, e.g. to define it as a global with Set.
+func (e *EventEmitter) Value() Value {
+	return e.obj.dup()
+}
+
+// On registers fn as a listener of the event, called on the goroutine of the context with the arguments of emit,
+// and returns the function removing it. On and the returned function must be called from the goroutine of the context.
+func (e *EventEmitter) On(event string, fn func(ctx *Context, args []Value)) (off func(), err error) {
+	listener := e.ctx.Function(func(ctx *Context, this Value, args []Value) Value {
+		fn(ctx, args)
+		return ctx.Undefined()
+	})
+	if err := e.call("on", event, listener); err != nil {
+		listener.Free()
+		return nil, err
+	}
+	return func() {
+		if listener.ctx == nil {
+			return
+		}
+		e.call("off", event, listener)
+		listener.Free()
+		listener = Value{}
+	}, nil
+}
+
+// Emit schedules the call of the listeners of the event with the arguments converted by Marshal, see Schedule,
+// so it may be called from any goroutine. It returns the error of Schedule; the exceptions thrown by the listeners
+// are reported like those of setTimeout callbacks, see SetUncaughtExceptionHandler.
+func (e *EventEmitter) Emit(event string, args ...interface{}) error {
+	e.mu.Lock()
+	if e.freed {
+		e.mu.Unlock()
+		return errors.New("quickjs: event emitter freed")
+	}
+	e.pending++
+	e.mu.Unlock()
+
+	err := e.ctx.schedule(job{
+		run: func(ctx *Context) {
+			defer e.release()
+			emit := e.obj.Get("emit")
+			defer emit.Free()
+			err := emit.CallInto(nil, &e.obj, append([]interface{}{event}, args...)...)
+			if err != nil {
+				jsErr, ok := err.(*Error)
+				if !ok {
+					jsErr = &Error{Cause: err.Error(), Err: err}
+				}
+				ctx.reportUncaught(jsErr)
+			}
+		},
+		cancel: func(error) { e.release() },
+	}, nil)
+	if err != nil {
+		e.release()
+	}
+	return err
+}
+
+// release ends a pending emit, freeing the object if the emitter was freed meanwhile.
+func (e *EventEmitter) release() {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.pending--
+	if e.freed && e.pending == 0 {
+		e.obj.Free()
+	}
+}
+
+// Free frees the emitter once its pending emits are run or dropped; the listeners registered by scripts remain
+// until the object of the emitter is collected. Free must be called from the goroutine of the context.
+func (e *EventEmitter) Free() {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if e.freed {
+		return
+	}
+	e.freed = true
+	if e.pending == 0 {
+		e.obj.Free()
+	}
+}
+
+// call calls the method of the emitter with the event and the listener.
+func (e *EventEmitter) call(method, event string, listener Value) error {
+	name := e.ctx.String(event)
+	defer name.Free()
+	ret := e.obj.Call(method, name, listener)
+	defer ret.Free()
+	if ret.IsException() {
+		return e.ctx.exceptionError()
+	}
+	return nil
+}
@@ -0,0 +1,194 @@
+package quickjs
+
+import (
+	"errors"
+	"time"
+)
+
+// defaultExprGlobals are the globals visible to expressions unless ExprGlobals is given.
+var defaultExprGlobals = []string{
+	"undefined", "NaN", "Infinity", "Math", "JSON", "Number", "String", "Boolean", "Array", "Object", "Date",
+	"parseInt", "parseFloat", "isNaN", "isFinite",
+}
+
+// exprRealmScript returns the function making the global object of the realm of an expression hold only its variables
+// and the allowed globals: the intrinsics of the realm, or else the globals of the context shared with it.
+// Code generation from strings is blocked first, as the Function constructors stay reachable from any function.
+// The global object is frozen last, so that assignments to the variables and globals throw in strict mode.
+const exprRealmScript = `((vars, allowed, shared) => {
+	const global = globalThis;
+	const { keys, defineProperty, freeze } = Object;
+	for (const key of Reflect.ownKeys(global)) {
+		if (!allowed.includes(key)) {
+			delete global[key];
+		}
+	}
+	for (const source of [shared, vars]) {
+		for (const key of keys(source)) {
+			defineProperty(global, key, { value: source[key], writable: true, enumerable: true, configurable: true });
+		}
+	}
+	freeze(global);
+})`
+
+type ExprOptions struct {
+	timeout time.Duration
+	globals []string
+}
+
+type ExprOption func(*ExprOptions)
+
+// ExprTimeout will bound the evaluation time of the expression; default is 1 second, use 0 for no limit.
+// The timeout is enforced by the context interrupt handler, besides the runtime's SetExecuteTimeout;
+// the handler set by SetContextInterruptHandler is still polled and is restored afterwards.
+func ExprTimeout(timeout time.Duration) ExprOption {
+	return func(options *ExprOptions) {
+		options.timeout = timeout
+	}
+}
+
+// ExprGlobals will set the globals visible to the expression besides its variables;
+// default is undefined, NaN, Infinity, Math, JSON, Number, String, Boolean, Array, Object, Date, parseInt, parseFloat, isNaN and isFinite.
+func ExprGlobals(names ...string) ExprOption {
+	return func(options *ExprOptions) {
+		options.globals = names
+	}
+}
+
+// EvalExpr evaluates the expression with the variables converted by Marshal, and returns its result converted by Unmarshal into T.
+// It covers evaluating user formulas: the expression runs in strict mode in a realm of its own, see NewRealm, whose global object
+// only holds the variables and the allowed globals and is frozen, so assignments to them fail; code generation from strings
+// is disabled and the evaluation is interrupted after the timeout. The allowed globals are the intrinsics of the realm,
+// or else the globals of the context of the same name, shared with their prototype chain like the variables, see Realm.Share;
+// the objects reachable from them are not restricted, so the expression should still not be trusted with sensitive state.
+func EvalExpr[T any](ctx *Context, expr string, vars map[string]interface{}, opts ...ExprOption) (T, error) {
+	var result T
+	options := &ExprOptions{timeout: time.Second, globals: defaultExprGlobals}
+	for _, fn := range opts {
+		fn(options)
+	}
+
+	if ctx.EvalEnabled() {
+		if err := ctx.SetEvalEnabled(false); err != nil {
+			return result, err
+		}
+		defer ctx.SetEvalEnabled(true)
+	}
+
+	if options.timeout > 0 {
+		deadline := time.Now().Add(options.timeout)
+		handler := ctx.interruptHandler
+		ctx.SetContextInterruptHandler(func(info InterruptInfo) int {
+			if time.Now().After(deadline) {
+				return 1
+			}
+			if handler != nil {
+				return handler(info)
+			}
+			return 0
+		})
+		defer ctx.SetContextInterruptHandler(handler)
+	}
+
+	if err := ctx.checkExpr(expr); err != nil {
+		return result, err
+	}
+	realm, err := ctx.exprRealm(vars, options.globals)
+	if err != nil {
+		return result, err
+	}
+	defer realm.Close()
+
+	// the expression is closed by a parenthesis on its own line, so a trailing comment cannot swallow it
+	fn, err := ctx.evalIn(realm.ref, exprWrapper("(", expr, ")"), nil, EvalFileName("<expr>"), EvalFlagStrict(true))
+	if err != nil {
+		return result, err
+	}
+	defer fn.Free()
+
+	ret := ctx.Invoke(fn, ctx.Undefined())
+	defer ret.Free()
+	if ret.IsException() {
+		err := ctx.exceptionError()
+		var jsErr *Error
+		if errors.As(err, &jsErr) && jsErr.Cause == "InternalError: interrupted" {
+			return result, errors.New("quickjs: expression timed out")
+		}
+		return result, err
+	}
+	err = ret.Unmarshal(&result)
+	return result, err
+}
+
+// exprWrapper returns the function evaluating the expression between the brackets.
+func exprWrapper(open, expr, close string) string {
+	return "(function () { return " + open + expr + "\n" + close + "; })"
+}
+
+// checkExpr checks that the expression cannot close the wrapper it is evaluated in, and run code outside of it.
+// It compiles the expression between square brackets instead of parentheses: the expression is tokenized the same way in both,
+// so it cannot end the bracket of the wrapper early in both, and an expression compiling in both is enclosed by the wrapper.
+func (ctx *Context) checkExpr(expr string) error {
+	ret, err := ctx.eval(exprWrapper("[", expr, "]"), EvalFileName("<expr>"), EvalFlagStrict(true), EvalFlagCompileOnly(true))
+	ret.Free()
+	return err
+}
+
+// exprRealm returns the realm evaluating an expression, see exprRealmScript.
+func (ctx *Context) exprRealm(vars map[string]interface{}, globals []string) (*Realm, error) {
+	realm, err := ctx.NewRealm()
+	if err != nil {
+		return nil, err
+	}
+	if err := ctx.exprSetup(realm, vars, globals); err != nil {
+		realm.Close()
+		return nil, err
+	}
+	return realm, nil
+}
+
+// exprSetup applies exprRealmScript to the realm.
+func (ctx *Context) exprSetup(realm *Realm, vars map[string]interface{}, globals []string) error {
+	restore, err := ctx.evalIn(realm.ref, blockCodegenScript, nil, EvalFileName("<codegen>"))
+	if err != nil {
+		return err
+	}
+	restore.Free()
+	setup, err := ctx.evalIn(realm.ref, exprRealmScript, nil, EvalFileName("<expr>"))
+	if err != nil {
+		return err
+	}
+	defer setup.Free()
+
+	jsVars, err := ctx.Marshal(vars)
+	if err != nil {
+		return err
+	}
+	if jsVars.IsNull() {
+		jsVars = ctx.Object()
+	}
+	defer jsVars.Free()
+	allowed, err := ctx.Marshal(append([]string{}, globals...))
+	if err != nil {
+		return err
+	}
+	defer allowed.Free()
+
+	realmGlobals := realm.Globals()
+	defer realmGlobals.Free()
+	shared := ctx.Object()
+	defer shared.Free()
+	contextGlobals := ctx.Globals()
+	for _, name := range globals {
+		if !realmGlobals.Has(name) && contextGlobals.Has(name) {
+			shared.Set(name, contextGlobals.Get(name))
+		}
+	}
+
+	ret := ctx.Invoke(setup, ctx.Null(), jsVars, allowed, shared)
+	defer ret.Free()
+	if ret.IsException() {
+		return ctx.exceptionError()
+	}
+	return nil
+}
@@ -0,0 +1,87 @@
+package quickjs
+
+// GlobalFallbackHandler provides the value of the undefined global of the name, reporting whether it does;
+// the context takes ownership of the value.
+type GlobalFallbackHandler func(name string) (*Value, bool)
+
+// fallbackScript returns the function inserting in the prototype chain of the global object a proxy asking the Go function
+// fallback(name, box) for the globals which are not defined: it stores the value in box.value and returns true if it provides one,
+// which is then defined as a global so that later references find it.
+const fallbackScript = `((fallback) => {
+	const target = Object.getPrototypeOf(globalThis);
+	const provide = (name) => {
+		if (typeof name !== "string") {
+			return false;
+		}
+		const box = {};
+		if (!fallback(name, box)) {
+			return false;
+		}
+		Object.defineProperty(globalThis, name, { value: box.value, writable: true, configurable: true });
+		return true;
+	};
+	Object.setPrototypeOf(globalThis, new Proxy(target, {
+		get(target, name, receiver) {
+			if (Reflect.has(target, name) || !provide(name)) {
+				return Reflect.get(target, name, receiver);
+			}
+			return globalThis[name];
+		},
+		has(target, name) {
+			return Reflect.has(target, name) || provide(name);
+		},
+	}));
+})`
+
+// SetGlobalFallbackHandler sets the handler called when a script references a global which is not defined,
+// e.g. to provide the binding of a host API only when a script first uses it: the value it provides is defined as a global,
+// so the handler is not called again for the name. Use nil to remove the handler; the globals it provided are kept.
+//
+// The handler is also called for the properties of globalThis which are not defined, e.g. globalThis.db, typeof db and "db" in globalThis.
+// As the engine cannot tell these apart from a plain reference, a name the handler does not provide evaluates to undefined instead of
+// throwing a ReferenceError; a handler may still provide the exception of Context.ThrowReferenceError, e.g. for a name close to a known one.
+// The handler is kept by Reset.
+func (ctx *Context) SetGlobalFallbackHandler(handler GlobalFallbackHandler) error {
+	ctx.globalFallback = handler
+	if handler == nil || ctx.globalFallbackInstalled {
+		return nil
+	}
+	return ctx.installGlobalFallback()
+}
+
+// installGlobalFallback evaluates fallbackScript.
+func (ctx *Context) installGlobalFallback() error {
+	install, err := ctx.eval(fallbackScript, EvalFileName("<fallback>"))
+	if err != nil {
+		return err
+	}
+	defer install.Free()
+
+	fallback := ctx.NamedFunction("fallback", 2, func(ctx *Context, this Value, args []Value) Value {
+		handler := ctx.globalFallback
+		if handler == nil {
+			return ctx.Bool(false)
+		}
+		val, ok := handler(args[0].String())
+		switch {
+		case !ok:
+			return ctx.Bool(false)
+		case val == nil:
+			args[1].Set("value", ctx.Undefined())
+		case val.IsException():
+			return *val
+		default:
+			args[1].Set("value", *val)
+		}
+		return ctx.Bool(true)
+	})
+	defer fallback.Free()
+
+	ret := ctx.Invoke(install, ctx.Null(), fallback)
+	defer ret.Free()
+	if ret.IsException() {
+		return ctx.exceptionError()
+	}
+	ctx.globalFallbackInstalled = true
+	return nil
+}
@@ -0,0 +1,91 @@
+package quickjs
+
+/*
+#include "bridge.h"
+*/
+import "C"
+import "sync"
+
+// FastFunc is a host function registered with RegisterFastFunction.
+// The arguments are read directly from the engine, so a call allocates neither Values nor reflection data.
+type FastFunc func(ctx *Context, args FastArgs) Value
+
+// FastFunctionID identifies a function of the fast function registry.
+type FastFunctionID int32
+
+type fastFunction struct {
+	name   string
+	length int
+	fn     FastFunc
+}
+
+// fastFunctions is the process-wide registry of fast functions, indexed by id.
+var fastFunctions struct {
+	sync.RWMutex
+	entries []fastFunction
+}
+
+// RegisterFastFunction adds the function to the process-wide registry and returns its id.
+// Fast functions suit hot paths called thousands of times per second: the JS function calls the Go function
+// in a single cgo transition, without the wrapper closure, handle lookups and argument slices of Context.Function.
+// The length is the number of arguments reported by the function's length property.
+func RegisterFastFunction(name string, length int, fn FastFunc) FastFunctionID {
+	fastFunctions.Lock()
+	defer fastFunctions.Unlock()
+	fastFunctions.entries = append(fastFunctions.entries, fastFunction{name: name, length: length, fn: fn})
+	return FastFunctionID(len(fastFunctions.entries) - 1)
+}
+
+func lookupFastFunction(id FastFunctionID) fastFunction {
+	fastFunctions.RLock()
+	defer fastFunctions.RUnlock()
+	return fastFunctions.entries[id]
+}
+
+// FastFunction returns a js function value calling the registered fast function; it panics if the id is unknown.
+func (ctx *Context) FastFunction(id FastFunctionID) Value {
+	entry := lookupFastFunction(id)
+
+	fn := ctx.newValue(C.NewFastFunction(ctx.ref, C.int32_t(id), C.int(entry.length)))
+	ctx.defineReadOnly(fn, "name", ctx.String(entry.name))
+	return fn
+}
+
+// FastArgs are the arguments of a fast function call. They are only valid during the call.
+type FastArgs struct {
+	ctx  *Context
+	refs []C.JSValue
+}
+
+// Len returns the number of arguments.
+func (a FastArgs) Len() int {
+	return len(a.refs)
+}
+
+// Value returns the argument at index i, or undefined if it is missing. The value is borrowed and must not be freed.
+func (a FastArgs) Value(i int) Value {
+	if i < 0 || i >= len(a.refs) {
+		return a.ctx.Undefined()
+	}
+	return a.ctx.borrow(a.refs[i])
+}
+
+// Int64 returns the argument at index i converted to int64.
+func (a FastArgs) Int64(i int) int64 {
+	return a.Value(i).Int64()
+}
+
+// Float64 returns the argument at index i converted to float64.
+func (a FastArgs) Float64(i int) float64 {
+	return a.Value(i).Float64()
+}
+
+// Bool returns the argument at index i converted to bool.
+func (a FastArgs) Bool(i int) bool {
+	return a.Value(i).Bool()
+}
+
+// String returns the argument at index i converted to string.
+func (a FastArgs) String(i int) string {
+	return a.Value(i).String()
+}
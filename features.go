@@ -0,0 +1,78 @@
+package quickjs
+
+/*
+#include "bridge.h"
+*/
+import "C"
+
+// Feature is a set of optional language extensions of the engine, added to the contexts of a runtime.
+type Feature int
+
+const (
+	// FeatureBigFloat adds the BigFloat type and literals, e.g. 1.5l.
+	FeatureBigFloat Feature = 1 << iota
+	// FeatureBigDecimal adds the BigDecimal type and literals, e.g. 1.5m.
+	FeatureBigDecimal
+	// FeatureOperators adds operator overloading with Operators.create.
+	FeatureOperators
+	// FeatureBignumExt enables the "use math" directive and the extended semantics of BigInt.
+	FeatureBignumExt
+
+	// FeatureAll is the default set of features.
+	FeatureAll = FeatureBigFloat | FeatureBigDecimal | FeatureOperators | FeatureBignumExt
+)
+
+// WithFeatures will set the language extensions of the runtime's contexts; default is FeatureAll, use 0 for standard JavaScript only.
+func WithFeatures(features Feature) Option {
+	return func(o *Options) {
+		o.features = features
+	}
+}
+
+// WithStrict will make the scripts of the runtime's contexts run in strict mode by default, see Context.SetStrict; default is false.
+func WithStrict(strict bool) Option {
+	return func(o *Options) {
+		o.strict = strict
+	}
+}
+
+// addFeatures adds the intrinsics of the features to the context.
+func addFeatures(ref *C.JSContext, features Feature) {
+	if features&FeatureBigFloat != 0 {
+		C.JS_AddIntrinsicBigFloat(ref)
+	}
+	if features&FeatureBigDecimal != 0 {
+		C.JS_AddIntrinsicBigDecimal(ref)
+	}
+	if features&FeatureOperators != 0 {
+		C.JS_AddIntrinsicOperators(ref)
+	}
+	if features&FeatureBignumExt != 0 {
+		C.JS_EnableBignumExt(ref, C.int(1))
+	}
+}
+
+// Features returns the language extensions of the context, see WithFeatures.
+func (ctx *Context) Features() Feature {
+	return ctx.runtime.options.features
+}
+
+// SetStrict sets whether Eval, EvalBatch, Compile and CompileContext run or compile scripts in strict mode by default,
+// which an EvalFlagStrict option still overrides; modules are always strict, and scripts of CompileScript never are,
+// as their bindings are provided by a with statement. The default is set by WithStrict.
+func (ctx *Context) SetStrict(strict bool) {
+	ctx.strict = strict
+}
+
+// Strict returns whether scripts run in strict mode by default, see SetStrict.
+func (ctx *Context) Strict() bool {
+	return ctx.strict
+}
+
+// strictOptions returns the options preceded by the strict mode default of the context, if set.
+func (ctx *Context) strictOptions(opts []EvalOption) []EvalOption {
+	if !ctx.strict {
+		return opts
+	}
+	return append([]EvalOption{EvalFlagStrict(true)}, opts...)
+}
@@ -0,0 +1,114 @@
+package quickjs
+
+/*
+#include "bridge.h"
+*/
+import "C"
+import (
+	"runtime"
+	"unsafe"
+)
+
+// freedValues counts the references to the values of a context owned by Go, and records where the last one was freed or
+// transferred to the engine, see WithFreeCheck. Releasing a reference Go does not own, e.g. freeing a value twice,
+// would decrement the reference count of another owner; the values whose last reference was freed are destroyed.
+// A value is forgotten when the engine hands the context a new reference at its address, which it may reuse for a new value.
+type freedValues struct {
+	owned    map[unsafe.Pointer]int
+	released map[unsafe.Pointer][]uintptr
+	freed    map[unsafe.Pointer]bool
+}
+
+func newFreedValues() *freedValues {
+	return &freedValues{
+		owned:    make(map[unsafe.Pointer]int),
+		released: make(map[unsafe.Pointer][]uintptr),
+		freed:    make(map[unsafe.Pointer]bool),
+	}
+}
+
+// acquire counts a new reference to the value owned by Go.
+func (f *freedValues) acquire(ref C.JSValue) {
+	ptr := C.ValueGetPtr(ref)
+	if ptr == nil {
+		return
+	}
+	f.revive(ptr)
+	f.owned[ptr]++
+}
+
+// release uncounts a reference to the value freed or transferred to the engine, panicking if Go owns none;
+// skip is the number of frames to drop from the stack.
+func (f *freedValues) release(ref C.JSValue, skip int) {
+	ptr := C.ValueGetPtr(ref)
+	if ptr == nil {
+		return
+	}
+	n := f.owned[ptr]
+	if n == 0 {
+		f.panicReleased(ptr)
+	}
+	if n > 1 {
+		f.owned[ptr] = n - 1
+		return
+	}
+	delete(f.owned, ptr)
+	pcs := make([]uintptr, 32)
+	f.released[ptr] = pcs[:runtime.Callers(skip+2, pcs)]
+}
+
+// markFreed records the value if ref is its last reference, before it is freed.
+func (f *freedValues) markFreed(ref C.JSValue) {
+	if C.ValueRefCount(ref) == 1 {
+		f.freed[C.ValueGetPtr(ref)] = true
+	}
+}
+
+// revive forgets the freed value at the address, where a value is alive.
+func (f *freedValues) revive(ptr unsafe.Pointer) {
+	if f.freed[ptr] {
+		delete(f.freed, ptr)
+		delete(f.released, ptr)
+	}
+}
+
+// panicReleased panics for a value which Go does not own a reference to, with the call site where its last one was released.
+func (f *freedValues) panicReleased(ptr unsafe.Pointer) {
+	msg, site := "quickjs: Value released without an owned reference, e.g. freed twice, after its ownership was transferred or while borrowed", "; last released at:\n"
+	if f.freed[ptr] {
+		msg, site = "quickjs: Value used after Free", "; freed at:\n"
+	}
+	if pcs, ok := f.released[ptr]; ok {
+		_, stack := describeStack(pcs)
+		msg += site + stack
+	}
+	panic(msg)
+}
+
+// borrow wraps a reference the engine lends to a Go callback, which must not free it.
+func (ctx *Context) borrow(ref C.JSValue) Value {
+	if ctx.freed != nil {
+		if ptr := C.ValueGetPtr(ref); ptr != nil {
+			ctx.freed.revive(ptr)
+		}
+	}
+	return Value{ctx: ctx, ref: ref}
+}
+
+// hold wraps a reference owned by the context itself, which the tracker does not report as a leak.
+func (ctx *Context) hold(ref C.JSValue) Value {
+	if ctx.freed != nil {
+		ctx.freed.acquire(ref)
+	}
+	return Value{ctx: ctx, ref: ref}
+}
+
+// checkFreed panics with the Free call site if the value was freed, when the free check is enabled.
+func (v Value) checkFreed() {
+	if v.ctx == nil || v.ctx.freed == nil {
+		return
+	}
+	if ptr := C.ValueGetPtr(v.ref); ptr != nil && v.ctx.freed.freed[ptr] {
+		v.ctx.freed.panicReleased(ptr)
+	}
+}
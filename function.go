@@ -0,0 +1,106 @@
+package quickjs
+
+/*
+#include "bridge.h"
+*/
+import "C"
+import (
+	"strings"
+	"unsafe"
+)
+
+// hostFunctionMarker is part of the source of the JS wrappers of host functions, see proxyFunction and asyncProxyFunction.
+const hostFunctionMarker = "proxy.call(this, fnHandler, ctx, "
+
+// hostFunction is the Go function called by a function of Function or NamedFunction.
+type hostFunction struct {
+	name string
+	fn   func(ctx *Context, this Value, args []Value) Value
+}
+
+// hostAsyncFunction is the Go function called by a function of AsyncFunction or NamedAsyncFunction.
+type hostAsyncFunction struct {
+	name string
+	fn   func(ctx *Context, this Value, promise Value, args []Value) Value
+}
+
+// NamedFunction returns a js function value like Function, with the given name and length properties,
+// so that it shows by name in stack traces and suits libraries reading fn.name or fn.length.
+// The name is also reported to the OnFunctionCall hook.
+func (ctx *Context) NamedFunction(name string, length int, fn func(ctx *Context, this Value, args []Value) Value) Value {
+	val := ctx.proxyFunction(&hostFunction{name: name, fn: fn})
+	ctx.defineReadOnly(val, "name", ctx.String(name))
+	ctx.defineReadOnly(val, "length", ctx.Int32(int32(length)))
+	return val
+}
+
+// NamedAsyncFunction returns a js async function value like AsyncFunction, with the given name and length properties, see NamedFunction.
+func (ctx *Context) NamedAsyncFunction(name string, length int, asyncFn func(ctx *Context, this Value, promise Value, args []Value) Value) Value {
+	val := ctx.asyncProxyFunction(&hostAsyncFunction{name: name, fn: asyncFn})
+	ctx.defineReadOnly(val, "name", ctx.String(name))
+	ctx.defineReadOnly(val, "length", ctx.Int32(int32(length)))
+	return val
+}
+
+// FunctionName returns the name property of the function, or "" if the value is not a function or its name is not a string.
+func (v Value) FunctionName() string {
+	if !v.IsFunction() {
+		return ""
+	}
+	name := v.Get("name")
+	defer name.Free()
+	if !name.IsString() {
+		return ""
+	}
+	return name.String()
+}
+
+// FunctionLength returns the length property of the function, which is the number of its declared parameters,
+// or 0 if the value is not a function or its length is not a number.
+func (v Value) FunctionLength() int {
+	if !v.IsFunction() {
+		return 0
+	}
+	length := v.Get("length")
+	defer length.Free()
+	if !length.IsNumber() {
+		return 0
+	}
+	return int(length.Int64())
+}
+
+// FunctionSource returns the source text of the function as given by Function.prototype.toString, and true.
+// It returns false if the value is not a function or its source is not available: native, host and bound functions,
+// and functions loaded from bytecode.
+func (v Value) FunctionSource() (string, bool) {
+	if !v.IsFunction() {
+		return "", false
+	}
+	function := v.ctx.Globals().Get("Function")
+	defer function.Free()
+	prototype := function.Get("prototype")
+	defer prototype.Free()
+	toString := prototype.Get("toString")
+	defer toString.Free()
+
+	ret := v.ctx.Invoke(toString, v)
+	defer ret.Free()
+	if ret.IsException() {
+		v.ctx.exceptionError()
+		return "", false
+	}
+	source := ret.String()
+	if strings.Contains(source, "[native code]") || strings.Contains(source, hostFunctionMarker) {
+		return "", false
+	}
+	return source, true
+}
+
+// defineReadOnly defines a configurable, non-writable and non-enumerable property of the object, as the name and length of functions are,
+// taking ownership of val.
+func (ctx *Context) defineReadOnly(obj Value, name string, val Value) {
+	namePtr := C.CString(name)
+	defer C.free(unsafe.Pointer(namePtr))
+	val.untrack()
+	C.JS_DefinePropertyValueStr(ctx.ref, obj.ref, namePtr, val.ref, C.JS_PROP_CONFIGURABLE)
+}
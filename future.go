@@ -0,0 +1,48 @@
+package quickjs
+
+// Future is the pending result of a script evaluated by EvalAsync.
+type Future struct {
+	done chan struct{}
+	val  *Value
+	err  error
+}
+
+// Done returns a channel closed once the result is available.
+func (f *Future) Done() <-chan struct{} {
+	return f.done
+}
+
+// Result waits for the script and returns its value, which must be freed, or its error.
+func (f *Future) Result() (*Value, error) {
+	<-f.done
+	return f.val, f.err
+}
+
+func (f *Future) complete(val *Value, err error) {
+	f.val, f.err = val, err
+	close(f.done)
+}
+
+// EvalAsync schedules the evaluation of the code and returns its future result without waiting, see Schedule.
+// A promise returned by the code is awaited, unless EvalAwait(false) is given.
+// The result is ErrJobQueueFull or ErrContextClosed if the script cannot be scheduled, or is still queued when the context is closed.
+func (ctx *Context) EvalAsync(code string, opts ...EvalOption) *Future {
+	f := &Future{done: make(chan struct{})}
+	opts = append([]EvalOption{EvalAwait(true)}, opts...)
+	err := ctx.schedule(job{
+		run: func(ctx *Context) {
+			val, err := ctx.Eval(code, opts...)
+			if err != nil {
+				val.Free()
+				f.complete(nil, err)
+				return
+			}
+			f.complete(&val, nil)
+		},
+		cancel: func(err error) { f.complete(nil, err) },
+	}, nil)
+	if err != nil {
+		f.complete(nil, err)
+	}
+	return f
+}
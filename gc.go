@@ -0,0 +1,64 @@
+package quickjs
+
+/*
+#include "bridge.h"
+*/
+import "C"
+import "time"
+
+// defaultGCThreshold is the GC threshold of a new quickjs runtime.
+const defaultGCThreshold = 256 * 1024
+
+// GCInfo describes the GC settings of a runtime and the last collection run with RunGC.
+type GCInfo struct {
+	Threshold     uint64        // allocated bytes triggering an automatic collection
+	Runs          int           // number of RunGC calls
+	ObjectsBefore int64         // objects alive before the last RunGC
+	ObjectsAfter  int64         // objects alive after the last RunGC
+	MemoryBefore  int64         // bytes in use before the last RunGC
+	MemoryAfter   int64         // bytes in use after the last RunGC
+	Duration      time.Duration // duration of the last RunGC
+}
+
+// MemoryUsage is a snapshot of the runtime memory usage.
+type MemoryUsage struct {
+	MallocSize      int64
+	MallocLimit     int64
+	MallocCount     int64
+	MemoryUsedSize  int64
+	MemoryUsedCount int64
+	AtomCount       int64
+	StrCount        int64
+	ObjCount        int64
+	PropCount       int64
+	ShapeCount      int64
+	JSFuncCount     int64
+	CFuncCount      int64
+	ArrayCount      int64
+}
+
+// GCInfo returns the GC threshold and the statistics of the last RunGC call.
+func (r Runtime) GCInfo() GCInfo {
+	return *r.gcInfo
+}
+
+// MemoryUsage computes the current memory usage of the runtime.
+func (r Runtime) MemoryUsage() MemoryUsage {
+	var s C.JSMemoryUsage
+	C.JS_ComputeMemoryUsage(r.ref, &s)
+	return MemoryUsage{
+		MallocSize:      int64(s.malloc_size),
+		MallocLimit:     int64(s.malloc_limit),
+		MallocCount:     int64(s.malloc_count),
+		MemoryUsedSize:  int64(s.memory_used_size),
+		MemoryUsedCount: int64(s.memory_used_count),
+		AtomCount:       int64(s.atom_count),
+		StrCount:        int64(s.str_count),
+		ObjCount:        int64(s.obj_count),
+		PropCount:       int64(s.prop_count),
+		ShapeCount:      int64(s.shape_count),
+		JSFuncCount:     int64(s.js_func_count),
+		CFuncCount:      int64(s.c_func_count),
+		ArrayCount:      int64(s.array_count),
+	}
+}
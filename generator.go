@@ -0,0 +1,66 @@
+package quickjs
+
+import "errors"
+
+// ErrNotGenerator is the error of the generator methods of a Value which is not a generator object.
+var ErrNotGenerator = errors.New("quickjs: not a generator")
+
+// IsGenerator reports whether the value is a generator object, as returned by calling a generator function, sync or async.
+func (v Value) IsGenerator() bool {
+	switch v.Kind() {
+	case KindGenerator, KindAsyncGenerator:
+		return true
+	}
+	return false
+}
+
+// IsAsyncGenerator reports whether the value is the generator object of an async generator function.
+func (v Value) IsAsyncGenerator() bool {
+	return v.Kind() == KindAsyncGenerator
+}
+
+// GeneratorNext resumes the generator with the argument, the value of the yield expression it is paused at, and returns the value
+// it yields next, which must be freed, and whether it is done, in which case the value is the one it returned. It does not take
+// ownership of the argument. The steps of an async generator are awaited, see Context.Await, so that Go code pulls the values
+// of both kinds of generators lazily, e.g. the pages of a listing fetched by a script. An exception thrown by the generator is returned
+// as the error, and ends it.
+func (v Value) GeneratorNext(arg Value) (Value, bool, error) {
+	return v.resumeGenerator("next", arg)
+}
+
+// GeneratorReturn resumes the generator as if a return statement with the value were at its yield expression, running its finally blocks,
+// see GeneratorNext; it is done unless a finally block yields.
+func (v Value) GeneratorReturn(val Value) (Value, bool, error) {
+	return v.resumeGenerator("return", val)
+}
+
+// GeneratorThrow resumes the generator as if the value were thrown at its yield expression, see GeneratorNext;
+// the error is returned unless the generator catches it.
+func (v Value) GeneratorThrow(val Value) (Value, bool, error) {
+	return v.resumeGenerator("throw", val)
+}
+
+// resumeGenerator calls the method of the generator with the argument and returns the value and done properties of the result.
+func (v Value) resumeGenerator(method string, arg Value) (Value, bool, error) {
+	ctx := v.ctx
+	kind := v.Kind()
+	if kind != KindGenerator && kind != KindAsyncGenerator {
+		return ctx.Undefined(), true, ErrNotGenerator
+	}
+	ret := v.Call(method, arg)
+	if ret.IsException() {
+		return ctx.Undefined(), true, ctx.exceptionError()
+	}
+	if kind == KindAsyncGenerator {
+		// Await takes ownership of the promise
+		ret.untrack()
+		var err error
+		if ret, err = ctx.Await(ret); err != nil {
+			return ctx.Undefined(), true, err
+		}
+	}
+	defer ret.Free()
+	done := ret.Get("done")
+	defer done.Free()
+	return ret.Get("value"), done.Bool(), nil
+}
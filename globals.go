@@ -0,0 +1,173 @@
+package quickjs
+
+/*
+#include "bridge.h"
+*/
+import "C"
+import (
+	"fmt"
+	"strings"
+)
+
+// GlobalBindings records the globals defined by DefineGlobals, so they can be removed at once.
+type GlobalBindings struct {
+	ctx        *Context
+	paths      [][]string
+	namespaces [][]string
+}
+
+// DefineGlobals converts the values with Marshal and defines them as globals.
+// A dotted name such as "app.db.query" defines the property in nested namespace objects, creating them as needed.
+// Names are defined in lexical order, so "app" may be given alongside "app.version" to provide the namespace object itself.
+func (ctx *Context) DefineGlobals(globals map[string]interface{}) (*GlobalBindings, error) {
+	bindings := &GlobalBindings{ctx: ctx}
+	for _, name := range sortedKeys(globals) {
+		if err := bindings.define(name, globals[name]); err != nil {
+			bindings.Remove()
+			return nil, err
+		}
+	}
+	return bindings, nil
+}
+
+func (b *GlobalBindings) define(name string, v interface{}) error {
+	path := strings.Split(name, ".")
+	for _, part := range path {
+		if part == "" {
+			return fmt.Errorf("quickjs: invalid global name %q", name)
+		}
+	}
+
+	obj := b.ctx.Globals().dup()
+	defer func() { obj.Free() }()
+	for i, part := range path[:len(path)-1] {
+		next := obj.Get(part)
+		if next.IsUndefined() {
+			next = b.ctx.Object()
+			obj.Set(part, next.dup())
+			b.namespaces = append(b.namespaces, path[:i+1])
+		} else if !next.IsObject() {
+			next.Free()
+			return fmt.Errorf("quickjs: global %q is not an object", strings.Join(path[:i+1], "."))
+		}
+		obj.Free()
+		obj = next
+	}
+
+	val, err := b.ctx.Marshal(v)
+	if err != nil {
+		return fmt.Errorf("quickjs: global %q: %w", name, err)
+	}
+	obj.Set(path[len(path)-1], val)
+	b.paths = append(b.paths, path)
+	return nil
+}
+
+// Names returns the dotted names of the defined globals.
+func (b *GlobalBindings) Names() []string {
+	names := make([]string, len(b.paths))
+	for i, path := range b.paths {
+		names[i] = strings.Join(path, ".")
+	}
+	return names
+}
+
+// Remove deletes the defined globals, and the namespace objects created for them once they are empty.
+func (b *GlobalBindings) Remove() {
+	for i := len(b.paths) - 1; i >= 0; i-- {
+		b.delete(b.paths[i], false)
+	}
+	for i := len(b.namespaces) - 1; i >= 0; i-- {
+		b.delete(b.namespaces[i], true)
+	}
+	b.paths, b.namespaces = nil, nil
+}
+
+// delete removes the property at path, only if it is an object without own keys when onlyEmpty is set.
+func (b *GlobalBindings) delete(path []string, onlyEmpty bool) {
+	obj := b.ctx.Globals().dup()
+	defer func() { obj.Free() }()
+	for _, part := range path[:len(path)-1] {
+		next := obj.Get(part)
+		if !next.IsObject() {
+			next.Free()
+			return
+		}
+		obj.Free()
+		obj = next
+	}
+
+	name := path[len(path)-1]
+	if onlyEmpty {
+		val := obj.Get(name)
+		defer val.Free()
+		if keys, err := val.ownKeys(); err != nil || len(keys) > 0 {
+			return
+		}
+	}
+	obj.Delete(name)
+}
+
+// lazyGlobals are the globals installed by the package, with the function installing them on first use.
+var lazyGlobals = []struct {
+	name    string
+	install func(ctx *Context) error
+}{
+	{"AbortController", (*Context).installAbort},
+	{"AbortSignal", (*Context).installAbort},
+	{"Blob", (*Context).installBlobs},
+	{"File", (*Context).installBlobs},
+	{"queueMicrotask", (*Context).installMicrotasks},
+	{"structuredClone", (*Context).installStructuredClone},
+}
+
+// lazyGlobalsScript returns the function defining the named globals as accessors calling install with their name on first use,
+// which must replace them by their values; setting one first replaces it by the value set.
+const lazyGlobalsScript = `((install, ...names) => {
+	for (const name of names) {
+		Object.defineProperty(globalThis, name, {
+			get() {
+				install(name);
+				return globalThis[name];
+			},
+			set(value) {
+				Object.defineProperty(globalThis, name, { value, writable: true, configurable: true });
+			},
+			configurable: true,
+		});
+	}
+})`
+
+// defineLazyGlobals defines the lazyGlobals, calling their install function the first time a script uses one of them,
+// so that the contexts which never use them, e.g. of a runtime with a tight memory limit, do not pay for them.
+// The accessors call a C function, which unlike a host function does not take a handle, see goInstallLazyGlobal.
+func (ctx *Context) defineLazyGlobals() error {
+	define, err := ctx.eval(lazyGlobalsScript, EvalFileName("<globals>"))
+	if err != nil {
+		return err
+	}
+	defer define.Free()
+
+	args := []Value{ctx.newValue(C.NewLazyGlobalInstaller(ctx.ref))}
+	for _, global := range lazyGlobals {
+		args = append(args, ctx.String(global.name))
+	}
+	defer freeValues(args)
+
+	ret := ctx.Invoke(define, ctx.Null(), args...)
+	defer ret.Free()
+	if ret.IsException() {
+		return ctx.exceptionError()
+	}
+	return nil
+}
+
+// installLazyGlobal installs the lazy global of the name.
+func (ctx *Context) installLazyGlobal(name string) error {
+	for _, global := range lazyGlobals {
+		if global.name == name {
+			return global.install(ctx)
+		}
+	}
+	return fmt.Errorf("quickjs: unknown global %q", name)
+}
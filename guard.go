@@ -0,0 +1,88 @@
+package quickjs
+
+import (
+	"bytes"
+	"errors"
+	"runtime"
+	"strconv"
+)
+
+// ErrWrongGoroutine is returned, or thrown, when a context guarded by WithThreadGuard is used from another goroutine than its creator.
+var ErrWrongGoroutine = errors.New("quickjs: Context used from wrong goroutine")
+
+// ErrForeignValue is returned, or thrown, when a Value of another runtime or of a closed context is passed to a context,
+// whose engine cannot use it; see Value.Migrate to use a value in another context of the same runtime.
+var ErrForeignValue = errors.New("quickjs: Value of another runtime or of a closed context")
+
+// goroutineID returns the id of the calling goroutine, parsed from its stack header "goroutine N [running]:".
+func goroutineID() uint64 {
+	var buf [64]byte
+	header := buf[:runtime.Stack(buf[:], false)]
+	header = bytes.TrimPrefix(header, []byte("goroutine "))
+	if i := bytes.IndexByte(header, ' '); i >= 0 {
+		header = header[:i]
+	}
+	id, _ := strconv.ParseUint(string(header), 10, 64)
+	return id
+}
+
+// checkGoroutine returns ErrWrongGoroutine if the context is guarded and used from another goroutine than its creator.
+func (ctx *Context) checkGoroutine() error {
+	if ctx.owner != 0 && goroutineID() != ctx.owner {
+		return ErrWrongGoroutine
+	}
+	return nil
+}
+
+// throwGoroutine returns the exception thrown for ErrWrongGoroutine by the methods returning a Value, see checkGoroutine.
+func (ctx *Context) throwGoroutine() (Value, bool) {
+	if err := ctx.checkGoroutine(); err != nil {
+		return ctx.ThrowError(err), true
+	}
+	return Value{}, false
+}
+
+// checkValues returns ErrForeignValue if one of the values belongs to another runtime than the context, or to a closed context.
+func (ctx *Context) checkValues(vals ...Value) error {
+	for _, v := range vals {
+		v.checkFreed()
+		if v.ctx != nil && v.ctx != ctx && (v.ctx.closed || v.ctx.runtime.ref != ctx.runtime.ref) {
+			return ErrForeignValue
+		}
+	}
+	return nil
+}
+
+// throwForeign returns the exception thrown for ErrForeignValue by the methods returning a Value, see checkValues.
+func (ctx *Context) throwForeign(vals ...Value) (Value, bool) {
+	if err := ctx.checkValues(vals...); err != nil {
+		return ctx.ThrowError(err), true
+	}
+	return Value{}, false
+}
+
+// dropForeign frees the value of another runtime given to a method taking its ownership, as the context cannot store it;
+// the values of a closed context were freed with it. It reports whether the value was foreign.
+func (ctx *Context) dropForeign(val Value) bool {
+	if ctx.checkValues(val) == nil {
+		return false
+	}
+	if !val.ctx.closed {
+		val.Free()
+	}
+	return true
+}
+
+// checkClose panics if a guarded context is closed from another goroutine, or while one of its scripts is running,
+// e.g. from a Go callback, which would free the engine state still in use.
+func (ctx *Context) checkClose() {
+	if ctx.owner == 0 {
+		return
+	}
+	if err := ctx.checkGoroutine(); err != nil {
+		panic(err)
+	}
+	if ctx.running > 0 {
+		panic("quickjs: Context closed while running")
+	}
+}
@@ -0,0 +1,119 @@
+package quickjs
+
+/*
+#include "bridge.h"
+*/
+import "C"
+
+// handleEntry is a Go object referenced by a handle object, see NewHandleObject.
+// It is the Go object of the handle object, so that the collection of the object and the close of the context release it.
+type handleEntry struct {
+	ctx       *Context
+	id        int64
+	object    interface{}
+	finalizer func(obj interface{})
+	released  bool
+}
+
+// release removes the entry from the table and finalizes its object, reporting whether it was not released before.
+func (e *handleEntry) release() bool {
+	if e.released {
+		return false
+	}
+	e.released = true
+	delete(e.ctx.handles, e.id)
+	e.ctx.unreserveHandle(HandleObject)
+	if e.finalizer != nil {
+		e.finalizer(e.object)
+	} else if f, ok := e.object.(Finalizer); ok {
+		f.Finalize()
+	}
+	return true
+}
+
+// Finalize releases the entry when its handle object is collected or the context closed.
+func (e *handleEntry) Finalize() {
+	e.release()
+}
+
+// NewHandleObject returns an opaque object standing for the Go object in scripts, e.g. a database connection or a file,
+// which is passed around by reference instead of being converted: the object has no prototype and only two frozen properties,
+// the id of the handle and a release method, which returns whether the handle was not released before.
+// A Go function receiving the object looks the Go object up with ResolveHandle, or with Resolve given its id.
+//
+// The handle is released when a script calls release, when ReleaseHandle is called, when its object is collected or when
+// the context is closed, whichever comes first: the finalizer is then called once with the Go object, or if it is nil,
+// the Go object is finalized if it implements Finalizer. Both run on the goroutine of the context and must not use it.
+// The handle counts against WithMaxHandles until it is released, and its release method until it is collected;
+// past the limit, NewHandleObject fails with a *LimitError.
+func (ctx *Context) NewHandleObject(obj interface{}, finalizer func(obj interface{})) (Value, error) {
+	if err := ctx.checkGoroutine(); err != nil {
+		return ctx.Undefined(), err
+	}
+	if err := ctx.reserveHandle(HandleObject); err != nil {
+		return ctx.Undefined(), err
+	}
+	ctx.handleSeq++
+	entry := &handleEntry{ctx: ctx, id: ctx.handleSeq, object: obj, finalizer: finalizer}
+
+	release := ctx.NamedFunction("release", 0, func(ctx *Context, this Value, args []Value) Value {
+		return ctx.Bool(entry.release())
+	})
+	if release.IsException() {
+		ctx.unreserveHandle(HandleObject)
+		return ctx.Undefined(), ctx.exceptionError()
+	}
+	val := ctx.newValue(C.JS_NewObjectProto(ctx.ref, C.JS_NewNull()))
+	if val.IsException() {
+		release.Free()
+		ctx.unreserveHandle(HandleObject)
+		return val, ctx.exceptionError()
+	}
+	if err := val.SetGoObject(entry); err != nil {
+		release.Free()
+		val.Free()
+		ctx.unreserveHandle(HandleObject)
+		return ctx.Undefined(), err
+	}
+	if ctx.handles == nil {
+		ctx.handles = make(map[int64]*handleEntry)
+	}
+	ctx.handles[entry.id] = entry
+
+	ctx.defineFrozen(val, "id", ctx.Int64(entry.id))
+	ctx.defineFrozen(val, "release", release)
+	C.JS_PreventExtensions(ctx.ref, val.ref)
+	return val, nil
+}
+
+// Resolve returns the Go object of the handle of the id, unless it was released. As scripts can forge the id of
+// a handle they were not given, prefer ResolveHandle for the values received from scripts.
+func (ctx *Context) Resolve(id int64) (interface{}, bool) {
+	entry, ok := ctx.handles[id]
+	if !ok {
+		return nil, false
+	}
+	return entry.object, true
+}
+
+// ResolveHandle returns the Go object of the handle object, unless it was released or the value is not a handle object.
+func (ctx *Context) ResolveHandle(v Value) (interface{}, bool) {
+	obj, ok := v.GetGoObject()
+	if !ok {
+		return nil, false
+	}
+	entry, ok := obj.(*handleEntry)
+	if !ok || entry.released || entry.ctx != ctx {
+		return nil, false
+	}
+	return entry.object, true
+}
+
+// ReleaseHandle releases the handle of the id, as its release method does, reporting whether it was not released before.
+func (ctx *Context) ReleaseHandle(id int64) bool {
+	entry, ok := ctx.handles[id]
+	if !ok {
+		return false
+	}
+	return entry.release()
+}
@@ -0,0 +1,180 @@
+package quickjs
+
+/*
+#include "bridge.h"
+*/
+import "C"
+import "runtime/cgo"
+
+// HandleKind is the kind of Go object held by a handle of the handle store of a context, see HandleStats.
+type HandleKind int
+
+const (
+	// HandleFunction is the Go function of a function of Function, NamedFunction or Realm.Function.
+	HandleFunction HandleKind = iota + 1
+	// HandleAsyncFunction is the Go function of a function of AsyncFunction or NamedAsyncFunction.
+	HandleAsyncFunction
+	// HandleObject is the Go object of a handle object, see NewHandleObject.
+	HandleObject
+)
+
+// String returns the name of the kind.
+func (k HandleKind) String() string {
+	switch k {
+	case HandleFunction:
+		return "function"
+	case HandleAsyncFunction:
+		return "async function"
+	case HandleObject:
+		return "handle object"
+	}
+	return "unknown"
+}
+
+// HandleStats are the counters of the handle store of a context, which holds the Go objects referenced by its JS objects.
+type HandleStats struct {
+	// Live counts the handles whose JS object is alive, by kind.
+	Live map[HandleKind]int
+	// Orphaned counts the handles whose JS object was collected, which hold their Go object until ReleaseOrphanedHandles.
+	Orphaned int
+	// Created and Released count the handles created and released since the context was created.
+	Created, Released uint64
+}
+
+// Total returns the number of handles held by the store, live and orphaned, which WithMaxHandles bounds.
+func (s HandleStats) Total() int {
+	n := s.Orphaned
+	for _, live := range s.Live {
+		n += live
+	}
+	return n
+}
+
+// HandleInfo describes a handle of the handle store, see OrphanedHandles.
+type HandleInfo struct {
+	Kind HandleKind
+	// Name is the name of the function, "" for the functions of Function and AsyncFunction.
+	Name string
+}
+
+// handleStore counts the handles of a context; the handles of functions are live until their function is collected,
+// then orphaned until they are released.
+type handleStore struct {
+	live     map[HandleKind]int
+	orphans  []*storedHandle // in the order of the collection of their function
+	created  uint64
+	released uint64
+}
+
+// storedHandle is the Go function of a host function, referenced by the cgo handle held by the object its JS wrapper captures,
+// see newFunctionHandle, so that the collection of the wrapper orphans it.
+type storedHandle struct {
+	ctx      *Context
+	handle   cgo.Handle
+	kind     HandleKind
+	name     string
+	value    interface{} // *hostFunction or *hostAsyncFunction
+	orphaned bool
+}
+
+// orphan orphans the handle, once its function is collected; the handles of the functions collected after the close
+// of the context are released.
+func (h *storedHandle) orphan() {
+	if h.orphaned {
+		return
+	}
+	h.orphaned = true
+	s := &h.ctx.handleStore
+	s.live[h.kind]--
+	if h.ctx.closed {
+		h.handle.Delete()
+		s.released++
+		return
+	}
+	s.orphans = append(s.orphans, h)
+}
+
+// WithMaxHandles will set the maximum number of handles held by the handle store of each context, live and orphaned, see
+// HandleStats, e.g. to bound a host creating functions per request. The orphaned handles are released when the limit is reached;
+// past it, a new handle fails with a *LimitError of LimitHandles, thrown by the methods returning a Value.
+// The functions installed by the runtime options count too; default is 0, no limit.
+func WithMaxHandles(max int) Option {
+	return func(o *Options) {
+		o.maxHandles = max
+	}
+}
+
+// reserveHandle counts a new live handle of the kind, unless the store holds WithMaxHandles handles after releasing its orphans.
+func (ctx *Context) reserveHandle(kind HandleKind) error {
+	if max := ctx.runtime.options.maxHandles; max > 0 && ctx.HandleStats().Total() >= max {
+		ctx.ReleaseOrphanedHandles()
+		if ctx.HandleStats().Total() >= max {
+			return &LimitError{Limit: LimitHandles}
+		}
+	}
+	s := &ctx.handleStore
+	if s.live == nil {
+		s.live = make(map[HandleKind]int)
+	}
+	s.live[kind]++
+	s.created++
+	return nil
+}
+
+// unreserveHandle uncounts a live handle of the kind, released without being orphaned.
+func (ctx *Context) unreserveHandle(kind HandleKind) {
+	ctx.handleStore.live[kind]--
+	ctx.handleStore.released++
+}
+
+// newFunctionHandle returns the object holding the handle of the Go function of a new host function, which its JS wrapper captures.
+func (ctx *Context) newFunctionHandle(kind HandleKind, name string, host interface{}) (Value, error) {
+	if err := ctx.reserveHandle(kind); err != nil {
+		return ctx.Undefined(), err
+	}
+	h := &storedHandle{ctx: ctx, kind: kind, name: name, value: host}
+	h.handle = cgo.NewHandle(h)
+	val := ctx.newValue(C.NewFunctionHandle(ctx.ref, C.uintptr_t(h.handle)))
+	if val.IsException() {
+		h.handle.Delete()
+		ctx.unreserveHandle(kind)
+		return val, ctx.exceptionError()
+	}
+	return val, nil
+}
+
+// HandleStats returns the counters of the handle store of the context.
+func (ctx *Context) HandleStats() HandleStats {
+	s := &ctx.handleStore
+	stats := HandleStats{Live: make(map[HandleKind]int), Orphaned: len(s.orphans), Created: s.created, Released: s.released}
+	for kind, live := range s.live {
+		if live > 0 {
+			stats.Live[kind] = live
+		}
+	}
+	return stats
+}
+
+// OrphanedHandles returns the handles whose function was collected, in the order of their collection, e.g. to report
+// the functions a host creates and drops repeatedly; their Go functions are held until ReleaseOrphanedHandles.
+func (ctx *Context) OrphanedHandles() []HandleInfo {
+	infos := make([]HandleInfo, len(ctx.handleStore.orphans))
+	for i, h := range ctx.handleStore.orphans {
+		infos[i] = HandleInfo{Kind: h.kind, Name: h.name}
+	}
+	return infos
+}
+
+// ReleaseOrphanedHandles releases the handles whose function was collected, dropping their Go functions,
+// and returns their number; see Runtime.RunGC to collect the functions no longer referenced first.
+// It is called when the WithMaxHandles limit is reached, and when the context is closed.
+func (ctx *Context) ReleaseOrphanedHandles() int {
+	s := &ctx.handleStore
+	n := len(s.orphans)
+	for _, h := range s.orphans {
+		h.handle.Delete()
+	}
+	s.orphans = nil
+	s.released += uint64(n)
+	return n
+}
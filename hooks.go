@@ -0,0 +1,103 @@
+package quickjs
+
+import "time"
+
+// Hooks are callbacks observing the execution of a runtime, e.g. to emit metrics or traces; nil callbacks are skipped.
+// They run synchronously on the goroutine of the context, so they should be quick and must not run scripts.
+type Hooks struct {
+	// OnEvalStart is called when Eval starts; Duration and Err are not set.
+	OnEvalStart func(info EvalInfo)
+	// OnEvalEnd is called when Eval returns.
+	OnEvalEnd func(info EvalInfo)
+	// OnFunctionCall is called when a host function created by Function, AsyncFunction or FastFunction returns.
+	OnFunctionCall func(info FunctionCallInfo)
+	// OnException is called when a JS exception is returned to Go as an error.
+	OnException func(ctx *Context, err *Error)
+}
+
+// EvalInfo describes an evaluation of code by Eval, or a compilation by Compile.
+type EvalInfo struct {
+	Context  *Context
+	Filename string
+	// Origin is the origin of the code, see EvalOrigin.
+	Origin string
+	// Compile reports that the code is only compiled, by Compile or the EvalFlagCompileOnly option.
+	Compile bool
+	// CacheHit reports that the bytecode was found in the bytecode cache; it is only set for OnEvalEnd.
+	CacheHit bool
+	Duration time.Duration
+	Err      error
+}
+
+// FunctionCallInfo describes a call of a host function.
+type FunctionCallInfo struct {
+	Context *Context
+	// Name is the name of a fast function or of a function created by NamedFunction or NamedAsyncFunction,
+	// and empty for other host functions, which are anonymous.
+	Name      string
+	Args      int
+	Duration  time.Duration
+	Exception bool
+	// Origin is the origin of the code calling the function, see EvalOrigin.
+	Origin string
+}
+
+// WithHooks will set the runtime's instrumentation hooks; default is nil.
+func WithHooks(hooks *Hooks) Option {
+	return func(o *Options) {
+		o.hooks = hooks
+	}
+}
+
+// SetHooks sets the instrumentation hooks of the runtime and its contexts; use nil to remove them.
+func (r Runtime) SetHooks(hooks *Hooks) {
+	r.options.hooks = hooks
+}
+
+// observeEval runs the evaluation between the OnEvalStart and OnEvalEnd hooks; eval may set the CacheHit of the info.
+func observeEval[T any](info EvalInfo, eval func(info *EvalInfo) (T, error)) (T, error) {
+	hooks := info.Context.runtime.options.hooks
+	if hooks == nil || hooks.OnEvalStart == nil && hooks.OnEvalEnd == nil {
+		return eval(&info)
+	}
+	if hooks.OnEvalStart != nil {
+		hooks.OnEvalStart(info)
+	}
+	start := time.Now()
+	ret, err := eval(&info)
+	if hooks.OnEvalEnd != nil {
+		info.Duration, info.Err = time.Since(start), err
+		hooks.OnEvalEnd(info)
+	}
+	return ret, err
+}
+
+// callStart returns the start time of a host function call, if the OnFunctionCall hook needs it.
+func (ctx *Context) callStart() time.Time {
+	if hooks := ctx.runtime.options.hooks; hooks != nil && hooks.OnFunctionCall != nil {
+		return time.Now()
+	}
+	return time.Time{}
+}
+
+// observeCall calls the OnFunctionCall hook, if any, for a host function called at start which returned ret.
+func (ctx *Context) observeCall(name string, args int, start time.Time, ret Value) {
+	if hooks := ctx.runtime.options.hooks; hooks != nil && hooks.OnFunctionCall != nil && !start.IsZero() {
+		hooks.OnFunctionCall(FunctionCallInfo{Context: ctx, Name: name, Args: args, Duration: time.Since(start), Exception: ret.IsException(), Origin: ctx.origin})
+	}
+}
+
+// observeException wraps the limit hit by the exception, if any, sets the origin of the code running,
+// calls the OnException hook, if any, and returns err.
+func (ctx *Context) observeException(err *Error) *Error {
+	if err != nil && err.Err == nil {
+		err.Err = ctx.limitError(err.Cause)
+	}
+	if err != nil {
+		err.withOrigin(ctx.origin)
+	}
+	if hooks := ctx.runtime.options.hooks; hooks != nil && hooks.OnException != nil && err != nil {
+		hooks.OnException(ctx, err)
+	}
+	return err
+}
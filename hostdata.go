@@ -0,0 +1,183 @@
+package quickjs
+
+/*
+#include "bridge.h"
+*/
+import "C"
+import (
+	"errors"
+	"runtime/cgo"
+	"sort"
+)
+
+// Finalizer is implemented by the Go objects and instance data holding external resources, e.g. connections,
+// to release them when they are detached from their JS object by its collection or by the close of its context.
+type Finalizer interface {
+	// Finalize is called once, on the goroutine of the context; it must not use the context.
+	Finalize()
+}
+
+// hostData is the Go data attached to a JS object, see SetGoObject and SetInstanceData.
+// It is held by a sentinel object stored in a private slot of the JS object, whose finalizer releases it, see privateSlotScript.
+type hostData struct {
+	ctx       *Context
+	seq       uint64 // the order of attachment in the context
+	object    interface{}
+	slots     map[string]interface{}
+	finalized bool
+}
+
+// finalize calls the Finalize method of the Go object, then of the instance data in the order of their keys, once.
+// The values replaced or detached before are not finalized.
+func (data *hostData) finalize() {
+	if data.finalized {
+		return
+	}
+	data.finalized = true
+	delete(data.ctx.hostData, data)
+
+	if f, ok := data.object.(Finalizer); ok {
+		f.Finalize()
+	}
+	keys := make([]string, 0, len(data.slots))
+	for key := range data.slots {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		if f, ok := data.slots[key].(Finalizer); ok {
+			f.Finalize()
+		}
+	}
+}
+
+// finalizeHostData finalizes the Go data still attached to live objects of the context, in the order of attachment,
+// as their objects may outlive it, e.g. when referenced by another context.
+func (ctx *Context) finalizeHostData() {
+	live := make([]*hostData, 0, len(ctx.hostData))
+	for data := range ctx.hostData {
+		live = append(live, data)
+	}
+	sort.Slice(live, func(i, j int) bool { return live[i].seq < live[j].seq })
+	for _, data := range live {
+		data.finalize()
+	}
+}
+
+// SetGoObject attaches the Go object to the object value, replacing the one attached before, so that GetGoObject returns it,
+// e.g. to find the Go data of objects created by scripts, factories or subclasses. The Go object is released when the JS object
+// is collected, or by ClearGoObject. It fails for values which are not objects, for Proxies, and for non-extensible objects without Go data.
+//
+// A Go object implementing Finalizer is finalized when the JS object is collected, or when the context is closed if the
+// JS object is still alive then; a Go object replaced or cleared before is not.
+func (v Value) SetGoObject(obj interface{}) error {
+	data, err := v.hostData(true)
+	if err != nil {
+		return err
+	}
+	data.object = obj
+	return nil
+}
+
+// GetGoObject returns the Go object attached to the object value by SetGoObject, if any.
+// It only considers the value itself, not its prototypes.
+func (v Value) GetGoObject() (interface{}, bool) {
+	data, _ := v.hostData(false)
+	if data == nil || data.object == nil {
+		return nil, false
+	}
+	return data.object, true
+}
+
+// ClearGoObject detaches the Go object attached to the object value by SetGoObject, if any.
+func (v Value) ClearGoObject() {
+	if data, _ := v.hostData(false); data != nil {
+		data.object = nil
+	}
+}
+
+// SetInstanceData attaches the Go value to the object value under the key, replacing the one attached before,
+// so that several Go values, e.g. a connection and its statistics, can be attached to one object besides its Go object.
+// The values are released together when the JS object is collected, and finalized like the Go object. It fails like SetGoObject.
+func (v Value) SetInstanceData(key string, val interface{}) error {
+	data, err := v.hostData(true)
+	if err != nil {
+		return err
+	}
+	if data.slots == nil {
+		data.slots = make(map[string]interface{})
+	}
+	data.slots[key] = val
+	return nil
+}
+
+// GetInstanceData returns the Go value attached to the object value under the key by SetInstanceData, if any.
+func (v Value) GetInstanceData(key string) (interface{}, bool) {
+	data, _ := v.hostData(false)
+	if data == nil {
+		return nil, false
+	}
+	val, ok := data.slots[key]
+	return val, ok
+}
+
+// DeleteInstanceData detaches the Go value attached to the object value under the key, if any.
+func (v Value) DeleteInstanceData(key string) {
+	if data, _ := v.hostData(false); data != nil {
+		delete(data.slots, key)
+	}
+}
+
+// InstanceDataAs returns the Go value attached to the object value under the key, if any and if it is a T.
+//
+//	conn, ok := quickjs.InstanceDataAs[*sql.Conn](&obj, "conn")
+func InstanceDataAs[T any](v *Value, key string) (T, bool) {
+	val, _ := v.GetInstanceData(key)
+	t, ok := val.(T)
+	return t, ok
+}
+
+// hostData returns the Go data attached to the object value, attaching new data if create is set.
+func (v Value) hostData(create bool) (*hostData, error) {
+	if !v.IsObject() {
+		return nil, errors.New("quickjs: Go objects can only be attached to objects")
+	}
+	if C.IsProxy(v.ref) != 0 {
+		return nil, errors.New("quickjs: Go objects cannot be attached to a Proxy")
+	}
+	ctx := v.ctx
+	existing, err := ctx.getPrivate(&ctx.hostDataSlot, v)
+	if err != nil {
+		return nil, err
+	}
+	defer existing.Free()
+	if handle := C.GetHostDataHandle(existing.ref); handle != 0 {
+		return cgo.Handle(handle).Value().(*hostData), nil
+	}
+	if !create {
+		return nil, nil
+	}
+	if C.JS_IsExtensible(ctx.ref, v.ref) != 1 {
+		return nil, errors.New("quickjs: cannot attach a Go object to a non-extensible object")
+	}
+
+	ctx.hostDataSeq++
+	data := &hostData{ctx: ctx, seq: ctx.hostDataSeq}
+	if ctx.hostData == nil {
+		ctx.hostData = make(map[*hostData]struct{})
+	}
+	ctx.hostData[data] = struct{}{}
+	handle := cgo.NewHandle(data)
+	sentinel := ctx.newValue(C.NewHostDataSentinel(ctx.ref, C.uintptr_t(handle)))
+	if sentinel.IsException() {
+		delete(ctx.hostData, data)
+		handle.Delete()
+		return nil, ctx.exceptionError()
+	}
+	// on failure, freeing the sentinel runs its finalizer, which releases the data.
+	defer sentinel.Free()
+	if err := ctx.definePrivate(&ctx.hostDataSlot, v, sentinel); err != nil {
+		return nil, err
+	}
+	return data, nil
+}
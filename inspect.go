@@ -0,0 +1,365 @@
+package quickjs
+
+/*
+#include "bridge.h"
+*/
+import "C"
+import (
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+	"unsafe"
+)
+
+type InspectOptions struct {
+	depth           int
+	maxArrayLength  int
+	maxStringLength int
+}
+
+type InspectOption func(*InspectOptions)
+
+// InspectDepth will set how many levels of nested objects are rendered, deeper ones are summarized as [Object];
+// default is 2, use a negative depth for no limit.
+func InspectDepth(depth int) InspectOption {
+	return func(options *InspectOptions) {
+		options.depth = depth
+	}
+}
+
+// InspectMaxArrayLength will set how many items of arrays, typed arrays, maps and sets are rendered; default is 100.
+func InspectMaxArrayLength(n int) InspectOption {
+	return func(options *InspectOptions) {
+		options.maxArrayLength = n
+	}
+}
+
+// InspectMaxStringLength will set how many characters of strings are rendered; default is 10000.
+func InspectMaxStringLength(n int) InspectOption {
+	return func(options *InspectOptions) {
+		options.maxStringLength = n
+	}
+}
+
+// Inspect renders the value on a single line for logging and debugging, like Node's util.inspect:
+// nested objects are limited in depth, cycles are marked [Circular], functions are summarized, long arrays and strings are truncated,
+// and accessors are shown as [Getter] or [Setter] without being called. Unlike JSONStringify, it never fails.
+func (v Value) Inspect(opts ...InspectOption) string {
+	options := &InspectOptions{depth: 2, maxArrayLength: 100, maxStringLength: 10000}
+	for _, fn := range opts {
+		fn(options)
+	}
+	in := &inspector{options: options}
+	var b strings.Builder
+	in.inspect(&b, v, 0)
+	return b.String()
+}
+
+// inspector renders a value for Inspect.
+type inspector struct {
+	options *InspectOptions
+	// seen are the objects being rendered, from the outermost, to detect cycles.
+	seen []unsafe.Pointer
+}
+
+var identifierPattern = regexp.MustCompile(`^[A-Za-z_$][A-Za-z0-9_$]*$`)
+
+var quoteReplacer = strings.NewReplacer(`\`, `\\`, `'`, `\'`, "\n", `\n`, "\r", `\r`, "\t", `\t`)
+
+func (in *inspector) quote(s string) string {
+	if max := in.options.maxStringLength; max >= 0 && len(s) > max {
+		return "'" + quoteReplacer.Replace(s[:max]) + "'... " + strconv.Itoa(len(s)-max) + " more characters"
+	}
+	return "'" + quoteReplacer.Replace(s) + "'"
+}
+
+func (in *inspector) inspect(b *strings.Builder, v Value, depth int) {
+	switch kind := v.Kind(); kind {
+	case KindUndefined, KindNull, KindBool:
+		b.WriteString(v.String())
+	case KindSymbol:
+		// symbols cannot be converted to strings implicitly
+		b.WriteString("Symbol(" + in.stringProperty(v, "description") + ")")
+	case KindNumber:
+		if f := v.Float64(); f == 0 && math.Signbit(f) {
+			b.WriteString("-0")
+		} else {
+			b.WriteString(v.String())
+		}
+	case KindBigInt:
+		b.WriteString(v.String() + "n")
+	case KindString:
+		b.WriteString(in.quote(v.String()))
+	case KindFunction:
+		if name := in.stringProperty(v, "name"); name != "" {
+			b.WriteString("[Function: " + name + "]")
+		} else {
+			b.WriteString("[Function (anonymous)]")
+		}
+	case KindError, KindRegExp:
+		b.WriteString(v.String())
+	case KindDate:
+		in.date(b, v)
+	case KindUnknown:
+		b.WriteString("[unknown]")
+	default:
+		in.object(b, v, kind, depth)
+	}
+}
+
+func (in *inspector) date(b *strings.Builder, v Value) {
+	t := v.Call("getTime")
+	defer t.Free()
+	if math.IsNaN(t.Float64()) {
+		b.WriteString("Invalid Date")
+		return
+	}
+	iso := v.Call("toISOString")
+	defer iso.Free()
+	b.WriteString(iso.String())
+}
+
+// object renders the objects of the kinds which may contain other values, guarding against cycles and depth.
+func (in *inspector) object(b *strings.Builder, v Value, kind Kind, depth int) {
+	ptr := C.ValueGetPtr(v.ref)
+	for _, seen := range in.seen {
+		if seen == ptr {
+			b.WriteString("[Circular]")
+			return
+		}
+	}
+	name := in.constructorName(v)
+	if in.options.depth >= 0 && depth > in.options.depth {
+		switch {
+		case kind == KindArray:
+			b.WriteString("[Array]")
+		case name != "":
+			b.WriteString("[" + name + "]")
+		default:
+			b.WriteString("[Object]")
+		}
+		return
+	}
+	in.seen = append(in.seen, ptr)
+	defer func() { in.seen = in.seen[:len(in.seen)-1] }()
+
+	switch kind {
+	case KindArray:
+		in.items(b, "", v, depth)
+	case KindTypedArray:
+		in.items(b, name+"("+strconv.FormatInt(v.Len(), 10)+") ", v, depth)
+	case KindArrayBuffer, KindDataView:
+		b.WriteString(name + " { byteLength: " + in.property(v, "byteLength") + " }")
+	case KindMap, KindSet:
+		in.collection(b, name, v, kind, depth)
+	case KindWeakMap, KindWeakSet:
+		b.WriteString(name + " { <items unknown> }")
+	case KindPromise:
+		in.promise(b, v, depth)
+	default:
+		prefix := ""
+		if name != "" && name != "Object" {
+			prefix = name + " "
+		}
+		in.properties(b, prefix, v, depth)
+	}
+}
+
+// items renders the elements of an array or typed array.
+func (in *inspector) items(b *strings.Builder, prefix string, v Value, depth int) {
+	n := v.Len()
+	b.WriteString(prefix)
+	if n == 0 {
+		b.WriteString("[]")
+		return
+	}
+	b.WriteString("[ ")
+	shown := n
+	if max := int64(in.options.maxArrayLength); max >= 0 && shown > max {
+		shown = max
+	}
+	for i := int64(0); i < shown; i++ {
+		if i > 0 {
+			b.WriteString(", ")
+		}
+		in.element(b, v.GetIdx(i), depth)
+	}
+	if shown < n {
+		if shown > 0 {
+			b.WriteString(", ")
+		}
+		b.WriteString("... " + strconv.FormatInt(n-shown, 10) + " more items")
+	}
+	b.WriteString(" ]")
+}
+
+// element renders and frees a value read from a container, which may be a pending exception.
+func (in *inspector) element(b *strings.Builder, val Value, depth int) {
+	defer val.Free()
+	if val.IsException() {
+		C.JS_FreeValue(val.ctx.ref, C.JS_GetException(val.ctx.ref))
+		b.WriteString("[Exception]")
+		return
+	}
+	in.inspect(b, val, depth+1)
+}
+
+// collection renders the entries of a Map or the values of a Set.
+func (in *inspector) collection(b *strings.Builder, name string, v Value, kind Kind, depth int) {
+	arrayCtor := v.ctx.Globals().Get("Array")
+	defer arrayCtor.Free()
+	entries := arrayCtor.Call("from", v)
+	defer entries.Free()
+	if entries.IsException() {
+		C.JS_FreeValue(v.ctx.ref, C.JS_GetException(v.ctx.ref))
+		b.WriteString(name + " {}")
+		return
+	}
+
+	n := entries.Len()
+	b.WriteString(name + "(" + strconv.FormatInt(n, 10) + ") ")
+	if n == 0 {
+		b.WriteString("{}")
+		return
+	}
+	b.WriteString("{ ")
+	shown := n
+	if max := int64(in.options.maxArrayLength); max >= 0 && shown > max {
+		shown = max
+	}
+	for i := int64(0); i < shown; i++ {
+		if i > 0 {
+			b.WriteString(", ")
+		}
+		entry := entries.GetIdx(i)
+		if kind == KindMap {
+			in.element(b, entry.GetIdx(0), depth)
+			b.WriteString(" => ")
+			in.element(b, entry.GetIdx(1), depth)
+		} else {
+			in.inspect(b, entry, depth+1)
+		}
+		entry.Free()
+	}
+	if shown < n {
+		if shown > 0 {
+			b.WriteString(", ")
+		}
+		b.WriteString("... " + strconv.FormatInt(n-shown, 10) + " more items")
+	}
+	b.WriteString(" }")
+}
+
+func (in *inspector) promise(b *strings.Builder, v Value, depth int) {
+	switch v.PromiseState() {
+	case PromiseStatePending:
+		b.WriteString("Promise { <pending> }")
+		return
+	case PromiseStateRejected:
+		b.WriteString("Promise { <rejected> ")
+	default:
+		b.WriteString("Promise { ")
+	}
+	result := v.ctx.newValue(C.JS_PromiseResult(v.ctx.ref, v.ref))
+	defer result.Free()
+	in.inspect(b, result, depth+1)
+	b.WriteString(" }")
+}
+
+// properties renders the own enumerable string properties of the object.
+func (in *inspector) properties(b *strings.Builder, prefix string, v Value, depth int) {
+	// a proxy may throw, which leaves no keys to render
+	keys, _ := v.ownKeys()
+	b.WriteString(prefix)
+	if len(keys) == 0 {
+		b.WriteString("{}")
+		return
+	}
+	b.WriteString("{ ")
+	for i, key := range keys {
+		if i > 0 {
+			b.WriteString(", ")
+		}
+		if identifierPattern.MatchString(key) {
+			b.WriteString(key)
+		} else {
+			b.WriteString(in.quote(key))
+		}
+		b.WriteString(": ")
+		in.ownProperty(b, v, key, depth)
+	}
+	b.WriteString(" }")
+}
+
+// ownProperty renders the own property of the object, without calling its accessors.
+func (in *inspector) ownProperty(b *strings.Builder, v Value, key string, depth int) {
+	atom := v.ctx.Atom(key)
+	defer atom.Free()
+	var desc C.JSPropertyDescriptor
+	switch ret := C.JS_GetOwnProperty(v.ctx.ref, &desc, v.ref, atom.ref); {
+	case ret < 0:
+		C.JS_FreeValue(v.ctx.ref, C.JS_GetException(v.ctx.ref))
+		b.WriteString("[Exception]")
+		return
+	case ret == 0:
+		b.WriteString("undefined")
+		return
+	}
+	defer C.JS_FreeValue(v.ctx.ref, desc.value)
+	defer C.JS_FreeValue(v.ctx.ref, desc.getter)
+	defer C.JS_FreeValue(v.ctx.ref, desc.setter)
+
+	if desc.flags&C.JS_PROP_GETSET != 0 {
+		hasGetter, hasSetter := C.JS_IsUndefined(desc.getter) == 0, C.JS_IsUndefined(desc.setter) == 0
+		switch {
+		case hasGetter && hasSetter:
+			b.WriteString("[Getter/Setter]")
+		case hasGetter:
+			b.WriteString("[Getter]")
+		default:
+			b.WriteString("[Setter]")
+		}
+		return
+	}
+	in.inspect(b, v.ctx.borrow(desc.value), depth+1)
+}
+
+// constructorName returns the name of the object's constructor, or an empty string.
+func (in *inspector) constructorName(v Value) string {
+	ctor := v.Get("constructor")
+	defer ctor.Free()
+	if ctor.IsException() {
+		C.JS_FreeValue(v.ctx.ref, C.JS_GetException(v.ctx.ref))
+		return ""
+	}
+	if !ctor.IsFunction() {
+		return ""
+	}
+	return in.stringProperty(ctor, "name")
+}
+
+// stringProperty returns the property of the object if it is a string, or an empty string.
+func (in *inspector) stringProperty(v Value, name string) string {
+	val := v.Get(name)
+	defer val.Free()
+	if val.IsException() {
+		C.JS_FreeValue(v.ctx.ref, C.JS_GetException(v.ctx.ref))
+		return ""
+	}
+	if !val.IsString() {
+		return ""
+	}
+	return val.String()
+}
+
+// property returns the string conversion of the property of the object.
+func (in *inspector) property(v Value, name string) string {
+	val := v.Get(name)
+	defer val.Free()
+	if val.IsException() {
+		C.JS_FreeValue(v.ctx.ref, C.JS_GetException(v.ctx.ref))
+		return ""
+	}
+	return val.String()
+}
@@ -0,0 +1,95 @@
+package quickjs
+
+/*
+#include "bridge.h"
+*/
+import "C"
+import (
+	"runtime/cgo"
+	"time"
+)
+
+// InterruptInfo describes the context running when the interrupt handler is polled.
+type InterruptInfo struct {
+	Context *Context
+	Elapsed time.Duration // time since Go entered the context, e.g. with Eval, Call or Loop
+	Tag     interface{}   // the tag of the context, see SetTag
+	Origin  string        // the origin of the code running, see EvalOrigin
+}
+
+// ContextInterruptHandler is a function type for the interrupt handler of a context.
+/* return != 0 if the JS code needs to be interrupted */
+type ContextInterruptHandler func(info InterruptInfo) int
+
+// interruptState dispatches the runtime's interrupt polls to the handler of the running context.
+type interruptState struct {
+	handle  cgo.Handle
+	handler InterruptHandler // the runtime-wide handler set by SetInterruptHandler
+	current *Context
+	started time.Time
+
+	limits *Limits // see WithLimits
+	polls  uint64  // the polls of the running entry
+	calls  uint64  // the host function calls of the running entry, see Limits.MaxHostCalls
+	hit    Limit   // the limit which interrupted the execution, until its exception is converted
+
+	timeout        time.Duration // see SetExecuteTimeout
+	timeoutStarted time.Time
+}
+
+// install makes the runtime poll the state.
+func (s *interruptState) install(rt *C.JSRuntime) {
+	C.SetInterruptHandler(rt, C.uintptr_t(s.handle))
+}
+
+// interrupt checks the limits and the execute timeout, which always apply, then asks the handler of the running context,
+// or else the runtime-wide one.
+func (s *interruptState) interrupt() int {
+	if s.exceeded() {
+		return 1
+	}
+	if s.timeout > 0 && time.Since(s.timeoutStarted) > s.timeout {
+		return 1
+	}
+	if ctx := s.current; ctx != nil && ctx.interruptHandler != nil {
+		return ctx.interruptHandler(InterruptInfo{Context: ctx, Elapsed: time.Since(s.started), Tag: ctx.tag, Origin: ctx.origin})
+	}
+	if s.handler != nil {
+		return s.handler()
+	}
+	return 0
+}
+
+// enter records the context as running until the returned function is called.
+// Nested entries of the same context keep the start time of the outermost one.
+func (ctx *Context) enter() func() {
+	s := ctx.runtime.interrupts
+	current, started, polls, calls := s.current, s.started, s.polls, s.calls
+	if current != ctx {
+		s.current, s.started, s.polls, s.calls = ctx, time.Now(), 0, 0
+	}
+	ctx.running++
+	return func() {
+		ctx.running--
+		s.current, s.started, s.polls, s.calls = current, started, polls, calls
+	}
+}
+
+// SetContextInterruptHandler sets the interrupt handler used while the context runs, in place of the runtime-wide one set by SetInterruptHandler;
+// use nil to remove it. The execute timeout of the runtime and the limits of WithLimits still apply. It lets a runtime hosting several tenants enforce a different budget per context.
+func (ctx *Context) SetContextInterruptHandler(handler ContextInterruptHandler) {
+	ctx.interruptHandler = handler
+	if handler != nil {
+		ctx.runtime.interrupts.install(ctx.runtime.ref)
+	}
+}
+
+// SetTag sets an opaque value identifying the context, passed to its interrupt handler.
+func (ctx *Context) SetTag(tag interface{}) {
+	ctx.tag = tag
+}
+
+// Tag returns the tag of the context.
+func (ctx *Context) Tag() interface{} {
+	return ctx.tag
+}
@@ -0,0 +1,101 @@
+package quickjs
+
+/*
+#include "bridge.h"
+*/
+import "C"
+import "errors"
+
+// ErrNotIterable is the error of Iterate for a value without a Symbol.iterator method.
+var ErrNotIterable = errors.New("quickjs: value is not iterable")
+
+// iteratorKey returns the atom of Symbol.iterator, created once per context.
+func (ctx *Context) iteratorKey() *Atom {
+	if ctx.iteratorAtom == nil {
+		symbolCtor := ctx.Globals().Get("Symbol")
+		defer symbolCtor.Free()
+		symbol := symbolCtor.Get("iterator")
+		defer symbol.Free()
+		ctx.iteratorAtom = &Atom{ctx: ctx, ref: C.JS_ValueToAtom(ctx.ref, symbol.ref)}
+	}
+	return ctx.iteratorAtom
+}
+
+// Iterate calls fn with the values of the iterable in order, as a for-of loop does, until fn returns false or the iterator is done:
+// it works with arrays, strings, Maps, Sets, generators and any object implementing the protocol of Symbol.iterator, without
+// converting them with Array.from first. The value passed to fn is freed once it returns, so fn must dup what it keeps, e.g. with Migrate.
+// When fn stops the iteration, the iterator is closed by calling its return method, which runs the finally blocks of a generator.
+// It returns ErrNotIterable if the value is not iterable, or the exception thrown by the iteration; async iterables are not supported.
+func (v Value) Iterate(fn func(*Value) bool) error {
+	ctx := v.ctx
+	if err := ctx.checkGoroutine(); err != nil {
+		return err
+	}
+	method := v.GetAtom(ctx.iteratorKey())
+	defer method.Free()
+	if method.IsException() {
+		return ctx.exceptionError()
+	}
+	if !method.IsFunction() {
+		return ErrNotIterable
+	}
+	iterator := ctx.Invoke(method, v)
+	defer iterator.Free()
+	if iterator.IsException() {
+		return ctx.exceptionError()
+	}
+	if !iterator.IsObject() {
+		return errors.New("quickjs: iterator is not an object")
+	}
+	next := iterator.Get("next")
+	defer next.Free()
+
+	for {
+		result := ctx.Invoke(next, iterator)
+		if result.IsException() {
+			return ctx.exceptionError()
+		}
+		if !result.IsObject() {
+			result.Free()
+			return errors.New("quickjs: iterator result is not an object")
+		}
+		done := result.Get("done")
+		value := result.Get("value")
+		result.Free()
+		if done.IsException() || value.IsException() {
+			done.Free()
+			value.Free()
+			return ctx.exceptionError()
+		}
+		if done.Bool() {
+			done.Free()
+			value.Free()
+			return nil
+		}
+		done.Free()
+		more := fn(&value)
+		value.Free()
+		if !more {
+			return closeIterator(iterator)
+		}
+	}
+}
+
+// closeIterator calls the return method of the iterator, if any, returning its exception.
+func closeIterator(iterator Value) error {
+	ctx := iterator.ctx
+	method := iterator.Get("return")
+	defer method.Free()
+	if method.IsException() {
+		return ctx.exceptionError()
+	}
+	if !method.IsFunction() {
+		return nil
+	}
+	ret := ctx.Invoke(method, iterator)
+	defer ret.Free()
+	if ret.IsException() {
+		return ctx.exceptionError()
+	}
+	return nil
+}
@@ -0,0 +1,185 @@
+package quickjs
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// defaultJobQueueSize is the size of the job queue of contexts, see WithJobQueueSize.
+const defaultJobQueueSize = 1024
+
+var (
+	// ErrContextClosed is the error of the jobs scheduled on a closed context, or still queued when it is closed.
+	ErrContextClosed = errors.New("quickjs: context closed")
+	// ErrJobQueueFull is the error of the jobs scheduled on a context whose job queue is full.
+	ErrJobQueueFull = errors.New("quickjs: job queue full")
+)
+
+// WithJobQueueSize will set the number of jobs queued by each context with Schedule or EvalAsync; default is 1024.
+func WithJobQueueSize(size int) Option {
+	return func(o *Options) {
+		o.jobQueueSize = size
+	}
+}
+
+// JobQueueStats describes the job queue of a context, see Context.JobQueueStats.
+type JobQueueStats struct {
+	Size      int    // the capacity of the queue, see WithJobQueueSize
+	Queued    int    // the jobs waiting to run
+	Scheduled uint64 // the jobs accepted since the context was created
+	Dropped   uint64 // the jobs rejected with ErrJobQueueFull since the context was created
+}
+
+// job is a function queued by Schedule; cancel, if not nil, is called instead of run when the context is closed first.
+type job struct {
+	run    func(ctx *Context)
+	cancel func(err error)
+}
+
+// jobQueue holds the jobs scheduled on a context until it runs them.
+type jobQueue struct {
+	jobs      chan job
+	done      chan struct{} // closed by close
+	closeOnce sync.Once
+
+	mu        sync.RWMutex // held for writing by close, for reading while pushing
+	closed    bool
+	scheduled uint64
+	dropped   uint64
+}
+
+func newJobQueue(size int) *jobQueue {
+	return &jobQueue{jobs: make(chan job, size), done: make(chan struct{})}
+}
+
+// push queues the job, waiting for room until the wait channel, if not nil, is closed.
+func (q *jobQueue) push(j job, wait <-chan struct{}) error {
+	q.mu.RLock()
+	defer q.mu.RUnlock()
+	if q.closed {
+		return ErrContextClosed
+	}
+	select {
+	case q.jobs <- j:
+		atomic.AddUint64(&q.scheduled, 1)
+		return nil
+	default:
+	}
+	if wait == nil {
+		atomic.AddUint64(&q.dropped, 1)
+		return ErrJobQueueFull
+	}
+	select {
+	case q.jobs <- j:
+		atomic.AddUint64(&q.scheduled, 1)
+		return nil
+	case <-q.done:
+		return ErrContextClosed
+	case <-wait:
+		return ErrJobQueueFull
+	}
+}
+
+// take returns the jobs queued so far.
+func (q *jobQueue) take() []job {
+	jobs := make([]job, 0, len(q.jobs))
+	for n := len(q.jobs); n > 0; n-- {
+		jobs = append(jobs, <-q.jobs)
+	}
+	return jobs
+}
+
+// next waits for the next job, unless the queue is closed first.
+func (q *jobQueue) next() (job, bool) {
+	select {
+	case j := <-q.jobs:
+		return j, true
+	case <-q.done:
+		return job{}, false
+	}
+}
+
+// poll returns the next job if one is queued, without waiting.
+func (q *jobQueue) poll() (job, bool) {
+	select {
+	case j := <-q.jobs:
+		return j, true
+	default:
+		return job{}, false
+	}
+}
+
+// nextUntil waits for the next job until the timeout channel, if not nil, fires or the queue is closed.
+func (q *jobQueue) nextUntil(timeout <-chan time.Time) (job, bool) {
+	select {
+	case j := <-q.jobs:
+		return j, true
+	case <-timeout:
+		return job{}, false
+	case <-q.done:
+		return job{}, false
+	}
+}
+
+// close closes the queue, returning the jobs left.
+func (q *jobQueue) close() []job {
+	q.closeOnce.Do(func() { close(q.done) })
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.closed = true
+	return q.take()
+}
+
+// Schedule queues fn to run with the context without waiting for it, so it may be called from any goroutine.
+// With WithDedicatedThread the job runs on the thread as soon as it is free; otherwise it runs in the next Loop of the context,
+// on the goroutine calling Loop. Schedule fails with ErrJobQueueFull if the queue is full, see WithJobQueueSize,
+// and with ErrContextClosed if the context is closed; the jobs still queued when the context is closed are dropped.
+func (ctx *Context) Schedule(fn func(ctx *Context)) error {
+	return ctx.schedule(job{run: fn}, nil)
+}
+
+// ScheduleWait is Schedule waiting for room in a full queue until the context of the caller is done,
+// in which case it fails with ErrJobQueueFull.
+func (ctx *Context) ScheduleWait(goctx context.Context, fn func(ctx *Context)) error {
+	return ctx.schedule(job{run: fn}, goctx.Done())
+}
+
+func (ctx *Context) schedule(j job, wait <-chan struct{}) error {
+	if err := ctx.jobQueue.push(j, wait); err != nil {
+		return err
+	}
+	if t := ctx.runtime.thread; t != nil {
+		t.post(ctx.runJobs)
+	}
+	return nil
+}
+
+// JobQueueStats returns the state of the job queue of the context.
+func (ctx *Context) JobQueueStats() JobQueueStats {
+	q := ctx.jobQueue
+	return JobQueueStats{
+		Size:      cap(q.jobs),
+		Queued:    len(q.jobs),
+		Scheduled: atomic.LoadUint64(&q.scheduled),
+		Dropped:   atomic.LoadUint64(&q.dropped),
+	}
+}
+
+// runJobs runs the jobs queued so far; the jobs they schedule run next time.
+func (ctx *Context) runJobs() {
+	for _, j := range ctx.jobQueue.take() {
+		j.run(ctx)
+	}
+}
+
+// closeJobs closes the job queue, cancelling the jobs left.
+func (ctx *Context) closeJobs() {
+	for _, j := range ctx.jobQueue.close() {
+		if j.cancel != nil {
+			j.cancel(ErrContextClosed)
+		}
+	}
+}
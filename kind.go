@@ -0,0 +1,173 @@
+package quickjs
+
+/*
+#include "bridge.h"
+*/
+import "C"
+import "sync"
+
+// Kind is the kind of a value, refining the JS typeof for the built-in objects.
+type Kind int
+
+const (
+	KindUnknown Kind = iota
+	KindUndefined
+	KindNull
+	KindBool
+	KindNumber
+	KindBigInt
+	KindString
+	KindSymbol
+	KindObject
+	KindFunction
+	KindArray
+	KindError
+	KindDate
+	KindRegExp
+	KindPromise
+	KindMap
+	KindSet
+	KindWeakMap
+	KindWeakSet
+	KindArrayBuffer
+	KindTypedArray
+	KindDataView
+	KindGenerator
+	KindAsyncGenerator
+)
+
+var kindNames = [...]string{
+	KindUnknown:        "unknown",
+	KindUndefined:      "undefined",
+	KindNull:           "null",
+	KindBool:           "boolean",
+	KindNumber:         "number",
+	KindBigInt:         "bigint",
+	KindString:         "string",
+	KindSymbol:         "symbol",
+	KindObject:         "object",
+	KindFunction:       "function",
+	KindArray:          "array",
+	KindError:          "error",
+	KindDate:           "date",
+	KindRegExp:         "regexp",
+	KindPromise:        "promise",
+	KindMap:            "map",
+	KindSet:            "set",
+	KindWeakMap:        "weakmap",
+	KindWeakSet:        "weakset",
+	KindArrayBuffer:    "arraybuffer",
+	KindTypedArray:     "typedarray",
+	KindDataView:       "dataview",
+	KindGenerator:      "generator",
+	KindAsyncGenerator: "asyncgenerator",
+}
+
+// String returns the name of the kind.
+func (k Kind) String() string {
+	if k < 0 || int(k) >= len(kindNames) {
+		return "unknown"
+	}
+	return kindNames[k]
+}
+
+// builtinClassesScript returns a sample object of each built-in class recognized by Kind, with its kind,
+// and for the typed arrays their constructor name.
+const builtinClassesScript = `(() => {
+	const samples = [
+		[new Date(0), "date"], [/x/, "regexp"], [Promise.resolve(), "promise"],
+		[new Map(), "map"], [new Set(), "set"], [new WeakMap(), "weakmap"], [new WeakSet(), "weakset"],
+		[new ArrayBuffer(0), "arraybuffer"], [new DataView(new ArrayBuffer(0)), "dataview"],
+		[(function* () {})(), "generator"], [(async function* () {})(), "asyncgenerator"],
+	];
+	for (const name of ["Int8Array", "Uint8Array", "Uint8ClampedArray", "Int16Array", "Uint16Array", "Int32Array", "Uint32Array",
+		"BigInt64Array", "BigUint64Array", "Float16Array", "Float32Array", "Float64Array"]) {
+		if (typeof globalThis[name] === "function") {
+			samples.push([new globalThis[name](0), "typedarray", name]);
+		}
+	}
+	return samples;
+})()`
+
+// builtinClasses maps the class ids of the built-in objects, which are the same in every runtime, to their kind,
+// and the ones of the typed arrays to their constructor name.
+var builtinClasses struct {
+	once        sync.Once
+	kinds       map[C.JSClassID]Kind
+	typedArrays map[C.JSClassID]string
+}
+
+// loadBuiltinClasses fills builtinClasses from sample objects created in the context.
+func (ctx *Context) loadBuiltinClasses() {
+	kinds := make(map[C.JSClassID]Kind)
+	typedArrays := make(map[C.JSClassID]string)
+	defer func() { builtinClasses.kinds, builtinClasses.typedArrays = kinds, typedArrays }()
+
+	samples, err := ctx.eval(builtinClassesScript, EvalFileName("<kind>"))
+	if err != nil {
+		return
+	}
+	defer samples.Free()
+	byName := make(map[string]Kind, len(kindNames))
+	for k, name := range kindNames {
+		byName[name] = Kind(k)
+	}
+	for i := int64(0); i < samples.Len(); i++ {
+		sample := samples.GetIdx(i)
+		obj, name, ctor := sample.GetIdx(0), sample.GetIdx(1), sample.GetIdx(2)
+		kinds[C.JS_GetClassID(obj.ref)] = byName[name.String()]
+		if ctor.IsString() {
+			typedArrays[C.JS_GetClassID(obj.ref)] = ctor.String()
+		}
+		obj.Free()
+		name.Free()
+		ctor.Free()
+		sample.Free()
+	}
+}
+
+// Kind returns the kind of the value. Objects of classes not listed, including user classes, are KindObject,
+// except functions, arrays and errors, which are recognized whatever their class.
+func (v Value) Kind() Kind {
+	switch {
+	case v.IsUndefined():
+		return KindUndefined
+	case v.IsNull():
+		return KindNull
+	case v.IsBool():
+		return KindBool
+	case v.IsNumber():
+		return KindNumber
+	case v.IsBigInt():
+		return KindBigInt
+	case v.IsString():
+		return KindString
+	case v.IsSymbol():
+		return KindSymbol
+	case !v.IsObject():
+		return KindUnknown
+	case v.IsFunction():
+		return KindFunction
+	case v.IsArray():
+		return KindArray
+	case v.IsError():
+		return KindError
+	}
+
+	builtinClasses.once.Do(v.ctx.loadBuiltinClasses)
+	if kind, ok := builtinClasses.kinds[C.JS_GetClassID(v.ref)]; ok {
+		return kind
+	}
+	return KindObject
+}
+
+// TypeOf returns the type of the value as the JS typeof operator does, e.g. "object" for null and arrays.
+func (v Value) TypeOf() string {
+	switch kind := v.Kind(); kind {
+	case KindUndefined, KindBool, KindNumber, KindBigInt, KindString, KindSymbol, KindFunction:
+		return kind.String()
+	case KindUnknown:
+		return "undefined"
+	}
+	return "object"
+}
@@ -0,0 +1,66 @@
+package quickjs
+
+// OnClose registers fn to be called when the context is closed, before its values are freed, e.g. to release
+// the resources exposed to its scripts. The functions are called in the reverse order of their registration.
+func (ctx *Context) OnClose(fn func(ctx *Context)) {
+	ctx.closeHooks = append(ctx.closeHooks, fn)
+}
+
+// OnReset registers fn to be called when the context is reset, once its global object is replaced,
+// e.g. to release the resources of the previous scripts and to define globals again, see Reset.
+// The functions are called in the order of their registration.
+func (ctx *Context) OnReset(fn func(ctx *Context)) {
+	ctx.resetHooks = append(ctx.resetHooks, fn)
+}
+
+// OnGC registers fn to be called with the context after each collection run by Runtime.RunGC, until the context is closed;
+// the automatic collections of the engine are not reported. The functions are called in the order of their registration.
+func (ctx *Context) OnGC(fn func(ctx *Context, info GCInfo)) {
+	hooks := ctx.runtime.gcHooks
+	hooks.hooks = append(hooks.hooks, gcHook{ctx: ctx, fn: fn})
+}
+
+// runCloseHooks calls the functions registered by OnClose, once, and forgets the functions registered by OnGC.
+func (ctx *Context) runCloseHooks() {
+	ctx.runtime.gcHooks.remove(ctx)
+	hooks := ctx.closeHooks
+	ctx.closeHooks = nil
+	for i := len(hooks) - 1; i >= 0; i-- {
+		hooks[i](ctx)
+	}
+}
+
+// runResetHooks calls the functions registered by OnReset.
+func (ctx *Context) runResetHooks() {
+	for _, fn := range ctx.resetHooks {
+		fn(ctx)
+	}
+}
+
+// gcHooks are the functions registered by the contexts of a runtime with OnGC.
+type gcHooks struct {
+	hooks []gcHook
+}
+
+type gcHook struct {
+	ctx *Context
+	fn  func(ctx *Context, info GCInfo)
+}
+
+// run calls the functions with the information of the last collection.
+func (h *gcHooks) run(info GCInfo) {
+	for _, hook := range append([]gcHook(nil), h.hooks...) {
+		hook.fn(hook.ctx, info)
+	}
+}
+
+// remove forgets the functions of the context.
+func (h *gcHooks) remove(ctx *Context) {
+	hooks := h.hooks[:0]
+	for _, hook := range h.hooks {
+		if hook.ctx != ctx {
+			hooks = append(hooks, hook)
+		}
+	}
+	h.hooks = hooks
+}
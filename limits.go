@@ -0,0 +1,199 @@
+package quickjs
+
+/*
+#include "bridge.h"
+*/
+import "C"
+import "time"
+
+// Limits bounds the resources of the scripts run by a runtime; a zero field means no limit.
+type Limits struct {
+	// WallTime bounds the time of each entry of Go into a context, e.g. one Eval, Call or Loop, including nested entries.
+	WallTime time.Duration
+	// MemoryBytes bounds the memory of the runtime, see WithMemoryLimit.
+	MemoryBytes uint64
+	// StackBytes bounds the stack used by scripts, see WithMaxStackSize.
+	StackBytes uint64
+	// MaxInterrupts bounds the number of times the engine polls the interrupt handler in each entry of Go into a context,
+	// roughly every 10000 bytecode instructions, which gives a deterministic budget for loops.
+	MaxInterrupts uint64
+	// MaxHostCalls bounds the number of calls of host functions, e.g. the ones of Function, NamedFunction or FastFunction,
+	// in each entry of Go into a context, protecting the host from scripts calling expensive callbacks in tight loops.
+	MaxHostCalls uint64
+}
+
+// Limit identifies the limit of Limits hit by a script.
+type Limit int
+
+const (
+	LimitWallTime Limit = iota + 1
+	LimitMemory
+	LimitStack
+	LimitInterrupts
+	LimitHostCalls
+	LimitStringLength
+	LimitArrayLength
+	LimitHandles
+)
+
+// String returns the name of the limit.
+func (l Limit) String() string {
+	switch l {
+	case LimitWallTime:
+		return "wall time"
+	case LimitMemory:
+		return "memory"
+	case LimitStack:
+		return "stack"
+	case LimitInterrupts:
+		return "interrupts"
+	case LimitHostCalls:
+		return "host calls"
+	case LimitStringLength:
+		return "string length"
+	case LimitArrayLength:
+		return "array length"
+	case LimitHandles:
+		return "handles"
+	}
+	return "unknown"
+}
+
+// LimitError is the error wrapped by the *Error of a script which hit a limit, see WithLimits.
+type LimitError struct {
+	Limit Limit
+}
+
+func (err *LimitError) Error() string {
+	return "quickjs: " + err.Limit.String() + " limit exceeded"
+}
+
+// WithLimits will bound the time, memory, stack, loop iterations and host function calls of the runtime's scripts together.
+// A script hitting a limit fails with an *Error wrapping a *LimitError, so errors.As tells which limit was hit.
+// The time and interrupt limits are checked by the interrupt handler, before the handler set by SetInterruptHandler
+// or SetContextInterruptHandler, and together with SetExecuteTimeout.
+// They do not apply while the event loop waits for a timer, nor while parsing, see CompileContext.
+func WithLimits(limits Limits) Option {
+	return func(o *Options) {
+		o.limits = &limits
+		if limits.MemoryBytes > 0 {
+			o.memoryLimit = limits.MemoryBytes
+		}
+		if limits.StackBytes > 0 {
+			o.maxStackSize = limits.StackBytes
+		}
+	}
+}
+
+// WithMaxStringLength will set the maximum length in bytes of the strings converted between Go and JS by the binding:
+// the strings created by Context.String, NewStringLen and Marshal, and the ones read by ToString and Unmarshal. A longer string
+// fails with a *LimitError of LimitStringLength, thrown by the methods returning a Value, so that a host converting untrusted input
+// fails early instead of copying it; default is 0, no limit. The strings of scripts themselves are bounded by the memory limit only.
+func WithMaxStringLength(max int) Option {
+	return func(o *Options) {
+		o.maxString = max
+	}
+}
+
+// WithMaxArrayLength will set the maximum number of elements of the arrays converted between Go and JS by the binding,
+// and of bytes of their ArrayBuffers: the ones created by Context.ArrayBuffer and Marshal, and the ones read by ToByteArray
+// and Unmarshal, e.g. a sparse array whose length would make Unmarshal allocate a huge slice. A longer array fails like
+// a string longer than WithMaxStringLength, with LimitArrayLength; default is 0, no limit.
+func WithMaxArrayLength(max int64) Option {
+	return func(o *Options) {
+		o.maxArray = max
+	}
+}
+
+// checkStringLength returns the *LimitError of a string of n bytes longer than WithMaxStringLength.
+func (ctx *Context) checkStringLength(n int) error {
+	if max := ctx.runtime.options.maxString; max > 0 && n > max {
+		return &LimitError{Limit: LimitStringLength}
+	}
+	return nil
+}
+
+// checkArrayLength returns the *LimitError of an array of n elements longer than WithMaxArrayLength.
+func (ctx *Context) checkArrayLength(n int64) error {
+	if max := ctx.runtime.options.maxArray; max > 0 && n > max {
+		return &LimitError{Limit: LimitArrayLength}
+	}
+	return nil
+}
+
+// exceeded checks the time and interrupt limits of the running entry, recording the limit hit.
+func (s *interruptState) exceeded() bool {
+	limits := s.limits
+	if limits == nil || s.current == nil {
+		return false
+	}
+	s.polls++
+	switch {
+	case limits.WallTime > 0 && time.Since(s.started) > limits.WallTime:
+		s.hit = LimitWallTime
+	case limits.MaxInterrupts > 0 && s.polls > limits.MaxInterrupts:
+		s.hit = LimitInterrupts
+	default:
+		return false
+	}
+	return true
+}
+
+// countHostCall counts a call of a host function in the running entry; past the MaxHostCalls limit, it records the limit hit
+// and returns the exception interrupting the script, which cannot catch it, instead of calling the function.
+func (ctx *Context) countHostCall() (C.JSValue, bool) {
+	s := ctx.runtime.interrupts
+	if s.limits == nil || s.limits.MaxHostCalls == 0 || s.current == nil {
+		return C.JS_NewUndefined(), false
+	}
+	s.calls++
+	if s.calls <= s.limits.MaxHostCalls {
+		return C.JS_NewUndefined(), false
+	}
+	s.hit = LimitHostCalls
+	return C.ThrowInterrupted(ctx.ref), true
+}
+
+// limitError returns the limit hit by the exception converted to the cause, if any.
+func (ctx *Context) limitError(cause string) error {
+	var limit Limit
+	switch cause {
+	case "InternalError: out of memory":
+		limit = LimitMemory
+	case "InternalError", "null":
+		// out of memory, the engine may fail to allocate the message of the error, or the error itself and throw null
+		if ctx.outOfMemory() {
+			limit = LimitMemory
+		}
+	case "InternalError: stack overflow":
+		limit = LimitStack
+	case "InternalError: interrupted":
+		s := ctx.runtime.interrupts
+		limit, s.hit = s.hit, 0
+	}
+	if limit == 0 {
+		return nil
+	}
+	return &LimitError{Limit: limit}
+}
+
+// liftMemoryLimit removes the memory limit of the runtime until the returned function is called,
+// so that the exception of a script which exhausted the memory can still be converted to a string.
+func (ctx *Context) liftMemoryLimit() func() {
+	limit := ctx.runtime.options.memoryLimit
+	if limit == 0 {
+		return func() {}
+	}
+	C.JS_SetMemoryLimit(ctx.runtime.ref, ^C.size_t(0))
+	return func() { C.JS_SetMemoryLimit(ctx.runtime.ref, C.size_t(limit)) }
+}
+
+// outOfMemoryMargin is the distance to its memory limit below which a runtime is considered out of memory;
+// it leaves room for the temporaries freed while the exception unwinds the stack.
+const outOfMemoryMargin = 64 << 10
+
+// outOfMemory reports whether the memory of the runtime is within outOfMemoryMargin of its limit.
+func (ctx *Context) outOfMemory() bool {
+	limit := ctx.runtime.options.memoryLimit
+	return limit > 0 && uint64(ctx.runtime.MemoryUsage().MallocSize)+outOfMemoryMargin > limit
+}
@@ -0,0 +1,158 @@
+package quickjs
+
+import "time"
+
+// DateFormat is the part of a date formatted by Locale.FormatDate.
+type DateFormat int
+
+const (
+	// DateFormatDateTime is the date and time, for Date.prototype.toLocaleString.
+	DateFormatDateTime DateFormat = iota
+	// DateFormatDate is the date, for Date.prototype.toLocaleDateString.
+	DateFormatDate
+	// DateFormatTime is the time, for Date.prototype.toLocaleTimeString.
+	DateFormatTime
+)
+
+// Locale delegates the locale-sensitive methods of scripts to Go, e.g. to golang.org/x/text, as the engine has no Intl support.
+// A nil function keeps the method of the engine, which ignores the locale.
+// The locale passed to the functions is the first one given by the script, or else Default; the options are the script's options object, or nil.
+type Locale struct {
+	// Default is the locale used when a script gives none, e.g. "en-US".
+	Default string
+	// FormatNumber implements Number.prototype.toLocaleString.
+	FormatNumber func(locale string, n float64, options map[string]interface{}) string
+	// FormatDate implements Date.prototype.toLocaleString, toLocaleDateString and toLocaleTimeString for valid dates;
+	// invalid dates format as "Invalid Date".
+	FormatDate func(locale string, t time.Time, format DateFormat, options map[string]interface{}) string
+	// Compare implements String.prototype.localeCompare, returning a negative number, zero or a positive number
+	// as a sorts before, with or after b.
+	Compare func(locale string, a, b string, options map[string]interface{}) int
+}
+
+// localeScript returns the function installing the methods of a Locale, or restoring the engine's ones for null functions.
+const localeScript = `(() => {
+	const originals = {
+		number: Number.prototype.toLocaleString,
+		dateTime: Date.prototype.toLocaleString,
+		date: Date.prototype.toLocaleDateString,
+		time: Date.prototype.toLocaleTimeString,
+		compare: String.prototype.localeCompare,
+	};
+	const define = (proto, name, fn) => {
+		Object.defineProperty(fn, "name", { value: name, configurable: true });
+		Object.defineProperty(proto, name, { value: fn, writable: true, configurable: true });
+	};
+	return (formatNumber, formatDate, compare, defaultLocale) => {
+		const locale = (locales) => {
+			if (typeof locales === "string") {
+				return locales;
+			}
+			if (Array.isArray(locales) && typeof locales[0] === "string") {
+				return locales[0];
+			}
+			return defaultLocale;
+		};
+		const dateMethod = (format) => function (locales, options) {
+			const time = Date.prototype.getTime.call(this);
+			return time !== time ? "Invalid Date" : formatDate(locale(locales), time, format, options);
+		};
+
+		define(Number.prototype, "toLocaleString", formatNumber ? function (locales, options) {
+			return formatNumber(locale(locales), Number.prototype.valueOf.call(this), options);
+		} : originals.number);
+		define(Date.prototype, "toLocaleString", formatDate ? dateMethod(0) : originals.dateTime);
+		define(Date.prototype, "toLocaleDateString", formatDate ? dateMethod(1) : originals.date);
+		define(Date.prototype, "toLocaleTimeString", formatDate ? dateMethod(2) : originals.time);
+		define(String.prototype, "localeCompare", compare ? function (that, locales, options) {
+			if (this === undefined || this === null) {
+				throw new TypeError("String.prototype.localeCompare called on null or undefined");
+			}
+			return compare(locale(locales), String(this), String(that), options);
+		} : originals.compare);
+	};
+})()`
+
+// SetLocale delegates the locale-sensitive methods of the context's scripts to the functions of the locale; use nil to restore the engine's methods.
+// The locale is kept by Reset.
+func (ctx *Context) SetLocale(locale *Locale) error {
+	if ctx.localeInstaller == nil {
+		installer, err := ctx.eval(localeScript, EvalFileName("<locale>"))
+		if err != nil {
+			return err
+		}
+		installer.keep()
+		ctx.localeInstaller = &installer
+	}
+	if locale == nil {
+		locale = &Locale{}
+	}
+
+	formatNumber, formatDate, compare := ctx.Null(), ctx.Null(), ctx.Null()
+	if fn := locale.FormatNumber; fn != nil {
+		formatNumber = ctx.NamedFunction("formatNumber", 3, func(ctx *Context, this Value, args []Value) Value {
+			options, err := localeOptions(args[2])
+			if err != nil {
+				return ctx.ThrowTypeError("%s", err)
+			}
+			return ctx.String(fn(args[0].String(), args[1].Float64(), options))
+		})
+	}
+	if fn := locale.FormatDate; fn != nil {
+		formatDate = ctx.NamedFunction("formatDate", 4, func(ctx *Context, this Value, args []Value) Value {
+			options, err := localeOptions(args[3])
+			if err != nil {
+				return ctx.ThrowTypeError("%s", err)
+			}
+			t := time.UnixMilli(args[1].Int64())
+			return ctx.String(fn(args[0].String(), t, DateFormat(args[2].Int32()), options))
+		})
+	}
+	if fn := locale.Compare; fn != nil {
+		compare = ctx.NamedFunction("compare", 4, func(ctx *Context, this Value, args []Value) Value {
+			options, err := localeOptions(args[3])
+			if err != nil {
+				return ctx.ThrowTypeError("%s", err)
+			}
+			return ctx.Int32(int32(sign(fn(args[0].String(), args[1].String(), args[2].String(), options))))
+		})
+	}
+	defaultLocale := ctx.String(locale.Default)
+	defer func() {
+		for _, v := range []Value{formatNumber, formatDate, compare, defaultLocale} {
+			v.Free()
+		}
+	}()
+
+	ret := ctx.Invoke(*ctx.localeInstaller, ctx.Null(), formatNumber, formatDate, compare, defaultLocale)
+	defer ret.Free()
+	if ret.IsException() {
+		return ctx.exceptionError()
+	}
+	if locale.FormatNumber == nil && locale.FormatDate == nil && locale.Compare == nil {
+		ctx.locale = nil
+	} else {
+		ctx.locale = locale
+	}
+	return nil
+}
+
+// localeOptions converts the options object of a locale-sensitive method, which may be undefined.
+func localeOptions(val Value) (map[string]interface{}, error) {
+	if !val.IsObject() {
+		return nil, nil
+	}
+	var options map[string]interface{}
+	err := val.Unmarshal(&options)
+	return options, err
+}
+
+func sign(n int) int {
+	switch {
+	case n < 0:
+		return -1
+	case n > 0:
+		return 1
+	}
+	return 0
+}
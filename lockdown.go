@@ -0,0 +1,188 @@
+package quickjs
+
+// LockdownReport describes what Lockdown froze.
+type LockdownReport struct {
+	// Intrinsics are the names of the intrinsics frozen with their properties and prototypes, e.g. "Array" or "%TypedArray%".
+	Intrinsics []string
+	// Objects is the number of objects frozen.
+	Objects int
+	// Overridable are the properties of the frozen objects turned into accessors, so that objects inheriting them can still
+	// define their own by assignment, e.g. "Object.prototype.toString".
+	Overridable []string
+	// EvalDisabled is whether eval and the Function constructors were disabled, see LockdownDisableEval.
+	EvalDisabled bool
+}
+
+// LockdownOption configures Lockdown.
+type LockdownOption func(*lockdownOptions)
+
+type lockdownOptions struct {
+	disableEval bool
+}
+
+// LockdownDisableEval sets whether Lockdown disables eval and the Function constructors before freezing them,
+// see SetEvalEnabled; default is false.
+func LockdownDisableEval(disable bool) LockdownOption {
+	return func(options *lockdownOptions) {
+		options.disableEval = disable
+	}
+}
+
+// intrinsicsScript declares roots, the pairs of the names and values of the intrinsics of the context, and known,
+// the map of the intrinsics and of their prototypes to their names; the scripts using the intrinsics start with it.
+const intrinsicsScript = `
+	const names = [
+		"Object", "Function", "Array", "Number", "Boolean", "String", "Symbol", "BigInt", "Date", "RegExp",
+		"Error", "EvalError", "RangeError", "ReferenceError", "SyntaxError", "TypeError", "URIError", "AggregateError", "InternalError",
+		"Promise", "Proxy", "Reflect", "JSON", "Math", "Map", "Set", "WeakMap", "WeakSet", "WeakRef", "FinalizationRegistry",
+		"ArrayBuffer", "SharedArrayBuffer", "DataView", "Atomics",
+		"Int8Array", "Uint8Array", "Uint8ClampedArray", "Int16Array", "Uint16Array", "Int32Array", "Uint32Array",
+		"BigInt64Array", "BigUint64Array", "Float32Array", "Float64Array",
+		"BigFloat", "BigFloatEnv", "BigDecimal", "Operators",
+		"eval", "parseInt", "parseFloat", "isNaN", "isFinite", "decodeURI", "decodeURIComponent", "encodeURI", "encodeURIComponent",
+		"escape", "unescape",
+	];
+	const hidden = {
+		"%TypedArray%": () => Object.getPrototypeOf(Int8Array),
+		"%AsyncFunction%": () => Object.getPrototypeOf(async function () {}).constructor,
+		"%GeneratorFunction%": () => Object.getPrototypeOf(function* () {}).constructor,
+		"%AsyncGeneratorFunction%": () => Object.getPrototypeOf(async function* () {}).constructor,
+		"%ArrayIteratorPrototype%": () => Object.getPrototypeOf([][Symbol.iterator]()),
+		"%MapIteratorPrototype%": () => Object.getPrototypeOf(new Map()[Symbol.iterator]()),
+		"%SetIteratorPrototype%": () => Object.getPrototypeOf(new Set()[Symbol.iterator]()),
+		"%StringIteratorPrototype%": () => Object.getPrototypeOf(""[Symbol.iterator]()),
+		"%RegExpStringIteratorPrototype%": () => Object.getPrototypeOf(/a/[Symbol.matchAll](""))
+	};
+	const roots = [];
+	for (const name of names) {
+		const desc = Object.getOwnPropertyDescriptor(globalThis, name);
+		if (desc !== undefined && "value" in desc) {
+			roots.push([name, desc.value]);
+		}
+	}
+	for (const [name, get] of Object.entries(hidden)) {
+		try {
+			roots.push([name, get()]);
+		} catch (e) {
+			// not supported by the engine
+		}
+	}
+
+	// the prototypes of the roots are named after them
+	const known = new Map();
+	for (const [name, value] of roots) {
+		known.set(value, name);
+		const proto = typeof value === "function" && Object.getOwnPropertyDescriptor(value, "prototype");
+		if (proto && "value" in proto && Object(proto.value) === proto.value && !known.has(proto.value)) {
+			known.set(proto.value, name + ".prototype");
+		}
+	}
+`
+
+// lockdownScript freezes the intrinsics of the context, naming the other objects by their path from a root, and returns the report.
+const lockdownScript = `(() => {` + intrinsicsScript + `
+	// the properties commonly defined by assignment on objects inheriting them, see the override mistake
+	const overridable = ["constructor", "name", "message", "toString", "toLocaleString", "valueOf"];
+
+	const frozen = new Set();
+	const overridden = [];
+	const tame = (obj, path) => {
+		for (const key of overridable) {
+			const desc = Object.getOwnPropertyDescriptor(obj, key);
+			if (desc === undefined || !("value" in desc) || !desc.writable || !desc.configurable) {
+				continue;
+			}
+			const value = desc.value;
+			Object.defineProperty(obj, key, {
+				get() {
+					return value;
+				},
+				set(newValue) {
+					if (this === obj) {
+						throw new TypeError("Cannot assign to read only property '" + key + "' of frozen intrinsic " + path);
+					}
+					Object.defineProperty(this, key, { value: newValue, writable: true, enumerable: true, configurable: true });
+				},
+				enumerable: desc.enumerable,
+				configurable: false,
+			});
+			overridden.push(path + "." + key);
+		}
+	};
+	const harden = (root, name) => {
+		const queue = [[root, name]];
+		while (queue.length > 0) {
+			const [obj, from] = queue.pop();
+			if ((typeof obj !== "object" || obj === null) && typeof obj !== "function" || frozen.has(obj)) {
+				continue;
+			}
+			const path = known.has(obj) ? known.get(obj) : from;
+			frozen.add(obj);
+			tame(obj, path);
+			Object.freeze(obj);
+			queue.push([Object.getPrototypeOf(obj), path + ".__proto__"]);
+			for (const key of Reflect.ownKeys(obj)) {
+				const desc = Reflect.getOwnPropertyDescriptor(obj, key);
+				const child = path + "." + String(typeof key === "symbol" ? "[" + key.description + "]" : key);
+				if ("value" in desc) {
+					queue.push([desc.value, child]);
+				} else {
+					queue.push([desc.get, child], [desc.set, child]);
+				}
+			}
+		}
+	};
+	roots.forEach(([name, value]) => harden(value, name));
+	return { intrinsics: roots.map(([name]) => name), objects: frozen.size, overridable: overridden.sort() };
+})()`
+
+// Lockdown freezes the intrinsics of the context, e.g. Object.prototype, Array.prototype and Function.prototype, with their
+// properties and prototypes, so that untrusted scripts cannot pollute the prototypes shared with other scripts of the context.
+// The global object itself is not frozen, so scripts still define globals. The commonly overridden properties of the
+// frozen objects, such as toString, become accessors defining an own property on the assigned object,
+// so that assigning them on objects inheriting them keeps working; the report lists them.
+//
+// Lockdown cannot be undone, and Reset locks the new intrinsics down again. The settings changing intrinsics, such as
+// SetLocale, SetRandomSource and SetEvalEnabled, fail afterwards, so they must be applied before; the globals installed by the package
+// on first use, e.g. AbortController, are not frozen.
+func (ctx *Context) Lockdown(opts ...LockdownOption) (*LockdownReport, error) {
+	var options lockdownOptions
+	for _, opt := range opts {
+		opt(&options)
+	}
+	report, err := ctx.lockdownWith(options)
+	if err != nil {
+		return nil, err
+	}
+	ctx.lockdown = &options
+	return report, nil
+}
+
+// lockdownWith freezes the intrinsics of the context with the options.
+func (ctx *Context) lockdownWith(options lockdownOptions) (*LockdownReport, error) {
+	if options.disableEval {
+		if err := ctx.SetEvalEnabled(false); err != nil {
+			return nil, err
+		}
+	}
+	ret, err := ctx.eval(lockdownScript, EvalFileName("<lockdown>"))
+	if err != nil {
+		return nil, err
+	}
+	defer ret.Free()
+
+	var result struct {
+		Intrinsics  []string `json:"intrinsics"`
+		Objects     int      `json:"objects"`
+		Overridable []string `json:"overridable"`
+	}
+	if err := ret.Unmarshal(&result); err != nil {
+		return nil, err
+	}
+	return &LockdownReport{
+		Intrinsics:   result.Intrinsics,
+		Objects:      result.Objects,
+		Overridable:  result.Overridable,
+		EvalDisabled: !ctx.EvalEnabled(),
+	}, nil
+}
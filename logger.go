@@ -0,0 +1,72 @@
+package quickjs
+
+/*
+#include "bridge.h"
+*/
+import "C"
+
+// LogLevel is the severity of a diagnostic passed to a Logger.
+type LogLevel int
+
+const (
+	LogLevelDebug LogLevel = iota
+	LogLevelInfo
+	LogLevelWarn
+	LogLevelError
+)
+
+// String returns the name of the level.
+func (l LogLevel) String() string {
+	switch l {
+	case LogLevelDebug:
+		return "debug"
+	case LogLevelInfo:
+		return "info"
+	case LogLevelWarn:
+		return "warn"
+	case LogLevelError:
+		return "error"
+	}
+	return "unknown"
+}
+
+// Logger receives the diagnostics of the runtime, which are otherwise printed to stderr or dropped:
+// uncaught exceptions of setTimeout callbacks without a handler (error), unhandled promise rejections
+// without a handler (warn) and leak reports without a leak handler (warn). An adapter over log/slog,
+// zap or another structured logger is a few lines.
+type Logger interface {
+	Log(level LogLevel, msg string, fields map[string]interface{})
+}
+
+// WithLogger will set the runtime's logger; default is nil.
+func WithLogger(logger Logger) Option {
+	return func(o *Options) {
+		o.logger = logger
+	}
+}
+
+// SetLogger sets the runtime's logger; use nil to remove it.
+// Promise rejections are reported to the logger as soon as they happen, so a promise rejected before its handler
+// is attached in the same job is logged too.
+func (r Runtime) SetLogger(logger Logger) {
+	r.options.logger = logger
+	r.updatePromiseRejectionTracker()
+}
+
+// updatePromiseRejectionTracker enables the engine's promise rejection tracker if a handler or a logger needs it.
+func (r Runtime) updatePromiseRejectionTracker() {
+	if r.options.promiseRejectionHandler != nil || r.options.logger != nil {
+		C.SetPromiseRejectionTracker(r.ref, C.int(1))
+	} else {
+		C.SetPromiseRejectionTracker(r.ref, C.int(0))
+	}
+}
+
+// errorFields returns the fields describing the error in a diagnostic.
+func errorFields(err *Error) map[string]interface{} {
+	fields := map[string]interface{}{"error": err.Cause}
+	if err.Stack != "" {
+		fields["stack"] = err.Stack
+	}
+	return fields
+}
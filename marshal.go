@@ -0,0 +1,815 @@
+package quickjs
+
+/*
+#include "bridge.h"
+*/
+import "C"
+import (
+	"encoding"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"math/big"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"unsafe"
+)
+
+var (
+	valueType      = reflect.TypeOf(Value{})
+	errorType      = reflect.TypeOf((*error)(nil)).Elem()
+	bigIntType     = reflect.TypeOf(big.Int{})
+	rawJSONType    = reflect.TypeOf(json.RawMessage{})
+	jsonNumberType = reflect.TypeOf(json.Number(""))
+
+	jsonMarshalerType   = reflect.TypeOf((*json.Marshaler)(nil)).Elem()
+	textMarshalerType   = reflect.TypeOf((*encoding.TextMarshaler)(nil)).Elem()
+	jsonUnmarshalerType = reflect.TypeOf((*json.Unmarshaler)(nil)).Elem()
+	textUnmarshalerType = reflect.TypeOf((*encoding.TextUnmarshaler)(nil)).Elem()
+)
+
+// maxSafeInteger is the largest integer a JS number holds exactly.
+const maxSafeInteger = 1<<53 - 1
+
+// Marshal returns a new JS value converted from the Go value:
+//   - nil, and nil pointers, slices and maps become null;
+//   - bools, integers, floats and strings become their JS counterpart, integers beyond 2^53 lose precision;
+//   - *big.Int becomes a BigInt and []byte an ArrayBuffer;
+//   - json.RawMessage is parsed as JSON, json.Number becomes a number, or a BigInt if it is an integer beyond 2^53;
+//   - slices and arrays become arrays; maps with string or integer keys and structs become objects,
+//     map keys are always defined in sorted order, so the result stringifies deterministically,
+//     struct fields are named after their json tag and skipped if tagged "-" or unexported;
+//   - functions become JS functions converting their arguments with Unmarshal and their results with Marshal,
+//     a non-nil trailing error result is thrown;
+//   - a Value is duplicated.
+//
+// With MarshalJSONFallback, types implementing json.Marshaler or encoding.TextMarshaler are converted by those instead.
+// With MarshalTypes, the members of tagged unions get their discriminator field, see RegisterUnion.
+func (ctx *Context) Marshal(v interface{}, opts ...MarshalOption) (Value, error) {
+	if v == nil {
+		return ctx.Null(), nil
+	}
+	options := &MarshalOptions{}
+	for _, fn := range opts {
+		fn(options)
+	}
+	return ctx.marshal(reflect.ValueOf(v), options)
+}
+
+type MarshalOptions struct {
+	jsonFallback bool
+	types        *TypeRegistry
+	depth        int
+}
+
+// maxMarshalDepth bounds the nesting converted by Marshal, so that cyclic values fail instead of overflowing the stack.
+const maxMarshalDepth = 1000
+
+type MarshalOption func(*MarshalOptions)
+
+// MarshalJSONFallback makes Marshal convert the types implementing json.Marshaler, parsing their JSON,
+// or else encoding.TextMarshaler, to a string, like encoding/json does; default is false.
+func MarshalJSONFallback(enabled bool) MarshalOption {
+	return func(options *MarshalOptions) {
+		options.jsonFallback = enabled
+	}
+}
+
+func (ctx *Context) marshal(rv reflect.Value, options *MarshalOptions) (Value, error) {
+	options.depth++
+	defer func() { options.depth-- }()
+	if options.depth > maxMarshalDepth {
+		return ctx.Null(), fmt.Errorf("quickjs: cannot marshal value nested deeper than %d levels", maxMarshalDepth)
+	}
+	if rv.Type() == valueType {
+		return rv.Interface().(Value).dup(), nil
+	}
+	if rv.Type() == bigIntType {
+		n := rv.Interface().(big.Int)
+		return ctx.BigInt(&n), nil
+	}
+	if rv.Type() == rawJSONType {
+		return ctx.marshalRawJSON(rv.Bytes())
+	}
+	if rv.Type() == jsonNumberType {
+		return ctx.marshalJSONNumber(json.Number(rv.String()))
+	}
+	if options.jsonFallback {
+		if val, ok, err := ctx.marshalFallback(rv); ok {
+			return val, err
+		}
+	}
+
+	switch rv.Kind() {
+	case reflect.Bool:
+		return ctx.Bool(rv.Bool()), nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return ctx.Int64(rv.Int()), nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return ctx.Float64(float64(rv.Uint())), nil
+	case reflect.Float32, reflect.Float64:
+		return ctx.Float64(rv.Float()), nil
+	case reflect.String:
+		if err := ctx.checkStringLength(rv.Len()); err != nil {
+			return ctx.Null(), err
+		}
+		return ctx.String(rv.String()), nil
+	case reflect.Interface, reflect.Pointer:
+		if rv.IsNil() {
+			return ctx.Null(), nil
+		}
+		return ctx.marshal(rv.Elem(), options)
+	case reflect.Slice:
+		if rv.IsNil() {
+			return ctx.Null(), nil
+		}
+		if err := ctx.checkArrayLength(int64(rv.Len())); err != nil {
+			return ctx.Null(), err
+		}
+		if rv.Type().Elem().Kind() == reflect.Uint8 {
+			buf := rv.Bytes()
+			if len(buf) == 0 {
+				return ctx.newValue(C.JS_NewArrayBufferCopy(ctx.ref, nil, 0)), nil
+			}
+			return ctx.ArrayBuffer(buf), nil
+		}
+		return ctx.marshalArray(rv, options)
+	case reflect.Array:
+		if err := ctx.checkArrayLength(int64(rv.Len())); err != nil {
+			return ctx.Null(), err
+		}
+		return ctx.marshalArray(rv, options)
+	case reflect.Map:
+		if rv.IsNil() {
+			return ctx.Null(), nil
+		}
+		return ctx.marshalMap(rv, options)
+	case reflect.Struct:
+		return ctx.marshalStruct(rv, options)
+	case reflect.Func:
+		if rv.IsNil() {
+			return ctx.Null(), nil
+		}
+		return ctx.marshalFunc(rv, options), nil
+	}
+	return ctx.Null(), fmt.Errorf("quickjs: cannot marshal %s", rv.Type())
+}
+
+func (ctx *Context) marshalRawJSON(raw []byte) (Value, error) {
+	if raw == nil {
+		return ctx.Null(), nil
+	}
+	val := ctx.ParseJSON(string(raw))
+	if val.IsException() {
+		return ctx.Null(), fmt.Errorf("quickjs: cannot marshal json.RawMessage: %w", ctx.exceptionError())
+	}
+	return val, nil
+}
+
+// marshalJSONNumber converts the number losslessly: integers beyond 2^53 become BigInts.
+func (ctx *Context) marshalJSONNumber(n json.Number) (Value, error) {
+	if n == "" {
+		return ctx.Float64(0), nil
+	}
+	if i, ok := new(big.Int).SetString(string(n), 10); ok {
+		if i.IsInt64() && i.Int64() >= -maxSafeInteger && i.Int64() <= maxSafeInteger {
+			return ctx.Int64(i.Int64()), nil
+		}
+		return ctx.BigInt(i), nil
+	}
+	f, err := n.Float64()
+	if err != nil {
+		return ctx.Null(), fmt.Errorf("quickjs: cannot marshal json.Number %q", string(n))
+	}
+	return ctx.Float64(f), nil
+}
+
+// marshalFallback converts the value with its json.Marshaler or encoding.TextMarshaler method, if any.
+func (ctx *Context) marshalFallback(rv reflect.Value) (Value, bool, error) {
+	if !rv.CanInterface() || rv.Kind() == reflect.Pointer && rv.IsNil() {
+		return ctx.Null(), false, nil
+	}
+	if !rv.Type().Implements(jsonMarshalerType) && !rv.Type().Implements(textMarshalerType) && rv.CanAddr() {
+		rv = rv.Addr()
+	}
+	switch m := rv.Interface().(type) {
+	case json.Marshaler:
+		data, err := m.MarshalJSON()
+		if err != nil {
+			return ctx.Null(), true, fmt.Errorf("quickjs: cannot marshal %s: %w", rv.Type(), err)
+		}
+		val, err := ctx.marshalRawJSON(data)
+		return val, true, err
+	case encoding.TextMarshaler:
+		text, err := m.MarshalText()
+		if err != nil {
+			return ctx.Null(), true, fmt.Errorf("quickjs: cannot marshal %s: %w", rv.Type(), err)
+		}
+		return ctx.String(string(text)), true, nil
+	}
+	return ctx.Null(), false, nil
+}
+
+func (ctx *Context) marshalArray(rv reflect.Value, options *MarshalOptions) (Value, error) {
+	arr := ctx.newValue(C.JS_NewArray(ctx.ref))
+	for i := 0; i < rv.Len(); i++ {
+		elem, err := ctx.marshal(rv.Index(i), options)
+		if err != nil {
+			arr.Free()
+			return ctx.Null(), err
+		}
+		arr.SetIdx(int64(i), elem)
+	}
+	return arr, nil
+}
+
+// marshalMap converts the map to an object, with the keys sorted as encoding/json does.
+func (ctx *Context) marshalMap(rv reflect.Value, options *MarshalOptions) (Value, error) {
+	keys := make([]string, 0, rv.Len())
+	values := make(map[string]reflect.Value, rv.Len())
+	iter := rv.MapRange()
+	for iter.Next() {
+		key, err := mapKeyString(iter.Key())
+		if err != nil {
+			return ctx.Null(), err
+		}
+		keys = append(keys, key)
+		values[key] = iter.Value()
+	}
+	sort.Strings(keys)
+
+	obj := ctx.Object()
+	for _, key := range keys {
+		elem, err := ctx.marshal(values[key], options)
+		if err != nil {
+			obj.Free()
+			return ctx.Null(), err
+		}
+		obj.defineOwn(key, elem)
+	}
+	return obj, nil
+}
+
+func (ctx *Context) marshalStruct(rv reflect.Value, options *MarshalOptions) (Value, error) {
+	obj := ctx.Object()
+	if member, ok := options.types.member(rv.Type()); ok {
+		obj.defineOwn(member.field, ctx.String(member.tag))
+	}
+	for _, field := range structFields(rv.Type()) {
+		fv := rv.FieldByIndex(field.index)
+		if field.omitEmpty && fv.IsZero() {
+			continue
+		}
+		elem, err := ctx.marshal(fv, options)
+		if err != nil {
+			obj.Free()
+			return ctx.Null(), err
+		}
+		obj.defineOwn(field.name, elem)
+	}
+	return obj, nil
+}
+
+// marshalFunc wraps a Go function with ctx.Function, converting its arguments and results.
+func (ctx *Context) marshalFunc(fn reflect.Value, options *MarshalOptions) Value {
+	fnType := fn.Type()
+	return ctx.Function(func(ctx *Context, this Value, args []Value) Value {
+		in := make([]reflect.Value, 0, fnType.NumIn())
+		for i := 0; i < fnType.NumIn(); i++ {
+			paramType := fnType.In(i)
+			if fnType.IsVariadic() && i == fnType.NumIn()-1 {
+				for j := i; j < len(args); j++ {
+					arg, err := unmarshalArg(args[j], paramType.Elem())
+					if err != nil {
+						return ctx.ThrowTypeError("argument %d: %s", j, err)
+					}
+					in = append(in, arg)
+				}
+				break
+			}
+			arg := reflect.Zero(paramType)
+			if i < len(args) {
+				var err error
+				if arg, err = unmarshalArg(args[i], paramType); err != nil {
+					return ctx.ThrowTypeError("argument %d: %s", i, err)
+				}
+			}
+			in = append(in, arg)
+		}
+
+		out := fn.Call(in)
+		if n := len(out); n > 0 && fnType.Out(n-1) == errorType {
+			if err, _ := out[n-1].Interface().(error); err != nil {
+				return ctx.ThrowError(err)
+			}
+			out = out[:n-1]
+		}
+		if len(out) == 0 {
+			return ctx.Undefined()
+		}
+		ret, err := ctx.marshal(out[0], options)
+		if err != nil {
+			return ctx.ThrowTypeError("%s", err)
+		}
+		return ret
+	})
+}
+
+// defineOwn defines an own enumerable property of the object, taking ownership of val.
+// Unlike Set, it does not call setters, so a key such as __proto__ does not change the prototype.
+func (v Value) defineOwn(name string, val Value) {
+	namePtr := C.CString(name)
+	defer C.free(unsafe.Pointer(namePtr))
+	val.untrack()
+	C.JS_DefinePropertyValueStr(v.ctx.ref, v.ref, namePtr, val.ref, C.JS_PROP_C_W_E)
+}
+
+// unmarshalArg converts a function argument; Value parameters receive the argument itself, which is only valid during the call.
+func unmarshalArg(arg Value, t reflect.Type) (reflect.Value, error) {
+	if t == valueType {
+		return reflect.ValueOf(arg), nil
+	}
+	ptr := reflect.New(t)
+	if err := arg.unmarshal(ptr.Elem(), &UnmarshalOptions{}); err != nil {
+		return ptr.Elem(), err
+	}
+	return ptr.Elem(), nil
+}
+
+type UnmarshalOptions struct {
+	strictNumbers bool
+	jsonFallback  bool
+	enums         map[reflect.Type]*enumMembers
+	types         *TypeRegistry
+	depth         int
+	any           *anyOptions
+}
+
+// maxUnmarshalDepth bounds the nesting converted by Unmarshal, so that cyclic values fail instead of overflowing the stack.
+const maxUnmarshalDepth = 1000
+
+type UnmarshalOption func(*UnmarshalOptions)
+
+// UnmarshalStrictNumbers makes Unmarshal fail on lossy numeric conversions, e.g. a fractional, non-finite
+// or out of range number into an integer, instead of truncating it; default is false.
+func UnmarshalStrictNumbers(strict bool) UnmarshalOption {
+	return func(options *UnmarshalOptions) {
+		options.strictNumbers = strict
+	}
+}
+
+// UnmarshalJSONFallback makes Unmarshal convert to the types implementing json.Unmarshaler, from the value stringified as JSON,
+// or else encoding.TextUnmarshaler, from a string, like encoding/json does; default is false.
+func UnmarshalJSONFallback(enabled bool) UnmarshalOption {
+	return func(options *UnmarshalOptions) {
+		options.jsonFallback = enabled
+	}
+}
+
+// Unmarshal stores the value converted to Go in the value pointed to by out, following the rules of Marshal in reverse.
+// Numbers unmarshal into interface{} as float64, BigInts as *big.Int, arrays as []interface{} and objects as map[string]interface{}.
+// Unmarshaling into a json.RawMessage stores the value stringified as JSON, and into a json.Number a number or BigInt as text.
+// Unmarshaling into a Value stores a duplicate which must be freed by the caller.
+// With UnmarshalJSONFallback, types implementing json.Unmarshaler or encoding.TextUnmarshaler are converted by those instead.
+// With UnmarshalTypes, the interfaces of tagged unions are converted to the member named by the discriminator, see RegisterUnion.
+func (v Value) Unmarshal(out interface{}, opts ...UnmarshalOption) error {
+	rv := reflect.ValueOf(out)
+	if rv.Kind() != reflect.Pointer || rv.IsNil() {
+		return errors.New("quickjs: Unmarshal requires a non-nil pointer")
+	}
+	options := &UnmarshalOptions{}
+	for _, fn := range opts {
+		fn(options)
+	}
+	return v.unmarshal(rv.Elem(), options)
+}
+
+func (v Value) unmarshal(rv reflect.Value, options *UnmarshalOptions) error {
+	options.depth++
+	defer func() { options.depth-- }()
+	if options.depth > maxUnmarshalDepth {
+		return fmt.Errorf("quickjs: cannot unmarshal value nested deeper than %d levels", maxUnmarshalDepth)
+	}
+	if rv.Type() == valueType {
+		rv.Set(reflect.ValueOf(v.dup()))
+		return nil
+	}
+	if rv.Type() == bigIntType {
+		n, err := v.ToBigInt()
+		if err != nil {
+			return v.unmarshalTypeError(rv.Type())
+		}
+		rv.Set(reflect.ValueOf(n).Elem())
+		return nil
+	}
+	if rv.Type() == rawJSONType {
+		raw, err := v.rawJSON()
+		if err != nil {
+			return err
+		}
+		rv.SetBytes(raw)
+		return nil
+	}
+	if rv.Type() == jsonNumberType {
+		if v.IsBigInt() {
+			rv.SetString(v.String())
+			return nil
+		}
+		f, err := v.ToFloat64Checked()
+		if err != nil || math.IsInf(f, 0) || math.IsNaN(f) {
+			return v.unmarshalTypeError(rv.Type())
+		}
+		rv.SetString(strconv.FormatFloat(f, 'g', -1, 64))
+		return nil
+	}
+	if enum, ok := options.enums[rv.Type()]; ok {
+		return v.unmarshalEnum(rv, enum)
+	}
+	if options.jsonFallback && rv.Kind() != reflect.Pointer && rv.CanAddr() {
+		if ok, err := v.unmarshalFallback(rv.Addr()); ok {
+			return err
+		}
+	}
+
+	switch rv.Kind() {
+	case reflect.Pointer:
+		if v.IsNull() || v.IsUndefined() {
+			rv.Set(reflect.Zero(rv.Type()))
+			return nil
+		}
+		if rv.IsNil() {
+			rv.Set(reflect.New(rv.Type().Elem()))
+		}
+		return v.unmarshal(rv.Elem(), options)
+	case reflect.Interface:
+		if u := options.types.union(rv.Type()); u != nil {
+			return v.unmarshalUnion(rv, u, options)
+		}
+		if rv.NumMethod() != 0 {
+			return v.unmarshalTypeError(rv.Type())
+		}
+		if v.IsNull() || v.IsUndefined() {
+			rv.Set(reflect.Zero(rv.Type()))
+			return nil
+		}
+		val, err := v.toInterface(options)
+		if err != nil {
+			return err
+		}
+		rv.Set(reflect.ValueOf(val))
+		return nil
+	case reflect.Bool:
+		if !v.IsBool() {
+			return v.unmarshalTypeError(rv.Type())
+		}
+		rv.SetBool(v.Bool())
+		return nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		if !v.IsNumber() {
+			return v.unmarshalTypeError(rv.Type())
+		}
+		if !options.strictNumbers {
+			rv.SetInt(v.Int64())
+			return nil
+		}
+		n, err := v.ToInt64Checked()
+		if err == nil && rv.OverflowInt(n) {
+			err = fmt.Errorf("quickjs: number %d overflows %s", n, rv.Type())
+		}
+		if err != nil {
+			return err
+		}
+		rv.SetInt(n)
+		return nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		if !v.IsNumber() {
+			return v.unmarshalTypeError(rv.Type())
+		}
+		if !options.strictNumbers {
+			rv.SetUint(uint64(v.Float64()))
+			return nil
+		}
+		f, err := v.ToFloat64Checked()
+		if err == nil && (f != math.Trunc(f) || f < 0 || f >= math.Ldexp(1, rv.Type().Bits())) {
+			err = fmt.Errorf("quickjs: number %v overflows %s", f, rv.Type())
+		}
+		if err != nil {
+			return err
+		}
+		rv.SetUint(uint64(f))
+		return nil
+	case reflect.Float32, reflect.Float64:
+		if !v.IsNumber() {
+			return v.unmarshalTypeError(rv.Type())
+		}
+		f := v.Float64()
+		if options.strictNumbers && rv.OverflowFloat(f) {
+			return fmt.Errorf("quickjs: number %v overflows %s", f, rv.Type())
+		}
+		rv.SetFloat(f)
+		return nil
+	case reflect.String:
+		if !v.IsString() {
+			return v.unmarshalTypeError(rv.Type())
+		}
+		str, err := v.ToString()
+		if err != nil {
+			return err
+		}
+		rv.SetString(str)
+		return nil
+	case reflect.Slice:
+		if v.IsNull() || v.IsUndefined() {
+			rv.Set(reflect.Zero(rv.Type()))
+			return nil
+		}
+		if rv.Type().Elem().Kind() == reflect.Uint8 && v.IsByteArray() {
+			buf, err := v.ToByteArray(uint(v.ByteLen()))
+			if err != nil {
+				return err
+			}
+			rv.SetBytes(buf)
+			return nil
+		}
+		if !v.IsArray() {
+			return v.unmarshalTypeError(rv.Type())
+		}
+		if err := v.ctx.checkArrayLength(v.Len()); err != nil {
+			return err
+		}
+		n := int(v.Len())
+		rv.Set(reflect.MakeSlice(rv.Type(), n, n))
+		return v.unmarshalElements(rv, n, options)
+	case reflect.Array:
+		if !v.IsArray() {
+			return v.unmarshalTypeError(rv.Type())
+		}
+		n := int(v.Len())
+		if n > rv.Len() {
+			n = rv.Len()
+		}
+		return v.unmarshalElements(rv, n, options)
+	case reflect.Map:
+		if v.IsNull() || v.IsUndefined() {
+			rv.Set(reflect.Zero(rv.Type()))
+			return nil
+		}
+		if !v.IsObject() {
+			return v.unmarshalTypeError(rv.Type())
+		}
+		return v.unmarshalMap(rv, options)
+	case reflect.Struct:
+		if !v.IsObject() {
+			return v.unmarshalTypeError(rv.Type())
+		}
+		for _, field := range structFields(rv.Type()) {
+			elem := v.Get(field.name)
+			if !elem.IsUndefined() {
+				if err := elem.unmarshal(rv.FieldByIndex(field.index), options); err != nil {
+					elem.Free()
+					return fmt.Errorf("%s: %w", field.name, err)
+				}
+			}
+			elem.Free()
+		}
+		return nil
+	}
+	return v.unmarshalTypeError(rv.Type())
+}
+
+// unmarshalFallback converts the value with the json.Unmarshaler or encoding.TextUnmarshaler method of ptr, if any.
+func (v Value) unmarshalFallback(ptr reflect.Value) (bool, error) {
+	if !ptr.CanInterface() {
+		return false, nil
+	}
+	switch u := ptr.Interface().(type) {
+	case json.Unmarshaler:
+		raw, err := v.rawJSON()
+		if err != nil {
+			return true, err
+		}
+		if raw == nil {
+			raw = json.RawMessage("null")
+		}
+		if err := u.UnmarshalJSON(raw); err != nil {
+			return true, fmt.Errorf("quickjs: cannot unmarshal into Go value of type %s: %w", ptr.Type().Elem(), err)
+		}
+		return true, nil
+	case encoding.TextUnmarshaler:
+		if !v.IsString() {
+			return true, v.unmarshalTypeError(ptr.Type().Elem())
+		}
+		if err := u.UnmarshalText([]byte(v.String())); err != nil {
+			return true, fmt.Errorf("quickjs: cannot unmarshal into Go value of type %s: %w", ptr.Type().Elem(), err)
+		}
+		return true, nil
+	}
+	return false, nil
+}
+
+// rawJSON returns the value stringified as JSON, or nil if it has no JSON representation, e.g. undefined.
+func (v Value) rawJSON() (json.RawMessage, error) {
+	str := v.ctx.newValue(C.JS_JSONStringify(v.ctx.ref, v.ref, C.JS_NewNull(), C.JS_NewNull()))
+	defer str.Free()
+	if str.IsException() {
+		return nil, fmt.Errorf("quickjs: cannot unmarshal %s into Go value of type json.RawMessage: %w", v.typeName(), v.ctx.exceptionError())
+	}
+	if str.IsUndefined() {
+		return nil, nil
+	}
+	return json.RawMessage(str.String()), nil
+}
+
+func (v Value) unmarshalElements(rv reflect.Value, n int, options *UnmarshalOptions) error {
+	for i := 0; i < n; i++ {
+		elem := v.GetIdx(int64(i))
+		err := elem.unmarshal(rv.Index(i), options)
+		elem.Free()
+		if err != nil {
+			return fmt.Errorf("[%d]: %w", i, err)
+		}
+	}
+	return nil
+}
+
+func (v Value) unmarshalMap(rv reflect.Value, options *UnmarshalOptions) error {
+	keys, err := v.ownKeys()
+	if err != nil {
+		return err
+	}
+	if rv.IsNil() {
+		rv.Set(reflect.MakeMapWithSize(rv.Type(), len(keys)))
+	}
+	keyType, elemType := rv.Type().Key(), rv.Type().Elem()
+	for _, name := range keys {
+		key, err := parseMapKey(name, keyType)
+		if err != nil {
+			return err
+		}
+		elem := reflect.New(elemType).Elem()
+		val := v.Get(name)
+		err = val.unmarshal(elem, options)
+		val.Free()
+		if err != nil {
+			return fmt.Errorf("%s: %w", name, err)
+		}
+		rv.SetMapIndex(key, elem)
+	}
+	return nil
+}
+
+// toInterface converts the value to the natural Go type used when unmarshaling into interface{}.
+func (v Value) toInterface(options *UnmarshalOptions) (interface{}, error) {
+	if options.any != nil {
+		if val, ok, err := v.toAny(options); ok {
+			return val, err
+		}
+	}
+	switch v.Kind() {
+	case KindNull, KindUndefined:
+		return nil, nil
+	case KindBool:
+		return v.Bool(), nil
+	case KindNumber:
+		return v.Float64(), nil
+	case KindBigInt:
+		return v.BigInt(), nil
+	case KindString:
+		return v.String(), nil
+	case KindArray:
+		var out []interface{}
+		err := v.unmarshal(reflect.ValueOf(&out).Elem(), options)
+		return out, err
+	case KindArrayBuffer:
+		var out []byte
+		err := v.unmarshal(reflect.ValueOf(&out).Elem(), options)
+		return out, err
+	case KindUnknown, KindSymbol, KindFunction:
+		return nil, v.unmarshalTypeError(reflect.TypeOf((*interface{})(nil)).Elem())
+	}
+	var out map[string]interface{}
+	err := v.unmarshal(reflect.ValueOf(&out).Elem(), options)
+	return out, err
+}
+
+func (v Value) unmarshalTypeError(t reflect.Type) error {
+	return fmt.Errorf("quickjs: cannot unmarshal %s into Go value of type %s", v.typeName(), t)
+}
+
+// typeName returns the JS type of the value, as used in error messages.
+func (v Value) typeName() string {
+	switch kind := v.Kind(); kind {
+	case KindUndefined, KindNull, KindBool, KindNumber, KindBigInt, KindString, KindSymbol, KindFunction, KindArray:
+		return kind.String()
+	}
+	return "object"
+}
+
+// ownKeys returns the own enumerable string keys of the object.
+func (v Value) ownKeys() ([]string, error) {
+	var ptr *C.JSPropertyEnum
+	var size C.uint32_t
+	if C.JS_GetOwnPropertyNames(v.ctx.ref, &ptr, &size, v.ref, C.JS_GPN_STRING_MASK|C.JS_GPN_ENUM_ONLY) < 0 {
+		return nil, v.ctx.Exception()
+	}
+	defer C.js_free(v.ctx.ref, unsafe.Pointer(ptr))
+
+	entries := unsafe.Slice(ptr, size)
+	keys := make([]string, len(entries))
+	for i, entry := range entries {
+		atom := Atom{ctx: v.ctx, ref: entry.atom}
+		keys[i] = atom.String()
+		atom.Free()
+	}
+	return keys, nil
+}
+
+// structField describes a struct field converted to an object property.
+type structField struct {
+	name      string
+	index     []int
+	omitEmpty bool
+}
+
+// structFields returns the fields of the struct type, flattening the embedded structs without a json tag.
+func structFields(t reflect.Type) []structField {
+	var fields []structField
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		tag := f.Tag.Get("json")
+		if tag == "-" {
+			continue
+		}
+		name, opts, _ := strings.Cut(tag, ",")
+		if f.Anonymous && name == "" {
+			ft := f.Type
+			if ft.Kind() == reflect.Pointer {
+				ft = ft.Elem()
+			}
+			if ft.Kind() == reflect.Struct && f.Type.Kind() != reflect.Pointer {
+				for _, embedded := range structFields(ft) {
+					embedded.index = append([]int{i}, embedded.index...)
+					fields = append(fields, embedded)
+				}
+				continue
+			}
+		}
+		if !f.IsExported() {
+			continue
+		}
+		if name == "" {
+			name = f.Name
+		}
+		fields = append(fields, structField{name: name, index: []int{i}, omitEmpty: strings.Contains(opts, "omitempty")})
+	}
+	return fields
+}
+
+func mapKeyString(key reflect.Value) (string, error) {
+	switch key.Kind() {
+	case reflect.String:
+		return key.String(), nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return strconv.FormatInt(key.Int(), 10), nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return strconv.FormatUint(key.Uint(), 10), nil
+	}
+	return "", fmt.Errorf("quickjs: cannot marshal map key of type %s", key.Type())
+}
+
+func parseMapKey(name string, t reflect.Type) (reflect.Value, error) {
+	key := reflect.New(t).Elem()
+	switch t.Kind() {
+	case reflect.String:
+		key.SetString(name)
+		return key, nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		n, err := strconv.ParseInt(name, 10, t.Bits())
+		if err != nil {
+			return key, fmt.Errorf("quickjs: cannot unmarshal key %q into Go value of type %s", name, t)
+		}
+		key.SetInt(n)
+		return key, nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		n, err := strconv.ParseUint(name, 10, t.Bits())
+		if err != nil {
+			return key, fmt.Errorf("quickjs: cannot unmarshal key %q into Go value of type %s", name, t)
+		}
+		key.SetUint(n)
+		return key, nil
+	}
+	return key, fmt.Errorf("quickjs: cannot unmarshal map key into Go value of type %s", t)
+}
+
+// sortedKeys returns the keys of the map in lexical order.
+func sortedKeys(m map[string]interface{}) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,49 @@
+package quickjs
+
+/*
+#include "bridge.h"
+*/
+import "C"
+
+// microtaskScript returns the function defining the queueMicrotask global, given the native function enqueueing
+// a job into the job queue of the engine and the reporter of uncaught exceptions, see wrapTimersScript.
+const microtaskScript = `((enqueue, report) => {
+	const queueMicrotask = function queueMicrotask(callback) {
+		if (typeof callback !== "function") {
+			throw new TypeError("The callback must be a function");
+		}
+		enqueue(() => {
+			try {
+				callback();
+			} catch (e) {
+				if (!report(e)) {
+					throw e;
+				}
+			}
+		});
+	};
+	Object.defineProperty(globalThis, "queueMicrotask", { value: queueMicrotask, writable: true, configurable: true });
+})`
+
+// installMicrotasks evaluates microtaskScript, defining the queueMicrotask global.
+// The callbacks run as promise jobs, in order with the reactions of promises; their exceptions are reported
+// like the ones of setTimeout callbacks, see SetUncaughtExceptionHandler.
+func (ctx *Context) installMicrotasks() error {
+	define, err := ctx.eval(microtaskScript, EvalFileName("<microtask>"))
+	if err != nil {
+		return err
+	}
+	defer define.Free()
+
+	enqueue := ctx.newValue(C.NewMicrotaskEnqueuer(ctx.ref))
+	defer enqueue.Free()
+	reporter := ctx.newValue(C.NewUncaughtExceptionReporter(ctx.ref))
+	defer reporter.Free()
+
+	ret := ctx.Invoke(define, ctx.Null(), enqueue, reporter)
+	defer ret.Free()
+	if ret.IsException() {
+		return ctx.exceptionError()
+	}
+	return nil
+}
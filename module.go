@@ -0,0 +1,172 @@
+package quickjs
+
+/*
+#include "bridge.h"
+*/
+import "C"
+import (
+	"errors"
+	"fmt"
+	"unsafe"
+)
+
+// Module gives access to the exports of an evaluated ES module.
+type Module struct {
+	ctx       *Context
+	name      string
+	namespace Value
+	promise   Value
+	origin    string // see EvalOrigin
+}
+
+// ModuleError is returned when the evaluation of a module is rejected, e.g. it throws or its top-level await rejects.
+type ModuleError struct {
+	Module string
+	Err    *Error
+}
+
+func (err *ModuleError) Error() string {
+	return fmt.Sprintf("module %s: %s", err.Module, err.Err.Cause)
+}
+
+func (err *ModuleError) Unwrap() error {
+	return err.Err
+}
+
+// Module evaluates the module returned by LoadModule, LoadModuleFile or LoadModuleBytecode if it was not imported yet,
+// and returns its exports. The module value is not freed.
+//
+// Module runs the event loop until the module settles, so exports assigned after a top-level await are available;
+// use EvalAwait(false) to return as soon as the module is started, and check State or call Await later.
+// A module which rejects returns a *ModuleError.
+func (ctx *Context) Module(module Value, opts ...EvalOption) (*Module, error) {
+	if err := ctx.checkGoroutine(); err != nil {
+		return nil, err
+	}
+	defer ctx.enter()()
+	if C.ValueGetTag(module.ref) != C.JS_TAG_MODULE {
+		return nil, errors.New("not a module")
+	}
+	options := newEvalOptions(append([]EvalOption{EvalAwait(true)}, opts...))
+	defer ctx.withOrigin(options.origin)()
+
+	name := Atom{ctx: ctx, ref: C.GetModuleName(ctx.ref, module.ref)}
+	defer name.Free()
+
+	promise := ctx.newValue(C.JS_EvalFunction(ctx.ref, C.JS_DupValue(ctx.ref, module.ref)))
+	if promise.IsException() {
+		exception := ctx.newValue(C.JS_GetException(ctx.ref))
+		defer exception.Free()
+		return nil, &ModuleError{Module: name.String(), Err: exception.toError().withOrigin(ctx.origin)}
+	}
+
+	namespace := ctx.newValue(C.GetModuleNamespace(ctx.ref, module.ref))
+	if namespace.IsException() {
+		promise.Free()
+		return nil, ctx.Exception()
+	}
+
+	m := &Module{ctx: ctx, name: name.String(), namespace: namespace, promise: promise, origin: ctx.origin}
+	var err error
+	if options.await {
+		err = m.Await()
+	} else {
+		err = m.err()
+	}
+	if err != nil {
+		m.Free()
+		return nil, err
+	}
+	return m, nil
+}
+
+// EvalModule compiles and evaluates the ES module code registered as name, and returns its exports.
+// Other modules can import it by name afterwards. The options are the ones of Module.
+func (ctx *Context) EvalModule(code string, name string, opts ...EvalOption) (*Module, error) {
+	module, err := ctx.LoadModule(code, name)
+	if err != nil {
+		return nil, err
+	}
+	defer module.Free()
+	return ctx.Module(module, opts...)
+}
+
+// State returns the state of the module evaluation; it is pending until its top-level await completes.
+func (m *Module) State() PromiseState {
+	return m.promise.PromiseState()
+}
+
+// Await runs the event loop until the module evaluation settles; it returns a *ModuleError if it was rejected.
+func (m *Module) Await() error {
+	if err := m.ctx.checkGoroutine(); err != nil {
+		return err
+	}
+	defer m.ctx.enter()()
+	defer m.ctx.withOrigin(m.origin)()
+	ret := m.ctx.newValue(m.ctx.await(C.JS_DupValue(m.ctx.ref, m.promise.ref)))
+	defer ret.Free()
+	if ret.IsException() {
+		C.JS_FreeValue(m.ctx.ref, C.JS_GetException(m.ctx.ref))
+	}
+	return m.err()
+}
+
+// err returns the rejection reason of the module evaluation.
+func (m *Module) err() error {
+	if m.State() != PromiseStateRejected {
+		return nil
+	}
+	reason := m.ctx.newValue(C.JS_PromiseResult(m.ctx.ref, m.promise.ref))
+	defer reason.Free()
+	return &ModuleError{Module: m.name, Err: reason.toError().withOrigin(m.origin)}
+}
+
+// Name returns the name of the module.
+func (m *Module) Name() string {
+	return m.name
+}
+
+// Namespace returns the module namespace object; the value is owned by the module and must not be freed.
+func (m *Module) Namespace() Value {
+	return m.namespace
+}
+
+// Keys returns the names of the exports of the module.
+func (m *Module) Keys() []string {
+	var ptr *C.JSPropertyEnum
+	var size C.uint32_t
+	if C.JS_GetOwnPropertyNames(m.ctx.ref, &ptr, &size, m.namespace.ref, C.JS_GPN_STRING_MASK|C.JS_GPN_ENUM_ONLY) < 0 {
+		return nil
+	}
+	defer C.js_free(m.ctx.ref, unsafe.Pointer(ptr))
+
+	entries := unsafe.Slice(ptr, size)
+	keys := make([]string, len(entries))
+	for i, entry := range entries {
+		atom := Atom{ctx: m.ctx, ref: entry.atom}
+		keys[i] = atom.String()
+		atom.Free()
+	}
+	return keys
+}
+
+// Get returns the export with the given name, undefined if the module has no such export.
+func (m *Module) Get(name string) Value {
+	return m.namespace.Get(name)
+}
+
+// Exports returns all the exports of the module by name; each value must be freed by the caller.
+func (m *Module) Exports() map[string]*Value {
+	exports := make(map[string]*Value)
+	for _, key := range m.Keys() {
+		v := m.Get(key)
+		exports[key] = &v
+	}
+	return exports
+}
+
+// Free frees the module namespace.
+func (m *Module) Free() {
+	m.namespace.Free()
+	m.promise.Free()
+}
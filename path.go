@@ -0,0 +1,137 @@
+package quickjs
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// pathSegment is a property name or an array index of a path expression.
+type pathSegment struct {
+	name    string
+	index   int64
+	isIndex bool
+}
+
+func (s pathSegment) String() string {
+	if s.isIndex {
+		return "[" + strconv.FormatInt(s.index, 10) + "]"
+	}
+	return s.name
+}
+
+// parsePath splits a path expression such as `a.b[2].c` or `a["key with dots"]` into segments.
+func parsePath(path string) ([]pathSegment, error) {
+	var segments []pathSegment
+	rest := path
+	for i := 0; rest != ""; i++ {
+		switch {
+		case rest[0] == '[':
+			end := strings.IndexByte(rest, ']')
+			if end < 0 {
+				return nil, fmt.Errorf("quickjs: invalid path %q: unclosed bracket", path)
+			}
+			inner := rest[1:end]
+			if len(inner) >= 2 && (inner[0] == '"' || inner[0] == '\'') && inner[len(inner)-1] == inner[0] {
+				segments = append(segments, pathSegment{name: inner[1 : len(inner)-1]})
+			} else if index, err := strconv.ParseInt(inner, 10, 64); err == nil && index >= 0 {
+				segments = append(segments, pathSegment{index: index, isIndex: true})
+			} else {
+				return nil, fmt.Errorf("quickjs: invalid path %q: bad index %q", path, inner)
+			}
+			rest = rest[end+1:]
+		case i > 0 && rest[0] != '.':
+			return nil, fmt.Errorf("quickjs: invalid path %q", path)
+		default:
+			if i > 0 {
+				rest = rest[1:]
+			}
+			end := strings.IndexAny(rest, ".[]")
+			if end < 0 {
+				end = len(rest)
+			}
+			if end == 0 {
+				return nil, fmt.Errorf("quickjs: invalid path %q: empty property name", path)
+			}
+			if end < len(rest) && rest[end] == ']' {
+				return nil, fmt.Errorf("quickjs: invalid path %q: unexpected bracket", path)
+			}
+			segments = append(segments, pathSegment{name: rest[:end]})
+			rest = rest[end:]
+		}
+	}
+	if len(segments) == 0 {
+		return nil, fmt.Errorf("quickjs: invalid path %q: empty path", path)
+	}
+	return segments, nil
+}
+
+func (v Value) getSegment(s pathSegment) Value {
+	if s.isIndex {
+		return v.GetIdx(s.index)
+	}
+	return v.Get(s.name)
+}
+
+// walkPath returns a new reference to the value holding the last segment, freeing the intermediate values.
+func (v Value) walkPath(path string, segments []pathSegment) (Value, error) {
+	obj := v.dup()
+	for i, s := range segments[:len(segments)-1] {
+		next := obj.getSegment(s)
+		obj.Free()
+		if !next.IsObject() {
+			kind := next.typeName()
+			next.Free()
+			return v.ctx.Undefined(), fmt.Errorf("quickjs: path %q: cannot read %s of %s", path, segments[i+1], kind)
+		}
+		obj = next
+	}
+	return obj, nil
+}
+
+// GetPath returns the value at the path expression, e.g. `a.b[2].c` or `a["key.with.dots"]`, freeing the intermediate values.
+// A missing last property returns undefined, a missing or primitive intermediate value returns an error.
+func (v Value) GetPath(path string) (Value, error) {
+	segments, err := parsePath(path)
+	if err != nil {
+		return v.ctx.Undefined(), err
+	}
+	if !v.IsObject() {
+		return v.ctx.Undefined(), fmt.Errorf("quickjs: path %q: cannot read %s of %s", path, segments[0], v.typeName())
+	}
+	obj, err := v.walkPath(path, segments)
+	if err != nil {
+		return obj, err
+	}
+	defer obj.Free()
+	return obj.getSegment(segments[len(segments)-1]), nil
+}
+
+// SetPath sets the value at the path expression, see GetPath; the intermediate values must exist.
+// Like Set, it takes ownership of val, even if an error is returned.
+func (v Value) SetPath(path string, val Value) error {
+	if v.ctx.dropForeign(val) {
+		return ErrForeignValue
+	}
+	segments, err := parsePath(path)
+	if err != nil {
+		val.Free()
+		return err
+	}
+	if !v.IsObject() {
+		val.Free()
+		return fmt.Errorf("quickjs: path %q: cannot set %s of %s", path, segments[0], v.typeName())
+	}
+	obj, err := v.walkPath(path, segments)
+	if err != nil {
+		val.Free()
+		return err
+	}
+	defer obj.Free()
+	if last := segments[len(segments)-1]; last.isIndex {
+		obj.SetIdx(last.index, val)
+	} else {
+		obj.Set(last.name, val)
+	}
+	return nil
+}
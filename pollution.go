@@ -0,0 +1,160 @@
+package quickjs
+
+// Pollution is an attempt of a script to pollute the intrinsics of the context, see SetPollutionHandler.
+type Pollution struct {
+	// Target is the name of the intrinsic, e.g. "Object.prototype" or "Array".
+	Target string
+	// Property is the property added to the intrinsic, or "__proto__" when its prototype is set.
+	Property string
+	// Operation is how the script attempts it: "set" for an assignment, "defineProperty" or "setPrototypeOf".
+	Operation string
+	// Stack is the stack trace of the script at the attempt.
+	Stack string
+}
+
+// PollutionHandler is called with the attempts of scripts to pollute the intrinsics, e.g. to log them;
+// unless it returns nil, the attempt is refused and the error thrown to the script.
+type PollutionHandler func(pollution Pollution) error
+
+// pollutionScript returns the function instrumenting the intrinsics, given the Go function report(target, property, operation, stack)
+// throwing the attempts refused, and returning the function removing the instrumentation. The new properties assigned to any object
+// reach the proxy inserted as the prototype of Object.prototype, which reports the ones assigned to an intrinsic; the functions
+// defining properties and setting prototypes, and the __proto__ setter, are wrapped.
+const pollutionScript = `((report) => {` + intrinsicsScript + `
+	const check = (obj, key, operation) => {
+		const name = known.get(obj);
+		if (name !== undefined) {
+			report(name, String(key), operation, new Error().stack);
+		}
+	};
+
+	const { defineProperty, defineProperties, setPrototypeOf } = Object;
+	const reflect = { defineProperty: Reflect.defineProperty, setPrototypeOf: Reflect.setPrototypeOf };
+
+	// the handler cannot inherit from Object.prototype, or looking its traps up would reach the proxy
+	const sentinel = new Proxy(Object.create(null), {
+		__proto__: null,
+		set(target, key, value, receiver) {
+			if (Object(receiver) !== receiver) {
+				return false;
+			}
+			check(receiver, key, "set");
+			const own = Reflect.getOwnPropertyDescriptor(receiver, key);
+			if (own !== undefined) {
+				return "value" in own && own.writable && reflect.defineProperty(receiver, key, { value });
+			}
+			return reflect.defineProperty(receiver, key, { value, writable: true, enumerable: true, configurable: true });
+		},
+	});
+
+	const restores = [];
+	const replace = (obj, key, desc) => {
+		const original = Object.getOwnPropertyDescriptor(obj, key);
+		defineProperty(obj, key, desc);
+		restores.push(() => defineProperty(obj, key, original));
+	};
+	const proto = Object.getOwnPropertyDescriptor(Object.prototype, "__proto__");
+	const wrappers = {
+		defineProperty(obj, key, desc) {
+			check(obj, key, "defineProperty");
+			return defineProperty(obj, key, desc);
+		},
+		defineProperties(obj, props) {
+			for (const key of Reflect.ownKeys(Object(props))) {
+				check(obj, key, "defineProperty");
+			}
+			return defineProperties(obj, props);
+		},
+		setPrototypeOf(obj, proto) {
+			check(obj, "__proto__", "setPrototypeOf");
+			return setPrototypeOf(obj, proto);
+		},
+		reflectDefineProperty(obj, key, desc) {
+			check(obj, key, "defineProperty");
+			return reflect.defineProperty(obj, key, desc);
+		},
+		reflectSetPrototypeOf(obj, proto) {
+			check(obj, "__proto__", "setPrototypeOf");
+			return reflect.setPrototypeOf(obj, proto);
+		},
+	};
+	const method = (value) => ({ value, writable: true, configurable: true });
+	replace(Object, "defineProperty", method(wrappers.defineProperty));
+	replace(Object, "defineProperties", method(wrappers.defineProperties));
+	replace(Object, "setPrototypeOf", method(wrappers.setPrototypeOf));
+	defineProperty(wrappers.reflectDefineProperty, "name", { value: "defineProperty" });
+	defineProperty(wrappers.reflectSetPrototypeOf, "name", { value: "setPrototypeOf" });
+	replace(Reflect, "defineProperty", method(wrappers.reflectDefineProperty));
+	replace(Reflect, "setPrototypeOf", method(wrappers.reflectSetPrototypeOf));
+	replace(Object.prototype, "__proto__", {
+		get: proto.get,
+		set: Object.getOwnPropertyDescriptor({
+			set __proto__(value) {
+				check(this, "__proto__", "setPrototypeOf");
+				proto.set.call(this, value);
+			},
+		}, "__proto__").set,
+		configurable: true,
+	});
+	setPrototypeOf(Object.prototype, sentinel);
+
+	return () => {
+		setPrototypeOf(Object.prototype, null);
+		restores.reverse().forEach((restore) => restore());
+	};
+})`
+
+// SetPollutionHandler sets the handler called when a script attempts to pollute the intrinsics, e.g. Object.prototype or
+// Array.prototype, by adding a property or setting its prototype, as merging untrusted JSON with a "__proto__" or
+// "constructor.prototype" key does; use nil to remove it. It monitors the scripts which Lockdown would restrict too much,
+// though the properties already defined on an intrinsic, such as its methods, are not monitored when assigned.
+//
+// The instrumentation costs a call of a JS function for each new property assigned to any object, e.g. this.x = x in a constructor;
+// the properties defined by object literals and classes are not affected. It must be set before Lockdown, and is kept by Reset.
+func (ctx *Context) SetPollutionHandler(handler PollutionHandler) error {
+	ctx.pollutionHandler = handler
+	if handler == nil && ctx.pollutionRestore != nil {
+		ret := ctx.Invoke(*ctx.pollutionRestore, ctx.Null())
+		defer ret.Free()
+		if ret.IsException() {
+			return ctx.exceptionError()
+		}
+		ctx.pollutionRestore.Free()
+		ctx.pollutionRestore = nil
+		return nil
+	}
+	if handler == nil || ctx.pollutionRestore != nil {
+		return nil
+	}
+	return ctx.installPollution()
+}
+
+// installPollution evaluates pollutionScript.
+func (ctx *Context) installPollution() error {
+	install, err := ctx.eval(pollutionScript, EvalFileName("<pollution>"))
+	if err != nil {
+		return err
+	}
+	defer install.Free()
+
+	report := ctx.NamedFunction("report", 4, func(ctx *Context, this Value, args []Value) Value {
+		handler := ctx.pollutionHandler
+		if handler == nil {
+			return ctx.Undefined()
+		}
+		err := handler(Pollution{Target: args[0].String(), Property: args[1].String(), Operation: args[2].String(), Stack: args[3].String()})
+		if err != nil {
+			return ctx.ThrowError(err)
+		}
+		return ctx.Undefined()
+	})
+	defer report.Free()
+
+	restore := ctx.Invoke(install, ctx.Null(), report)
+	if restore.IsException() {
+		restore.Free()
+		return ctx.exceptionError()
+	}
+	ctx.pollutionRestore = &restore
+	return nil
+}
@@ -0,0 +1,77 @@
+package quickjs
+
+// privateSlotScript evaluates to a function making a private slot: the functions reading and defining a private field
+// on any object. Unlike a property keyed by a symbol, a private field is neither listed by reflection, copied by
+// Object.assign nor seen by the traps of a Proxy, so scripts can neither reach nor forge the values Go stores in it.
+// The base class returns the target from its constructor, so that the field is defined on an object it did not create;
+// as for any private field, this also works on non-extensible objects.
+const privateSlotScript = `(function () {
+	class Slot extends function (target) { return target } {
+		#value;
+		constructor(target) { super(target) }
+		static get(target) { try { return target.#value } catch { return undefined } }
+		static define(target, value) { new Slot(target).#value = value }
+	}
+	return [Slot.get, Slot.define];
+})`
+
+// privateSlot returns the functions of the private slot stored in *slot, making it on first use.
+func (ctx *Context) privateSlot(slot **Value) (Value, error) {
+	if *slot == nil {
+		factory, err := ctx.eval(privateSlotScript, EvalFileName("<slot>"))
+		if err != nil {
+			return ctx.Undefined(), err
+		}
+		defer factory.Free()
+		fns := ctx.Invoke(factory, ctx.Null())
+		if fns.IsException() {
+			return ctx.Undefined(), ctx.exceptionError()
+		}
+		fns.keep()
+		*slot = &fns
+	}
+	return **slot, nil
+}
+
+// getPrivate returns the value stored in the private slot of the object, or undefined.
+// The caller frees the value; the object must not be a Proxy.
+func (ctx *Context) getPrivate(slot **Value, obj Value) (Value, error) {
+	fns, err := ctx.privateSlot(slot)
+	if err != nil {
+		return ctx.Undefined(), err
+	}
+	get := fns.GetIdx(0)
+	defer get.Free()
+	val := ctx.Invoke(get, ctx.Null(), obj)
+	if val.IsException() {
+		return ctx.Undefined(), ctx.exceptionError()
+	}
+	return val, nil
+}
+
+// definePrivate stores the value in the private slot of the object, which must not hold one yet; the caller keeps ownership of val.
+func (ctx *Context) definePrivate(slot **Value, obj Value, val Value) error {
+	fns, err := ctx.privateSlot(slot)
+	if err != nil {
+		return err
+	}
+	define := fns.GetIdx(1)
+	defer define.Free()
+	ret := ctx.Invoke(define, ctx.Null(), obj, val)
+	if ret.IsException() {
+		return ctx.exceptionError()
+	}
+	ret.Free()
+	return nil
+}
+
+// freeSlots frees the private slots of the context. Unlike its other internals, they outlive Reset,
+// so that the Go data and weak references of the objects obtained before are still found.
+func (ctx *Context) freeSlots() {
+	for _, slot := range []**Value{&ctx.weakRefSlot, &ctx.hostDataSlot} {
+		if *slot != nil {
+			(*slot).Free()
+			*slot = nil
+		}
+	}
+}
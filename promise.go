@@ -0,0 +1,98 @@
+package quickjs
+
+/*
+#include "bridge.h"
+*/
+import "C"
+
+// PromiseState is the state of a promise.
+type PromiseState int
+
+const (
+	PromiseStatePending   PromiseState = C.JS_PROMISE_PENDING
+	PromiseStateFulfilled PromiseState = C.JS_PROMISE_FULFILLED
+	PromiseStateRejected  PromiseState = C.JS_PROMISE_REJECTED
+)
+
+// String returns the name of the state.
+func (s PromiseState) String() string {
+	switch s {
+	case PromiseStatePending:
+		return "pending"
+	case PromiseStateFulfilled:
+		return "fulfilled"
+	case PromiseStateRejected:
+		return "rejected"
+	}
+	return "unknown"
+}
+
+// PromiseState returns the state of the promise; it returns -1 if the value is not a promise.
+func (v Value) PromiseState() PromiseState {
+	return PromiseState(C.JS_PromiseState(v.ctx.ref, v.ref))
+}
+
+// PromiseRejectionHandler is called when a promise is rejected without a handler (isHandled is false),
+// and again if a handler is attached later (isHandled is true). Rejections are reported as soon as they happen,
+// so a promise rejected before its handler is attached in the same job is reported twice.
+// The promise and reason values are borrowed and must not be freed.
+type PromiseRejectionHandler func(ctx *Context, promise Value, reason Value, isHandled bool)
+
+// WithPromiseRejectionHandler will set the runtime's promise rejection handler; default is nil, rejections are dropped.
+func WithPromiseRejectionHandler(handler PromiseRejectionHandler) Option {
+	return func(o *Options) {
+		o.promiseRejectionHandler = handler
+	}
+}
+
+// SetPromiseRejectionHandler sets the runtime's promise rejection handler, so hosts can log or escalate unhandled rejections; use nil to remove it.
+func (r Runtime) SetPromiseRejectionHandler(handler PromiseRejectionHandler) {
+	r.options.promiseRejectionHandler = handler
+	r.updatePromiseRejectionTracker()
+}
+
+// PromiseAll returns the promise of Promise.all for the values, fulfilled with the array of their results once all are fulfilled,
+// or rejected with the first rejection, e.g. to wait with a single Await for the promises returned by several scripts.
+// It does not take ownership of the values; a nil value stands for undefined. The promise must be freed.
+func (ctx *Context) PromiseAll(values ...*Value) *Value {
+	return ctx.combinePromises("all", values)
+}
+
+// PromiseRace returns the promise of Promise.race for the values, settled like the first of them to settle, see PromiseAll.
+func (ctx *Context) PromiseRace(values ...*Value) *Value {
+	return ctx.combinePromises("race", values)
+}
+
+// PromiseAllSettled returns the promise of Promise.allSettled for the values, fulfilled once all are settled with the array
+// of their outcomes, objects of a status, "fulfilled" or "rejected", and of a value or a reason; see PromiseAll.
+func (ctx *Context) PromiseAllSettled(values ...*Value) *Value {
+	return ctx.combinePromises("allSettled", values)
+}
+
+// combinePromises calls the method of the Promise constructor of the context with the array of the values.
+func (ctx *Context) combinePromises(method string, values []*Value) *Value {
+	vals := make([]Value, 0, len(values))
+	for _, v := range values {
+		if v != nil {
+			vals = append(vals, *v)
+		}
+	}
+	if exception, ok := ctx.throwForeign(vals...); ok {
+		return &exception
+	}
+
+	arr := ctx.newValue(C.JS_NewArray(ctx.ref))
+	defer arr.Free()
+	for i, v := range values {
+		if v == nil {
+			arr.SetIdx(int64(i), ctx.Undefined())
+		} else {
+			arr.SetIdx(int64(i), v.dup())
+		}
+	}
+
+	ctor := ctx.Globals().Get("Promise")
+	defer ctor.Free()
+	ret := ctor.Call(method, arr)
+	return &ret
+}
@@ -1,13 +1,23 @@
 package quickjs_test
 
 import (
+	"bytes"
+	"context"
+	"encoding/json"
 	"errors"
 	"fmt"
+	"io"
+	"math"
 	"math/big"
+	"os"
+	"path/filepath"
+	"runtime"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
+	"unicode/utf8"
 
 	"github.com/buke/quickjs-go"
 	"github.com/stretchr/testify/assert"
@@ -32,7 +42,6 @@ func Example() {
 
 	// Create a new object
 	test := ctx.Object()
-	defer test.Free()
 	// bind properties to the object
 	test.Set("A", test.Context().String("String A"))
 	test.Set("B", ctx.Int32(0))
@@ -50,7 +59,9 @@ func Example() {
 	fmt.Println(js_ret.String())
 
 	// call js function by go
-	go_ret := ctx.Globals().Get("test").Call("hello", ctx.String("Golang!"))
+	globalTest := ctx.Globals().Get("test")
+	defer globalTest.Free()
+	go_ret := globalTest.Call("hello", ctx.String("Golang!"))
 	fmt.Println(go_ret.String())
 
 	//bind go function to Javascript async function
@@ -119,6 +130,34 @@ func TestRuntimeMemoryLimit(t *testing.T) {
 
 }
 
+func TestNewContextTightMemoryLimit(t *testing.T) {
+	logger := &testLogger{}
+	rt := quickjs.NewRuntime(quickjs.WithMemoryLimit(110000), quickjs.WithAtomics(false), quickjs.WithLogger(logger))
+	defer rt.Close()
+
+	// the setup of the context does not fit, so no context is created
+	ctx, err := rt.NewContextErr()
+	require.ErrorContains(t, err, "quickjs: context setup failed")
+	require.Nil(t, ctx)
+
+	// or the context fails closed, instead of running code without the settings of the runtime
+	ctx = rt.NewContext()
+	defer ctx.Close()
+	require.Len(t, logger.entries, 1)
+	require.True(t, strings.HasPrefix(logger.entries[0], "warn quickjs: context setup failed"))
+
+	rt.SetMemoryLimit(64 << 20)
+	_, err = ctx.Eval(`typeof Atomics + " " + typeof SharedArrayBuffer`)
+	require.ErrorContains(t, err, "quickjs: context setup failed")
+
+	// until a reset applies them
+	require.NoError(t, ctx.Reset())
+	ret, err := ctx.Eval(`typeof Atomics + " " + typeof SharedArrayBuffer`)
+	require.NoError(t, err)
+	require.Equal(t, "undefined undefined", ret.String())
+	ret.Free()
+}
+
 func TestRuntimeStackSize(t *testing.T) {
 	rt := quickjs.NewRuntime()
 	defer rt.Close()
@@ -163,6 +202,10 @@ func TestThrowError(t *testing.T) {
 	_, actual := ctx.Eval("A()")
 	require.Error(t, actual)
 	require.EqualValues(t, "Error: "+expected.Error(), actual.Error())
+
+	// values other than Error objects are thrown too
+	_, actual = ctx.Eval("throw 1")
+	require.EqualError(t, actual, "1")
 }
 
 func TestThrowInternalError(t *testing.T) {
@@ -782,6 +825,353 @@ func TestAwait(t *testing.T) {
 
 }
 
+func TestAwaitFairness(t *testing.T) {
+	rt := quickjs.NewRuntime()
+	defer rt.Close()
+
+	ctx := rt.NewContext()
+	defer ctx.Close()
+
+	// a promise settled by a job scheduled from another goroutine
+	promise, err := ctx.Eval(`new Promise((resolve) => { globalThis.resolve = resolve; })`)
+	require.NoError(t, err)
+	go func() {
+		time.Sleep(10 * time.Millisecond)
+		ctx.Schedule(func(ctx *quickjs.Context) {
+			ret, _ := ctx.Eval(`resolve(42)`)
+			ret.Free()
+		})
+	}()
+	ret, err := ctx.Await(promise)
+	require.NoError(t, err)
+	require.EqualValues(t, 42, ret.Int32())
+	ret.Free()
+
+	// endless promise jobs starve neither the scheduled jobs nor the timers
+	_, err = ctx.Eval(`
+		globalThis.spins = 0;
+		globalThis.stop = false;
+		const spin = () => { spins++; if (!stop) Promise.resolve().then(spin); };
+		spin();
+	`)
+	require.NoError(t, err)
+	promise, err = ctx.Eval(`new Promise((resolve) => { globalThis.resolve = resolve; })`)
+	require.NoError(t, err)
+	require.NoError(t, ctx.Schedule(func(ctx *quickjs.Context) {
+		ret, _ := ctx.Eval(`setTimeout(() => { stop = true; resolve(spins); }, 0)`)
+		ret.Free()
+	}))
+	ret, err = ctx.Await(promise)
+	require.NoError(t, err)
+	require.Greater(t, ret.Int32(), int32(0))
+	ret.Free()
+
+	// the iterations are bounded
+	_, err = ctx.Eval(`globalThis.stop = false; spin();`)
+	require.NoError(t, err)
+	promise, err = ctx.Eval(`new Promise(() => {})`)
+	require.NoError(t, err)
+	_, err = ctx.Await(promise, quickjs.AwaitMaxIterations(10))
+	require.ErrorContains(t, err, "maximum await iterations of 10 exceeded")
+	_, err = ctx.Eval(`stop = true`)
+	require.NoError(t, err)
+
+	rt2 := quickjs.NewRuntime(quickjs.WithMaxAwaitIterations(5))
+	defer rt2.Close()
+	ctx2 := rt2.NewContext()
+	defer ctx2.Close()
+	_, err = ctx2.Eval(`(async () => { for (;;) await null; })()`, quickjs.EvalAwait(true))
+	require.ErrorContains(t, err, "maximum await iterations of 5 exceeded")
+}
+
+func TestAwaitAll(t *testing.T) {
+	rt := quickjs.NewRuntime()
+	defer rt.Close()
+
+	ctx := rt.NewContext()
+	defer ctx.Close()
+
+	first, err := ctx.Eval(`new Promise((resolve) => setTimeout(() => resolve(1), 10))`)
+	require.NoError(t, err)
+	second, err := ctx.Eval(`Promise.resolve(2)`)
+	require.NoError(t, err)
+	third := ctx.String("three")
+	vals, err := ctx.AwaitAll([]*quickjs.Value{&first, &second, nil, &third})
+	require.NoError(t, err)
+	require.Len(t, vals, 4)
+	require.EqualValues(t, 1, vals[0].Int32())
+	require.EqualValues(t, 2, vals[1].Int32())
+	require.True(t, vals[2].IsUndefined())
+	require.EqualValues(t, "three", vals[3].String())
+	for _, val := range vals {
+		val.Free()
+	}
+
+	// the first rejection in order is returned
+	first, err = ctx.Eval(`Promise.reject(new Error("first"))`)
+	require.NoError(t, err)
+	second, err = ctx.Eval(`Promise.reject(new Error("second"))`)
+	require.NoError(t, err)
+	vals, err = ctx.AwaitAll([]*quickjs.Value{&first, &second})
+	require.Nil(t, vals)
+	require.ErrorContains(t, err, "first")
+}
+
+func TestPromiseCombinators(t *testing.T) {
+	rt := quickjs.NewRuntime()
+	defer rt.Close()
+
+	ctx := rt.NewContext()
+	defer ctx.Close()
+
+	slow, err := ctx.Eval(`new Promise((resolve) => setTimeout(() => resolve("slow"), 10))`)
+	require.NoError(t, err)
+	defer slow.Free()
+	fast, err := ctx.Eval(`Promise.resolve("fast")`)
+	require.NoError(t, err)
+	defer fast.Free()
+	failed, err := ctx.Eval(`Promise.reject(new Error("failed"))`)
+	require.NoError(t, err)
+	defer failed.Free()
+	plain := ctx.Int32(1)
+	defer plain.Free()
+
+	all := ctx.PromiseAll(&slow, &fast, &plain, nil)
+	ret, err := ctx.Await(*all)
+	require.NoError(t, err)
+	require.EqualValues(t, `["slow","fast",1,null]`, ret.JSONStringify())
+	ret.Free()
+
+	never, err := ctx.Eval(`new Promise(() => {})`)
+	require.NoError(t, err)
+	defer never.Free()
+	race := ctx.PromiseRace(&never, &fast)
+	ret, err = ctx.Await(*race)
+	require.NoError(t, err)
+	require.EqualValues(t, "fast", ret.String())
+	ret.Free()
+
+	settled := ctx.PromiseAllSettled(&fast, &failed)
+	ret, err = ctx.Await(*settled)
+	require.NoError(t, err)
+	require.EqualValues(t, `[{"status":"fulfilled","value":"fast"},{"status":"rejected","reason":{}}]`, ret.JSONStringify())
+	ret.Free()
+
+	all = ctx.PromiseAll(&fast, &failed)
+	_, err = ctx.Await(*all)
+	require.ErrorContains(t, err, "failed")
+
+	// the values of another runtime are refused
+	rt2 := quickjs.NewRuntime()
+	defer rt2.Close()
+	ctx2 := rt2.NewContext()
+	defer ctx2.Close()
+	foreign := ctx2.String("foreign")
+	defer foreign.Free()
+	ret = *ctx.PromiseRace(&foreign)
+	require.True(t, ret.IsException())
+	require.ErrorContains(t, ctx.Exception(), quickjs.ErrForeignValue.Error())
+}
+
+func TestThenable(t *testing.T) {
+	rt := quickjs.NewRuntime()
+	defer rt.Close()
+
+	ctx := rt.NewContext()
+	defer ctx.Close()
+
+	ctx.Globals().Set("answer", ctx.NewThenable(func(resolve, reject func(*quickjs.Value)) {
+		val := ctx.Int32(41)
+		resolve(&val)
+	}))
+	ctx.Globals().Set("denied", ctx.NewThenable(func(resolve, reject func(*quickjs.Value)) {
+		reason := ctx.Error(errors.New("denied"))
+		defer reason.Free()
+		reject(&reason)
+		resolve(nil)
+	}))
+	ret, err := ctx.Eval(`(async () => await answer + 1)()`, quickjs.EvalAwait(true))
+	require.NoError(t, err)
+	require.EqualValues(t, 42, ret.Int32())
+	ret.Free()
+	_, err = ctx.Eval(`(async () => await denied)()`, quickjs.EvalAwait(true))
+	require.ErrorContains(t, err, "denied")
+
+	// a Go function runs once, on a goroutine of its own
+	var calls int32
+	ctx.Globals().Set("lookup", ctx.NewThenableFunc(func() (interface{}, error) {
+		atomic.AddInt32(&calls, 1)
+		time.Sleep(5 * time.Millisecond)
+		return map[string]int{"n": 21}, nil
+	}))
+	ret, err = ctx.Eval(`Promise.all([lookup, lookup]).then(([a, b]) => a.n + b.n)`, quickjs.EvalAwait(true))
+	require.NoError(t, err)
+	require.EqualValues(t, 42, ret.Int32())
+	ret.Free()
+	require.EqualValues(t, 1, atomic.LoadInt32(&calls))
+
+	ctx.Globals().Set("failing", ctx.NewThenableFunc(func() (interface{}, error) {
+		return nil, errors.New("lookup failed")
+	}))
+	_, err = ctx.Eval(`(async () => await failing)()`, quickjs.EvalAwait(true))
+	require.ErrorContains(t, err, "lookup failed")
+
+	ch := make(chan interface{}, 1)
+	ctx.Globals().Set("received", ctx.NewThenableChan(ch))
+	go func() { ch <- "hello" }()
+	ret, err = ctx.Eval(`(async () => await received)()`, quickjs.EvalAwait(true))
+	require.NoError(t, err)
+	require.EqualValues(t, "hello", ret.String())
+	ret.Free()
+
+	// the callbacks not settled are dropped with the context
+	ctx.Globals().Set("never", ctx.NewThenable(func(resolve, reject func(*quickjs.Value)) {}))
+	ret, err = ctx.Eval(`never.then(() => {}); Promise.resolve(never)`)
+	require.NoError(t, err)
+	require.EqualValues(t, quickjs.PromiseStatePending, ret.PromiseState())
+	ret.Free()
+}
+
+func TestGenerator(t *testing.T) {
+	rt := quickjs.NewRuntime()
+	defer rt.Close()
+
+	ctx := rt.NewContext()
+	defer ctx.Close()
+
+	gen, err := ctx.Eval(`(function* pages() {
+		let size = 1;
+		try {
+			for (let page = 1; ; page++) {
+				const next = yield { page, size };
+				if (next !== undefined) size = next;
+			}
+		} finally {
+			globalThis.cleaned = true;
+		}
+	})()`)
+	require.NoError(t, err)
+	defer gen.Free()
+	require.True(t, gen.IsGenerator())
+	require.False(t, gen.IsAsyncGenerator())
+	require.EqualValues(t, quickjs.KindGenerator, gen.Kind())
+
+	val, done, err := gen.GeneratorNext(ctx.Undefined())
+	require.NoError(t, err)
+	require.False(t, done)
+	require.EqualValues(t, `{"page":1,"size":1}`, val.JSONStringify())
+	val.Free()
+	val, done, err = gen.GeneratorNext(ctx.Int32(10))
+	require.NoError(t, err)
+	require.False(t, done)
+	require.EqualValues(t, `{"page":2,"size":10}`, val.JSONStringify())
+	val.Free()
+
+	val, done, err = gen.GeneratorReturn(ctx.String("stopped"))
+	require.NoError(t, err)
+	require.True(t, done)
+	require.EqualValues(t, "stopped", val.String())
+	val.Free()
+	cleaned := ctx.Globals().Get("cleaned")
+	require.True(t, cleaned.Bool())
+	cleaned.Free()
+
+	// a thrown value ends the generator unless it catches it
+	gen2, err := ctx.Eval(`(function* () { try { yield 1; } catch (e) { yield "caught " + e; } })()`)
+	require.NoError(t, err)
+	defer gen2.Free()
+	val, _, err = gen2.GeneratorNext(ctx.Undefined())
+	require.NoError(t, err)
+	val.Free()
+	val, done, err = gen2.GeneratorThrow(ctx.String("oops"))
+	require.NoError(t, err)
+	require.False(t, done)
+	require.EqualValues(t, "caught oops", val.String())
+	val.Free()
+	_, done, err = gen2.GeneratorThrow(ctx.String("again"))
+	require.Error(t, err)
+	require.True(t, done)
+
+	// the steps of async generators are awaited
+	agen, err := ctx.Eval(`(async function* () {
+		for (let i = 1; i <= 2; i++) {
+			yield await new Promise((resolve) => setTimeout(() => resolve(i * 10), 1));
+		}
+		throw new Error("exhausted");
+	})()`)
+	require.NoError(t, err)
+	defer agen.Free()
+	require.True(t, agen.IsGenerator())
+	require.True(t, agen.IsAsyncGenerator())
+	var got []int32
+	for {
+		val, done, err := agen.GeneratorNext(ctx.Undefined())
+		if err != nil {
+			require.ErrorContains(t, err, "exhausted")
+			break
+		}
+		require.False(t, done)
+		got = append(got, val.Int32())
+		val.Free()
+	}
+	require.EqualValues(t, []int32{10, 20}, got)
+
+	obj := ctx.Object()
+	defer obj.Free()
+	require.False(t, obj.IsGenerator())
+	_, _, err = obj.GeneratorNext(ctx.Undefined())
+	require.ErrorIs(t, err, quickjs.ErrNotGenerator)
+}
+
+func TestIterate(t *testing.T) {
+	rt := quickjs.NewRuntime()
+	defer rt.Close()
+
+	ctx := rt.NewContext()
+	defer ctx.Close()
+
+	collect := func(code string) []string {
+		val, err := ctx.Eval(code)
+		require.NoError(t, err)
+		defer val.Free()
+		var got []string
+		require.NoError(t, val.Iterate(func(v *quickjs.Value) bool {
+			got = append(got, v.JSONStringify())
+			return true
+		}))
+		return got
+	}
+	require.EqualValues(t, []string{"1", "2"}, collect(`[1, 2]`))
+	require.EqualValues(t, []string{`"a"`, `"b"`}, collect(`"ab"`))
+	require.EqualValues(t, []string{`["k",1]`}, collect(`new Map([["k", 1]])`))
+	require.EqualValues(t, []string{"3", "4"}, collect(`new Set([3, 4])`))
+	require.EqualValues(t, []string{"0", "1", "2"}, collect(`({ *[Symbol.iterator]() { for (let i = 0; i < 3; i++) yield i; } })`))
+
+	// stopping early closes the iterator
+	gen, err := ctx.Eval(`(function* () { try { for (let i = 0; ; i++) yield i; } finally { globalThis.closed = true; } })()`)
+	require.NoError(t, err)
+	defer gen.Free()
+	var got []int32
+	require.NoError(t, gen.Iterate(func(v *quickjs.Value) bool {
+		got = append(got, v.Int32())
+		return len(got) < 3
+	}))
+	require.EqualValues(t, []int32{0, 1, 2}, got)
+	closed := ctx.Globals().Get("closed")
+	require.True(t, closed.Bool())
+	closed.Free()
+
+	// the exceptions of the iteration are returned
+	failing, err := ctx.Eval(`({ *[Symbol.iterator]() { yield 1; throw new Error("broken"); } })`)
+	require.NoError(t, err)
+	defer failing.Free()
+	require.ErrorContains(t, failing.Iterate(func(v *quickjs.Value) bool { return true }), "broken")
+
+	obj := ctx.Object()
+	defer obj.Free()
+	require.ErrorIs(t, obj.Iterate(func(v *quickjs.Value) bool { return true }), quickjs.ErrNotIterable)
+}
+
 func TestModule(t *testing.T) {
 	// enable module import
 	rt := quickjs.NewRuntime(quickjs.WithModuleImport(true))
@@ -885,3 +1275,4429 @@ func TestClassConstructor(t *testing.T) {
 	require.EqualValues(t, 10, x.Int32())
 
 }
+
+func TestWeakRef(t *testing.T) {
+	rt := quickjs.NewRuntime()
+	defer rt.Close()
+	ctx := rt.NewContext()
+	defer ctx.Close()
+
+	obj, err := ctx.Eval(`globalThis.target = { name: "foo" }`)
+	require.NoError(t, err)
+
+	weak, err := ctx.NewWeakRef(obj)
+	require.NoError(t, err)
+	obj.Free()
+
+	target, ok := weak.Deref()
+	require.True(t, ok)
+	require.EqualValues(t, "foo", target.Get("name").String())
+	target.Free()
+
+	ret, err := ctx.Eval(`delete globalThis.target`)
+	require.NoError(t, err)
+	ret.Free()
+	rt.RunGC()
+
+	require.False(t, weak.Alive())
+	_, ok = weak.Deref()
+	require.False(t, ok)
+
+	_, err = ctx.NewWeakRef(ctx.Int32(1))
+	require.Error(t, err)
+
+	frozen, _ := ctx.Eval(`Object.freeze({})`)
+	defer frozen.Free()
+	_, err = ctx.NewWeakRef(frozen)
+	require.Error(t, err)
+
+	// a Proxy could keep the sentinel from its target
+	proxy, err := ctx.Eval(`
+		globalThis.stolen = [];
+		new Proxy({}, { defineProperty: (target, key, desc) => { stolen.push(desc.value); return true; } })
+	`)
+	require.NoError(t, err)
+	defer proxy.Free()
+	_, err = ctx.NewWeakRef(proxy)
+	require.EqualError(t, err, "weak reference target cannot be a Proxy")
+	ret, err = ctx.Eval(`stolen.length`)
+	require.NoError(t, err)
+	require.EqualValues(t, 0, ret.Int32())
+	ret.Free()
+
+	// the sentinel is out of reach of scripts, which cannot keep it alive once the target is collected
+	obj, err = ctx.Eval(`globalThis.other = {}`)
+	require.NoError(t, err)
+	weak, err = ctx.NewWeakRef(obj)
+	require.NoError(t, err)
+	again, err := ctx.NewWeakRef(obj)
+	require.NoError(t, err)
+	obj.Free()
+	ret, err = ctx.Eval(`
+		globalThis.kept = [Object.getOwnPropertySymbols(other).map(key => other[key]), Object.getOwnPropertyDescriptors(other)];
+		delete globalThis.other;
+		JSON.stringify(kept)
+	`)
+	require.NoError(t, err)
+	require.Equal(t, "[[],{}]", ret.String())
+	ret.Free()
+	rt.RunGC()
+	require.False(t, weak.Alive())
+	require.False(t, again.Alive())
+	if target, ok := weak.Deref(); ok {
+		defer target.Free()
+		t.Fatalf("collected target still dereferenced: %s", target.JSONStringify())
+	}
+}
+
+func TestScope(t *testing.T) {
+	rt := quickjs.NewRuntime()
+	defer rt.Close()
+	ctx := rt.NewContext()
+	defer ctx.Close()
+
+	var escaped quickjs.Value
+	func() {
+		s := ctx.NewScope()
+		defer s.Close()
+
+		obj := s.Track(ctx.Object())
+		obj.Set("a", ctx.Int32(1))
+
+		ret, err := s.Eval(`[1, 2, 3].map(x => x * 2)`)
+		require.NoError(t, err)
+		require.EqualValues(t, 2, s.Len())
+
+		inner := s.NewScope()
+		str := inner.Track(ctx.String("escaped"))
+		escaped = str.Escape(inner)
+		inner.Close()
+		require.EqualValues(t, 0, inner.Len())
+		require.EqualValues(t, 3, s.Len())
+
+		escaped = ret.Escape(s)
+		require.EqualValues(t, 2, s.Len())
+	}()
+	defer escaped.Free()
+
+	require.EqualValues(t, "2,4,6", escaped.String())
+}
+
+func TestValueTracking(t *testing.T) {
+	var closeReport *quickjs.LeakReport
+	rt := quickjs.NewRuntime(
+		quickjs.WithValueTracking(true),
+		quickjs.WithLeakHandler(func(report *quickjs.LeakReport) { closeReport = report }),
+	)
+	defer rt.Close()
+	ctx := rt.NewContext()
+
+	obj := ctx.Object()
+	obj.Set("name", ctx.String("foo"))
+	obj.Free()
+
+	var leaked []quickjs.Value
+	for i := 0; i < 3; i++ {
+		leaked = append(leaked, ctx.String(fmt.Sprintf("leak %d", i)))
+	}
+
+	report := ctx.LeakReport()
+	require.EqualValues(t, 3, report.Total)
+	require.Len(t, report.Sites, 1)
+	require.EqualValues(t, 3, report.Sites[0].Count)
+	require.Contains(t, report.Sites[0].Location, "quickjs_test.go")
+	require.Contains(t, report.String(), "3 value(s) not freed")
+
+	leaked[0].Free()
+	ctx.Close()
+
+	require.NotNil(t, closeReport)
+	require.EqualValues(t, 2, closeReport.Total)
+}
+
+func TestFreeCheck(t *testing.T) {
+	rt := quickjs.NewRuntime(quickjs.WithFreeCheck(true))
+	defer rt.Close()
+	ctx := rt.NewContext()
+	defer ctx.Close()
+
+	panicMessage := func(fn func()) (msg string) {
+		defer func() {
+			msg, _ = recover().(string)
+		}()
+		fn()
+		return ""
+	}
+
+	obj := ctx.Object()
+	obj.Set("name", ctx.String("foo"))
+	stale := obj
+	obj.Free()
+
+	msg := panicMessage(func() { stale.Get("name") })
+	require.Contains(t, msg, "quickjs: Value used after Free")
+	require.Contains(t, msg, "TestFreeCheck")
+	require.Contains(t, panicMessage(func() { stale.Free() }), "quickjs: Value used after Free")
+	toString := ctx.Globals().Get("String")
+	defer toString.Free()
+	require.Contains(t, panicMessage(func() { ctx.Invoke(toString, ctx.Null(), stale) }), "quickjs: Value used after Free")
+
+	// freeing one of several references does not mark the value
+	parent := ctx.Object()
+	defer parent.Free()
+	parent.Set("child", ctx.Object())
+	first := parent.Get("child")
+	second := parent.Get("child")
+	first.Free()
+	require.Empty(t, panicMessage(func() { require.Equal(t, "[object Object]", second.String()) }))
+	second.Free()
+
+	// the values reusing the memory of a freed value are valid
+	for i := 0; i < 100; i++ {
+		val := ctx.Object()
+		require.Empty(t, panicMessage(func() { val.Set("i", ctx.Int32(int32(i))) }))
+		val.Free()
+	}
+}
+
+func TestDoubleFree(t *testing.T) {
+	rt := quickjs.NewRuntime(quickjs.WithFreeCheck(true))
+	defer rt.Close()
+	ctx := rt.NewContext()
+	defer ctx.Close()
+
+	panicMessage := func(fn func()) (msg string) {
+		defer func() {
+			msg, _ = recover().(string)
+		}()
+		fn()
+		return ""
+	}
+
+	// Set takes ownership, so the deferred Free releases a reference Go no longer owns
+	msg := panicMessage(func() {
+		config := ctx.Object()
+		defer config.Free()
+		config.Set("debug", ctx.Bool(true))
+		ctx.Globals().Set("config", config)
+	})
+	require.Contains(t, msg, "quickjs: Value released without an owned reference")
+	require.Contains(t, msg, "last released at")
+	require.Contains(t, msg, "TestDoubleFree")
+
+	// the global kept its reference
+	ret, err := ctx.Eval("config.debug")
+	require.NoError(t, err)
+	require.True(t, ret.Bool())
+	ret.Free()
+
+	// a value retrieved back from the globals is owned again
+	require.Empty(t, panicMessage(func() {
+		config := ctx.Globals().Get("config")
+		defer config.Free()
+		require.True(t, config.Get("debug").Bool())
+	}))
+
+	obj := ctx.Object()
+	obj.Free()
+	require.Contains(t, panicMessage(func() { obj.Free() }), "quickjs: Value used after Free")
+
+	// freeing a borrowed argument is detected too
+	fn := ctx.Function(func(ctx *quickjs.Context, this quickjs.Value, args []quickjs.Value) quickjs.Value {
+		args[0].Free()
+		return ctx.Undefined()
+	})
+	ctx.Globals().Set("release", fn)
+	_, err = ctx.Eval("release({})")
+	require.ErrorContains(t, err, "quickjs: Value released without an owned reference")
+}
+
+func TestValueDup(t *testing.T) {
+	rt := quickjs.NewRuntime(quickjs.WithFreeCheck(true))
+	defer rt.Close()
+	ctx := rt.NewContext()
+	defer ctx.Close()
+
+	config := ctx.Object()
+	defer config.Free()
+	config.Set("debug", ctx.Bool(true))
+	ctx.Globals().Set("config", config.Dup())
+	_, err := ctx.Eval("config.debug = false")
+	require.NoError(t, err)
+	require.False(t, config.Get("debug").Bool())
+
+	// a borrowed argument is kept beyond the call with Dup
+	var kept quickjs.Value
+	keep := ctx.Function(func(ctx *quickjs.Context, this quickjs.Value, args []quickjs.Value) quickjs.Value {
+		kept = args[0].Dup()
+		return ctx.Undefined()
+	})
+	ctx.Globals().Set("keep", keep)
+	_, err = ctx.Eval("keep({ name: 'kept' })")
+	require.NoError(t, err)
+	rt.RunGC()
+	name := kept.Get("name")
+	require.Equal(t, "kept", name.String())
+	name.Free()
+	kept.Free()
+}
+
+func TestAutoFree(t *testing.T) {
+	rt := quickjs.NewRuntime(quickjs.WithValueTracking(true), quickjs.WithLeakHandler(func(*quickjs.LeakReport) {}))
+	defer rt.Close()
+	ctx := rt.NewContext()
+	defer ctx.Close()
+
+	// finalizers run asynchronously, so give the Go GC a few rounds under pressure.
+	collect := func() {
+		for i := 0; i < 50 && ctx.LeakReport().Total > 0; i++ {
+			runtime.GC()
+			time.Sleep(10 * time.Millisecond)
+			ctx.FreePending()
+		}
+	}
+
+	for i := 0; i < 10000; i++ {
+		v := ctx.String(fmt.Sprintf("value %d", i)).AutoFree()
+		require.EqualValues(t, fmt.Sprintf("value %d", i), v.String())
+	}
+	collect()
+	require.EqualValues(t, 0, ctx.LeakReport().Total)
+
+	kept := ctx.Object().AutoFree()
+	kept.Set("name", ctx.String("kept"))
+	runtime.GC()
+	ret, err := ctx.Eval(`1 + 1`)
+	require.NoError(t, err)
+	require.EqualValues(t, 2, ret.Int32())
+	name := kept.Get("name")
+	require.EqualValues(t, "kept", name.String())
+	name.Free()
+	runtime.KeepAlive(kept)
+
+	kept = nil
+	collect()
+	require.EqualValues(t, 0, ctx.LeakReport().Total)
+}
+
+func TestBytecodeCache(t *testing.T) {
+	cache := quickjs.NewMemoryBytecodeCache()
+	rt := quickjs.NewRuntime(quickjs.WithBytecodeCache(cache))
+	defer rt.Close()
+	ctx := rt.NewContext()
+	defer ctx.Close()
+
+	for i := 0; i < 3; i++ {
+		ret, err := ctx.Eval(`var counter = (globalThis.counter || 0) + 1; counter`)
+		require.NoError(t, err)
+		require.EqualValues(t, i+1, ret.Int32())
+		ret.Free()
+	}
+	require.EqualValues(t, 1, cache.Len())
+
+	_, err := ctx.Eval(`"bad syntax'`)
+	require.Error(t, err)
+	require.EqualValues(t, 1, cache.Len())
+
+	buf1, err := ctx.Compile(`1 + 2`)
+	require.NoError(t, err)
+	buf2, err := ctx.Compile(`1 + 2`)
+	require.NoError(t, err)
+	require.Equal(t, buf1, buf2)
+	require.EqualValues(t, 2, cache.Len())
+
+	// the bytecode returned is the caller's, changing it leaves the cache intact
+	original := append([]byte(nil), buf1...)
+	for i := range buf1 {
+		buf1[i], buf2[i] = 0, 0
+	}
+	buf3, err := ctx.Compile(`1 + 2`)
+	require.NoError(t, err)
+	require.Equal(t, original, buf3)
+	compiledKey := quickjs.BytecodeCacheKey(`1 + 2`, "<input>", 0)
+	cached, found := cache.Get(compiledKey)
+	require.True(t, found)
+	for i := range cached {
+		cached[i] = 0
+	}
+	cached, _ = cache.Get(compiledKey)
+	require.Equal(t, original, cached)
+
+	dir := t.TempDir()
+	fileCache, err := quickjs.NewFileBytecodeCache(dir)
+	require.NoError(t, err)
+	ctx.SetBytecodeCache(fileCache)
+	require.Equal(t, fileCache, ctx.BytecodeCache())
+
+	for i := 0; i < 2; i++ {
+		ret, err := ctx.Eval(`[1, 2, 3].join("-")`)
+		require.NoError(t, err)
+		require.EqualValues(t, "1-2-3", ret.String())
+		ret.Free()
+	}
+	key := quickjs.BytecodeCacheKey(`[1, 2, 3].join("-")`, "<input>", 0)
+	_, ok := fileCache.Get(key)
+	require.True(t, ok)
+
+	// a corrupted entry is recompiled and replaced.
+	fileCache.Put(key, []byte{1, 2, 3})
+	ret, err := ctx.Eval(`[1, 2, 3].join("-")`)
+	require.NoError(t, err)
+	require.EqualValues(t, "1-2-3", ret.String())
+	ret.Free()
+	buf, _ := fileCache.Get(key)
+	require.Greater(t, len(buf), 3)
+}
+
+func TestQuickJSVersion(t *testing.T) {
+	// an empty version would let the bytecode of any engine through
+	require.NotEmpty(t, quickjs.QuickJSVersion)
+	require.Regexp(t, `^\d{4}-\d{2}-\d{2}$`, quickjs.QuickJSVersion)
+
+	// the version is the one of the bundled library
+	lib, err := os.ReadFile(filepath.Join("deps", "libs", runtime.GOOS+"_"+runtime.GOARCH, "libquickjs.a"))
+	require.NoError(t, err)
+	require.True(t, bytes.Contains(lib, []byte(" "+quickjs.QuickJSVersion+" version,")))
+
+	// and of its sources, when the submodule is checked out
+	version, err := os.ReadFile(filepath.Join("deps", "quickjs", "VERSION"))
+	if errors.Is(err, os.ErrNotExist) {
+		t.Skip("the quickjs submodule is not checked out")
+	}
+	require.NoError(t, err)
+	require.Equal(t, strings.TrimSpace(string(version)), quickjs.QuickJSVersion)
+}
+
+func TestBytecodeHeader(t *testing.T) {
+	rt := quickjs.NewRuntime()
+	defer rt.Close()
+	ctx := rt.NewContext()
+	defer ctx.Close()
+
+	buf, err := ctx.Compile(`1 + 2`)
+	require.NoError(t, err)
+	require.EqualValues(t, "QJSB", string(buf[:4]))
+
+	ret, err := ctx.EvalBytecode(buf)
+	require.NoError(t, err)
+	require.EqualValues(t, 3, ret.Int32())
+
+	// bytecode produced by another engine version
+	other := append([]byte{}, buf...)
+	copy(other[7:], "2021-03-27")
+	_, err = ctx.EvalBytecode(other)
+	require.ErrorIs(t, err, quickjs.ErrBytecodeVersionMismatch)
+	require.Contains(t, err.Error(), "2021-03-27")
+
+	// corrupted payload
+	corrupted := append([]byte{}, buf...)
+	corrupted[len(corrupted)-1] ^= 0xff
+	_, err = ctx.EvalBytecode(corrupted)
+	require.ErrorIs(t, err, quickjs.ErrBytecodeChecksum)
+
+	// truncated payload
+	_, err = ctx.EvalBytecode(buf[:len(buf)-2])
+	require.ErrorIs(t, err, quickjs.ErrBytecodeChecksum)
+
+	// raw bytecode without header
+	_, err = ctx.EvalBytecode(buf[21:])
+	require.ErrorIs(t, err, quickjs.ErrBytecodeInvalid)
+
+	// script bytecode is not a module
+	_, err = ctx.LoadModuleBytecode(buf)
+	require.EqualError(t, err, "not a module")
+}
+
+func TestSetEvalEnabled(t *testing.T) {
+	rt := quickjs.NewRuntime()
+	defer rt.Close()
+	ctx := rt.NewContext()
+	defer ctx.Close()
+
+	require.True(t, ctx.EvalEnabled())
+	require.NoError(t, ctx.SetEvalEnabled(false))
+	require.False(t, ctx.EvalEnabled())
+
+	for _, code := range []string{
+		`eval("1 + 1")`,
+		`(0, eval)("1 + 1")`,
+		`new Function("return 1")()`,
+		`Function("return 1")()`,
+		`(function () {}).constructor("return 1")()`,
+		`(async function () {}).constructor("return 1")`,
+		`(function* () {}).constructor("yield 1")`,
+	} {
+		ret, err := ctx.Eval(code)
+		require.Error(t, err, code)
+		require.Contains(t, err.Error(), "EvalError: Code generation from strings disallowed", code)
+		ret.Free()
+	}
+
+	// nor through the std and os modules, dynamically or statically imported
+	for _, code := range []string{
+		`import("std").then((std) => std.evalScript("1 + 1"))`,
+		`import("os").then((os) => typeof os.Worker)`,
+	} {
+		ret, err := ctx.Eval(code, quickjs.EvalAwait(true))
+		require.Error(t, err, code)
+		require.Contains(t, err.Error(), "disallowed for this context", code)
+		ret.Free()
+	}
+	ret, err := ctx.Eval(`import * as std from "std"; globalThis.leaked = std.evalScript("1 + 1");`, quickjs.EvalFlagModule(true))
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "module 'std' disallowed for this context")
+	ret.Free()
+	leaked := ctx.Globals().Get("leaked")
+	require.True(t, leaked.IsUndefined())
+	leaked.Free()
+
+	// functions keep working and host code can still evaluate
+	ret, err = ctx.Eval(`(function () { return 42 })() + ((() => {}) instanceof Function ? 1 : 0)`)
+	require.NoError(t, err)
+	require.EqualValues(t, 43, ret.Int32())
+
+	require.NoError(t, ctx.SetEvalEnabled(true))
+	require.True(t, ctx.EvalEnabled())
+	ret, err = ctx.Eval(`eval("1 + 1") + new Function("return 1")()`)
+	require.NoError(t, err)
+	require.EqualValues(t, 3, ret.Int32())
+	ret, err = ctx.Eval(`import("std").then((std) => std.evalScript("1 + 1"))`, quickjs.EvalAwait(true))
+	require.NoError(t, err)
+	require.EqualValues(t, 2, ret.Int32())
+	ret.Free()
+
+	require.NoError(t, ctx.SetEvalEnabled(false))
+}
+
+func TestGCInfo(t *testing.T) {
+	rt := quickjs.NewRuntime(quickjs.WithGCThreshold(512 * 1024))
+	defer rt.Close()
+	ctx := rt.NewContext()
+	defer ctx.Close()
+
+	require.EqualValues(t, 512*1024, rt.GCInfo().Threshold)
+	rt.SetGCThreshold(1024 * 1024)
+	require.EqualValues(t, 1024*1024, rt.GCInfo().Threshold)
+
+	ret, err := ctx.Eval(`
+		for (let i = 0; i < 1000; i++) {
+			const a = {}, b = { a };
+			a.b = b;
+		}
+	`)
+	require.NoError(t, err)
+	ret.Free()
+
+	require.Greater(t, rt.MemoryUsage().ObjCount, int64(0))
+	rt.RunGC()
+
+	info := rt.GCInfo()
+	require.EqualValues(t, 1, info.Runs)
+	require.Greater(t, info.ObjectsBefore, info.ObjectsAfter)
+	require.Greater(t, info.MemoryBefore, info.MemoryAfter)
+	require.EqualValues(t, info.ObjectsAfter, rt.MemoryUsage().ObjCount)
+}
+
+func TestAtomics(t *testing.T) {
+	rt := quickjs.NewRuntime(quickjs.WithAtomics(false))
+	defer rt.Close()
+	ctx := rt.NewContext()
+	defer ctx.Close()
+
+	ret, err := ctx.Eval(`typeof Atomics + "," + typeof SharedArrayBuffer`)
+	require.NoError(t, err)
+	require.EqualValues(t, "undefined,undefined", ret.String())
+	ret.Free()
+
+	rt2 := quickjs.NewRuntime(quickjs.WithAtomicsWaitLimit(20 * time.Millisecond))
+	defer rt2.Close()
+	ctx2 := rt2.NewContext()
+	defer ctx2.Close()
+
+	start := time.Now()
+	ret, err = ctx2.Eval(`
+		const ia = new Int32Array(new SharedArrayBuffer(16));
+		Atomics.wait(ia, 0, 0) + "," + Atomics.wait(ia, 0, 0, 5) + "," + Atomics.wait(ia, 0, 1)
+	`)
+	require.NoError(t, err)
+	require.EqualValues(t, "timed-out,timed-out,not-equal", ret.String())
+	require.Less(t, time.Since(start), 5*time.Second)
+	ret.Free()
+}
+
+func TestPromiseRejectionHandler(t *testing.T) {
+	rt := quickjs.NewRuntime()
+	defer rt.Close()
+	ctx := rt.NewContext()
+	defer ctx.Close()
+
+	var unhandled, handled []string
+	rt.SetPromiseRejectionHandler(func(ctx *quickjs.Context, promise quickjs.Value, reason quickjs.Value, isHandled bool) {
+		require.True(t, promise.IsPromise())
+		if isHandled {
+			handled = append(handled, reason.String())
+		} else {
+			unhandled = append(unhandled, reason.String())
+		}
+	})
+
+	ret, err := ctx.Eval(`
+		globalThis.p = Promise.reject(new Error("first"));
+		Promise.reject("second");
+		Promise.reject("third").catch(() => {});
+	`)
+	require.NoError(t, err)
+	ret.Free()
+	ctx.Loop()
+	// rejections are reported synchronously, so "third" is reported again once its handler is attached.
+	require.Equal(t, []string{"Error: first", "second", "third"}, unhandled)
+	require.Equal(t, []string{"third"}, handled)
+
+	ret, err = ctx.Eval(`p.catch(() => {})`)
+	require.NoError(t, err)
+	ret.Free()
+	ctx.Loop()
+	require.Equal(t, []string{"third", "Error: first"}, handled)
+
+	rt.SetPromiseRejectionHandler(nil)
+	ret, err = ctx.Eval(`Promise.reject("ignored")`)
+	require.NoError(t, err)
+	ret.Free()
+	ctx.Loop()
+	require.Len(t, unhandled, 3)
+}
+
+func TestUncaughtExceptionHandler(t *testing.T) {
+	rt := quickjs.NewRuntime()
+	defer rt.Close()
+	ctx := rt.NewContext()
+	defer ctx.Close()
+
+	var errs []*quickjs.Error
+	ctx.SetUncaughtExceptionHandler(func(err *quickjs.Error) {
+		errs = append(errs, err)
+	})
+
+	ret, err := ctx.Eval(`
+		globalThis.after = false;
+		setTimeout(() => { throw new Error("boom"); }, 0);
+		setTimeout(() => { throw "plain"; }, 1);
+		setTimeout(() => { globalThis.after = true; }, 2);
+	`)
+	require.NoError(t, err)
+	ret.Free()
+	ctx.Loop()
+
+	require.Len(t, errs, 2)
+	require.Equal(t, "Error: boom", errs[0].Cause)
+	require.Contains(t, errs[0].Stack, "<input>")
+	require.Equal(t, "plain", errs[1].Cause)
+
+	after := ctx.Globals().Get("after")
+	defer after.Free()
+	require.True(t, after.Bool())
+}
+
+func TestUncaughtExceptionHandlerJobs(t *testing.T) {
+	rt := quickjs.NewRuntime()
+	defer rt.Close()
+	ctx := rt.NewContext()
+	defer ctx.Close()
+
+	var uncaught []string
+	ctx.SetUncaughtExceptionHandler(func(err *quickjs.Error) {
+		uncaught = append(uncaught, err.Error())
+	})
+
+	// the exceptions of microtasks are reported by Loop and Await
+	ret, err := ctx.Eval(`queueMicrotask(() => { throw new Error("microtask"); })`)
+	require.NoError(t, err)
+	ret.Free()
+	ctx.Loop()
+	require.Equal(t, []string{"Error: microtask"}, uncaught)
+
+	promise, err := ctx.Eval(`
+		queueMicrotask(() => { throw new Error("awaited microtask"); });
+		new Promise((resolve) => setTimeout(resolve, 1))
+	`)
+	require.NoError(t, err)
+	ret, err = ctx.Await(promise)
+	require.NoError(t, err)
+	ret.Free()
+	require.Equal(t, []string{"Error: microtask", "Error: awaited microtask"}, uncaught)
+
+	// so are the ones of the jobs which fail, e.g. when interrupted
+	uncaught = nil
+	interrupt := false
+	ctx.SetContextInterruptHandler(func(quickjs.InterruptInfo) int {
+		if interrupt {
+			return 1
+		}
+		return 0
+	})
+	ret, err = ctx.Eval(`queueMicrotask(() => { for (;;) {} })`)
+	require.NoError(t, err)
+	ret.Free()
+	interrupt = true
+	ctx.Loop()
+	require.Equal(t, []string{"InternalError: interrupted"}, uncaught)
+	ctx.SetContextInterruptHandler(nil)
+
+	// while the callbacks of promises reject the promise they return
+	uncaught = nil
+	ret, err = ctx.Eval(`Promise.resolve().then(() => { throw new Error("reaction"); })`)
+	require.NoError(t, err)
+	ret.Free()
+	ctx.Loop()
+	require.Empty(t, uncaught)
+}
+
+func TestContextInterruptHandler(t *testing.T) {
+	rt := quickjs.NewRuntime()
+	defer rt.Close()
+
+	strict := rt.NewContext()
+	defer strict.Close()
+	lenient := rt.NewContext()
+	defer lenient.Close()
+
+	var infos []quickjs.InterruptInfo
+	budget := func(limit time.Duration) quickjs.ContextInterruptHandler {
+		return func(info quickjs.InterruptInfo) int {
+			infos = append(infos, info)
+			if info.Elapsed > limit {
+				return 1
+			}
+			return 0
+		}
+	}
+	strict.SetTag("strict")
+	strict.SetContextInterruptHandler(budget(50 * time.Millisecond))
+	lenient.SetTag("lenient")
+	lenient.SetContextInterruptHandler(budget(time.Hour))
+
+	ret, err := strict.Eval(`while(true){}`)
+	defer ret.Free()
+	require.EqualError(t, err, "InternalError: interrupted")
+	require.Equal(t, "strict", strict.Tag())
+	require.Equal(t, "strict", infos[len(infos)-1].Tag)
+	require.Same(t, strict, infos[len(infos)-1].Context)
+	require.Greater(t, infos[len(infos)-1].Elapsed, 50*time.Millisecond)
+
+	infos = nil
+	ret2, err := lenient.Eval(`let n = 0; for (let i = 0; i < 1000000; i++) { n += i; } n`)
+	defer ret2.Free()
+	require.NoError(t, err)
+	require.NotEmpty(t, infos)
+	require.Equal(t, "lenient", infos[0].Tag)
+
+	// contexts without their own handler fall back to the runtime-wide one
+	other := rt.NewContext()
+	defer other.Close()
+	other.SetInterruptHandler(func() int { return 1 })
+	ret3, err := other.Eval(`while(true){}`)
+	defer ret3.Free()
+	require.EqualError(t, err, "InternalError: interrupted")
+}
+
+func TestEvalExprKeepsExecuteTimeout(t *testing.T) {
+	rt := quickjs.NewRuntime(quickjs.WithExecuteTimeout(1))
+	defer rt.Close()
+	ctx := rt.NewContext()
+	defer ctx.Close()
+
+	n, err := quickjs.EvalExpr[int](ctx, `1 + 1`, nil)
+	require.NoError(t, err)
+	require.Equal(t, 2, n)
+
+	start := time.Now()
+	ret, err := ctx.Eval(`while(true){}`)
+	defer ret.Free()
+	require.EqualError(t, err, "InternalError: interrupted")
+	require.Less(t, time.Since(start), 3*time.Second)
+}
+
+func TestContextInterruptHandlerKeepsExecuteTimeout(t *testing.T) {
+	rt := quickjs.NewRuntime(quickjs.WithExecuteTimeout(1))
+	defer rt.Close()
+	ctx := rt.NewContext()
+	defer ctx.Close()
+
+	polled := false
+	ctx.SetContextInterruptHandler(func(quickjs.InterruptInfo) int {
+		polled = true
+		return 0
+	})
+
+	start := time.Now()
+	ret, err := ctx.Eval(`while(true){}`)
+	defer ret.Free()
+	require.EqualError(t, err, "InternalError: interrupted")
+	require.True(t, polled)
+	require.Less(t, time.Since(start), 3*time.Second)
+}
+
+func TestModuleExports(t *testing.T) {
+	rt := quickjs.NewRuntime(quickjs.WithModuleImport(true))
+	defer rt.Close()
+	ctx := rt.NewContext()
+	defer ctx.Close()
+
+	mod, err := ctx.LoadModule(`
+		export const answer = 42;
+		export function add(a, b) { return a + b; }
+		export default "hello";
+	`, "math")
+	defer mod.Free()
+	require.NoError(t, err)
+
+	m, err := ctx.Module(mod)
+	require.NoError(t, err)
+	defer m.Free()
+
+	require.Equal(t, "math", m.Name())
+	require.ElementsMatch(t, []string{"answer", "add", "default"}, m.Keys())
+
+	answer := m.Get("answer")
+	defer answer.Free()
+	require.EqualValues(t, 42, answer.Int32())
+
+	missing := m.Get("missing")
+	defer missing.Free()
+	require.True(t, missing.IsUndefined())
+
+	sum := m.Namespace().Call("add", ctx.Int32(1), ctx.Int32(2))
+	defer sum.Free()
+	require.EqualValues(t, 3, sum.Int32())
+
+	exports := m.Exports()
+	require.Len(t, exports, 3)
+	require.Equal(t, "hello", exports["default"].String())
+	for _, v := range exports {
+		v.Free()
+	}
+
+	// the module is evaluated once, importing it again shares the same bindings
+	ret, err := ctx.Eval(`import { answer } from "math"; globalThis.imported = answer;`)
+	defer ret.Free()
+	require.NoError(t, err)
+	imported := ctx.Globals().Get("imported")
+	defer imported.Free()
+	require.EqualValues(t, 42, imported.Int32())
+
+	_, err = ctx.Module(ctx.Int32(1))
+	require.EqualError(t, err, "not a module")
+}
+
+func TestEvalModule(t *testing.T) {
+	rt := quickjs.NewRuntime(quickjs.WithModuleImport(true))
+	defer rt.Close()
+	ctx := rt.NewContext()
+	defer ctx.Close()
+
+	m, err := ctx.EvalModule(`
+		const value = await new Promise((resolve) => setTimeout(() => resolve(21), 1));
+		export const doubled = value * 2;
+		export default function greet(name) { return "hello " + name; }
+	`, "greeter")
+	require.NoError(t, err)
+	defer m.Free()
+
+	doubled := m.Get("doubled")
+	defer doubled.Free()
+	require.EqualValues(t, 42, doubled.Int32())
+
+	greeting := m.Namespace().Call("default", ctx.String("world"))
+	defer greeting.Free()
+	require.Equal(t, "hello world", greeting.String())
+
+	_, err = ctx.EvalModule(`export const = 1;`, "broken")
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "SyntaxError")
+
+	_, err = ctx.EvalModule(`throw new Error("failed");`, "throwing")
+	require.EqualError(t, err, "module throwing: Error: failed")
+}
+
+func TestModuleTopLevelAwait(t *testing.T) {
+	rt := quickjs.NewRuntime(quickjs.WithModuleImport(true))
+	defer rt.Close()
+	ctx := rt.NewContext()
+	defer ctx.Close()
+
+	require.Equal(t, "pending", quickjs.PromiseStatePending.String())
+
+	m, err := ctx.EvalModule(`
+		export let value = "initial";
+		value = await new Promise((resolve) => setTimeout(() => resolve("settled"), 1));
+	`, "delayed", quickjs.EvalAwait(false))
+	require.NoError(t, err)
+	defer m.Free()
+	require.Equal(t, quickjs.PromiseStatePending, m.State())
+
+	require.NoError(t, m.Await())
+	require.Equal(t, quickjs.PromiseStateFulfilled, m.State())
+	value := m.Get("value")
+	defer value.Free()
+	require.Equal(t, "settled", value.String())
+
+	pending, err := ctx.EvalModule(`
+		await new Promise((resolve, reject) => setTimeout(() => reject(new TypeError("late")), 1));
+	`, "rejecting", quickjs.EvalAwait(false))
+	require.NoError(t, err)
+	defer pending.Free()
+	err = pending.Await()
+	require.Equal(t, quickjs.PromiseStateRejected, pending.State())
+
+	var moduleErr *quickjs.ModuleError
+	require.ErrorAs(t, err, &moduleErr)
+	require.Equal(t, "rejecting", moduleErr.Module)
+	require.Equal(t, "TypeError: late", moduleErr.Err.Cause)
+	require.EqualError(t, err, "module rejecting: TypeError: late")
+
+	_, err = ctx.EvalModule(`await Promise.reject("plain");`, "plain")
+	require.ErrorAs(t, err, &moduleErr)
+	require.Equal(t, "plain", moduleErr.Err.Cause)
+}
+
+func TestDefineGlobals(t *testing.T) {
+	rt := quickjs.NewRuntime()
+	defer rt.Close()
+	ctx := rt.NewContext()
+	defer ctx.Close()
+
+	type user struct {
+		Name  string `json:"name"`
+		Age   int    `json:"age"`
+		Email string `json:"email,omitempty"`
+		token string
+	}
+
+	bindings, err := ctx.DefineGlobals(map[string]interface{}{
+		"version": "1.0",
+		"app.config": map[string]interface{}{
+			"debug": true,
+			"ports": []int{80, 443},
+		},
+		"app.db.query": func(table string, limit int) ([]user, error) {
+			if table != "users" {
+				return nil, errors.New("unknown table " + table)
+			}
+			return []user{{Name: "alice", Age: 30, token: "secret"}}[:limit], nil
+		},
+		"app.sum": func(values ...float64) float64 {
+			total := 0.0
+			for _, v := range values {
+				total += v
+			}
+			return total
+		},
+	})
+	require.NoError(t, err)
+	require.Equal(t, []string{"app.config", "app.db.query", "app.sum", "version"}, bindings.Names())
+
+	ret, err := ctx.Eval(`JSON.stringify([version, app.config, app.db.query("users", 1), app.sum(1, 2, 3)])`)
+	require.NoError(t, err)
+	require.Equal(t, `["1.0",{"debug":true,"ports":[80,443]},[{"name":"alice","age":30}],6]`, ret.String())
+	ret.Free()
+
+	_, err = ctx.Eval(`app.db.query("orders", 1)`)
+	require.EqualError(t, err, "Error: unknown table orders")
+	_, err = ctx.Eval(`app.db.query(1, 1)`)
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "TypeError: argument 0")
+
+	// existing namespaces are kept, created ones are removed once empty
+	ret, err = ctx.Eval(`globalThis.app.custom = 1`)
+	require.NoError(t, err)
+	ret.Free()
+	bindings.Remove()
+	ret, err = ctx.Eval(`JSON.stringify([typeof version, Object.keys(app)])`)
+	require.NoError(t, err)
+	require.Equal(t, `["undefined",["custom"]]`, ret.String())
+	ret.Free()
+
+	_, err = ctx.DefineGlobals(map[string]interface{}{"app.custom.x": 1})
+	require.EqualError(t, err, `quickjs: global "app.custom" is not an object`)
+	_, err = ctx.DefineGlobals(map[string]interface{}{"a..b": 1})
+	require.Error(t, err)
+}
+
+func TestMarshal(t *testing.T) {
+	rt := quickjs.NewRuntime()
+	defer rt.Close()
+	ctx := rt.NewContext()
+	defer ctx.Close()
+
+	type inner struct {
+		Tags []string `json:"tags"`
+	}
+	type record struct {
+		inner
+		ID      int64             `json:"id"`
+		Score   float64           `json:"score"`
+		Data    []byte            `json:"data"`
+		Big     *big.Int          `json:"big"`
+		Counts  map[int]int       `json:"counts"`
+		Extra   map[string]string `json:"extra"`
+		Skipped string            `json:"-"`
+	}
+	in := record{
+		inner:   inner{Tags: []string{"a", "b"}},
+		ID:      7,
+		Score:   1.5,
+		Data:    []byte{1, 2, 3},
+		Big:     new(big.Int).Lsh(big.NewInt(1), 80),
+		Counts:  map[int]int{1: 2},
+		Skipped: "x",
+	}
+
+	v, err := ctx.Marshal(in)
+	require.NoError(t, err)
+	defer v.Free()
+
+	require.True(t, v.Has("tags"))
+	require.False(t, v.Has("Skipped"))
+	extra := v.Get("extra")
+	require.True(t, extra.IsNull())
+	extra.Free()
+
+	var out record
+	require.NoError(t, v.Unmarshal(&out))
+	out.Skipped = "x"
+	require.Equal(t, in, out)
+
+	var generic interface{}
+	require.NoError(t, v.Unmarshal(&generic))
+	require.Equal(t, []interface{}{"a", "b"}, generic.(map[string]interface{})["tags"])
+	require.Equal(t, float64(7), generic.(map[string]interface{})["id"])
+
+	var wrong struct {
+		ID string `json:"id"`
+	}
+	require.EqualError(t, v.Unmarshal(&wrong), "id: quickjs: cannot unmarshal number into Go value of type string")
+	require.Error(t, v.Unmarshal(out))
+
+	var held quickjs.Value
+	require.NoError(t, v.Unmarshal(&held))
+	require.True(t, held.IsObject())
+	held.Free()
+
+	_, err = ctx.Marshal(make(chan int))
+	require.EqualError(t, err, "quickjs: cannot marshal chan int")
+}
+
+func TestContextReset(t *testing.T) {
+	rt := quickjs.NewRuntime()
+	defer rt.Close()
+	ctx := rt.NewContext()
+	defer ctx.Close()
+
+	cache := quickjs.NewMemoryBytecodeCache()
+	ctx.SetBytecodeCache(cache)
+	require.NoError(t, ctx.SetEvalEnabled(false))
+	ctx.SetTag("tenant")
+
+	ret, err := ctx.Eval(`
+		var counter = 1;
+		const secret = "s";
+		globalThis.fired = false;
+		Array.prototype.polluted = true;
+		setTimeout(() => { globalThis.fired = true; }, 0);
+		Promise.resolve().then(() => { globalThis.job = true; });
+	`)
+	require.NoError(t, err)
+	ret.Free()
+	kept := ctx.Globals().Get("Array")
+
+	require.NoError(t, ctx.Reset())
+	ctx.Loop()
+
+	ret, err = ctx.Eval(`JSON.stringify([typeof counter, typeof secret, typeof fired, typeof job, [].polluted])`)
+	require.NoError(t, err)
+	require.Equal(t, `["undefined","undefined","undefined","undefined",null]`, ret.String())
+	ret.Free()
+
+	// redeclaring a lexical global works on the new global object
+	ret, err = ctx.Eval(`const secret = "t"; secret`)
+	require.NoError(t, err)
+	require.Equal(t, "t", ret.String())
+	ret.Free()
+
+	require.False(t, ctx.EvalEnabled())
+	_, err = ctx.Eval(`eval("1")`)
+	require.Error(t, err)
+	require.Equal(t, "tenant", ctx.Tag())
+	require.Same(t, cache, ctx.BytecodeCache())
+
+	// values obtained before Reset remain usable
+	require.True(t, kept.IsFunction())
+	kept.Free()
+}
+
+func TestContextResetSelfQueueingJob(t *testing.T) {
+	rt := quickjs.NewRuntime()
+	defer rt.Close()
+	ctx := rt.NewContext()
+	defer ctx.Close()
+
+	ret, err := ctx.Eval(`var n = 0; function f() { n++; Promise.resolve().then(f); } f();`)
+	require.NoError(t, err)
+	ret.Free()
+
+	require.ErrorIs(t, ctx.Reset(), quickjs.ErrPendingJobs)
+	// the context was not reset
+	ret, err = ctx.Eval(`typeof f`)
+	require.NoError(t, err)
+	require.Equal(t, "function", ret.String())
+	ret.Free()
+
+	// once the execute timeout has fired, it interrupts the chain of jobs
+	rt2 := quickjs.NewRuntime(quickjs.WithExecuteTimeout(1))
+	defer rt2.Close()
+	ctx2 := rt2.NewContext()
+	defer ctx2.Close()
+
+	ret, err = ctx2.Eval(`while(true){}`)
+	require.EqualError(t, err, "InternalError: interrupted")
+	ret.Free()
+	ret, err = ctx2.Eval(`var n = 0; function f() { n++; Promise.resolve().then(f); } f();`)
+	require.NoError(t, err)
+	ret.Free()
+	require.NoError(t, ctx2.Reset())
+}
+
+func TestBigInt(t *testing.T) {
+	rt := quickjs.NewRuntime()
+	defer rt.Close()
+	ctx := rt.NewContext()
+	defer ctx.Close()
+
+	huge, ok := new(big.Int).SetString("-123456789012345678901234567890123456789", 10)
+	require.True(t, ok)
+
+	for _, n := range []*big.Int{big.NewInt(0), big.NewInt(-42), new(big.Int).Lsh(big.NewInt(1), 64), huge} {
+		v := ctx.BigInt(n)
+		require.True(t, v.IsBigInt())
+		got, err := v.ToBigInt()
+		require.NoError(t, err)
+		require.Equal(t, 0, n.Cmp(got), n.String())
+		v.Free()
+	}
+
+	ctx.Globals().Set("huge", ctx.BigInt(huge))
+	ret, err := ctx.Eval(`String(huge * 2n)`)
+	require.NoError(t, err)
+	require.Equal(t, new(big.Int).Mul(huge, big.NewInt(2)).String(), ret.String())
+	ret.Free()
+
+	n, err := ctx.Float64(1e20).ToBigInt()
+	require.NoError(t, err)
+	require.Equal(t, "100000000000000000000", n.String())
+	_, err = ctx.Float64(1.5).ToBigInt()
+	require.EqualError(t, err, "quickjs: cannot convert 1.5 to big.Int")
+
+	type account struct {
+		Balance *big.Int `json:"balance"`
+	}
+	v, err := ctx.Marshal(account{Balance: huge})
+	require.NoError(t, err)
+	defer v.Free()
+	var out account
+	require.NoError(t, v.Unmarshal(&out))
+	require.Equal(t, 0, huge.Cmp(out.Balance))
+}
+
+func TestCheckedNumbers(t *testing.T) {
+	rt := quickjs.NewRuntime()
+	defer rt.Close()
+	ctx := rt.NewContext()
+	defer ctx.Close()
+
+	n, err := ctx.Float64(42).ToInt64Checked()
+	require.NoError(t, err)
+	require.EqualValues(t, 42, n)
+	n, err = ctx.BigInt64(-7).ToInt64Checked()
+	require.NoError(t, err)
+	require.EqualValues(t, -7, n)
+
+	for _, bad := range []float64{1.5, math.NaN(), math.Inf(1), 1e19} {
+		_, err := ctx.Float64(bad).ToInt64Checked()
+		require.Error(t, err, bad)
+	}
+	_, err = ctx.Float64(1 << 40).ToInt32Checked()
+	require.EqualError(t, err, "quickjs: number 1099511627776 overflows int32")
+	_, err = ctx.String("1").ToFloat64Checked()
+	require.EqualError(t, err, "quickjs: string is not a number")
+	f, err := ctx.Float64(math.Inf(-1)).ToFloat64Checked()
+	require.NoError(t, err)
+	require.True(t, math.IsInf(f, -1))
+
+	v := ctx.Float64(300.5)
+	var small int8
+	require.NoError(t, v.Unmarshal(&small))
+	require.Error(t, v.Unmarshal(&small, quickjs.UnmarshalStrictNumbers(true)))
+
+	var u uint8
+	require.EqualError(t, ctx.Float64(256).Unmarshal(&u, quickjs.UnmarshalStrictNumbers(true)), "quickjs: number 256 overflows uint8")
+	require.EqualError(t, ctx.Float64(-1).Unmarshal(&u, quickjs.UnmarshalStrictNumbers(true)), "quickjs: number -1 overflows uint8")
+	require.NoError(t, ctx.Float64(255).Unmarshal(&u, quickjs.UnmarshalStrictNumbers(true)))
+	require.EqualValues(t, 255, u)
+
+	var f32 float32
+	require.Error(t, ctx.Float64(1e300).Unmarshal(&f32, quickjs.UnmarshalStrictNumbers(true)))
+
+	obj, err := ctx.Eval(`({ counts: [1, 2.5] })`)
+	require.NoError(t, err)
+	defer obj.Free()
+	var out struct {
+		Counts []int `json:"counts"`
+	}
+	require.NoError(t, obj.Unmarshal(&out))
+	require.Equal(t, []int{1, 2}, out.Counts)
+	require.EqualError(t, obj.Unmarshal(&out, quickjs.UnmarshalStrictNumbers(true)), "counts: [1]: quickjs: number 2.5 is not an integer")
+}
+
+func TestGetPath(t *testing.T) {
+	rt := quickjs.NewRuntime()
+	defer rt.Close()
+	ctx := rt.NewContext()
+	defer ctx.Close()
+
+	obj, err := ctx.Eval(`({ a: { b: [1, 2, { c: "deep" }] }, "x.y": { z: true }, n: null })`)
+	require.NoError(t, err)
+	defer obj.Free()
+
+	v, err := obj.GetPath("a.b[2].c")
+	require.NoError(t, err)
+	require.Equal(t, "deep", v.String())
+	v.Free()
+
+	v, err = obj.GetPath(`["x.y"].z`)
+	require.NoError(t, err)
+	require.True(t, v.Bool())
+	v.Free()
+
+	v, err = obj.GetPath("a.missing")
+	require.NoError(t, err)
+	require.True(t, v.IsUndefined())
+
+	_, err = obj.GetPath("a.missing.c")
+	require.EqualError(t, err, `quickjs: path "a.missing.c": cannot read c of undefined`)
+	_, err = obj.GetPath("n[0]")
+	require.EqualError(t, err, `quickjs: path "n[0]": cannot read [0] of null`)
+	for _, bad := range []string{"", "a..b", "a[", "a[-1]", "a.", "a]b"} {
+		_, err = obj.GetPath(bad)
+		require.Error(t, err, bad)
+	}
+
+	require.NoError(t, obj.SetPath("a.b[0]", ctx.String("first")))
+	require.NoError(t, obj.SetPath("a.b[2].d", ctx.Int32(4)))
+	require.Error(t, obj.SetPath("a.none.d", ctx.String("leaked?")))
+	require.Equal(t, `{"a":{"b":["first",2,{"c":"deep","d":4}]},"x.y":{"z":true},"n":null}`, obj.JSONStringify())
+}
+
+func TestCallArgs(t *testing.T) {
+	rt := quickjs.NewRuntime()
+	defer rt.Close()
+	ctx := rt.NewContext()
+	defer ctx.Close()
+
+	hooks, err := ctx.Eval(`({
+		prefix: ">",
+		format(item, count) { return { label: this.prefix + item.name, total: item.price * count }; },
+		fail(reason) { throw reason; },
+	})`)
+	require.NoError(t, err)
+	defer hooks.Free()
+
+	format := hooks.Get("format")
+	defer format.Free()
+
+	type item struct {
+		Name  string  `json:"name"`
+		Price float64 `json:"price"`
+	}
+	ret, err := format.CallArgs(&hooks, item{Name: "pen", Price: 1.5}, 4)
+	require.NoError(t, err)
+	require.Equal(t, map[string]interface{}{"label": ">pen", "total": float64(6)}, ret)
+
+	var typed struct {
+		Label string `json:"label"`
+		Total int    `json:"total"`
+	}
+	require.NoError(t, format.CallInto(&typed, &hooks, item{Name: "ink", Price: 2}, 3))
+	require.Equal(t, ">ink", typed.Label)
+	require.Equal(t, 6, typed.Total)
+
+	// without this, the sloppy mode function sees the global object
+	ret, err = format.CallArgs(nil, item{Name: "cap"}, 1)
+	require.NoError(t, err)
+	require.Equal(t, "undefinedcap", ret.(map[string]interface{})["label"])
+
+	fail := hooks.Get("fail")
+	defer fail.Free()
+	_, err = fail.CallArgs(nil, "plain reason")
+	var jsErr *quickjs.Error
+	require.ErrorAs(t, err, &jsErr)
+	require.Equal(t, "plain reason", jsErr.Cause)
+
+	_, err = hooks.CallArgs(nil)
+	require.EqualError(t, err, "quickjs: value is not a function")
+	_, err = format.CallArgs(nil, make(chan int))
+	require.EqualError(t, err, "quickjs: cannot marshal chan int")
+}
+
+var (
+	fastAddID = quickjs.RegisterFastFunction("add", 2, func(ctx *quickjs.Context, args quickjs.FastArgs) quickjs.Value {
+		return ctx.Float64(args.Float64(0) + args.Float64(1))
+	})
+	fastGreetID = quickjs.RegisterFastFunction("greet", 1, func(ctx *quickjs.Context, args quickjs.FastArgs) quickjs.Value {
+		if args.Len() == 0 {
+			return ctx.ThrowTypeError("missing name")
+		}
+		return ctx.String("hello " + args.String(0))
+	})
+)
+
+func TestFastFunction(t *testing.T) {
+	rt := quickjs.NewRuntime()
+	defer rt.Close()
+	ctx := rt.NewContext()
+	defer ctx.Close()
+
+	ctx.Globals().Set("add", ctx.FastFunction(fastAddID))
+	ctx.Globals().Set("greet", ctx.FastFunction(fastGreetID))
+
+	ret, err := ctx.Eval(`let sum = 0; for (let i = 0; i < 1000; i++) { sum = add(sum, i); } [sum, add.name, add.length, greet("go")].join()`)
+	require.NoError(t, err)
+	require.Equal(t, "499500,add,2,hello go", ret.String())
+	ret.Free()
+
+	_, err = ctx.Eval(`greet()`)
+	require.EqualError(t, err, "TypeError: missing name")
+}
+
+func BenchmarkFunctionCall(b *testing.B) {
+	rt := quickjs.NewRuntime()
+	defer rt.Close()
+	ctx := rt.NewContext()
+	defer ctx.Close()
+
+	ctx.Globals().Set("add", ctx.Function(func(ctx *quickjs.Context, this quickjs.Value, args []quickjs.Value) quickjs.Value {
+		return ctx.Float64(args[0].Float64() + args[1].Float64())
+	}))
+	benchmarkAddCalls(b, ctx)
+}
+
+func BenchmarkFastFunctionCall(b *testing.B) {
+	rt := quickjs.NewRuntime()
+	defer rt.Close()
+	ctx := rt.NewContext()
+	defer ctx.Close()
+
+	ctx.Globals().Set("add", ctx.FastFunction(fastAddID))
+	benchmarkAddCalls(b, ctx)
+}
+
+// benchmarkAddCalls reports the cost of one call of the global add function from JS.
+func benchmarkAddCalls(b *testing.B, ctx *quickjs.Context) {
+	loop, err := ctx.Eval(`(n) => { let sum = 0; for (let i = 0; i < n; i++) { sum = add(sum, 1); } return sum; }`)
+	require.NoError(b, err)
+	defer loop.Free()
+
+	b.ResetTimer()
+	ret := ctx.Invoke(loop, ctx.Null(), ctx.Int32(int32(b.N)))
+	defer ret.Free()
+	require.EqualValues(b, b.N, ret.Int64())
+}
+
+func TestEvalBatch(t *testing.T) {
+	rt := quickjs.NewRuntime()
+	defer rt.Close()
+	ctx := rt.NewContext()
+	defer ctx.Close()
+
+	results, err := ctx.EvalBatch([]string{`var total = 1`, `total += 41`, `"total: " + total`, ``})
+	require.NoError(t, err)
+	require.Len(t, results, 4)
+	require.Equal(t, "total: 42", results[2].String())
+	require.True(t, results[3].IsUndefined())
+	for _, v := range results {
+		v.Free()
+	}
+
+	results, err = ctx.EvalBatch([]string{`1 + 1`, `throw new RangeError("bad")`, `never()`})
+	require.EqualError(t, err, "batch[1]: RangeError: bad")
+	var jsErr *quickjs.Error
+	require.ErrorAs(t, err, &jsErr)
+	require.Len(t, results, 1)
+	require.EqualValues(t, 2, results[0].Int32())
+	results[0].Free()
+
+	results, err = ctx.EvalBatch([]string{`Promise.resolve(1)`, `Promise.resolve(2)`}, quickjs.EvalAwait(true))
+	require.NoError(t, err)
+	require.EqualValues(t, 2, results[1].Int32())
+	for _, v := range results {
+		v.Free()
+	}
+
+	results, err = ctx.EvalBatch(nil)
+	require.NoError(t, err)
+	require.Empty(t, results)
+}
+
+func TestCompileScript(t *testing.T) {
+	rt := quickjs.NewRuntime()
+	defer rt.Close()
+	ctx := rt.NewContext()
+	defer ctx.Close()
+
+	script, err := ctx.CompileScript(`
+		const total = items.reduce((sum, item) => sum + item.price * item.qty, 0);
+		customer + ": " + (total * (1 - discount)).toFixed(2)
+	`)
+	require.NoError(t, err)
+	defer script.Free()
+
+	type item struct {
+		Price float64 `json:"price"`
+		Qty   int     `json:"qty"`
+	}
+	for _, tc := range []struct {
+		bindings map[string]interface{}
+		expected string
+	}{
+		{map[string]interface{}{"customer": "ann", "discount": 0, "items": []item{{2, 3}}}, "ann: 6.00"},
+		{map[string]interface{}{"customer": "bob", "discount": 0.5, "items": []item{{10, 1}, {1, 5}}}, "bob: 7.50"},
+	} {
+		ret, err := script.Run(tc.bindings)
+		require.NoError(t, err)
+		require.Equal(t, tc.expected, ret.String())
+		ret.Free()
+	}
+
+	// bindings do not leak into the global object, missing ones are reference errors
+	ret, err := script.Run(map[string]interface{}{"customer": "eve", "discount": 0})
+	require.EqualError(t, err, "ReferenceError: 'items' is not defined")
+	ret.Free()
+	ret, err = ctx.Eval(`typeof customer`)
+	require.NoError(t, err)
+	require.Equal(t, "undefined", ret.String())
+	ret.Free()
+
+	_, err = ctx.CompileScript(`1 +`)
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "SyntaxError")
+}
+
+func TestEvalExpr(t *testing.T) {
+	rt := quickjs.NewRuntime()
+	defer rt.Close()
+	ctx := rt.NewContext()
+	defer ctx.Close()
+
+	price, err := quickjs.EvalExpr[float64](ctx, `Math.round(base * (1 + rate) * 100) / 100`, map[string]interface{}{"base": 10, "rate": 0.075})
+	require.NoError(t, err)
+	require.Equal(t, 10.75, price)
+
+	type decision struct {
+		Approved bool   `json:"approved"`
+		Reason   string `json:"reason"`
+	}
+	d, err := quickjs.EvalExpr[decision](ctx, `score > 600 ? { approved: true, reason: "ok" } : { approved: false, reason: "low score" }`, map[string]interface{}{"score": 580})
+	require.NoError(t, err)
+	require.Equal(t, decision{Approved: false, Reason: "low score"}, d)
+
+	_, err = quickjs.EvalExpr[string](ctx, `setTimeout.name`, nil)
+	require.EqualError(t, err, "ReferenceError: 'setTimeout' is not defined")
+	_, err = quickjs.EvalExpr[int](ctx, `score = 1`, map[string]interface{}{"score": 2})
+	require.Error(t, err)
+	_, err = quickjs.EvalExpr[int](ctx, `Number.constructor("return 1")()`, nil)
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "EvalError")
+	_, err = quickjs.EvalExpr[int](ctx, `(() => { while (true) {} })()`, nil, quickjs.ExprTimeout(50*time.Millisecond))
+	require.EqualError(t, err, "quickjs: expression timed out")
+	_, err = quickjs.EvalExpr[int](ctx, `"text"`, nil)
+	require.Error(t, err)
+
+	upper, err := quickjs.EvalExpr[string](ctx, `name.toUpperCase()`, map[string]interface{}{"name": "ok"}, quickjs.ExprGlobals())
+	require.NoError(t, err)
+	require.Equal(t, "OK", upper)
+
+	// the expression cannot close the wrapper it is evaluated in
+	ctx.Globals().Set("secret", ctx.String("secret"))
+	_, err = quickjs.EvalExpr[int](ctx, `0); } }, (() => { globalThis.leaked = secret; })(), function(){ { (0`, nil)
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "SyntaxError")
+	leaked := ctx.Globals().Get("leaked")
+	require.True(t, leaked.IsUndefined())
+	leaked.Free()
+	_, err = quickjs.EvalExpr[int](ctx, `1; 2`, nil)
+	require.Error(t, err)
+
+	// nor reach the global object of the context
+	ctx.Globals().Set("secret", ctx.String("s3cr3t"))
+	for _, expr := range []string{
+		`(function () { return this })().secret`,
+		`(() => this)().secret`,
+		`globalThis.secret`,
+		`Reflect.get(Math.max.constructor("return this")(), "secret")`,
+	} {
+		leak, err := quickjs.EvalExpr[string](ctx, expr, nil, quickjs.ExprGlobals("Math", "Reflect"))
+		require.Error(t, err, expr)
+		require.Empty(t, leak)
+	}
+	_, err = quickjs.EvalExpr[int](ctx, `Math = 1`, nil)
+	require.Error(t, err)
+
+	// unless a global of the context is allowed
+	ctx.Globals().Set("rate", ctx.Float64(0.5))
+	half, err := quickjs.EvalExpr[float64](ctx, `base * rate`, map[string]interface{}{"base": 10}, quickjs.ExprGlobals("rate"))
+	require.NoError(t, err)
+	require.Equal(t, 5.0, half)
+
+	// the context is left as it was
+	require.True(t, ctx.EvalEnabled())
+	ret, err := ctx.Eval(`eval("typeof setTimeout")`)
+	require.NoError(t, err)
+	require.Equal(t, "function", ret.String())
+	ret.Free()
+}
+
+func TestMarshalJSONTypes(t *testing.T) {
+	rt := quickjs.NewRuntime()
+	defer rt.Close()
+	ctx := rt.NewContext()
+	defer ctx.Close()
+
+	type payload struct {
+		Config json.RawMessage `json:"config"`
+		Small  json.Number     `json:"small"`
+		Large  json.Number     `json:"large"`
+		Ratio  json.Number     `json:"ratio"`
+	}
+	val, err := ctx.Marshal(payload{
+		Config: json.RawMessage(`{"enabled":true,"tags":["a","b"]}`),
+		Small:  "42",
+		Large:  "123456789012345678901234567890",
+		Ratio:  "0.25",
+	})
+	require.NoError(t, err)
+	ctx.Globals().Set("payload", val)
+	ret, err := ctx.Eval(`[payload.config.tags.join(), typeof payload.small, typeof payload.large, String(payload.large + 1n), payload.ratio * 4].join("|")`)
+	require.NoError(t, err)
+	require.Equal(t, "a,b|number|bigint|123456789012345678901234567891|1", ret.String())
+	ret.Free()
+
+	var out payload
+	val = ctx.Globals().Get("payload")
+	defer val.Free()
+	require.NoError(t, val.Unmarshal(&out))
+	require.JSONEq(t, `{"enabled":true,"tags":["a","b"]}`, string(out.Config))
+	require.Equal(t, json.Number("42"), out.Small)
+	require.Equal(t, json.Number("123456789012345678901234567890"), out.Large)
+	require.Equal(t, json.Number("0.25"), out.Ratio)
+
+	_, err = ctx.Marshal(json.RawMessage(`{bad`))
+	require.Error(t, err)
+	_, err = ctx.Marshal(json.Number("1x"))
+	require.Error(t, err)
+
+	str := ctx.String("text")
+	defer str.Free()
+	var n json.Number
+	require.Error(t, str.Unmarshal(&n))
+	var raw json.RawMessage
+	require.NoError(t, str.Unmarshal(&raw))
+	require.Equal(t, `"text"`, string(raw))
+}
+
+type testLevel int
+
+func (l testLevel) MarshalText() ([]byte, error) {
+	return []byte(strings.Repeat("*", int(l))), nil
+}
+
+func (l *testLevel) UnmarshalText(text []byte) error {
+	if strings.Trim(string(text), "*") != "" {
+		return errors.New("bad level")
+	}
+	*l = testLevel(len(text))
+	return nil
+}
+
+func TestMarshalJSONFallback(t *testing.T) {
+	rt := quickjs.NewRuntime()
+	defer rt.Close()
+	ctx := rt.NewContext()
+	defer ctx.Close()
+
+	type event struct {
+		At    time.Time  `json:"at"`
+		Level testLevel  `json:"level"`
+		Next  *testLevel `json:"next"`
+	}
+	at := time.Date(2024, 5, 1, 12, 30, 0, 0, time.UTC)
+	next := testLevel(1)
+	in := event{At: at, Level: 3, Next: &next}
+
+	// without the fallback, the kinds are converted
+	val, err := ctx.Marshal(in)
+	require.NoError(t, err)
+	require.Equal(t, `{"at":{},"level":3,"next":1}`, val.JSONStringify())
+	val.Free()
+
+	val, err = ctx.Marshal(in, quickjs.MarshalJSONFallback(true))
+	require.NoError(t, err)
+	defer val.Free()
+	require.Equal(t, `{"at":"2024-05-01T12:30:00Z","level":"***","next":"*"}`, val.JSONStringify())
+
+	var out event
+	require.NoError(t, val.Unmarshal(&out, quickjs.UnmarshalJSONFallback(true)))
+	require.True(t, at.Equal(out.At))
+	require.Equal(t, testLevel(3), out.Level)
+	require.Equal(t, testLevel(1), *out.Next)
+
+	bad := ctx.ParseJSON(`{"level":"x*"}`)
+	defer bad.Free()
+	err = bad.Unmarshal(&out, quickjs.UnmarshalJSONFallback(true))
+	require.ErrorContains(t, err, "bad level")
+	bad2 := ctx.ParseJSON(`{"level":3}`)
+	defer bad2.Free()
+	require.Error(t, bad2.Unmarshal(&out, quickjs.UnmarshalJSONFallback(true)))
+	require.NoError(t, bad2.Unmarshal(&out))
+}
+
+func TestJSONStringifyStable(t *testing.T) {
+	rt := quickjs.NewRuntime()
+	defer rt.Close()
+	ctx := rt.NewContext()
+	defer ctx.Close()
+
+	a, err := ctx.Eval(`({ b: 1, a: { d: [ { z: 1, y: 2 } ], c: null }, 10: "x", 2: "y" })`)
+	require.NoError(t, err)
+	defer a.Free()
+	b, err := ctx.Eval(`({ 2: "y", a: { c: null, d: [ { y: 2, z: 1 } ] }, 10: "x", b: 1 })`)
+	require.NoError(t, err)
+	defer b.Free()
+
+	sa, err := a.JSONStringifyStable()
+	require.NoError(t, err)
+	sb, err := b.JSONStringifyStable()
+	require.NoError(t, err)
+	require.Equal(t, `{"2":"y","10":"x","a":{"c":null,"d":[{"y":2,"z":1}]},"b":1}`, sa)
+	require.Equal(t, sa, sb)
+
+	for i := 0; i < 10; i++ {
+		m, err := ctx.Marshal(map[string]interface{}{"k": 1, "e": 2, "x": map[string]int{"b": 1, "a": 2}})
+		require.NoError(t, err)
+		require.Equal(t, `{"e":2,"k":1,"x":{"a":2,"b":1}}`, m.JSONStringify())
+		m.Free()
+	}
+
+	bigVal := ctx.BigInt64(1)
+	defer bigVal.Free()
+	_, err = bigVal.JSONStringifyStable()
+	require.Error(t, err)
+}
+
+func TestErrorCause(t *testing.T) {
+	rt := quickjs.NewRuntime()
+	defer rt.Close()
+	ctx := rt.NewContext()
+	defer ctx.Close()
+
+	root := errors.New("connection refused")
+	ctx.Globals().Set("load", ctx.Function(func(ctx *quickjs.Context, this quickjs.Value, args []quickjs.Value) quickjs.Value {
+		return ctx.ThrowError(fmt.Errorf("load config: %w", root))
+	}))
+
+	ret, err := ctx.Eval(`try { load() } catch (e) { [e.message, e.cause.message, e.cause.cause, Object.keys(e).includes("cause")].join("|") }`)
+	require.NoError(t, err)
+	require.Equal(t, "load config: connection refused|connection refused||false", ret.String())
+	ret.Free()
+
+	_, err = ctx.Eval(`try { load() } catch (e) { throw new Error("startup failed", { cause: e }) }`)
+	require.EqualError(t, err, "Error: startup failed")
+	chain := []string{}
+	for e := err; e != nil; e = errors.Unwrap(e) {
+		chain = append(chain, e.Error())
+	}
+	require.Equal(t, []string{"Error: startup failed", "Error: load config: connection refused", "Error: connection refused"}, chain)
+
+	_, err = ctx.Eval(`throw new TypeError("bad input", { cause: 42 })`)
+	require.Equal(t, "42", errors.Unwrap(err).Error())
+
+	_, err = ctx.Eval(`const e = new Error("loop"); e.cause = e; throw e`)
+	require.EqualError(t, err, "Error: loop")
+}
+
+func TestErrorClass(t *testing.T) {
+	rt := quickjs.NewRuntime()
+	defer rt.Close()
+	ctx := rt.NewContext()
+	defer ctx.Close()
+
+	cls, err := ctx.NewErrorClass("QuotaError")
+	require.NoError(t, err)
+	defer cls.Free()
+	require.True(t, cls.IsConstructor())
+
+	ctx.Globals().Set("upload", ctx.Function(func(ctx *quickjs.Context, this quickjs.Value, args []quickjs.Value) quickjs.Value {
+		return ctx.ThrowCustomError("QuotaError", "limit exceeded", map[string]interface{}{"limit": 100})
+	}))
+	ret, err := ctx.Eval(`try { upload() } catch (e) { [e instanceof QuotaError, e instanceof Error, e.name, e.message, e.limit, String(e)].join("|") }`)
+	require.NoError(t, err)
+	require.Equal(t, "true|true|QuotaError|limit exceeded|100|QuotaError: limit exceeded", ret.String())
+	ret.Free()
+
+	_, err = ctx.Eval(`throw new QuotaError("from script")`)
+	require.EqualError(t, err, "QuotaError: from script")
+
+	ctx.Globals().Set("unknown", ctx.Function(func(ctx *quickjs.Context, this quickjs.Value, args []quickjs.Value) quickjs.Value {
+		return ctx.ThrowCustomError("MissingError", "x", nil)
+	}))
+	_, err = ctx.Eval(`unknown()`)
+	require.EqualError(t, err, "TypeError: quickjs: error class MissingError is not defined")
+}
+
+var fastPanicID = quickjs.RegisterFastFunction("fastPanic", 0, func(ctx *quickjs.Context, args quickjs.FastArgs) quickjs.Value {
+	panic("fast boom")
+})
+
+func TestCallbackPanic(t *testing.T) {
+	rt := quickjs.NewRuntime()
+	defer rt.Close()
+	ctx := rt.NewContext()
+	defer ctx.Close()
+
+	ctx.Globals().Set("boom", ctx.Function(func(ctx *quickjs.Context, this quickjs.Value, args []quickjs.Value) quickjs.Value {
+		var m map[string]int
+		m["x"] = 1
+		return ctx.Undefined()
+	}))
+	ctx.Globals().Set("fastPanic", ctx.FastFunction(fastPanicID))
+
+	ret, err := ctx.Eval(`try { boom() } catch (e) { e instanceof InternalError ? e.message : "not internal" }`)
+	require.NoError(t, err)
+	require.Equal(t, "panic in Go callback: assignment to entry in nil map", ret.String())
+	ret.Free()
+
+	_, err = ctx.Eval(`fastPanic()`)
+	require.EqualError(t, err, "InternalError: panic in Go callback: fast boom")
+
+	// the context is still usable
+	ret, err = ctx.Eval(`1 + 1`)
+	require.NoError(t, err)
+	require.EqualValues(t, 2, ret.Int32())
+	ret.Free()
+
+	ctx.SetContextInterruptHandler(func(info quickjs.InterruptInfo) int {
+		panic("interrupt boom")
+	})
+	_, err = ctx.Eval(`while (true) {}`)
+	require.EqualError(t, err, "InternalError: interrupted")
+}
+
+func TestThreadGuard(t *testing.T) {
+	rt := quickjs.NewRuntime(quickjs.WithThreadGuard(true))
+	defer rt.Close()
+	ctx := rt.NewContext()
+	defer ctx.Close()
+
+	ret, err := ctx.Eval(`1 + 1`)
+	require.NoError(t, err)
+	ret.Free()
+
+	fn, err := ctx.Eval(`() => 1`)
+	require.NoError(t, err)
+	defer fn.Free()
+
+	var evalErr error
+	var closePanic interface{}
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		_, evalErr = ctx.Eval(`1 + 1`)
+		func() {
+			defer func() { closePanic = recover() }()
+			ctx.Close()
+		}()
+	}()
+	<-done
+	require.ErrorIs(t, evalErr, quickjs.ErrWrongGoroutine)
+	require.Equal(t, quickjs.ErrWrongGoroutine, closePanic)
+
+	ctx.Globals().Set("closeContext", ctx.Function(func(ctx *quickjs.Context, this quickjs.Value, args []quickjs.Value) quickjs.Value {
+		ctx.Close()
+		return ctx.Undefined()
+	}))
+	_, err = ctx.Eval(`closeContext()`)
+	require.EqualError(t, err, "InternalError: panic in Go callback: quickjs: Context closed while running")
+}
+
+func TestHooks(t *testing.T) {
+	var events []string
+	hooks := &quickjs.Hooks{
+		OnEvalStart: func(info quickjs.EvalInfo) {
+			events = append(events, "start "+info.Filename)
+		},
+		OnEvalEnd: func(info quickjs.EvalInfo) {
+			events = append(events, fmt.Sprintf("end %s %v", info.Filename, info.Err))
+		},
+		OnFunctionCall: func(info quickjs.FunctionCallInfo) {
+			events = append(events, fmt.Sprintf("call %q %d %v", info.Name, info.Args, info.Exception))
+		},
+		OnException: func(ctx *quickjs.Context, err *quickjs.Error) {
+			events = append(events, "exception "+err.Cause)
+		},
+	}
+	rt := quickjs.NewRuntime(quickjs.WithHooks(hooks))
+	defer rt.Close()
+	ctx := rt.NewContext()
+	defer ctx.Close()
+
+	// creating functions and other internal scripts are not observed
+	ctx.Globals().Set("double", ctx.Function(func(ctx *quickjs.Context, this quickjs.Value, args []quickjs.Value) quickjs.Value {
+		return ctx.Int32(args[0].Int32() * 2)
+	}))
+	ctx.Globals().Set("add", ctx.FastFunction(fastAddID))
+	require.Empty(t, events)
+
+	ret, err := ctx.Eval(`double(add(1, 2))`, quickjs.EvalFileName("main.js"))
+	require.NoError(t, err)
+	ret.Free()
+	_, err = ctx.Eval(`null.x`, quickjs.EvalFileName("bad.js"))
+	require.Error(t, err)
+
+	require.Equal(t, []string{
+		"start main.js",
+		`call "add" 2 false`,
+		`call "" 1 false`,
+		"end main.js <nil>",
+		"start bad.js",
+		"exception TypeError: cannot read property 'x' of null",
+		"end bad.js TypeError: cannot read property 'x' of null",
+	}, events)
+
+	rt.SetHooks(nil)
+	events = nil
+	ret, err = ctx.Eval(`double(1)`)
+	require.NoError(t, err)
+	ret.Free()
+	require.Empty(t, events)
+}
+
+type testLogger struct {
+	entries []string
+}
+
+func (l *testLogger) Log(level quickjs.LogLevel, msg string, fields map[string]interface{}) {
+	l.entries = append(l.entries, fmt.Sprintf("%s %s %v", level, msg, fields["error"]))
+}
+
+func TestLogger(t *testing.T) {
+	logger := &testLogger{}
+	rt := quickjs.NewRuntime(quickjs.WithLogger(logger), quickjs.WithValueTracking(true))
+	defer rt.Close()
+	ctx := rt.NewContext()
+
+	ret, err := ctx.Eval(`
+		setTimeout(() => { throw new Error("boom"); }, 0);
+		Promise.reject(new TypeError("nobody listens"));
+	`)
+	require.NoError(t, err)
+	ret.Free()
+	ctx.Loop()
+
+	ctx.String("leaked") // never freed
+	ctx.Close()
+
+	require.Equal(t, []string{
+		"warn quickjs: unhandled promise rejection TypeError: nobody listens",
+		"error quickjs: uncaught exception Error: boom",
+		"warn quickjs: values not freed <nil>",
+	}, logger.entries)
+
+	rt.SetLogger(nil)
+}
+
+func TestCompileContext(t *testing.T) {
+	rt := quickjs.NewRuntime()
+	defer rt.Close()
+	ctx := rt.NewContext()
+	defer ctx.Close()
+
+	buf, err := ctx.CompileContext(context.Background(), `const answer = 6 * 7; answer`)
+	require.NoError(t, err)
+	ret, err := ctx.EvalBytecode(buf)
+	require.NoError(t, err)
+	require.EqualValues(t, 42, ret.Int32())
+	ret.Free()
+
+	_, err = ctx.CompileContext(context.Background(), `let = ;`)
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "SyntaxError")
+
+	goCtx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	huge := strings.Repeat("a = 1 + 2 * 3;\n", 500000)
+	start := time.Now()
+	_, err = ctx.CompileContext(goCtx, huge)
+	require.ErrorIs(t, err, context.DeadlineExceeded)
+	require.Less(t, time.Since(start), 200*time.Millisecond)
+
+	_, err = ctx.CompileContext(goCtx, `1`)
+	require.ErrorIs(t, err, context.DeadlineExceeded)
+}
+
+func TestCompilePool(t *testing.T) {
+	sources := make([]quickjs.CompileSource, 50)
+	for i := range sources {
+		sources[i] = quickjs.CompileSource{Code: fmt.Sprintf("%d * 2", i), Filename: fmt.Sprintf("script%d.js", i)}
+	}
+	results, err := quickjs.NewCompilePool(4).Compile(sources)
+	require.NoError(t, err)
+	require.Len(t, results, len(sources))
+
+	rt := quickjs.NewRuntime()
+	defer rt.Close()
+	ctx := rt.NewContext()
+	defer ctx.Close()
+	for i, buf := range results {
+		ret, err := ctx.EvalBytecode(buf)
+		require.NoError(t, err)
+		require.EqualValues(t, i*2, ret.Int32())
+		ret.Free()
+	}
+
+	sources[7].Code = "let = ;"
+	results, err = quickjs.NewCompilePool(0).Compile(sources)
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "compile script7.js: SyntaxError")
+	require.Nil(t, results[7])
+	require.NotNil(t, results[8])
+}
+
+func TestValueKind(t *testing.T) {
+	rt := quickjs.NewRuntime()
+	defer rt.Close()
+	ctx := rt.NewContext()
+	defer ctx.Close()
+
+	cases := []struct {
+		code   string
+		kind   quickjs.Kind
+		typeOf string
+	}{
+		{`undefined`, quickjs.KindUndefined, "undefined"},
+		{`null`, quickjs.KindNull, "object"},
+		{`true`, quickjs.KindBool, "boolean"},
+		{`1.5`, quickjs.KindNumber, "number"},
+		{`1n`, quickjs.KindBigInt, "bigint"},
+		{`"s"`, quickjs.KindString, "string"},
+		{`Symbol("s")`, quickjs.KindSymbol, "symbol"},
+		{`({})`, quickjs.KindObject, "object"},
+		{`new (class Point {})()`, quickjs.KindObject, "object"},
+		{`(() => 1)`, quickjs.KindFunction, "function"},
+		{`(async function () {})`, quickjs.KindFunction, "function"},
+		{`class A {}; A`, quickjs.KindFunction, "function"},
+		{`[1, 2]`, quickjs.KindArray, "object"},
+		{`new RangeError("x")`, quickjs.KindError, "object"},
+		{`new Date()`, quickjs.KindDate, "object"},
+		{`/x/g`, quickjs.KindRegExp, "object"},
+		{`new Promise(() => {})`, quickjs.KindPromise, "object"},
+		{`new Map()`, quickjs.KindMap, "object"},
+		{`(function* () {})()`, quickjs.KindGenerator, "object"},
+		{`(async function* () {})()`, quickjs.KindAsyncGenerator, "object"},
+		{`new Set()`, quickjs.KindSet, "object"},
+		{`new WeakMap()`, quickjs.KindWeakMap, "object"},
+		{`new WeakSet()`, quickjs.KindWeakSet, "object"},
+		{`new ArrayBuffer(8)`, quickjs.KindArrayBuffer, "object"},
+		{`new Float64Array(2)`, quickjs.KindTypedArray, "object"},
+		{`new Uint8Array(2)`, quickjs.KindTypedArray, "object"},
+		{`new DataView(new ArrayBuffer(2))`, quickjs.KindDataView, "object"},
+	}
+	for _, c := range cases {
+		val, err := ctx.Eval(c.code)
+		require.NoError(t, err, c.code)
+		require.Equal(t, c.kind, val.Kind(), c.code)
+		require.Equal(t, c.typeOf, val.TypeOf(), c.code)
+		val.Free()
+	}
+	require.Equal(t, "typedarray", quickjs.KindTypedArray.String())
+}
+
+func TestInspect(t *testing.T) {
+	rt := quickjs.NewRuntime()
+	defer rt.Close()
+	ctx := rt.NewContext()
+	defer ctx.Close()
+
+	cases := []struct {
+		code string
+		want string
+		opts []quickjs.InspectOption
+	}{
+		{code: `undefined`, want: `undefined`},
+		{code: `-0`, want: `-0`},
+		{code: `12n`, want: `12n`},
+		{code: `Symbol("tag")`, want: `Symbol(tag)`},
+		{code: `"it's\n"`, want: `'it\'s\n'`},
+		{code: `[1, "a", null, [2, [3, [4]]]]`, want: `[ 1, 'a', null, [ 2, [ 3, [Array] ] ] ]`},
+		{code: `({ a: 1, "b-c": { d: { e: { f: 1 } } }, [Symbol("s")]: 2 })`, want: `{ a: 1, 'b-c': { d: { e: [Object] } } }`},
+		{code: `const o = { name: "loop" }; o.self = o; o`, want: `{ name: 'loop', self: [Circular] }`},
+		{code: `({ f() {}, g: () => 1, h: function () {} })`, want: `{ f: [Function: f], g: [Function: g], h: [Function: h] }`},
+		{code: `({ get x() { throw new Error("no") }, set y(v) {} })`, want: `{ x: [Getter], y: [Setter] }`},
+		{code: `new (class Point { constructor() { this.x = 1 } })()`, want: `Point { x: 1 }`},
+		{code: `new Map([["a", 1], [{}, [2]]])`, want: `Map(2) { 'a' => 1, {} => [ 2 ] }`},
+		{code: `new Set([1, "x"])`, want: `Set(2) { 1, 'x' }`},
+		{code: `new Uint8Array([1, 2, 3, 4])`, want: `Uint8Array(4) [ 1, 2, ... 2 more items ]`, opts: []quickjs.InspectOption{quickjs.InspectMaxArrayLength(2)}},
+		{code: `new ArrayBuffer(8)`, want: `ArrayBuffer { byteLength: 8 }`},
+		{code: `new Date(0)`, want: `1970-01-01T00:00:00.000Z`},
+		{code: `new Date(NaN)`, want: `Invalid Date`},
+		{code: `/a+/g`, want: `/a+/g`},
+		{code: `new TypeError("bad")`, want: `TypeError: bad`},
+		{code: `Promise.resolve({ ok: true })`, want: `Promise { { ok: true } }`},
+		{code: `new Promise(() => {})`, want: `Promise { <pending> }`},
+		{code: `new WeakMap()`, want: `WeakMap { <items unknown> }`},
+		{code: `"abcdef"`, want: `'abc'... 3 more characters`, opts: []quickjs.InspectOption{quickjs.InspectMaxStringLength(3)}},
+		{code: `[[[[1]]]]`, want: `[ [ [ [ 1 ] ] ] ]`, opts: []quickjs.InspectOption{quickjs.InspectDepth(-1)}},
+		{code: `Object.create(null)`, want: `{}`},
+	}
+	for _, c := range cases {
+		val, err := ctx.Eval(c.code)
+		require.NoError(t, err, c.code)
+		require.Equal(t, c.want, val.Inspect(c.opts...), c.code)
+		val.Free()
+	}
+}
+
+// FuzzEval checks that evaluating and inspecting arbitrary code never crashes the process.
+func FuzzEval(f *testing.F) {
+	for _, seed := range []string{
+		`1 + 1`,
+		`"use strict"; let x = {}; x.x = x; x`,
+		`[1, 2, 3].map((x) => x * 2)`,
+		`new Promise((resolve) => setTimeout(resolve, 0))`,
+		`class A { #p = 1; static m() { return new A() } }; A.m()`,
+		`function f(n) { return n ? f(n - 1) : 0 } f(1e6)`,
+		`export const a = 1;`,
+		`throw new Error("x", { cause: 1 })`,
+		"'\x00\xff'",
+		`while (true) {}`,
+		`"a".repeat(1 << 20).split("")`,
+		`new Proxy({}, { ownKeys() { throw 1 } })`,
+	} {
+		f.Add(seed)
+	}
+	f.Fuzz(func(t *testing.T, code string) {
+		rt := quickjs.NewRuntime(quickjs.WithMemoryLimit(32<<20), quickjs.WithMaxStackSize(1<<20))
+		defer rt.Close()
+		ctx := rt.NewContext()
+		defer ctx.Close()
+		deadline := time.Now().Add(100 * time.Millisecond)
+		ctx.SetContextInterruptHandler(func(quickjs.InterruptInfo) int {
+			if time.Now().After(deadline) {
+				return 1
+			}
+			return 0
+		})
+
+		ret, err := ctx.Eval(code)
+		defer ret.Free()
+		if err != nil {
+			return
+		}
+		_ = ret.Inspect()
+	})
+}
+
+// FuzzMarshalRoundTrip checks that JSON-shaped Go values are unchanged by Marshal then Unmarshal.
+func FuzzMarshalRoundTrip(f *testing.F) {
+	for _, seed := range []string{
+		`null`,
+		`{"a": 1, "b": [true, false, null], "c": {"d": "e"}}`,
+		`[1.5, -0, 1e308, "x\u0000y", "😀"]`,
+		`{"__proto__": {"polluted": true}, "constructor": 1}`,
+		`{"0": "zero", "10": "ten", "2": "two", "-1": "minus"}`,
+		`"\ud800"`,
+	} {
+		f.Add([]byte(seed))
+	}
+	rt := quickjs.NewRuntime()
+	defer rt.Close()
+	ctx := rt.NewContext()
+	defer ctx.Close()
+
+	f.Fuzz(func(t *testing.T, data []byte) {
+		var in interface{}
+		if err := json.Unmarshal(data, &in); err != nil {
+			return
+		}
+		val, err := ctx.Marshal(in)
+		require.NoError(t, err)
+		defer val.Free()
+		var out interface{}
+		require.NoError(t, val.Unmarshal(&out))
+		require.Equal(t, in, out)
+	})
+}
+
+func TestFuzzRegressions(t *testing.T) {
+	rt := quickjs.NewRuntime()
+	defer rt.Close()
+	ctx := rt.NewContext()
+	defer ctx.Close()
+
+	// strings keep embedded NUL characters both ways
+	str := ctx.String("a\x00b")
+	require.EqualValues(t, 3, str.Len())
+	require.EqualValues(t, "a\x00b", str.String())
+	str.Free()
+
+	// a __proto__ key is an own property, not the prototype
+	obj, err := ctx.Marshal(map[string]interface{}{"__proto__": map[string]interface{}{"polluted": true}})
+	require.NoError(t, err)
+	names, err := obj.PropertyNames()
+	require.NoError(t, err)
+	require.EqualValues(t, []string{"__proto__"}, names)
+	require.False(t, obj.Has("polluted"))
+	obj.Free()
+
+	// a cyclic value fails to unmarshal instead of overflowing the stack
+	cyclic, err := ctx.Eval(`const cyclic = {}; cyclic.self = cyclic; cyclic`)
+	require.NoError(t, err)
+	defer cyclic.Free()
+	var out interface{}
+	require.ErrorContains(t, cyclic.Unmarshal(&out), "nested deeper than")
+
+	// and a cyclic Go value fails to marshal
+	type node struct {
+		Next *node `json:"next"`
+	}
+	n := &node{}
+	n.Next = n
+	_, err = ctx.Marshal(n)
+	require.ErrorContains(t, err, "nested deeper than")
+	cycle := map[string]interface{}{}
+	cycle["self"] = cycle
+	_, err = ctx.Marshal(cycle)
+	require.ErrorContains(t, err, "nested deeper than")
+
+	// pending timers are freed with the runtime
+	timerRt := quickjs.NewRuntime()
+	timerCtx := timerRt.NewContext()
+	ret, err := timerCtx.Eval(`setTimeout(() => {}, 1000)`)
+	require.NoError(t, err)
+	ret.Free()
+	timerCtx.Close()
+	timerRt.Close()
+}
+
+func TestLimits(t *testing.T) {
+	limitOf := func(t *testing.T, err error) quickjs.Limit {
+		var limitErr *quickjs.LimitError
+		require.ErrorAs(t, err, &limitErr)
+		return limitErr.Limit
+	}
+
+	t.Run("WallTime", func(t *testing.T) {
+		rt := quickjs.NewRuntime(quickjs.WithLimits(quickjs.Limits{WallTime: 50 * time.Millisecond}))
+		defer rt.Close()
+		ctx := rt.NewContext()
+		defer ctx.Close()
+
+		start := time.Now()
+		_, err := ctx.Eval(`for (;;) {}`)
+		require.Less(t, time.Since(start), time.Second)
+		require.Equal(t, quickjs.LimitWallTime, limitOf(t, err))
+		require.EqualError(t, errors.Unwrap(err), "quickjs: wall time limit exceeded")
+
+		// the budget applies to each entry
+		ret, err := ctx.Eval(`1 + 1`)
+		require.NoError(t, err)
+		ret.Free()
+	})
+
+	t.Run("Interrupts", func(t *testing.T) {
+		rt := quickjs.NewRuntime(quickjs.WithLimits(quickjs.Limits{MaxInterrupts: 10}))
+		defer rt.Close()
+		ctx := rt.NewContext()
+		defer ctx.Close()
+
+		ret, err := ctx.Eval(`let n = 0; for (let i = 0; i < 1000; i++) n += i; n`)
+		require.NoError(t, err)
+		ret.Free()
+
+		_, err = ctx.Eval(`for (;;) {}`)
+		require.Equal(t, quickjs.LimitInterrupts, limitOf(t, err))
+	})
+
+	t.Run("MemoryAndStack", func(t *testing.T) {
+		rt := quickjs.NewRuntime(quickjs.WithLimits(quickjs.Limits{MemoryBytes: 4 << 20, StackBytes: 256 << 10}))
+		defer rt.Close()
+		ctx := rt.NewContext()
+		defer ctx.Close()
+
+		_, err := ctx.Eval(`function f() { return f() + 1 } f()`)
+		require.Equal(t, quickjs.LimitStack, limitOf(t, err))
+
+		_, err = ctx.Eval(`new ArrayBuffer(8 << 20)`)
+		require.Equal(t, quickjs.LimitMemory, limitOf(t, err))
+	})
+
+	t.Run("HostCalls", func(t *testing.T) {
+		rt := quickjs.NewRuntime(quickjs.WithLimits(quickjs.Limits{MaxHostCalls: 100}))
+		defer rt.Close()
+		ctx := rt.NewContext()
+		defer ctx.Close()
+
+		calls := 0
+		ctx.Globals().Set("expensive", ctx.Function(func(ctx *quickjs.Context, this quickjs.Value, args []quickjs.Value) quickjs.Value {
+			calls++
+			return ctx.Undefined()
+		}))
+
+		// the script cannot catch the interruption
+		_, err := ctx.Eval(`for (;;) { try { expensive() } catch (e) {} }`)
+		require.Equal(t, quickjs.LimitHostCalls, limitOf(t, err))
+		require.EqualError(t, errors.Unwrap(err), "quickjs: host calls limit exceeded")
+		require.Equal(t, 100, calls)
+
+		// the budget applies to each entry
+		ret, err := ctx.Eval(`for (let i = 0; i < 100; i++) expensive()`)
+		require.NoError(t, err)
+		ret.Free()
+	})
+
+	t.Run("StringAndArrayLength", func(t *testing.T) {
+		rt := quickjs.NewRuntime(quickjs.WithMaxStringLength(16), quickjs.WithMaxArrayLength(4))
+		defer rt.Close()
+		ctx := rt.NewContext()
+		defer ctx.Close()
+
+		var limitErr *quickjs.LimitError
+		str := ctx.String(strings.Repeat("x", 17))
+		require.True(t, str.IsException())
+		err := ctx.Exception()
+		require.ErrorContains(t, err, "quickjs: string length limit exceeded")
+		str = ctx.NewStringLen(make([]byte, 17))
+		require.True(t, str.IsException())
+		ctx.Exception()
+		buf := ctx.ArrayBuffer(make([]byte, 5))
+		require.True(t, buf.IsException())
+		require.ErrorContains(t, ctx.Exception(), "quickjs: array length limit exceeded")
+		str = ctx.String(strings.Repeat("x", 16))
+		require.EqualValues(t, 16, str.StringLen())
+		str.Free()
+
+		_, err = ctx.Marshal(strings.Repeat("x", 17))
+		require.ErrorAs(t, err, &limitErr)
+		require.Equal(t, quickjs.LimitStringLength, limitErr.Limit)
+		_, err = ctx.Marshal([]int{1, 2, 3, 4, 5})
+		require.ErrorAs(t, err, &limitErr)
+		require.Equal(t, quickjs.LimitArrayLength, limitErr.Limit)
+		_, err = ctx.Marshal(make([]byte, 5))
+		require.ErrorAs(t, err, &limitErr)
+
+		// the values of scripts are bounded when read
+		long, err := ctx.Eval(`"x".repeat(100)`)
+		require.NoError(t, err)
+		defer long.Free()
+		_, err = long.ToString()
+		require.ErrorAs(t, err, &limitErr)
+		var s string
+		require.ErrorAs(t, long.Unmarshal(&s), &limitErr)
+
+		sparse, err := ctx.Eval(`const a = []; a.length = 1e9; a`)
+		require.NoError(t, err)
+		defer sparse.Free()
+		var ints []int
+		require.ErrorAs(t, sparse.Unmarshal(&ints), &limitErr)
+		require.Equal(t, quickjs.LimitArrayLength, limitErr.Limit)
+
+		buffer, err := ctx.Eval(`new ArrayBuffer(8)`)
+		require.NoError(t, err)
+		defer buffer.Free()
+		_, err = buffer.ToByteArray(8)
+		require.ErrorAs(t, err, &limitErr)
+		_, err = buffer.ToByteArray(4)
+		require.NoError(t, err)
+	})
+
+	t.Run("ContextHandler", func(t *testing.T) {
+		rt := quickjs.NewRuntime(quickjs.WithLimits(quickjs.Limits{WallTime: time.Minute}))
+		defer rt.Close()
+		ctx := rt.NewContext()
+		defer ctx.Close()
+
+		// an interruption by the handler is not attributed to a limit
+		ctx.SetContextInterruptHandler(func(quickjs.InterruptInfo) int { return 1 })
+		_, err := ctx.Eval(`for (;;) {}`)
+		require.EqualError(t, err, "InternalError: interrupted")
+		var limitErr *quickjs.LimitError
+		require.False(t, errors.As(err, &limitErr))
+	})
+}
+
+func TestNamedFunction(t *testing.T) {
+	var names []string
+	rt := quickjs.NewRuntime(quickjs.WithHooks(&quickjs.Hooks{
+		OnFunctionCall: func(info quickjs.FunctionCallInfo) { names = append(names, info.Name) },
+	}))
+	defer rt.Close()
+	ctx := rt.NewContext()
+	defer ctx.Close()
+
+	ctx.Globals().Set("add", ctx.NamedFunction("add", 2, func(ctx *quickjs.Context, this quickjs.Value, args []quickjs.Value) quickjs.Value {
+		return ctx.Int32(args[0].Int32() + args[1].Int32())
+	}))
+	ctx.Globals().Set("fail", ctx.NamedFunction("fail", 0, func(ctx *quickjs.Context, this quickjs.Value, args []quickjs.Value) quickjs.Value {
+		return ctx.ThrowError(errors.New("failed"))
+	}))
+	ctx.Globals().Set("wait", ctx.NamedAsyncFunction("wait", 1, func(ctx *quickjs.Context, this quickjs.Value, promise quickjs.Value, args []quickjs.Value) quickjs.Value {
+		return promise.Call("resolve", ctx.String("done"))
+	}))
+
+	ret, err := ctx.Eval(`[add.name, add.length, add(1, 2), wait.name, wait.length, Object.getOwnPropertyDescriptor(add, "name").writable]`)
+	require.NoError(t, err)
+	require.EqualValues(t, `["add",2,3,"wait",1,false]`, ret.JSONStringify())
+	ret.Free()
+
+	_, err = ctx.Eval(`fail()`)
+	var jsErr *quickjs.Error
+	require.ErrorAs(t, err, &jsErr)
+	require.Contains(t, jsErr.Stack, "at fail")
+
+	ret, err = ctx.Eval(`wait()`)
+	require.NoError(t, err)
+	ret, err = ctx.Await(ret)
+	require.NoError(t, err)
+	require.EqualValues(t, "done", ret.String())
+	ret.Free()
+
+	require.EqualValues(t, []string{"add", "fail", "wait"}, names)
+
+	// functions without a name stay anonymous
+	anonymous := ctx.Function(func(ctx *quickjs.Context, this quickjs.Value, args []quickjs.Value) quickjs.Value { return ctx.Null() })
+	defer anonymous.Free()
+	name := anonymous.Get("name")
+	defer name.Free()
+	require.EqualValues(t, "", name.String())
+}
+
+func TestFunctionIntrospection(t *testing.T) {
+	rt := quickjs.NewRuntime()
+	defer rt.Close()
+	ctx := rt.NewContext()
+	defer ctx.Close()
+
+	fn, err := ctx.Eval(`(function onEvent(type, payload) { return type; })`)
+	require.NoError(t, err)
+	defer fn.Free()
+	require.EqualValues(t, "onEvent", fn.FunctionName())
+	require.EqualValues(t, 2, fn.FunctionLength())
+	source, ok := fn.FunctionSource()
+	require.True(t, ok)
+	require.EqualValues(t, "function onEvent(type, payload) { return type; }", source)
+
+	arrow, err := ctx.Eval(`const handler = (a, b = 1, ...rest) => a; handler`)
+	require.NoError(t, err)
+	defer arrow.Free()
+	require.EqualValues(t, "handler", arrow.FunctionName())
+	require.EqualValues(t, 1, arrow.FunctionLength())
+
+	// sources which are not available
+	ctx.Globals().Set("host", ctx.NamedFunction("host", 1, func(ctx *quickjs.Context, this quickjs.Value, args []quickjs.Value) quickjs.Value { return ctx.Null() }))
+	for _, code := range []string{`Math.max`, `(function f() {}).bind(null)`, `host`} {
+		val, err := ctx.Eval(code)
+		require.NoError(t, err)
+		_, ok := val.FunctionSource()
+		require.False(t, ok, code)
+		val.Free()
+	}
+
+	notFunction := ctx.Int32(1)
+	require.EqualValues(t, "", notFunction.FunctionName())
+	require.EqualValues(t, 0, notFunction.FunctionLength())
+	_, ok = notFunction.FunctionSource()
+	require.False(t, ok)
+}
+
+type testColor uint8
+
+func TestEnum(t *testing.T) {
+	rt := quickjs.NewRuntime()
+	defer rt.Close()
+	ctx := rt.NewContext()
+	defer ctx.Close()
+
+	colors := map[string]testColor{"Red": 0, "Green": 1, "Blue": 2}
+	enum, err := ctx.NewEnum(colors)
+	require.NoError(t, err)
+	ctx.Globals().Set("Color", enum)
+
+	ret, err := ctx.Eval(`"use strict"; [Color.Green, Color[2], Object.isFrozen(Color), JSON.stringify(Color)]`)
+	require.NoError(t, err)
+	require.EqualValues(t, `[1,"Blue",true,"{\"0\":\"Red\",\"1\":\"Green\",\"2\":\"Blue\",\"Red\":0,\"Green\":1,\"Blue\":2}"]`, ret.JSONStringify())
+	ret.Free()
+
+	_, err = ctx.Eval(`"use strict"; Color.Red = 5`)
+	require.Error(t, err)
+
+	levels, err := ctx.NewEnum([]string{"Low", "High"})
+	require.NoError(t, err)
+	require.EqualValues(t, `{"0":"Low","1":"High","Low":0,"High":1}`, levels.JSONStringify())
+	levels.Free()
+
+	_, err = ctx.NewEnum(map[string]string{"A": "a"})
+	require.Error(t, err)
+	_, err = ctx.NewEnum([]string{"A", "A"})
+	require.Error(t, err)
+
+	// members unmarshal by name or by value
+	var settings struct {
+		Primary   testColor
+		Secondary testColor
+		Count     uint8
+	}
+	obj, err := ctx.Eval(`({Primary: "Blue", Secondary: Color.Green, Count: 3})`)
+	require.NoError(t, err)
+	defer obj.Free()
+	require.NoError(t, obj.Unmarshal(&settings, quickjs.UnmarshalEnum(colors)))
+	require.EqualValues(t, 2, settings.Primary)
+	require.EqualValues(t, 1, settings.Secondary)
+	require.EqualValues(t, 3, settings.Count)
+
+	var color testColor
+	for _, code := range []string{`"Purple"`, `7`, `1.5`, `true`} {
+		val, err := ctx.Eval(code)
+		require.NoError(t, err)
+		require.Error(t, val.Unmarshal(&color, quickjs.UnmarshalEnum(colors)), code)
+		val.Free()
+	}
+}
+
+type testShape interface{ area() float64 }
+
+type testCircle struct {
+	Radius float64 `json:"radius"`
+}
+
+func (c testCircle) area() float64 { return 3 * c.Radius * c.Radius }
+
+type testSquare struct {
+	Side float64 `json:"side"`
+}
+
+func (s *testSquare) area() float64 { return s.Side * s.Side }
+
+func TestUnion(t *testing.T) {
+	rt := quickjs.NewRuntime()
+	defer rt.Close()
+	ctx := rt.NewContext()
+	defer ctx.Close()
+
+	registry := quickjs.NewTypeRegistry()
+	require.NoError(t, quickjs.RegisterUnion[testShape](registry, "kind", testCircle{}, &testSquare{}))
+	require.Error(t, quickjs.RegisterUnion[testShape](registry, "kind", testCircle{}))
+	require.Error(t, quickjs.RegisterUnion[testCircle](quickjs.NewTypeRegistry(), "kind"))
+
+	shapes := []testShape{testCircle{Radius: 1}, &testSquare{Side: 2}}
+	val, err := ctx.Marshal(shapes, quickjs.MarshalTypes(registry))
+	require.NoError(t, err)
+	defer val.Free()
+	require.EqualValues(t, `[{"kind":"testCircle","radius":1},{"kind":"testSquare","side":2}]`, val.JSONStringify())
+
+	var out []testShape
+	require.NoError(t, val.Unmarshal(&out, quickjs.UnmarshalTypes(registry)))
+	require.Equal(t, shapes, out)
+	require.EqualValues(t, 4, out[1].area())
+
+	// without the registry, the interface cannot be unmarshaled
+	require.Error(t, val.Unmarshal(&out))
+
+	for _, code := range []string{`[{"side": 1}]`, `[{"kind": "testTriangle"}]`, `[1]`} {
+		bad, err := ctx.Eval(code)
+		require.NoError(t, err)
+		require.Error(t, bad.Unmarshal(&out, quickjs.UnmarshalTypes(registry)), code)
+		bad.Free()
+	}
+}
+
+func TestGenericHelpers(t *testing.T) {
+	rt := quickjs.NewRuntime()
+	defer rt.Close()
+	ctx := rt.NewContext()
+	defer ctx.Close()
+
+	val, err := ctx.Eval(`({name: "quickjs", tags: ["js", "go"]})`)
+	require.NoError(t, err)
+	defer val.Free()
+	type project struct {
+		Name string   `json:"name"`
+		Tags []string `json:"tags"`
+	}
+	p, err := quickjs.As[project](&val)
+	require.NoError(t, err)
+	require.EqualValues(t, project{Name: "quickjs", Tags: []string{"js", "go"}}, p)
+	_, err = quickjs.As[int](&val)
+	require.Error(t, err)
+
+	fn, err := ctx.Eval(`(a, b) => ({sum: a + b, product: a * b})`)
+	require.NoError(t, err)
+	defer fn.Free()
+	result, err := quickjs.Call[map[string]int](&fn, 3, 4)
+	require.NoError(t, err)
+	require.EqualValues(t, map[string]int{"sum": 7, "product": 12}, result)
+
+	thrower, err := ctx.Eval(`() => { throw new TypeError("bad") }`)
+	require.NoError(t, err)
+	defer thrower.Free()
+	_, err = quickjs.Call[int](&thrower)
+	require.EqualError(t, err, "TypeError: bad")
+
+	_, err = quickjs.Call[int](&val)
+	require.Error(t, err)
+	_, err = quickjs.Call[int](nil)
+	require.Error(t, err)
+}
+
+func TestStrictAndFeatures(t *testing.T) {
+	rt := quickjs.NewRuntime(quickjs.WithStrict(true))
+	defer rt.Close()
+	ctx := rt.NewContext()
+	defer ctx.Close()
+	require.True(t, ctx.Strict())
+	require.Equal(t, quickjs.FeatureAll, ctx.Features())
+
+	_, err := ctx.Eval(`undeclared = 1`)
+	require.EqualError(t, err, "ReferenceError: 'undeclared' is not defined")
+	_, err = ctx.Eval(`with ({}) {}`)
+	require.Error(t, err)
+	ret, err := ctx.Eval(`(function () { return this === undefined })()`)
+	require.NoError(t, err)
+	require.True(t, ret.Bool())
+	ret.Free()
+
+	// an explicit flag overrides the default
+	ret, err = ctx.Eval(`with ({a: 1}) { a }`, quickjs.EvalFlagStrict(false))
+	require.NoError(t, err)
+	require.EqualValues(t, 1, ret.Int32())
+	ret.Free()
+
+	// compiled scripts keep the mode
+	buf, err := ctx.Compile(`sloppy = 1`)
+	require.NoError(t, err)
+	_, err = ctx.EvalBytecode(buf)
+	require.Error(t, err)
+
+	// expressions still resolve their variables
+	n, err := quickjs.EvalExpr[int](ctx, "a + 1", map[string]interface{}{"a": 1})
+	require.NoError(t, err)
+	require.EqualValues(t, 2, n)
+
+	ctx.SetStrict(false)
+	ret, err = ctx.Eval(`sloppy = 1`)
+	require.NoError(t, err)
+	ret.Free()
+
+	// standard JavaScript without the bignum extensions
+	plainRt := quickjs.NewRuntime(quickjs.WithFeatures(0))
+	defer plainRt.Close()
+	plainCtx := plainRt.NewContext()
+	defer plainCtx.Close()
+	require.EqualValues(t, 0, plainCtx.Features())
+	ret, err = plainCtx.Eval(`[typeof BigFloat, typeof BigDecimal, typeof Operators, typeof BigInt]`)
+	require.NoError(t, err)
+	require.EqualValues(t, `["undefined","undefined","undefined","function"]`, ret.JSONStringify())
+	ret.Free()
+
+	ret, err = ctx.Eval(`[typeof BigFloat, typeof BigDecimal, typeof Operators]`)
+	require.NoError(t, err)
+	require.EqualValues(t, `["function","function","function"]`, ret.JSONStringify())
+	ret.Free()
+}
+
+func TestLocale(t *testing.T) {
+	rt := quickjs.NewRuntime()
+	defer rt.Close()
+	ctx := rt.NewContext()
+	defer ctx.Close()
+
+	require.NoError(t, ctx.SetLocale(&quickjs.Locale{
+		Default: "en-US",
+		FormatNumber: func(locale string, n float64, options map[string]interface{}) string {
+			return fmt.Sprintf("%s:%v:%v", locale, n, options["style"])
+		},
+		FormatDate: func(locale string, t time.Time, format quickjs.DateFormat, options map[string]interface{}) string {
+			return fmt.Sprintf("%s:%d:%d", locale, t.UTC().Year(), format)
+		},
+		Compare: func(locale string, a, b string, options map[string]interface{}) int {
+			// compare case-insensitively
+			return strings.Compare(strings.ToLower(a), strings.ToLower(b)) * 10
+		},
+	}))
+
+	ret, err := ctx.Eval(`[
+		(1234.5).toLocaleString(),
+		(1).toLocaleString("de-DE", {style: "currency"}),
+		new Date(Date.UTC(2024, 0, 1)).toLocaleString(["fr-FR", "en"]),
+		new Date(Date.UTC(2024, 0, 1)).toLocaleDateString(),
+		new Date(Date.UTC(2024, 0, 1)).toLocaleTimeString(),
+		new Date(NaN).toLocaleString(),
+		["b", "A", "c"].sort((a, b) => a.localeCompare(b)).join(""),
+		"a".localeCompare("B"),
+		Number.prototype.toLocaleString.name,
+	]`)
+	require.NoError(t, err)
+	require.EqualValues(t, `["en-US:1234.5:<nil>","de-DE:1:currency","fr-FR:2024:0","en-US:2024:1","en-US:2024:2","Invalid Date","Abc",-1,"toLocaleString"]`, ret.JSONStringify())
+	ret.Free()
+
+	// the locale is kept by Reset
+	require.NoError(t, ctx.Reset())
+	ret, err = ctx.Eval(`(2).toLocaleString()`)
+	require.NoError(t, err)
+	require.EqualValues(t, "en-US:2:<nil>", ret.String())
+	ret.Free()
+
+	// nil restores the engine's methods
+	require.NoError(t, ctx.SetLocale(nil))
+	ret, err = ctx.Eval(`[(2).toLocaleString(), "a".localeCompare("B") > 0]`)
+	require.NoError(t, err)
+	require.EqualValues(t, `["2",true]`, ret.JSONStringify())
+	ret.Free()
+}
+
+func TestStringSlice(t *testing.T) {
+	rt := quickjs.NewRuntime()
+	defer rt.Close()
+	ctx := rt.NewContext()
+	defer ctx.Close()
+
+	str := ctx.NewStringLen([]byte("héllo, 世界 😀\x00!"))
+	defer str.Free()
+	require.EqualValues(t, "héllo, 世界 😀\x00!", str.String())
+	require.EqualValues(t, 14, str.StringLen())
+
+	slice := str.StringSlice(7, 9)
+	require.EqualValues(t, "世界", slice.String())
+	slice.Free()
+	slice = str.StringSlice(-2, 100)
+	require.EqualValues(t, "\x00!", slice.String())
+	slice.Free()
+	slice = str.StringSlice(10, 12)
+	require.EqualValues(t, 2, slice.StringLen())
+	slice.Free()
+
+	empty := ctx.NewStringLen(nil)
+	require.EqualValues(t, 0, empty.StringLen())
+	empty.Free()
+
+	num := ctx.Int32(1)
+	require.EqualValues(t, -1, num.StringLen())
+	ret := num.StringSlice(0, 1)
+	require.True(t, ret.IsException())
+	require.ErrorContains(t, ctx.Exception(), "not a string")
+}
+
+// largeLog returns a string of about 1 MB of log lines.
+func largeLog() []byte {
+	var buf bytes.Buffer
+	for i := 0; buf.Len() < 1<<20; i++ {
+		fmt.Fprintf(&buf, "2024-01-01T00:00:00Z INFO request %d served\n", i)
+	}
+	return buf.Bytes()
+}
+
+func BenchmarkStringSlice(b *testing.B) {
+	rt := quickjs.NewRuntime()
+	defer rt.Close()
+	ctx := rt.NewContext()
+	defer ctx.Close()
+	str := ctx.NewStringLen(largeLog())
+	defer str.Free()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		slice := str.StringSlice(1000, 1040)
+		_ = slice.String()
+		slice.Free()
+	}
+}
+
+func BenchmarkStringSliceConverted(b *testing.B) {
+	rt := quickjs.NewRuntime()
+	defer rt.Close()
+	ctx := rt.NewContext()
+	defer ctx.Close()
+	str := ctx.NewStringLen(largeLog())
+	defer str.Free()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		_ = str.String()[1000:1040]
+	}
+}
+
+func BenchmarkNewStringLen(b *testing.B) {
+	rt := quickjs.NewRuntime()
+	defer rt.Close()
+	ctx := rt.NewContext()
+	defer ctx.Close()
+	log := largeLog()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		str := ctx.NewStringLen(log)
+		str.Free()
+	}
+}
+
+func BenchmarkString(b *testing.B) {
+	rt := quickjs.NewRuntime()
+	defer rt.Close()
+	ctx := rt.NewContext()
+	defer ctx.Close()
+	log := largeLog()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		str := ctx.String(string(log))
+		str.Free()
+	}
+}
+
+func TestToAny(t *testing.T) {
+	rt := quickjs.NewRuntime()
+	defer rt.Close()
+	ctx := rt.NewContext()
+	defer ctx.Close()
+
+	val, err := ctx.Eval(`({
+		count: 3,
+		ratio: 0.5,
+		big: 12345678901234567890n,
+		when: new Date(Date.UTC(2024, 0, 2, 3, 4, 5)),
+		tags: new Set(["a", "b"]),
+		scores: new Map([["alice", 1], [2, [new Date(0)]]]),
+		floats: new Float32Array([1.5, -2]),
+		longs: new BigInt64Array([-1n, 2n]),
+		bytes: new Uint8Array(new Uint8Array([1, 2, 3, 4]).buffer, 1, 2),
+		view: new DataView(new Uint8Array([9, 8, 7]).buffer, 1),
+		nested: [{ n: 1 }, null],
+	})`)
+	require.NoError(t, err)
+	defer val.Free()
+
+	out, err := val.ToAny()
+	require.NoError(t, err)
+	large, _ := new(big.Int).SetString("12345678901234567890", 10)
+	require.Equal(t, map[string]interface{}{
+		"count":  float64(3),
+		"ratio":  0.5,
+		"big":    large,
+		"when":   time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC),
+		"tags":   []interface{}{"a", "b"},
+		"scores": map[string]interface{}{"alice": float64(1), "2": []interface{}{time.Unix(0, 0).UTC()}},
+		"floats": []float32{1.5, -2},
+		"longs":  []int64{-1, 2},
+		"bytes":  []uint8{2, 3},
+		"view":   []byte{8, 7},
+		"nested": []interface{}{map[string]interface{}{"n": float64(1)}, nil},
+	}, out)
+
+	out, err = val.ToAny(
+		quickjs.AnyNumbers(quickjs.NumberInt64),
+		quickjs.AnyMaps(quickjs.MapAnyKeys),
+		quickjs.AnyDates(quickjs.DateISOString),
+		quickjs.AnyTypedArrays(quickjs.TypedArrayNumbers),
+	)
+	require.NoError(t, err)
+	obj := out.(map[string]interface{})
+	require.Equal(t, int64(3), obj["count"])
+	require.Equal(t, 0.5, obj["ratio"])
+	require.Equal(t, "2024-01-02T03:04:05.000Z", obj["when"])
+	require.Equal(t, map[interface{}]interface{}{"alice": int64(1), int64(2): []interface{}{"1970-01-01T00:00:00.000Z"}}, obj["scores"])
+	require.Equal(t, []interface{}{1.5, int64(-2)}, obj["floats"])
+	require.Equal(t, []interface{}{big.NewInt(-1), big.NewInt(2)}, obj["longs"])
+	require.Equal(t, []interface{}{map[string]interface{}{"n": int64(1)}, nil}, obj["nested"])
+
+	out, err = val.ToAny(quickjs.AnyDates(quickjs.DateMillis), quickjs.AnyTypedArrays(quickjs.TypedArrayBytes))
+	require.NoError(t, err)
+	obj = out.(map[string]interface{})
+	require.Equal(t, float64(1704164645000), obj["when"])
+	require.Equal(t, []byte{2, 3}, obj["bytes"])
+	require.Len(t, obj["floats"], 8)
+
+	for code, msg := range map[string]string{
+		"new Map([[{}, 1]])":                       "cannot convert Map key of type object to string",
+		"[new Date(NaN)]":                          "cannot convert an invalid Date",
+		"({ fn() {} })":                            "cannot unmarshal function",
+		"const m = new Map(); m.set('self', m); m": "nested deeper than",
+	} {
+		v, err := ctx.Eval(code)
+		require.NoError(t, err)
+		_, err = v.ToAny()
+		require.ErrorContains(t, err, msg, code)
+		v.Free()
+	}
+	v, err := ctx.Eval("new Map([[[1], 1]])")
+	require.NoError(t, err)
+	_, err = v.ToAny(quickjs.AnyMaps(quickjs.MapAnyKeys))
+	require.ErrorContains(t, err, "cannot convert Map key of type array to a Go map key")
+	v.Free()
+}
+
+func TestStringUTF16(t *testing.T) {
+	rt := quickjs.NewRuntime()
+	defer rt.Close()
+	ctx := rt.NewContext()
+	defer ctx.Close()
+
+	str, err := ctx.Eval(`"a\uD800b\uDC00\u00e9\u0000😀"`)
+	require.NoError(t, err)
+	defer str.Free()
+	units := []uint16{'a', 0xd800, 'b', 0xdc00, 0xe9, 0, 0xd83d, 0xde00}
+	require.EqualValues(t, units, str.ToUTF16())
+
+	// the code units convert back, lone surrogates included
+	copied := ctx.NewStringUTF16(units)
+	defer copied.Free()
+	isSame, err := ctx.Eval(`(a, b) => a === b`)
+	require.NoError(t, err)
+	defer isSame.Free()
+	ret := ctx.Invoke(isSame, ctx.Null(), str, copied)
+	require.True(t, ret.Bool())
+	require.EqualValues(t, 8, copied.StringLen())
+
+	preserved, err := str.ToString()
+	require.NoError(t, err)
+	require.EqualValues(t, str.String(), preserved)
+	require.False(t, utf8.ValidString(preserved))
+	roundTrip := ctx.String(preserved)
+	require.EqualValues(t, units, roundTrip.ToUTF16())
+	roundTrip.Free()
+
+	replaced, err := str.ToString(quickjs.StringLoneSurrogates(quickjs.LoneSurrogatesReplace))
+	require.NoError(t, err)
+	require.EqualValues(t, "a\uFFFDb\uFFFD\u00e9\x00😀", replaced)
+
+	_, err = str.ToString(quickjs.StringLoneSurrogates(quickjs.LoneSurrogatesReject))
+	require.ErrorIs(t, err, quickjs.ErrLoneSurrogate)
+	wellFormed := ctx.String("é😀")
+	s, err := wellFormed.ToString(quickjs.StringLoneSurrogates(quickjs.LoneSurrogatesReject))
+	require.NoError(t, err)
+	require.EqualValues(t, "é😀", s)
+	wellFormed.Free()
+
+	// the exceptions of the conversion are returned
+	obj, err := ctx.Eval(`({ toString() { throw new Error("no string"); } })`)
+	require.NoError(t, err)
+	defer obj.Free()
+	_, err = obj.ToString()
+	require.ErrorContains(t, err, "no string")
+	require.Nil(t, obj.ToUTF16())
+}
+
+func TestAtom(t *testing.T) {
+	rt := quickjs.NewRuntime()
+	defer rt.Close()
+	ctx := rt.NewContext()
+	defer ctx.Close()
+
+	name := ctx.InternAtom("name")
+	require.Same(t, name, ctx.InternAtom("name"))
+	require.EqualValues(t, "name", name.String())
+
+	obj := ctx.Object()
+	defer obj.Free()
+	require.False(t, obj.HasAtom(name))
+	obj.SetAtom(name, ctx.String("quickjs"))
+	require.True(t, obj.HasAtom(name))
+
+	val := obj.GetAtom(name)
+	require.EqualValues(t, "quickjs", val.String())
+	val.Free()
+	val = obj.Get("name")
+	require.EqualValues(t, "quickjs", val.String())
+	val.Free()
+
+	require.True(t, obj.DeleteAtom(name))
+	require.False(t, obj.HasAtom(name))
+
+	// interned atoms remain valid across Reset
+	require.NoError(t, ctx.Reset())
+	ret, err := ctx.Eval(`({name: "reset"})`)
+	require.NoError(t, err)
+	val = ret.GetAtom(ctx.InternAtom("name"))
+	require.EqualValues(t, "reset", val.String())
+	val.Free()
+	ret.Free()
+}
+
+func BenchmarkGet(b *testing.B) {
+	benchmarkPropertyAccess(b, func(obj quickjs.Value) quickjs.Value {
+		return obj.Get("value")
+	})
+}
+
+func BenchmarkGetAtom(b *testing.B) {
+	benchmarkPropertyAccess(b, func(obj quickjs.Value) quickjs.Value {
+		return obj.GetAtom(obj.Context().InternAtom("value"))
+	})
+}
+
+// benchmarkPropertyAccess reports the cost of one read of a property of an object from Go.
+func benchmarkPropertyAccess(b *testing.B, get func(obj quickjs.Value) quickjs.Value) {
+	rt := quickjs.NewRuntime()
+	defer rt.Close()
+	ctx := rt.NewContext()
+	defer ctx.Close()
+
+	obj, err := ctx.Eval(`({value: 1})`)
+	require.NoError(b, err)
+	defer obj.Free()
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		val := get(obj)
+		val.Free()
+	}
+}
+
+func TestDedicatedThread(t *testing.T) {
+	rt := quickjs.NewRuntime(quickjs.WithDedicatedThread(true))
+	defer rt.Close()
+	ctx := rt.NewContext()
+	defer ctx.Close()
+
+	// Go callbacks run on the thread and may call the context
+	ctx.Do(func(ctx *quickjs.Context) {
+		ctx.Globals().Set("double", ctx.Function(func(ctx *quickjs.Context, this quickjs.Value, args []quickjs.Value) quickjs.Value {
+			ret, err := ctx.Eval(`2`)
+			if err != nil {
+				return ctx.ThrowError(err)
+			}
+			defer ret.Free()
+			return ctx.Int32(args[0].Int32() * ret.Int32())
+		}))
+	})
+	ret, err := ctx.Eval(`var counter = 0; function increment() { counter = double(counter) / 2 + 1; }`)
+	require.NoError(t, err)
+	ret.Free()
+
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				ret, err := ctx.Eval(`increment()`)
+				if err != nil {
+					panic(err)
+				}
+				ret.Free()
+			}
+		}()
+	}
+	wg.Wait()
+
+	ret, err = ctx.Eval(`counter`)
+	require.NoError(t, err)
+	var counter int32
+	ctx.Do(func(ctx *quickjs.Context) {
+		counter = ret.Int32()
+	})
+	ret.Free()
+	require.EqualValues(t, 800, counter)
+
+	// panics are raised on the calling goroutine
+	require.PanicsWithValue(t, "boom", func() {
+		ctx.Do(func(ctx *quickjs.Context) { panic("boom") })
+	})
+
+	_, err = ctx.Eval(`throw new Error("failed")`)
+	require.EqualError(t, err, "Error: failed")
+}
+
+func TestEvalAsync(t *testing.T) {
+	t.Run("Loop", func(t *testing.T) {
+		rt := quickjs.NewRuntime()
+		defer rt.Close()
+		ctx := rt.NewContext()
+		defer ctx.Close()
+
+		future := ctx.EvalAsync(`new Promise((resolve) => setTimeout(() => resolve(1 + 2), 10))`)
+		failed := ctx.EvalAsync(`throw new Error("failed")`)
+		select {
+		case <-future.Done():
+			t.Fatal("evaluated before Loop")
+		default:
+		}
+
+		ctx.Loop()
+		<-future.Done()
+		val, err := future.Result()
+		require.NoError(t, err)
+		require.EqualValues(t, 3, val.Int32())
+		val.Free()
+
+		_, err = failed.Result()
+		require.EqualError(t, err, "Error: failed")
+
+		// the scripts still queued fail when the context is closed
+		closed := rt.NewContext()
+		pending := closed.EvalAsync(`1`)
+		closed.Close()
+		_, err = pending.Result()
+		require.ErrorIs(t, err, quickjs.ErrContextClosed)
+		_, err = closed.EvalAsync(`1`).Result()
+		require.ErrorIs(t, err, quickjs.ErrContextClosed)
+	})
+
+	t.Run("DedicatedThread", func(t *testing.T) {
+		rt := quickjs.NewRuntime(quickjs.WithDedicatedThread(true))
+		defer rt.Close()
+		ctx := rt.NewContext()
+		defer ctx.Close()
+
+		futures := make([]*quickjs.Future, 10)
+		for i := range futures {
+			futures[i] = ctx.EvalAsync(fmt.Sprintf(`Promise.resolve(%d * 2)`, i))
+		}
+		for i, future := range futures {
+			val, err := future.Result()
+			require.NoError(t, err)
+			var n int32
+			ctx.Do(func(ctx *quickjs.Context) { n = val.Int32() })
+			val.Free()
+			require.EqualValues(t, i*2, n)
+		}
+
+		// EvalAwait(false) returns the promise
+		val, err := ctx.EvalAsync(`Promise.resolve(1)`, quickjs.EvalAwait(false)).Result()
+		require.NoError(t, err)
+		var isPromise bool
+		ctx.Do(func(ctx *quickjs.Context) { isPromise = val.IsPromise() })
+		val.Free()
+		require.True(t, isPromise)
+	})
+}
+
+func TestSchedule(t *testing.T) {
+	rt := quickjs.NewRuntime(quickjs.WithJobQueueSize(2))
+	defer rt.Close()
+	ctx := rt.NewContext()
+	defer ctx.Close()
+
+	var ran []int
+	for i := 0; i < 2; i++ {
+		i := i
+		require.NoError(t, ctx.Schedule(func(ctx *quickjs.Context) { ran = append(ran, i) }))
+	}
+	require.ErrorIs(t, ctx.Schedule(func(ctx *quickjs.Context) {}), quickjs.ErrJobQueueFull)
+	_, err := ctx.EvalAsync(`1`).Result()
+	require.ErrorIs(t, err, quickjs.ErrJobQueueFull)
+
+	// ScheduleWait gives up when its context is done
+	goctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	require.ErrorIs(t, ctx.ScheduleWait(goctx, func(ctx *quickjs.Context) {}), quickjs.ErrJobQueueFull)
+	require.EqualValues(t, quickjs.JobQueueStats{Size: 2, Queued: 2, Scheduled: 2, Dropped: 2}, ctx.JobQueueStats())
+
+	// ScheduleWait waits for room
+	scheduled := make(chan error)
+	go func() {
+		scheduled <- ctx.ScheduleWait(context.Background(), func(ctx *quickjs.Context) { ran = append(ran, 2) })
+	}()
+	ctx.Loop()
+	require.NoError(t, <-scheduled)
+	ctx.Loop()
+	require.EqualValues(t, []int{0, 1, 2}, ran)
+
+	// the jobs still queued are dropped when the context is closed
+	closed := rt.NewContext()
+	require.NoError(t, closed.Schedule(func(ctx *quickjs.Context) { t.Fatal("ran after Close") }))
+	closed.Close()
+	require.ErrorIs(t, closed.Schedule(func(ctx *quickjs.Context) {}), quickjs.ErrContextClosed)
+}
+
+func TestCloseWithTimeout(t *testing.T) {
+	rt := quickjs.NewRuntime()
+	defer rt.Close()
+
+	ctx := rt.NewContext()
+	var events []string
+	ctx.OnClose(func(ctx *quickjs.Context) { events = append(events, "first hook") })
+	ctx.OnClose(func(ctx *quickjs.Context) { events = append(events, "second hook") })
+	ctx.Globals().Set("record", ctx.Function(func(ctx *quickjs.Context, this quickjs.Value, args []quickjs.Value) quickjs.Value {
+		events = append(events, args[0].String())
+		return ctx.Undefined()
+	}))
+	ret, err := ctx.Eval(`
+		setTimeout(() => record("timer 20"), 20);
+		setTimeout(() => { record("timer 10"); Promise.resolve().then(() => record("promise")); }, 10);
+		clearTimeout(setTimeout(() => record("cleared"), 30));
+	`)
+	require.NoError(t, err)
+	ret.Free()
+	require.NoError(t, ctx.Schedule(func(ctx *quickjs.Context) { events = append(events, "job") }))
+
+	require.True(t, ctx.CloseWithTimeout(time.Second))
+	require.EqualValues(t, []string{"job", "timer 10", "promise", "timer 20", "second hook", "first hook"}, events)
+	require.ErrorIs(t, ctx.Schedule(func(ctx *quickjs.Context) {}), quickjs.ErrContextClosed)
+
+	// the work left at the timeout is dropped
+	ctx = rt.NewContext()
+	events = nil
+	ctx.Globals().Set("record", ctx.Function(func(ctx *quickjs.Context, this quickjs.Value, args []quickjs.Value) quickjs.Value {
+		events = append(events, args[0].String())
+		return ctx.Undefined()
+	}))
+	ret, err = ctx.Eval(`
+		setTimeout(() => record("soon"), 0);
+		setTimeout(() => record("late"), 60000);
+	`)
+	require.NoError(t, err)
+	ret.Free()
+	start := time.Now()
+	require.False(t, ctx.CloseWithTimeout(50*time.Millisecond))
+	require.Less(t, time.Since(start), time.Second)
+	require.EqualValues(t, []string{"soon"}, events)
+
+	// nor is a chain of promise jobs running past the timeout
+	ctx = rt.NewContext()
+	ret, err = ctx.Eval(`
+		function busy() {
+			const end = Date.now() + 1;
+			while (Date.now() < end) {}
+			Promise.resolve().then(busy);
+		}
+		busy();
+	`)
+	require.NoError(t, err)
+	ret.Free()
+	start = time.Now()
+	require.False(t, ctx.CloseWithTimeout(50*time.Millisecond))
+	require.Less(t, time.Since(start), time.Second)
+}
+
+func TestLifecycleHooks(t *testing.T) {
+	rt := quickjs.NewRuntime()
+	defer rt.Close()
+	ctx := rt.NewContext()
+	other := rt.NewContext()
+	defer other.Close()
+
+	var events []string
+	ctx.OnReset(func(ctx *quickjs.Context) {
+		// the hooks may define globals again
+		ctx.Globals().Set("restored", ctx.Bool(true))
+		events = append(events, "reset")
+	})
+	ctx.OnGC(func(ctx *quickjs.Context, info quickjs.GCInfo) {
+		events = append(events, fmt.Sprintf("gc %d", info.Runs))
+	})
+	other.OnGC(func(ctx *quickjs.Context, info quickjs.GCInfo) {
+		events = append(events, fmt.Sprintf("other gc %d", info.Runs))
+	})
+	ctx.OnClose(func(ctx *quickjs.Context) { events = append(events, "close") })
+
+	require.NoError(t, ctx.Reset())
+	ret, err := ctx.Eval(`restored`)
+	require.NoError(t, err)
+	require.True(t, ret.Bool())
+	ret.Free()
+
+	rt.RunGC()
+	ctx.Close()
+	// the functions of a closed context are forgotten
+	rt.RunGC()
+	require.EqualValues(t, []string{"reset", "gc 1", "other gc 1", "close", "other gc 2"}, events)
+}
+
+func TestGoObject(t *testing.T) {
+	rt := quickjs.NewRuntime()
+	defer rt.Close()
+	ctx := rt.NewContext()
+	defer ctx.Close()
+
+	type point struct{ X, Y int }
+
+	ret, err := ctx.Eval(`
+		class Base {}
+		class Derived extends Base {}
+		globalThis.base = new Base();
+		[base, new Derived(), Object.create(base), Object.freeze({})]
+	`)
+	require.NoError(t, err)
+	defer ret.Free()
+	base, derived, inherited, frozen := ret.GetIdx(0), ret.GetIdx(1), ret.GetIdx(2), ret.GetIdx(3)
+	defer base.Free()
+	defer derived.Free()
+	defer inherited.Free()
+	defer frozen.Free()
+
+	_, ok := base.GetGoObject()
+	require.False(t, ok)
+
+	require.NoError(t, base.SetGoObject(&point{1, 2}))
+	require.NoError(t, derived.SetGoObject("derived"))
+	obj, ok := base.GetGoObject()
+	require.True(t, ok)
+	require.EqualValues(t, &point{1, 2}, obj)
+	obj, ok = derived.GetGoObject()
+	require.True(t, ok)
+	require.EqualValues(t, "derived", obj)
+
+	// the Go object of a prototype is not inherited
+	_, ok = inherited.GetGoObject()
+	require.False(t, ok)
+
+	// the data is hidden from scripts
+	keys, err := ctx.Eval(`JSON.stringify([Reflect.ownKeys(base).map(String), JSON.stringify(base)])`)
+	require.NoError(t, err)
+	require.EqualValues(t, `[[],"{}"]`, keys.String())
+	keys.Free()
+
+	require.NoError(t, base.SetGoObject(&point{3, 4}))
+	obj, _ = base.GetGoObject()
+	require.EqualValues(t, &point{3, 4}, obj)
+	base.ClearGoObject()
+	_, ok = base.GetGoObject()
+	require.False(t, ok)
+
+	require.Error(t, frozen.SetGoObject(1))
+	proxy, err := ctx.Eval(`new Proxy({}, {})`)
+	require.NoError(t, err)
+	defer proxy.Free()
+	require.EqualError(t, proxy.SetGoObject(1), "quickjs: Go objects cannot be attached to a Proxy")
+	require.Error(t, ctx.Int32(1).SetGoObject(1))
+}
+
+func TestInstanceData(t *testing.T) {
+	rt := quickjs.NewRuntime()
+	defer rt.Close()
+	ctx := rt.NewContext()
+	defer ctx.Close()
+
+	obj := ctx.Object()
+	defer obj.Free()
+
+	_, ok := obj.GetInstanceData("conn")
+	require.False(t, ok)
+
+	require.NoError(t, obj.SetGoObject("object"))
+	require.NoError(t, obj.SetInstanceData("conn", &strings.Builder{}))
+	require.NoError(t, obj.SetInstanceData("count", 1))
+	require.NoError(t, obj.SetInstanceData("count", 2))
+
+	conn, ok := quickjs.InstanceDataAs[*strings.Builder](&obj, "conn")
+	require.True(t, ok)
+	require.NotNil(t, conn)
+	count, ok := quickjs.InstanceDataAs[int](&obj, "count")
+	require.True(t, ok)
+	require.EqualValues(t, 2, count)
+	_, ok = quickjs.InstanceDataAs[string](&obj, "count")
+	require.False(t, ok)
+
+	// the slots are independent of the Go object
+	goObj, ok := obj.GetGoObject()
+	require.True(t, ok)
+	require.EqualValues(t, "object", goObj)
+	obj.DeleteInstanceData("conn")
+	_, ok = obj.GetInstanceData("conn")
+	require.False(t, ok)
+	obj.ClearGoObject()
+	val, ok := obj.GetInstanceData("count")
+	require.True(t, ok)
+	require.EqualValues(t, 2, val)
+}
+
+type testFinalizer struct {
+	name   string
+	events *[]string
+}
+
+func (f *testFinalizer) Finalize() { *f.events = append(*f.events, f.name) }
+
+func TestGoObjectFinalize(t *testing.T) {
+	rt := quickjs.NewRuntime()
+	defer rt.Close()
+	ctx := rt.NewContext()
+
+	var events []string
+	ctx.OnClose(func(ctx *quickjs.Context) { events = append(events, "close") })
+
+	// an object created by a constructor of a script
+	ret, err := ctx.Eval(`class Resource {}; globalThis.resource = new Resource(); resource`)
+	require.NoError(t, err)
+	require.NoError(t, ret.SetGoObject(&testFinalizer{"constructed", &events}))
+	require.NoError(t, ret.SetInstanceData("b", &testFinalizer{"constructed b", &events}))
+	require.NoError(t, ret.SetInstanceData("a", &testFinalizer{"constructed a", &events}))
+	ret.Free()
+
+	// an object created by Go
+	obj := ctx.Object()
+	require.NoError(t, obj.SetGoObject(&testFinalizer{"wrapped", &events}))
+	ctx.Globals().Set("wrapped", obj)
+
+	// a collected object is finalized by the GC
+	collected := ctx.Object()
+	require.NoError(t, collected.SetGoObject(&testFinalizer{"collected", &events}))
+	collected.Free()
+	rt.RunGC()
+	require.EqualValues(t, []string{"collected"}, events)
+
+	// replaced values are not finalized
+	ret, err = ctx.Eval(`resource`)
+	require.NoError(t, err)
+	require.NoError(t, ret.SetInstanceData("c", &testFinalizer{"replaced", &events}))
+	require.NoError(t, ret.SetInstanceData("c", 1))
+	ret.Free()
+
+	ctx.Close()
+	require.EqualValues(t, []string{"collected", "close", "constructed", "constructed a", "constructed b", "wrapped"}, events)
+}
+
+func TestHandleObject(t *testing.T) {
+	rt := quickjs.NewRuntime()
+	defer rt.Close()
+	ctx := rt.NewContext()
+
+	type conn struct{ name string }
+	var released []string
+	finalizer := func(obj interface{}) { released = append(released, obj.(*conn).name) }
+
+	db, err := ctx.NewHandleObject(&conn{"db"}, finalizer)
+	require.NoError(t, err)
+	id := db.Get("id").Int64()
+	ctx.Globals().Set("db", db)
+	ctx.Globals().Set("query", ctx.Function(func(ctx *quickjs.Context, this quickjs.Value, args []quickjs.Value) quickjs.Value {
+		obj, ok := ctx.ResolveHandle(args[0])
+		if !ok {
+			return ctx.ThrowTypeError("not a connection")
+		}
+		return ctx.String("queried " + obj.(*conn).name)
+	}))
+
+	ret, err := ctx.Eval(`db.id = 0; JSON.stringify([Object.keys(db), Object.getPrototypeOf(db), Object.isFrozen(db), db.id > 0, query(db)])`)
+	require.NoError(t, err)
+	require.Equal(t, `[["id","release"],null,true,true,"queried db"]`, ret.String())
+	ret.Free()
+
+	// a forged handle carries the id but not the Go object
+	_, err = ctx.Eval(`query({ id: db.id, release() {} })`)
+	require.ErrorContains(t, err, "not a connection")
+	// nor does a copy of its own properties, nor a Proxy of it
+	_, err = ctx.Eval(`
+		const forged = { id: db.id, release() {} };
+		for (const key of Reflect.ownKeys(db)) Object.defineProperty(forged, key, Object.getOwnPropertyDescriptor(db, key));
+		query(forged)
+	`)
+	require.ErrorContains(t, err, "not a connection")
+	_, err = ctx.Eval(`query(new Proxy(db, { getOwnPropertyDescriptor: (target, key) => Reflect.getOwnPropertyDescriptor(target, key) }))`)
+	require.ErrorContains(t, err, "not a connection")
+	obj, ok := ctx.Resolve(id)
+	require.True(t, ok)
+	require.Equal(t, "db", obj.(*conn).name)
+
+	ret, err = ctx.Eval(`[db.release(), db.release()].join()`)
+	require.NoError(t, err)
+	require.Equal(t, "true,false", ret.String())
+	ret.Free()
+	require.Equal(t, []string{"db"}, released)
+	_, ok = ctx.Resolve(id)
+	require.False(t, ok)
+	_, err = ctx.Eval(`query(db)`)
+	require.ErrorContains(t, err, "not a connection")
+
+	// Go releases handles by id, and the collection of their object releases them too
+	file, err := ctx.NewHandleObject(&conn{"file"}, finalizer)
+	require.NoError(t, err)
+	require.True(t, ctx.ReleaseHandle(file.Get("id").Int64()))
+	require.False(t, ctx.ReleaseHandle(file.Get("id").Int64()))
+	file.Free()
+	collected, err := ctx.NewHandleObject(&conn{"collected"}, finalizer)
+	require.NoError(t, err)
+	collected.Free()
+	rt.RunGC()
+	require.Equal(t, []string{"db", "file", "collected"}, released)
+
+	// the handles alive are released when the context is closed, finalizing the objects implementing Finalizer
+	var events []string
+	kept, err := ctx.NewHandleObject(&testFinalizer{"kept", &events}, nil)
+	require.NoError(t, err)
+	ctx.Globals().Set("kept", kept)
+	ctx.Close()
+	require.Equal(t, []string{"kept"}, events)
+}
+
+func TestHandleStore(t *testing.T) {
+	rt := quickjs.NewRuntime()
+	defer rt.Close()
+	ctx := rt.NewContext()
+	defer ctx.Close()
+
+	// the functions created per request and dropped are orphaned by their collection, until released
+	base := ctx.HandleStats()
+	for i := 0; i < 3; i++ {
+		fn := ctx.NamedFunction("request", 0, func(ctx *quickjs.Context, this quickjs.Value, args []quickjs.Value) quickjs.Value {
+			return ctx.Null()
+		})
+		fn.Free()
+	}
+	async := ctx.AsyncFunction(func(ctx *quickjs.Context, this quickjs.Value, promise quickjs.Value, args []quickjs.Value) quickjs.Value {
+		return promise.Call("resolve", ctx.Null())
+	})
+	rt.RunGC()
+	stats := ctx.HandleStats()
+	require.Equal(t, base.Live[quickjs.HandleFunction], stats.Live[quickjs.HandleFunction])
+	require.Equal(t, 1, stats.Live[quickjs.HandleAsyncFunction])
+	require.Equal(t, 3, stats.Orphaned)
+	require.Equal(t, base.Created+4, stats.Created)
+	require.Equal(t, base.Total()+4, stats.Total())
+	require.Equal(t, []quickjs.HandleInfo{
+		{Kind: quickjs.HandleFunction, Name: "request"},
+		{Kind: quickjs.HandleFunction, Name: "request"},
+		{Kind: quickjs.HandleFunction, Name: "request"},
+	}, ctx.OrphanedHandles())
+	require.Equal(t, 3, ctx.ReleaseOrphanedHandles())
+	require.Empty(t, ctx.OrphanedHandles())
+	require.Equal(t, base.Released+3, ctx.HandleStats().Released)
+	require.Equal(t, "async function", quickjs.HandleAsyncFunction.String())
+
+	// the functions still referenced keep working
+	ctx.Globals().Set("async", async)
+	ret, err := ctx.Eval(`async().then(v => v === null)`)
+	require.NoError(t, err)
+	ret, err = ctx.Await(ret)
+	require.NoError(t, err)
+	require.True(t, ret.Bool())
+	ret.Free()
+}
+
+func TestMaxHandles(t *testing.T) {
+	rt := quickjs.NewRuntime()
+	probe := rt.NewContext()
+	setup := probe.HandleStats().Total()
+	probe.Close()
+	rt.Close()
+
+	// a, h and the release method of h
+	rt = quickjs.NewRuntime(quickjs.WithMaxHandles(setup + 3))
+	defer rt.Close()
+	ctx := rt.NewContext()
+	defer ctx.Close()
+	noop := func(ctx *quickjs.Context, this quickjs.Value, args []quickjs.Value) quickjs.Value { return ctx.Null() }
+
+	ctx.Globals().Set("a", ctx.Function(noop))
+	h, err := ctx.NewHandleObject("conn", nil)
+	require.NoError(t, err)
+	ctx.Globals().Set("h", h)
+
+	fn := ctx.Function(noop)
+	require.True(t, fn.IsException())
+	require.ErrorContains(t, ctx.Exception(), "quickjs: handles limit exceeded")
+	_, err = ctx.NewHandleObject("file", nil)
+	var limitErr *quickjs.LimitError
+	require.ErrorAs(t, err, &limitErr)
+	require.Equal(t, quickjs.LimitHandles, limitErr.Limit)
+
+	// releasing a handle object frees its place, and the orphaned handles are released when the limit is reached
+	ret, err := ctx.Eval(`h.release()`)
+	require.NoError(t, err)
+	ret.Free()
+	fn = ctx.Function(noop)
+	require.False(t, fn.IsException())
+	fn.Free()
+	rt.RunGC()
+	require.Equal(t, 1, ctx.HandleStats().Orphaned)
+	ctx.Globals().Set("b", ctx.Function(noop))
+	require.Equal(t, 0, ctx.HandleStats().Orphaned)
+	require.Equal(t, setup+3, ctx.HandleStats().Total())
+
+	ret, err = ctx.Eval(`a() === null && b() === null`)
+	require.NoError(t, err)
+	require.True(t, ret.Bool())
+	ret.Free()
+}
+
+func TestBindJSClass(t *testing.T) {
+	rt := quickjs.NewRuntime()
+	defer rt.Close()
+	ctx := rt.NewContext()
+	defer ctx.Close()
+
+	ret, err := ctx.Eval(`
+		class Counter {
+			constructor(start) { this.count = start; }
+			add(...values) { for (const v of values) this.count += v; return this.count; }
+			get() { return this.count; }
+			async label(prefix) { return prefix + this.count; }
+			reset() { if (this.count < 0) throw new Error("negative"); this.count = 0; }
+			fail() { throw new Error("failed"); }
+		}
+	`)
+	require.NoError(t, err)
+	ret.Free()
+
+	type counter struct {
+		Add     func(values ...int) int
+		Current func() (int, error) `json:"get"`
+		Label   func(prefix string) (string, error)
+		Reset   func() error
+		Fail    func()
+		Skipped func() `json:"-"`
+		Name    string
+	}
+	var c counter
+	obj, err := ctx.BindJSClass("Counter", &c, 10)
+	require.NoError(t, err)
+	defer obj.Free()
+
+	require.EqualValues(t, 13, c.Add(1, 2))
+	n, err := c.Current()
+	require.NoError(t, err)
+	require.EqualValues(t, 13, n)
+	label, err := c.Label("count: ")
+	require.NoError(t, err)
+	require.EqualValues(t, "count: 13", label)
+	require.NoError(t, c.Reset())
+	require.EqualValues(t, -1, c.Add(-1))
+	require.EqualError(t, c.Reset(), "Error: negative")
+	require.PanicsWithError(t, "Error: failed", func() { c.Fail() })
+	require.Nil(t, c.Skipped)
+
+	var missing struct{ Missing func() }
+	require.EqualError(t, ctx.BindJSObject(obj, &missing), "quickjs: object has no method missing for field Missing")
+	_, err = ctx.BindJSClass("Undefined", &c)
+	require.EqualError(t, err, "quickjs: Undefined is not a class")
+	_, err = ctx.BindJSClass("Counter; throw 1", &c)
+	require.EqualError(t, err, `quickjs: invalid class name "Counter; throw 1"`)
+	var bad struct{ Get func() (int, int) }
+	require.EqualError(t, ctx.BindJSObject(obj, &bad), "quickjs: cannot bind field Get: the second result is not an error")
+}
+
+func TestEventEmitter(t *testing.T) {
+	rt := quickjs.NewRuntime()
+	defer rt.Close()
+	ctx := rt.NewContext()
+	defer ctx.Close()
+
+	emitter, err := ctx.NewEventEmitter()
+	require.NoError(t, err)
+	defer emitter.Free()
+	ctx.Globals().Set("events", emitter.Value())
+
+	var received []string
+	off, err := emitter.On("ping", func(ctx *quickjs.Context, args []quickjs.Value) {
+		received = append(received, "go: "+args[0].String())
+	})
+	require.NoError(t, err)
+
+	ret, err := ctx.Eval(`
+		globalThis.log = [];
+		events.on("config", (config) => log.push("config " + config.name));
+		events.once("config", () => log.push("once"));
+		events.emit("ping", "from js");
+	`)
+	require.NoError(t, err)
+	require.True(t, ret.Bool())
+	ret.Free()
+	require.EqualValues(t, []string{"go: from js"}, received)
+
+	// Go emits are scheduled, from any goroutine
+	done := make(chan error)
+	go func() { done <- emitter.Emit("config", map[string]string{"name": "a"}) }()
+	require.NoError(t, <-done)
+	require.NoError(t, emitter.Emit("config", map[string]string{"name": "b"}))
+	require.NoError(t, emitter.Emit("ping", "from go"))
+	ctx.Loop()
+	ret, err = ctx.Eval(`JSON.stringify(log)`)
+	require.NoError(t, err)
+	require.EqualValues(t, `["config a","once","config b"]`, ret.String())
+	ret.Free()
+	require.EqualValues(t, []string{"go: from js", "go: from go"}, received)
+
+	// listener exceptions are reported as uncaught
+	var uncaught []string
+	ctx.SetUncaughtExceptionHandler(func(err *quickjs.Error) { uncaught = append(uncaught, err.Error()) })
+	ret, err = ctx.Eval(`events.on("fail", () => { throw new Error("listener failed"); })`)
+	require.NoError(t, err)
+	ret.Free()
+	require.NoError(t, emitter.Emit("fail"))
+	ctx.Loop()
+	require.EqualValues(t, []string{"Error: listener failed"}, uncaught)
+
+	off()
+	off()
+	ret, err = ctx.Eval(`events.listenerCount("ping")`)
+	require.NoError(t, err)
+	require.EqualValues(t, 0, ret.Int32())
+	ret.Free()
+
+	// pending emits keep the emitter alive until they run
+	require.NoError(t, emitter.Emit("config", map[string]string{"name": "c"}))
+	emitter.Free()
+	require.Error(t, emitter.Emit("config", nil))
+	ctx.Loop()
+	ret, err = ctx.Eval(`log.length`)
+	require.NoError(t, err)
+	require.EqualValues(t, 4, ret.Int32())
+	ret.Free()
+}
+
+func TestAbortSignal(t *testing.T) {
+	rt := quickjs.NewRuntime()
+	defer rt.Close()
+	ctx := rt.NewContext()
+	defer ctx.Close()
+
+	ret, err := ctx.Eval(`
+		const log = [];
+		const controller = new AbortController();
+		controller.signal.onabort = (e) => log.push("onabort " + e.type);
+		controller.signal.addEventListener("abort", () => log.push("listener " + controller.signal.reason.name));
+		controller.abort();
+		controller.abort();
+		try {
+			controller.signal.throwIfAborted();
+		} catch (e) {
+			log.push("thrown " + e.message);
+		}
+		log.push(AbortSignal.abort("reason").reason);
+		log.push(Object.prototype.toString.call(controller.signal));
+		try {
+			new AbortSignal();
+		} catch (e) {
+			log.push(e.message);
+		}
+		AbortSignal.timeout(1).onabort = (e) => log.push("timeout " + e.target.reason.name);
+		log;
+	`)
+	require.NoError(t, err)
+	ret.Free()
+	ctx.Loop()
+	ret, err = ctx.Eval(`JSON.stringify(log)`)
+	require.NoError(t, err)
+	require.EqualValues(t, `["onabort abort","listener AbortError","thrown This operation was aborted","reason","[object AbortSignal]","Illegal constructor","timeout TimeoutError"]`, ret.String())
+	ret.Free()
+
+	// signals linked to Go contexts
+	goctx, cancel := context.WithCancel(context.Background())
+	signal, err := ctx.NewAbortSignalFromContext(goctx)
+	require.NoError(t, err)
+	ctx.Globals().Set("cancelled", signal)
+	deadline, cancelDeadline := context.WithTimeout(context.Background(), time.Millisecond)
+	defer cancelDeadline()
+	signal, err = ctx.NewAbortSignalFromContext(deadline)
+	require.NoError(t, err)
+	ctx.Globals().Set("expired", signal)
+	signal, err = ctx.NewAbortSignalFromContext(context.Background())
+	require.NoError(t, err)
+	ctx.Globals().Set("background", signal)
+	signal, err = ctx.NewAbortSignalFromContext(goctx)
+	require.NoError(t, err)
+	ctx.Globals().Set("pending", signal)
+
+	ret, err = ctx.Eval(`cancelled.aborted`)
+	require.NoError(t, err)
+	require.False(t, ret.Bool())
+	ret.Free()
+
+	cancel()
+	<-deadline.Done()
+	for ctx.JobQueueStats().Scheduled < 3 {
+		time.Sleep(time.Millisecond)
+	}
+	ctx.Loop()
+	ret, err = ctx.Eval(`JSON.stringify([cancelled.reason.name, cancelled.reason.message, expired.reason.name, background.aborted, pending.aborted])`)
+	require.NoError(t, err)
+	require.EqualValues(t, `["AbortError","context canceled","TimeoutError",false,true]`, ret.String())
+	ret.Free()
+
+	// a Go context done already aborts the signal at once
+	signal, err = ctx.NewAbortSignalFromContext(goctx)
+	require.NoError(t, err)
+	reason := signal.Get("reason")
+	require.EqualValues(t, "AbortError: context canceled", reason.String())
+	reason.Free()
+	signal.Free()
+
+	// a global set by a script before its first use is kept
+	other := rt.NewContext()
+	defer other.Close()
+	ret, err = other.Eval(`AbortSignal = 1; const s = new AbortController().signal; [AbortSignal, typeof s.aborted].join()`)
+	require.NoError(t, err)
+	require.EqualValues(t, "1,boolean", ret.String())
+	ret.Free()
+}
+
+type testStreamCloser struct {
+	strings.Builder
+	closed bool
+}
+
+func (w *testStreamCloser) Close() error {
+	w.closed = true
+	return nil
+}
+
+type testFailingWriter struct{}
+
+func (testFailingWriter) Write(p []byte) (int, error) {
+	return 0, errors.New("disk full")
+}
+
+func TestStreams(t *testing.T) {
+	rt := quickjs.NewRuntime()
+	defer rt.Close()
+	ctx := rt.NewContext()
+	defer ctx.Close()
+
+	// read in chunks with async iteration
+	stream, err := ctx.NewReadableStreamSize(strings.NewReader("hello streams"), 4)
+	require.NoError(t, err)
+	ctx.Globals().Set("input", stream)
+	ret, err := ctx.Eval(`
+		var chunks = [];
+		(async () => {
+			for await (const chunk of input) {
+				chunks.push(String.fromCharCode(...chunk));
+			}
+			chunks.push(input.locked);
+		})();
+	`)
+	require.NoError(t, err)
+	ret.Free()
+	ctx.Loop()
+	ret, err = ctx.Eval(`JSON.stringify(chunks)`)
+	require.NoError(t, err)
+	require.EqualValues(t, `["hell","o st","ream","s",false]`, ret.String())
+	ret.Free()
+
+	// pipe to a writer, which is closed
+	out := &testStreamCloser{}
+	stream, err = ctx.NewReadableStream(strings.NewReader("piped"))
+	require.NoError(t, err)
+	ctx.Globals().Set("source", stream)
+	stream, err = ctx.NewWritableStream(out)
+	require.NoError(t, err)
+	ctx.Globals().Set("sink", stream)
+	ret, err = ctx.Eval(`
+		var piped = false;
+		source.pipeTo(sink).then(async () => {
+			const writer = sink.getWriter();
+			await writer.closed;
+			piped = [Object.prototype.toString.call(sink), writer.desiredSize].join();
+		});
+	`)
+	require.NoError(t, err)
+	ret.Free()
+	ctx.Loop()
+	ret, err = ctx.Eval(`piped`)
+	require.NoError(t, err)
+	require.EqualValues(t, "[object WritableStream],0", ret.String())
+	ret.Free()
+	require.EqualValues(t, "piped", out.String())
+	require.True(t, out.closed)
+
+	// write strings and views, waiting for ready
+	out = &testStreamCloser{}
+	stream, err = ctx.NewWritableStream(out)
+	require.NoError(t, err)
+	ctx.Globals().Set("output", stream)
+	ret, err = ctx.Eval(`
+		(async () => {
+			const writer = output.getWriter();
+			writer.write("a");
+			await writer.ready;
+			await writer.write(new Uint8Array([98, 99, 100]).subarray(1));
+			await writer.close();
+		})();
+	`)
+	require.NoError(t, err)
+	ret.Free()
+	ctx.Loop()
+	require.EqualValues(t, "acd", out.String())
+	require.True(t, out.closed)
+
+	// errors of the writer reject the writes, and cancelling closes the reader
+	closer := &testStreamCloser{}
+	stream, err = ctx.NewWritableStream(testFailingWriter{})
+	require.NoError(t, err)
+	ctx.Globals().Set("failing", stream)
+	stream, err = ctx.NewReadableStream(struct {
+		io.Reader
+		io.Closer
+	}{strings.NewReader("unread"), closer})
+	require.NoError(t, err)
+	ctx.Globals().Set("cancelled", stream)
+	ret, err = ctx.Eval(`
+		var errors = [];
+		(async () => {
+			const writer = failing.getWriter();
+			await writer.write("x").catch((e) => errors.push(e.message));
+			await writer.closed.catch((e) => errors.push("closed " + e.message));
+			await writer.write("y").catch((e) => errors.push("again " + e.message));
+			const reader = cancelled.getReader();
+			await reader.cancel();
+			errors.push(JSON.stringify(await reader.read()));
+		})();
+	`)
+	require.NoError(t, err)
+	ret.Free()
+	ctx.Loop()
+	ret, err = ctx.Eval(`JSON.stringify(errors)`)
+	require.NoError(t, err)
+	require.EqualValues(t, `["disk full","closed disk full","again disk full","{\"done\":true}"]`, ret.String())
+	ret.Free()
+	require.True(t, closer.closed)
+
+	_, err = ctx.NewReadableStreamSize(strings.NewReader(""), 0)
+	require.Error(t, err)
+}
+
+func TestBlob(t *testing.T) {
+	rt := quickjs.NewRuntime()
+	defer rt.Close()
+	ctx := rt.NewContext()
+	defer ctx.Close()
+
+	blob, err := ctx.NewBlob(bytes.NewReader([]byte("héllo blob")), "Text/Plain")
+	require.NoError(t, err)
+	ctx.Globals().Set("blob", blob)
+	modified := time.UnixMilli(1700000000000)
+	file, err := ctx.NewFile(strings.NewReader("a,b\n1,2\n"), "data.csv", "text/csv", modified)
+	require.NoError(t, err)
+	ctx.Globals().Set("file", file)
+
+	ret, err := ctx.Eval(`
+		(async () => {
+			const slice = blob.slice(7, -1, "text/x-slice");
+			const parts = new Blob(["[", slice, new Uint8Array([93]), "]"]);
+			return [
+				blob.size, blob.type, await blob.text(), blob instanceof Blob,
+				slice.size, slice.type, await slice.text(), (await blob.slice(-2).bytes()).join(" "),
+				await parts.text(), (await new Blob().arrayBuffer()).byteLength,
+				file.name, file.type, file.lastModified, file instanceof File, file instanceof Blob, await file.slice(4).text(),
+				Object.prototype.toString.call(file), new File(["x"], "x.txt", { lastModified: 1 }).lastModified,
+			].join("|");
+		})()
+	`, quickjs.EvalAwait(true))
+	require.NoError(t, err)
+	require.EqualValues(t, "11|text/plain|héllo blob|true|3|text/x-slice|blo|111 98|[blo]]|0|data.csv|text/csv|1700000000000|true|true|1,2\n|[object File]|1", ret.String())
+	ret.Free()
+
+	// files of paths are read when the scripts read them
+	path := filepath.Join(t.TempDir(), "note.txt")
+	require.NoError(t, os.WriteFile(path, []byte("on disk"), 0o600))
+	file, err = ctx.NewFileFromPath(path, "text/plain")
+	require.NoError(t, err)
+	ctx.Globals().Set("note", file)
+	ret, err = ctx.Eval(`Promise.all([note.name, note.size, note.text()]).then((r) => r.join())`, quickjs.EvalAwait(true))
+	require.NoError(t, err)
+	require.EqualValues(t, "note.txt,7,on disk", ret.String())
+	ret.Free()
+
+	require.NoError(t, os.Truncate(path, 2))
+	_, err = ctx.Eval(`note.text()`, quickjs.EvalAwait(true))
+	require.ErrorContains(t, err, "unexpected EOF")
+
+	_, err = ctx.NewFileFromPath(t.TempDir(), "")
+	require.Error(t, err)
+}
+
+func TestStorage(t *testing.T) {
+	rt := quickjs.NewRuntime()
+	defer rt.Close()
+	ctx := rt.NewContext()
+	defer ctx.Close()
+
+	store := quickjs.NewMemoryStorage()
+	require.NoError(t, store.Set("theme", "dark"))
+	require.NoError(t, ctx.EnableStorage(store, quickjs.StorageQuota(32)))
+
+	ret, err := ctx.Eval(`
+		const log = [localStorage.getItem("theme"), localStorage.theme, localStorage.getItem("missing"), localStorage.missing];
+		localStorage.setItem("count", 1);
+		localStorage.lang = "fr";
+		log.push(localStorage.length, localStorage.key(0), localStorage.key(9), Object.keys(localStorage).join(), "lang" in localStorage);
+		delete localStorage.lang;
+		localStorage.removeItem("theme");
+		log.push(JSON.stringify(localStorage), String(localStorage));
+		try {
+			localStorage.setItem("big", "x".repeat(32));
+		} catch (e) {
+			log.push(e.name);
+		}
+		sessionStorage.setItem("tab", "1");
+		log.push(sessionStorage.getItem("tab"), localStorage.getItem("tab"));
+		log.join("|");
+	`)
+	require.NoError(t, err)
+	require.EqualValues(t, `dark|dark|||3|count||count,lang,theme|true|{"count":"1"}|[object Storage]|QuotaExceededError|1|`, ret.String())
+	ret.Free()
+	value, ok, _ := store.Get("count")
+	require.True(t, ok)
+	require.EqualValues(t, "1", value)
+
+	// kept by Reset, with the session storage
+	require.NoError(t, ctx.Reset())
+	ret, err = ctx.Eval(`[localStorage.count, sessionStorage.tab].join()`)
+	require.NoError(t, err)
+	require.EqualValues(t, "1,1", ret.String())
+	ret.Free()
+
+	require.NoError(t, ctx.EnableStorage(nil))
+	ret, err = ctx.Eval(`typeof localStorage + typeof sessionStorage`)
+	require.NoError(t, err)
+	require.EqualValues(t, "undefinedundefined", ret.String())
+	ret.Free()
+}
+
+func TestRandomSource(t *testing.T) {
+	next := 0.0
+	rt := quickjs.NewRuntime(quickjs.WithRandomSource(func() float64 {
+		next += 0.25
+		return next
+	}))
+	defer rt.Close()
+	ctx := rt.NewContext()
+	defer ctx.Close()
+
+	ret, err := ctx.Eval(`[Math.random(), Math.random(), Math.random.name].join()`)
+	require.NoError(t, err)
+	require.EqualValues(t, "0.25,0.5,random", ret.String())
+	ret.Free()
+
+	// kept by Reset
+	require.NoError(t, ctx.Reset())
+	ret, err = ctx.Eval(`Math.random()`)
+	require.NoError(t, err)
+	require.EqualValues(t, 0.75, ret.Float64())
+	ret.Free()
+
+	// per context
+	require.NoError(t, ctx.SetRandomSource(quickjs.CryptoRandom))
+	ret, err = ctx.Eval(`Array.from({ length: 100 }, Math.random).every((n) => n >= 0 && n < 1 && n !== 0.75)`)
+	require.NoError(t, err)
+	require.True(t, ret.Bool())
+	ret.Free()
+	require.NoError(t, ctx.SetRandomSource(nil))
+	ret, err = ctx.Eval(`Math.random() < 1`)
+	require.NoError(t, err)
+	require.True(t, ret.Bool())
+	ret.Free()
+	require.EqualValues(t, 0.75, next)
+}
+
+func TestDeterministicMode(t *testing.T) {
+	run := func() string {
+		rt := quickjs.NewRuntime(quickjs.WithDeterministicMode(quickjs.DeterministicMode{Seed: 42, Start: time.UnixMilli(1700000000000)}))
+		defer rt.Close()
+		ctx := rt.NewContext()
+		defer ctx.Close()
+
+		ret, err := ctx.Eval(`
+			var log = [Date.now(), new Date().toISOString(), new Date(0).getTime(), new Date() instanceof Date, Math.random()];
+			setTimeout(() => log.push("b " + performance.now()), 20);
+			setTimeout(() => log.push("a " + performance.now()), 10);
+			setTimeout(() => log.push("c " + performance.now()), 20);
+		`)
+		require.NoError(t, err)
+		ret.Free()
+		ctx.Loop()
+
+		ctx.AdvanceClock(time.Second)
+		require.EqualValues(t, 1700000001020, ctx.Now().UnixMilli())
+		ret, err = ctx.Eval(`new Promise((resolve) => setTimeout(() => resolve(Date.now()), 5000))`, quickjs.EvalAwait(true))
+		require.NoError(t, err)
+		require.EqualValues(t, 1700000006020, ret.Int64())
+		ret.Free()
+
+		ret, err = ctx.Eval(`JSON.stringify(log)`)
+		require.NoError(t, err)
+		defer ret.Free()
+		return ret.String()
+	}
+
+	first := run()
+	require.Contains(t, first, `[1700000000000,"2023-11-14T22:13:20.000Z",0,true,`)
+	require.Contains(t, first, `"a 10","b 20","c 20"]`)
+	require.EqualValues(t, first, run())
+}
+
+func TestQueueMicrotask(t *testing.T) {
+	rt := quickjs.NewRuntime()
+	defer rt.Close()
+	ctx := rt.NewContext()
+	defer ctx.Close()
+
+	var uncaught []string
+	ctx.SetUncaughtExceptionHandler(func(err *quickjs.Error) {
+		uncaught = append(uncaught, err.Cause)
+	})
+	ret, err := ctx.Eval(`
+		var log = [];
+		Promise.resolve().then(() => log.push("promise"));
+		queueMicrotask(() => log.push("microtask"));
+		queueMicrotask(() => { throw new Error("boom"); });
+		queueMicrotask(() => log.push("after"));
+		log.push("sync");
+		try {
+			queueMicrotask(1);
+		} catch (e) {
+			log.push(e.name);
+		}
+	`)
+	require.NoError(t, err)
+	ret.Free()
+	ctx.Loop()
+	ret, err = ctx.Eval(`log.join()`)
+	require.NoError(t, err)
+	require.EqualValues(t, "sync,TypeError,promise,microtask,after", ret.String())
+	ret.Free()
+	require.EqualValues(t, []string{"Error: boom"}, uncaught)
+}
+
+func TestStructuredClone(t *testing.T) {
+	rt := quickjs.NewRuntime()
+	defer rt.Close()
+	ctx := rt.NewContext()
+	defer ctx.Close()
+
+	ret, err := ctx.Eval(`
+		const shared = { n: 1 };
+		const source = {
+			shared, again: shared, list: [1, "two", 3n, null, undefined],
+			date: new Date(5), re: /a+/gi, map: new Map([[shared, new Set([1, 2])]]),
+			bytes: new Uint8Array([1, 2, 3]).subarray(1), error: new RangeError("bad", { cause: shared }),
+			wrapped: Object(false),
+		};
+		source.self = source;
+		const copy = structuredClone(source);
+		[
+			copy !== source, copy.self === copy, copy.shared !== shared, copy.shared === copy.again, copy.shared.n,
+			copy.list.length, typeof copy.list[2], copy.date.getTime(), copy.re.flags, copy.re.source,
+			copy.map.get(copy.shared).has(2), copy.bytes.join("-"), copy.bytes.byteOffset,
+			copy.error instanceof RangeError, copy.error.message, copy.error.cause === copy.shared, copy.wrapped instanceof Boolean,
+		].join();
+	`)
+	require.NoError(t, err)
+	require.EqualValues(t, "true,true,true,true,1,5,bigint,5,gi,a+,true,2-3,1,true,bad,true,true", ret.String())
+	ret.Free()
+
+	ret, err = ctx.Eval(`
+		const errors = [];
+		for (const value of [() => 1, Symbol("s"), Promise.resolve(), new WeakMap()]) {
+			try {
+				structuredClone({ value });
+			} catch (e) {
+				errors.push(e.name);
+			}
+		}
+		const buffer = new Uint8Array([7, 8]).buffer;
+		const moved = structuredClone({ buffer }, { transfer: [buffer] });
+		errors.push(buffer.byteLength, new Uint8Array(moved.buffer).join("-"));
+		errors.join();
+	`)
+	require.NoError(t, err)
+	require.EqualValues(t, "DataCloneError,DataCloneError,DataCloneError,DataCloneError,0,7-8", ret.String())
+	ret.Free()
+}
+
+func TestGlobalFallbackHandler(t *testing.T) {
+	rt := quickjs.NewRuntime()
+	defer rt.Close()
+	ctx := rt.NewContext()
+	defer ctx.Close()
+
+	var asked []string
+	require.NoError(t, ctx.SetGlobalFallbackHandler(func(name string) (*quickjs.Value, bool) {
+		asked = append(asked, name)
+		switch name {
+		case "db":
+			db := ctx.Object()
+			db.Set("name", ctx.String("main"))
+			return &db, true
+		case "dbb":
+			err := ctx.ThrowReferenceError("%s is not defined, did you mean db?", name)
+			return &err, true
+		}
+		return nil, false
+	}))
+
+	ret, err := ctx.Eval(`[db.name, db === globalThis.db, typeof missing, "other" in globalThis, typeof toString].join()`)
+	require.NoError(t, err)
+	require.EqualValues(t, "main,true,undefined,false,function", ret.String())
+	ret.Free()
+	require.EqualValues(t, []string{"db", "missing", "other"}, asked)
+
+	_, err = ctx.Eval(`dbb`)
+	require.ErrorContains(t, err, "ReferenceError: dbb is not defined, did you mean db?")
+
+	// kept by Reset
+	require.NoError(t, ctx.Reset())
+	ret, err = ctx.Eval(`db.name`)
+	require.NoError(t, err)
+	require.EqualValues(t, "main", ret.String())
+	ret.Free()
+
+	require.NoError(t, ctx.SetGlobalFallbackHandler(nil))
+	ret, err = ctx.Eval(`[db.name, typeof other].join()`)
+	require.NoError(t, err)
+	require.EqualValues(t, "main,undefined", ret.String())
+	ret.Free()
+}
+
+func TestLockdown(t *testing.T) {
+	rt := quickjs.NewRuntime()
+	defer rt.Close()
+	ctx := rt.NewContext()
+	defer ctx.Close()
+
+	report, err := ctx.Lockdown(quickjs.LockdownDisableEval(true))
+	require.NoError(t, err)
+	require.Contains(t, report.Intrinsics, "Object")
+	require.Contains(t, report.Intrinsics, "%TypedArray%")
+	require.Contains(t, report.Overridable, "Object.prototype.toString")
+	require.Greater(t, report.Objects, 100)
+	require.True(t, report.EvalDisabled)
+	require.False(t, ctx.EvalEnabled())
+
+	// the prototypes cannot be polluted
+	ret, err := ctx.Eval(`
+		Object.prototype.polluted = true;
+		Array.prototype.push = null;
+		[Object.isFrozen(Object.prototype), Object.isFrozen(Function.prototype), ({}).polluted, typeof [].push].join()
+	`)
+	require.NoError(t, err)
+	require.EqualValues(t, "true,true,,function", ret.String())
+	ret.Free()
+
+	_, err = ctx.Eval(`"use strict"; Object.prototype.toString = null`)
+	require.ErrorContains(t, err, "TypeError")
+	_, err = ctx.Eval(`Function("return 1")`)
+	require.Error(t, err)
+
+	// the overridable properties are still assigned on objects inheriting them
+	ret, err = ctx.Eval(`
+		"use strict";
+		function Point() {}
+		Point.prototype.toString = function () { return "point"; };
+		const e = new Error("failed");
+		e.name = "CustomError";
+		[String(new Point()), e.name, Error.prototype.name, globalThis.answer = 42].join()
+	`)
+	require.NoError(t, err)
+	require.EqualValues(t, "point,CustomError,Error,42", ret.String())
+	ret.Free()
+
+	// kept by Reset
+	require.NoError(t, ctx.Reset())
+	ret, err = ctx.Eval(`Object.isFrozen(Array.prototype)`)
+	require.NoError(t, err)
+	require.True(t, ret.Bool())
+	ret.Free()
+	require.False(t, ctx.EvalEnabled())
+}
+
+func TestPollutionHandler(t *testing.T) {
+	rt := quickjs.NewRuntime()
+	defer rt.Close()
+	ctx := rt.NewContext()
+	defer ctx.Close()
+
+	var attempts []quickjs.Pollution
+	require.NoError(t, ctx.SetPollutionHandler(func(pollution quickjs.Pollution) error {
+		attempts = append(attempts, pollution)
+		if pollution.Property == "isAdmin" {
+			return errors.New("prototype pollution refused")
+		}
+		return nil
+	}))
+
+	// the ordinary assignments are not reported
+	ret, err := ctx.Eval(`
+		class Point { constructor(x) { this.x = x; } }
+		const p = new Point(1);
+		p.y = 2;
+		const arr = [];
+		arr[0] = 1;
+		[p.x, p.y, arr.length, Object.getOwnPropertyDescriptor(p, "y").enumerable].join()
+	`)
+	require.NoError(t, err)
+	require.EqualValues(t, "1,2,1,true", ret.String())
+	ret.Free()
+	require.Empty(t, attempts)
+
+	// the attempts are reported, and refused when the handler returns an error
+	ret, err = ctx.Eval(`
+		const merge = (target, source) => {
+			for (const key of Object.keys(source)) {
+				if (typeof source[key] === "object") {
+					merge(target[key], source[key]);
+				} else {
+					target[key] = source[key];
+				}
+			}
+		};
+		merge({}, JSON.parse('{"__proto__": {"polluted": true}}'));
+		merge({}, JSON.parse('{"constructor": {"prototype": {"tainted": true}}}'));
+		Object.defineProperty(Array.prototype, "last", { value: 1 });
+		Object.setPrototypeOf(Function.prototype, null) === Function.prototype;
+		[({}).polluted, ({}).tainted].join()
+	`)
+	require.NoError(t, err)
+	require.EqualValues(t, "true,true", ret.String())
+	ret.Free()
+	require.Len(t, attempts, 4)
+	require.EqualValues(t, "Object.prototype", attempts[0].Target)
+	require.EqualValues(t, "polluted", attempts[0].Property)
+	require.EqualValues(t, "set", attempts[0].Operation)
+	require.Contains(t, attempts[0].Stack, "merge")
+	require.EqualValues(t, "tainted", attempts[1].Property)
+	require.EqualValues(t, quickjs.Pollution{Target: "Array.prototype", Property: "last", Operation: "defineProperty"}, quickjs.Pollution{Target: attempts[2].Target, Property: attempts[2].Property, Operation: attempts[2].Operation})
+	require.EqualValues(t, "Function.prototype", attempts[3].Target)
+	require.EqualValues(t, "setPrototypeOf", attempts[3].Operation)
+
+	_, err = ctx.Eval(`({}).__proto__.isAdmin = true`)
+	require.ErrorContains(t, err, "prototype pollution refused")
+	ret, err = ctx.Eval(`typeof ({}).isAdmin`)
+	require.NoError(t, err)
+	require.EqualValues(t, "undefined", ret.String())
+	ret.Free()
+
+	// kept by Reset
+	require.NoError(t, ctx.Reset())
+	_, err = ctx.Eval(`Object.prototype.isAdmin = true`)
+	require.ErrorContains(t, err, "prototype pollution refused")
+
+	require.NoError(t, ctx.SetPollutionHandler(nil))
+	ret, err = ctx.Eval(`Object.prototype.isAdmin = true; [Object.getPrototypeOf(Object.prototype), ({}).isAdmin].join()`)
+	require.NoError(t, err)
+	require.EqualValues(t, ",true", ret.String())
+	ret.Free()
+}
+
+func TestRealm(t *testing.T) {
+	rt := quickjs.NewRuntime()
+	defer rt.Close()
+	ctx := rt.NewContext()
+	defer ctx.Close()
+
+	realm, err := ctx.NewRealm()
+	require.NoError(t, err)
+	other, err := ctx.NewRealm()
+	require.NoError(t, err)
+	require.Same(t, ctx, realm.Context())
+
+	// the globals and intrinsics are isolated
+	ret, err := realm.Eval(`var plugin = "a"; Object.prototype.polluted = true; typeof setTimeout`)
+	require.NoError(t, err)
+	require.EqualValues(t, "undefined", ret.String())
+	ret.Free()
+	for _, eval := range []func(string, ...quickjs.EvalOption) (quickjs.Value, error){ctx.Eval, other.Eval} {
+		ret, err = eval(`[typeof plugin, ({}).polluted].join()`)
+		require.NoError(t, err)
+		require.EqualValues(t, "undefined,", ret.String())
+		ret.Free()
+	}
+
+	// the values are shared explicitly
+	config := realm.ParseJSON(`{"name": "plugin"}`)
+	defer config.Free()
+	require.NoError(t, realm.Share("config", config))
+	require.NoError(t, realm.Share("version", ctx.Int32(2)))
+	log := realm.Function("log", 1, func(ctx *quickjs.Context, this quickjs.Value, args []quickjs.Value) quickjs.Value {
+		return ctx.String("logged " + args[0].String())
+	})
+	defer log.Free()
+	require.NoError(t, realm.Share("log", log))
+	ret, err = realm.Eval(`[log(config.name), version, log.constructor === Function, Object.getPrototypeOf(config) === Object.prototype].join()`)
+	require.NoError(t, err)
+	require.EqualValues(t, "logged plugin,2,true,true", ret.String())
+	ret.Free()
+
+	globals := realm.Globals()
+	fn := globals.Get("plugin")
+	require.EqualValues(t, "a", fn.String())
+	fn.Free()
+	globals.Free()
+
+	_, err = realm.Eval(`throw new TypeError("failed")`)
+	require.ErrorContains(t, err, "TypeError: failed")
+
+	// kept by Reset, closed with the context
+	require.NoError(t, ctx.Reset())
+	ret, err = realm.Eval(`plugin`)
+	require.NoError(t, err)
+	require.EqualValues(t, "a", ret.String())
+	ret.Free()
+
+	other.Close()
+	_, err = other.Eval(`1`)
+	require.ErrorIs(t, err, quickjs.ErrRealmClosed)
+}
+
+func TestEvalOrigin(t *testing.T) {
+	var evals, calls, exceptions []string
+	rt := quickjs.NewRuntime(quickjs.WithHooks(&quickjs.Hooks{
+		OnEvalStart: func(info quickjs.EvalInfo) { evals = append(evals, info.Origin) },
+		OnFunctionCall: func(info quickjs.FunctionCallInfo) {
+			calls = append(calls, info.Origin)
+		},
+		OnException: func(ctx *quickjs.Context, err *quickjs.Error) { exceptions = append(exceptions, err.Origin) },
+	}))
+	defer rt.Close()
+	ctx := rt.NewContext()
+	defer ctx.Close()
+
+	nested := ctx.NamedFunction("nested", 0, func(ctx *quickjs.Context, this quickjs.Value, args []quickjs.Value) quickjs.Value {
+		ret, err := ctx.Eval(`1 + 1`)
+		if err != nil {
+			return ctx.ThrowError(err)
+		}
+		return ret
+	})
+	ctx.Globals().Set("nested", nested)
+
+	ret, err := ctx.Eval(`nested()`, quickjs.EvalOrigin("tenant-42"))
+	require.NoError(t, err)
+	require.EqualValues(t, 2, ret.Int32())
+	ret.Free()
+	require.EqualValues(t, []string{"tenant-42", "tenant-42"}, evals)
+	require.EqualValues(t, []string{"tenant-42"}, calls)
+
+	// the errors carry the origin
+	_, err = ctx.Eval(`throw new Error("failed")`, quickjs.EvalOrigin("tenant-7"))
+	var jsErr *quickjs.Error
+	require.ErrorAs(t, err, &jsErr)
+	require.EqualValues(t, "tenant-7", jsErr.Origin)
+	require.EqualValues(t, []string{"tenant-7"}, exceptions)
+
+	_, err = ctx.EvalModule(`throw new Error("failed")`, "plugin", quickjs.EvalOrigin("tenant-8"))
+	var moduleErr *quickjs.ModuleError
+	require.ErrorAs(t, err, &moduleErr)
+	require.EqualValues(t, "tenant-8", moduleErr.Err.Origin)
+
+	_, err = ctx.Eval(`throw new Error("failed")`)
+	require.ErrorAs(t, err, &jsErr)
+	require.Empty(t, jsErr.Origin)
+
+	// the interrupt handler sees the origin of the running code
+	ctx.SetContextInterruptHandler(func(info quickjs.InterruptInfo) int {
+		if info.Origin == "tenant-9" {
+			return 1
+		}
+		return 0
+	})
+	_, err = ctx.Eval(`for (;;) {}`, quickjs.EvalOrigin("tenant-9"))
+	require.ErrorAs(t, err, &jsErr)
+	require.EqualValues(t, "tenant-9", jsErr.Origin)
+	require.ErrorContains(t, err, "interrupted")
+	ret, err = ctx.Eval(`let n = 0; for (let i = 0; i < 100000; i++) n++; n`, quickjs.EvalOrigin("tenant-10"))
+	require.NoError(t, err)
+	ret.Free()
+}
+
+func TestUserData(t *testing.T) {
+	type tenant struct{ name string }
+
+	rt := quickjs.NewRuntime()
+	defer rt.Close()
+	ctx := rt.NewContext()
+	defer ctx.Close()
+	require.Nil(t, ctx.UserData())
+	require.Nil(t, rt.UserData())
+
+	rt.SetUserData("shared")
+	ctx.SetUserData(&tenant{name: "tenant-42"})
+	ctx.Globals().Set("whoami", ctx.Function(func(ctx *quickjs.Context, this quickjs.Value, args []quickjs.Value) quickjs.Value {
+		return ctx.String(ctx.UserData().(*tenant).name + "/" + ctx.Runtime().UserData().(string))
+	}))
+	ret, err := ctx.Eval(`whoami()`)
+	require.NoError(t, err)
+	require.EqualValues(t, "tenant-42/shared", ret.String())
+	ret.Free()
+
+	// kept by Reset
+	require.NoError(t, ctx.Reset())
+	require.EqualValues(t, "tenant-42", ctx.UserData().(*tenant).name)
+}
+
+func TestMaxBridgeDepth(t *testing.T) {
+	rt := quickjs.NewRuntime(quickjs.WithMaxBridgeDepth(10))
+	defer rt.Close()
+	ctx := rt.NewContext()
+	defer ctx.Close()
+
+	depth, deepest := 0, 0
+	ctx.Globals().Set("down", ctx.Function(func(ctx *quickjs.Context, this quickjs.Value, args []quickjs.Value) quickjs.Value {
+		depth++
+		defer func() { depth-- }()
+		if depth > deepest {
+			deepest = depth
+		}
+		return args[0].Call("call", ctx.Undefined())
+	}))
+
+	ret, err := ctx.Eval(`function f() { return down(f) } try { f() } catch (e) { String(e) }`)
+	require.NoError(t, err)
+	require.EqualValues(t, "RangeError: maximum bridge depth of 10 exceeded", ret.String())
+	ret.Free()
+	require.Equal(t, 10, deepest)
+
+	// the depth is released as the calls return
+	rt.SetMaxBridgeDepth(2)
+	ret, err = ctx.Eval(`let n = 0; for (let i = 0; i < 5; i++) down(() => n++); n`)
+	require.NoError(t, err)
+	require.EqualValues(t, 5, ret.Int32())
+	ret.Free()
+}
+
+func TestValueMigrate(t *testing.T) {
+	rt := quickjs.NewRuntime()
+	defer rt.Close()
+	ctx := rt.NewContext()
+	defer ctx.Close()
+	src := rt.NewContext()
+
+	// a value outlives its context once migrated
+	obj, err := src.Eval(`({ name: "shared" })`)
+	require.NoError(t, err)
+	migrated, err := obj.Migrate(ctx)
+	require.NoError(t, err)
+	obj.Free()
+	src.Close()
+	name := migrated.Get("name")
+	require.EqualValues(t, "shared", name.String())
+	name.Free()
+
+	_, err = obj.Migrate(ctx)
+	require.ErrorIs(t, err, quickjs.ErrForeignValue)
+
+	// the values of another runtime are refused
+	otherRt := quickjs.NewRuntime()
+	defer otherRt.Close()
+	other := otherRt.NewContext()
+	defer other.Close()
+	_, err = migrated.Migrate(other)
+	require.ErrorIs(t, err, quickjs.ErrForeignValue)
+
+	fn, err := other.Eval(`(function (v) { return v })`)
+	require.NoError(t, err)
+	defer fn.Free()
+	ret := other.Invoke(fn, other.Null(), *migrated)
+	require.True(t, ret.IsException())
+	require.ErrorContains(t, other.Exception(), quickjs.ErrForeignValue.Error())
+
+	holder := other.Object()
+	defer holder.Free()
+	require.ErrorIs(t, holder.SetPath("value", migrated.Get("name")), quickjs.ErrForeignValue)
+	holder.Set("value", ctx.String("dropped"))
+	require.False(t, holder.Has("value"))
+
+	migrated.Free()
+}
@@ -0,0 +1,159 @@
+// Package quickjstrace creates tracing spans around the evaluations, compilations and host function calls of a quickjs runtime.
+//
+// It depends on no tracing library: Tracer and Span are small enough to be implemented over an OpenTelemetry
+// trace.Tracer in a few lines, starting spans with trace.WithTimestamp and linking them to their parent
+// with trace.ContextWithSpan.
+package quickjstrace
+
+import (
+	"sync"
+	"time"
+
+	"github.com/buke/quickjs-go"
+)
+
+// Span names.
+const (
+	SpanEval    = "quickjs.eval"
+	SpanCompile = "quickjs.compile"
+	SpanCall    = "quickjs.call"
+)
+
+// Attribute keys.
+const (
+	AttrScript      = "quickjs.script"
+	AttrFunction    = "quickjs.function"
+	AttrArgs        = "quickjs.args"
+	AttrCacheHit    = "quickjs.bytecode_cache.hit"
+	AttrMemoryDelta = "quickjs.memory.delta"
+	AttrException   = "quickjs.exception"
+)
+
+// Attribute is a key-value pair annotating a span; values are strings, ints, int64s or bools.
+type Attribute struct {
+	Key   string
+	Value interface{}
+}
+
+// Tracer starts spans.
+type Tracer interface {
+	// Start starts a span at the given time, as a child of parent, or as a root span if parent is nil.
+	Start(name string, parent Span, start time.Time) Span
+}
+
+// Span is a span started by a Tracer.
+type Span interface {
+	SetAttributes(attrs ...Attribute)
+	RecordError(err error)
+	// End ends the span at the given time.
+	End(end time.Time)
+}
+
+type Options struct {
+	memoryDelta bool
+}
+
+type Option func(*Options)
+
+// WithMemoryDelta will annotate the eval and compile spans with the change of the runtime's memory usage;
+// default is false, as computing the memory usage walks the whole heap.
+func WithMemoryDelta(enabled bool) Option {
+	return func(o *Options) {
+		o.memoryDelta = enabled
+	}
+}
+
+// openSpan is an eval or compile span waiting for its end.
+type openSpan struct {
+	span   Span
+	memory int64
+}
+
+type tracer struct {
+	tracer  Tracer
+	options *Options
+
+	mu sync.Mutex
+	// open are the eval spans of each context, innermost last, as evaluations nest through host functions.
+	open map[*quickjs.Context][]openSpan
+}
+
+// Hooks returns the runtime hooks tracing with the tracer, to be set with quickjs.WithHooks or Runtime.SetHooks.
+// Eval and compile spans are nested as their calls are; host function spans are children of the innermost eval span.
+func Hooks(t Tracer, opts ...Option) *quickjs.Hooks {
+	options := &Options{}
+	for _, opt := range opts {
+		opt(options)
+	}
+	tr := &tracer{tracer: t, options: options, open: make(map[*quickjs.Context][]openSpan)}
+	return &quickjs.Hooks{
+		OnEvalStart:    tr.evalStart,
+		OnEvalEnd:      tr.evalEnd,
+		OnFunctionCall: tr.functionCall,
+	}
+}
+
+// parent returns the innermost open span of the context, or nil. It must be called with the lock held.
+func (t *tracer) parent(ctx *quickjs.Context) Span {
+	if stack := t.open[ctx]; len(stack) > 0 {
+		return stack[len(stack)-1].span
+	}
+	return nil
+}
+
+func (t *tracer) evalStart(info quickjs.EvalInfo) {
+	name := SpanEval
+	if info.Compile {
+		name = SpanCompile
+	}
+	var memory int64
+	if t.options.memoryDelta {
+		memory = info.Context.Runtime().MemoryUsage().MemoryUsedSize
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	span := t.tracer.Start(name, t.parent(info.Context), time.Now())
+	span.SetAttributes(Attribute{Key: AttrScript, Value: info.Filename})
+	t.open[info.Context] = append(t.open[info.Context], openSpan{span: span, memory: memory})
+}
+
+func (t *tracer) evalEnd(info quickjs.EvalInfo) {
+	t.mu.Lock()
+	stack := t.open[info.Context]
+	if len(stack) == 0 {
+		t.mu.Unlock()
+		return
+	}
+	open := stack[len(stack)-1]
+	if len(stack) == 1 {
+		delete(t.open, info.Context)
+	} else {
+		t.open[info.Context] = stack[:len(stack)-1]
+	}
+	t.mu.Unlock()
+
+	open.span.SetAttributes(Attribute{Key: AttrCacheHit, Value: info.CacheHit}, Attribute{Key: AttrException, Value: info.Err != nil})
+	if t.options.memoryDelta {
+		delta := info.Context.Runtime().MemoryUsage().MemoryUsedSize - open.memory
+		open.span.SetAttributes(Attribute{Key: AttrMemoryDelta, Value: delta})
+	}
+	if info.Err != nil {
+		open.span.RecordError(info.Err)
+	}
+	open.span.End(time.Now())
+}
+
+func (t *tracer) functionCall(info quickjs.FunctionCallInfo) {
+	end := time.Now()
+	t.mu.Lock()
+	span := t.tracer.Start(SpanCall, t.parent(info.Context), end.Add(-info.Duration))
+	t.mu.Unlock()
+
+	span.SetAttributes(
+		Attribute{Key: AttrFunction, Value: info.Name},
+		Attribute{Key: AttrArgs, Value: info.Args},
+		Attribute{Key: AttrException, Value: info.Exception},
+	)
+	span.End(end)
+}
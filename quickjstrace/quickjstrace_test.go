@@ -0,0 +1,113 @@
+package quickjstrace_test
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/buke/quickjs-go"
+	"github.com/buke/quickjs-go/quickjstrace"
+	"github.com/stretchr/testify/require"
+)
+
+type testSpan struct {
+	name   string
+	parent *testSpan
+	attrs  map[string]interface{}
+	err    error
+	start  time.Time
+	end    time.Time
+}
+
+func (s *testSpan) SetAttributes(attrs ...quickjstrace.Attribute) {
+	for _, attr := range attrs {
+		s.attrs[attr.Key] = attr.Value
+	}
+}
+
+func (s *testSpan) RecordError(err error) { s.err = err }
+
+func (s *testSpan) End(end time.Time) { s.end = end }
+
+// String describes the span with its parent and sorted attributes, leaving out the timings.
+func (s *testSpan) String() string {
+	keys := make([]string, 0, len(s.attrs))
+	for key := range s.attrs {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	parts := []string{s.name}
+	if s.parent != nil {
+		parts = append(parts, "parent="+s.parent.name+":"+fmt.Sprint(s.parent.attrs[quickjstrace.AttrScript]))
+	}
+	for _, key := range keys {
+		if key != quickjstrace.AttrMemoryDelta {
+			parts = append(parts, fmt.Sprintf("%s=%v", key, s.attrs[key]))
+		}
+	}
+	return strings.Join(parts, " ")
+}
+
+type testTracer struct {
+	spans []*testSpan
+}
+
+func (t *testTracer) Start(name string, parent quickjstrace.Span, start time.Time) quickjstrace.Span {
+	span := &testSpan{name: name, attrs: map[string]interface{}{}, start: start}
+	if parent != nil {
+		span.parent = parent.(*testSpan)
+	}
+	t.spans = append(t.spans, span)
+	return span
+}
+
+func TestHooks(t *testing.T) {
+	tracer := &testTracer{}
+	rt := quickjs.NewRuntime(
+		quickjs.WithHooks(quickjstrace.Hooks(tracer, quickjstrace.WithMemoryDelta(true))),
+		quickjs.WithBytecodeCache(quickjs.NewMemoryBytecodeCache()),
+	)
+	defer rt.Close()
+	ctx := rt.NewContext()
+	defer ctx.Close()
+
+	ctx.Globals().Set("load", ctx.Function(func(ctx *quickjs.Context, this quickjs.Value, args []quickjs.Value) quickjs.Value {
+		ret, err := ctx.Eval(`[1, 2, 3]`, quickjs.EvalFileName("data.js"))
+		if err != nil {
+			return ctx.ThrowError(err)
+		}
+		return ret
+	}))
+
+	for i := 0; i < 2; i++ {
+		ret, err := ctx.Eval(`load().length`, quickjs.EvalFileName("main.js"))
+		require.NoError(t, err)
+		ret.Free()
+	}
+	_, err := ctx.Compile(`1 + 1`, quickjs.EvalFileName("lib.js"))
+	require.NoError(t, err)
+	_, err = ctx.Eval(`throw new Error("boom")`, quickjs.EvalFileName("bad.js"))
+	require.Error(t, err)
+
+	var got []string
+	for _, span := range tracer.spans {
+		require.False(t, span.end.IsZero(), span.name)
+		require.False(t, span.end.Before(span.start), span.name)
+		require.Contains(t, span.attrs, quickjstrace.AttrException)
+		got = append(got, span.String())
+	}
+	require.Equal(t, []string{
+		"quickjs.eval quickjs.bytecode_cache.hit=false quickjs.exception=false quickjs.script=main.js",
+		"quickjs.eval parent=quickjs.eval:main.js quickjs.bytecode_cache.hit=false quickjs.exception=false quickjs.script=data.js",
+		"quickjs.call parent=quickjs.eval:main.js quickjs.args=0 quickjs.exception=false quickjs.function=",
+		"quickjs.eval quickjs.bytecode_cache.hit=true quickjs.exception=false quickjs.script=main.js",
+		"quickjs.eval parent=quickjs.eval:main.js quickjs.bytecode_cache.hit=true quickjs.exception=false quickjs.script=data.js",
+		"quickjs.call parent=quickjs.eval:main.js quickjs.args=0 quickjs.exception=false quickjs.function=",
+		"quickjs.compile quickjs.bytecode_cache.hit=false quickjs.exception=false quickjs.script=lib.js",
+		"quickjs.eval quickjs.bytecode_cache.hit=false quickjs.exception=true quickjs.script=bad.js",
+	}, got)
+	require.EqualError(t, tracer.spans[7].err, "Error: boom")
+	require.Contains(t, tracer.spans[0].attrs, quickjstrace.AttrMemoryDelta)
+}
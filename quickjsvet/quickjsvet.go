@@ -0,0 +1,294 @@
+// Package quickjsvet reports misuses of the ownership of quickjs values in Go source code, in the manner of go vet:
+// freeing a value twice, and freeing or using a value whose ownership was given to a method such as Set.
+//
+// The checks are syntactic: they follow the local variables of each function by name, in the order of the statements,
+// without type information. The events of a nested block are forgotten when it ends, since it may return early,
+// so the checker misses some misuses and, rarely, reports a method of the same name of another type.
+// For a check at run time, see quickjs.WithFreeCheck.
+package quickjsvet
+
+import (
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// Owners maps the methods taking ownership of a value to the index of the argument they take.
+var Owners = map[string]int{
+	"Set":     1,
+	"SetIdx":  1,
+	"SetAtom": 1,
+	"SetPath": 1,
+	"Throw":   0,
+	"Await":   0,
+}
+
+// Diagnostic is a misuse found in the source.
+type Diagnostic struct {
+	Pos     token.Position
+	Message string
+}
+
+// String returns the diagnostic in the format of go vet, file:line:column: message.
+func (d Diagnostic) String() string {
+	return fmt.Sprintf("%s: %s", d.Pos, d.Message)
+}
+
+// CheckFile returns the misuses in the file.
+func CheckFile(fset *token.FileSet, file *ast.File) []Diagnostic {
+	c := &checker{fset: fset}
+	for _, decl := range file.Decls {
+		if fn, ok := decl.(*ast.FuncDecl); ok && fn.Body != nil {
+			c.function(fn.Body)
+		}
+	}
+	sortDiagnostics(c.diags)
+	return c.diags
+}
+
+// CheckDir parses the Go files of the directory, including its tests, and returns their misuses.
+func CheckDir(dir string) ([]Diagnostic, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	fset := token.NewFileSet()
+	var diags []Diagnostic
+	for _, entry := range entries {
+		if entry.IsDir() || !strings.HasSuffix(entry.Name(), ".go") {
+			continue
+		}
+		file, err := parser.ParseFile(fset, filepath.Join(dir, entry.Name()), nil, 0)
+		if err != nil {
+			return nil, err
+		}
+		diags = append(diags, CheckFile(fset, file)...)
+	}
+	sortDiagnostics(diags)
+	return diags, nil
+}
+
+func sortDiagnostics(diags []Diagnostic) {
+	sort.SliceStable(diags, func(i, j int) bool {
+		if diags[i].Pos.Filename != diags[j].Pos.Filename {
+			return diags[i].Pos.Filename < diags[j].Pos.Filename
+		}
+		return diags[i].Pos.Offset < diags[j].Pos.Offset
+	})
+}
+
+// variable is what happened to a local variable holding a value.
+type variable struct {
+	freed    token.Pos // an explicit Free
+	deferred token.Pos // a deferred Free
+	given    token.Pos // a call taking its ownership
+	givenTo  string
+}
+
+// scope maps the names of the variables to their events; a nested block works on a copy.
+type scope map[string]variable
+
+func (s scope) copy() scope {
+	c := make(scope, len(s))
+	for name, v := range s {
+		c[name] = v
+	}
+	return c
+}
+
+type checker struct {
+	fset  *token.FileSet
+	diags []Diagnostic
+}
+
+func (c *checker) report(pos token.Pos, format string, args ...interface{}) {
+	c.diags = append(c.diags, Diagnostic{Pos: c.fset.Position(pos), Message: fmt.Sprintf(format, args...)})
+}
+
+// line returns the line of the position, to refer to an earlier event.
+func (c *checker) line(pos token.Pos) string {
+	return fmt.Sprintf("line %d", c.fset.Position(pos).Line)
+}
+
+// function checks the body of a function with its own variables.
+func (c *checker) function(body *ast.BlockStmt) {
+	c.block(body.List, scope{})
+}
+
+func (c *checker) block(list []ast.Stmt, s scope) {
+	for _, stmt := range list {
+		c.stmt(stmt, s)
+	}
+}
+
+func (c *checker) stmt(stmt ast.Stmt, s scope) {
+	switch stmt := stmt.(type) {
+	case nil:
+	case *ast.BlockStmt:
+		c.block(stmt.List, s.copy())
+	case *ast.IfStmt:
+		c.stmt(stmt.Init, s)
+		c.expr(stmt.Cond, s)
+		c.block(stmt.Body.List, s.copy())
+		c.stmt(stmt.Else, s.copy())
+	case *ast.ForStmt:
+		c.stmt(stmt.Init, s)
+		c.expr(stmt.Cond, s)
+		body := s.copy()
+		c.block(stmt.Body.List, body)
+		c.stmt(stmt.Post, body)
+	case *ast.RangeStmt:
+		c.expr(stmt.X, s)
+		c.block(stmt.Body.List, s.copy())
+	case *ast.SwitchStmt:
+		c.stmt(stmt.Init, s)
+		c.expr(stmt.Tag, s)
+		c.clauses(stmt.Body, s)
+	case *ast.TypeSwitchStmt:
+		c.stmt(stmt.Init, s)
+		c.stmt(stmt.Assign, s)
+		c.clauses(stmt.Body, s)
+	case *ast.SelectStmt:
+		c.clauses(stmt.Body, s)
+	case *ast.LabeledStmt:
+		c.stmt(stmt.Stmt, s)
+	case *ast.DeferStmt:
+		if name, ok := freeCall(stmt.Call); ok {
+			c.deferFree(name, stmt.Pos(), s)
+			return
+		}
+		c.expr(stmt.Call, s)
+	case *ast.AssignStmt:
+		for _, rhs := range stmt.Rhs {
+			c.expr(rhs, s)
+		}
+		for _, lhs := range stmt.Lhs {
+			if ident, ok := lhs.(*ast.Ident); ok {
+				delete(s, ident.Name)
+			}
+		}
+	case *ast.DeclStmt:
+		c.expr(stmt, s)
+		if decl, ok := stmt.Decl.(*ast.GenDecl); ok {
+			for _, spec := range decl.Specs {
+				if spec, ok := spec.(*ast.ValueSpec); ok {
+					for _, ident := range spec.Names {
+						delete(s, ident.Name)
+					}
+				}
+			}
+		}
+	default:
+		c.expr(stmt, s)
+	}
+}
+
+// clauses checks the clauses of a switch or select statement, each in a copy of the scope.
+func (c *checker) clauses(body *ast.BlockStmt, s scope) {
+	for _, clause := range body.List {
+		switch clause := clause.(type) {
+		case *ast.CaseClause:
+			for _, expr := range clause.List {
+				c.expr(expr, s)
+			}
+			c.block(clause.Body, s.copy())
+		case *ast.CommClause:
+			nested := s.copy()
+			c.stmt(clause.Comm, nested)
+			c.block(clause.Body, nested)
+		}
+	}
+}
+
+// expr checks the calls of the node in source order; the function literals are checked as functions of their own.
+func (c *checker) expr(node ast.Node, s scope) {
+	if node == nil {
+		return
+	}
+	ast.Inspect(node, func(n ast.Node) bool {
+		switch n := n.(type) {
+		case *ast.FuncLit:
+			c.function(n.Body)
+			return false
+		case *ast.CallExpr:
+			c.call(n, s)
+		}
+		return true
+	})
+}
+
+func (c *checker) call(call *ast.CallExpr, s scope) {
+	if name, ok := freeCall(call); ok {
+		c.free(name, call.Pos(), s)
+		return
+	}
+	sel, ok := call.Fun.(*ast.SelectorExpr)
+	if !ok {
+		return
+	}
+	idx, ok := Owners[sel.Sel.Name]
+	if !ok || idx >= len(call.Args) {
+		return
+	}
+	arg, ok := call.Args[idx].(*ast.Ident)
+	if !ok {
+		return
+	}
+	name, method, v := arg.Name, sel.Sel.Name, s[arg.Name]
+	switch {
+	case v.freed.IsValid():
+		c.report(arg.Pos(), "%s is given to %s after it was freed at %s", name, method, c.line(v.freed))
+	case v.given.IsValid():
+		c.report(arg.Pos(), "%s is given to %s after %s took its ownership at %s; give %s.Dup() instead", name, method, v.givenTo, c.line(v.given), name)
+	case v.deferred.IsValid():
+		c.report(arg.Pos(), "%s is given to %s, which takes its ownership, but the deferred Free at %s frees it too; give %s.Dup() instead", name, method, c.line(v.deferred), name)
+	}
+	v.given, v.givenTo = arg.Pos(), method
+	s[name] = v
+}
+
+func (c *checker) free(name string, pos token.Pos, s scope) {
+	v := s[name]
+	switch {
+	case v.given.IsValid():
+		c.report(pos, "%s is freed after %s took its ownership at %s", name, v.givenTo, c.line(v.given))
+	case v.freed.IsValid():
+		c.report(pos, "%s is freed twice, first at %s", name, c.line(v.freed))
+	case v.deferred.IsValid():
+		c.report(pos, "%s is freed, but the deferred Free at %s frees it too", name, c.line(v.deferred))
+	}
+	v.freed = pos
+	s[name] = v
+}
+
+func (c *checker) deferFree(name string, pos token.Pos, s scope) {
+	v := s[name]
+	switch {
+	case v.given.IsValid():
+		c.report(pos, "%s is freed by a deferred Free after %s took its ownership at %s", name, v.givenTo, c.line(v.given))
+	case v.freed.IsValid():
+		c.report(pos, "%s is freed by a deferred Free after it was freed at %s", name, c.line(v.freed))
+	case v.deferred.IsValid():
+		c.report(pos, "%s is freed twice by deferred Frees, first at %s", name, c.line(v.deferred))
+	}
+	v.deferred = pos
+	s[name] = v
+}
+
+// freeCall returns the name of the variable freed by the call, if it is a call of Free on a variable.
+func freeCall(call *ast.CallExpr) (string, bool) {
+	sel, ok := call.Fun.(*ast.SelectorExpr)
+	if !ok || sel.Sel.Name != "Free" || len(call.Args) != 0 {
+		return "", false
+	}
+	ident, ok := sel.X.(*ast.Ident)
+	if !ok {
+		return "", false
+	}
+	return ident.Name, true
+}
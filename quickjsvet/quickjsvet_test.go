@@ -0,0 +1,105 @@
+package quickjsvet_test
+
+import (
+	"go/parser"
+	"go/token"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/buke/quickjs-go/quickjsvet"
+	"github.com/stretchr/testify/require"
+)
+
+const source = `package example
+
+import "github.com/buke/quickjs-go"
+
+func deferredThenSet(ctx *quickjs.Context) {
+	config := ctx.Object()
+	defer config.Free()
+	ctx.Globals().Set("config", config)
+}
+
+func freedTwice(ctx *quickjs.Context) {
+	val := ctx.Object()
+	val.Free()
+	val.Free()
+}
+
+func freedAfterSetIdx(ctx *quickjs.Context, arr quickjs.Value) {
+	val := ctx.Object()
+	arr.SetIdx(0, val)
+	val.Free()
+}
+
+func givenTwice(ctx *quickjs.Context, obj quickjs.Value) {
+	val := ctx.Object()
+	obj.Set("a", val)
+	obj.Set("b", val)
+}
+
+func closure(ctx *quickjs.Context) {
+	fn := func() {
+		val := ctx.Object()
+		defer val.Free()
+		ctx.Throw(val)
+	}
+	fn()
+}
+
+func dup(ctx *quickjs.Context) {
+	config := ctx.Object()
+	defer config.Free()
+	ctx.Globals().Set("config", config.Dup())
+}
+
+func earlyReturn(ctx *quickjs.Context, ok bool) {
+	val := ctx.Object()
+	if !ok {
+		val.Free()
+		return
+	}
+	val.Free()
+}
+
+func reassigned(ctx *quickjs.Context, obj quickjs.Value) {
+	val := ctx.Object()
+	obj.Set("a", val)
+	val = ctx.Object()
+	val.Free()
+}
+`
+
+func TestCheckFile(t *testing.T) {
+	fset := token.NewFileSet()
+	file, err := parser.ParseFile(fset, "example.go", source, 0)
+	require.NoError(t, err)
+
+	var got []string
+	for _, diag := range quickjsvet.CheckFile(fset, file) {
+		got = append(got, diag.String())
+	}
+	require.Equal(t, []string{
+		"example.go:8:30: config is given to Set, which takes its ownership, but the deferred Free at line 7 frees it too; give config.Dup() instead",
+		"example.go:14:2: val is freed twice, first at line 13",
+		"example.go:20:2: val is freed after SetIdx took its ownership at line 19",
+		"example.go:26:15: val is given to Set after Set took its ownership at line 25; give val.Dup() instead",
+		"example.go:33:13: val is given to Throw, which takes its ownership, but the deferred Free at line 32 frees it too; give val.Dup() instead",
+	}, got)
+}
+
+func TestCheckDir(t *testing.T) {
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "example.go"), []byte(source), 0o644))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "README.md"), []byte("# example"), 0o644))
+
+	diags, err := quickjsvet.CheckDir(dir)
+	require.NoError(t, err)
+	require.Len(t, diags, 5)
+	require.Equal(t, filepath.Join(dir, "example.go"), diags[0].Pos.Filename)
+
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "broken.go"), []byte("package"), 0o644))
+	_, err = quickjsvet.CheckDir(dir)
+	require.Error(t, err)
+}
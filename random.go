@@ -0,0 +1,68 @@
+package quickjs
+
+import (
+	"crypto/rand"
+	"encoding/binary"
+)
+
+// WithRandomSource will make Math.random of the runtime's contexts return the numbers of the source, which must be in [0, 1);
+// default is nil, which keeps the engine's generator. A seeded generator, e.g. rand.New(rand.NewSource(seed)).Float64
+// of math/rand, makes the scripts replayable, and CryptoRandom suits security-sensitive scripts. See Context.SetRandomSource.
+func WithRandomSource(source func() float64) Option {
+	return func(o *Options) {
+		o.randomSource = source
+	}
+}
+
+// CryptoRandom returns a number in [0, 1) of 53 random bits read from crypto/rand, for WithRandomSource.
+func CryptoRandom() float64 {
+	var b [8]byte
+	if _, err := rand.Read(b[:]); err != nil {
+		panic(err)
+	}
+	return float64(binary.BigEndian.Uint64(b[:])>>11) / (1 << 53)
+}
+
+// randomScript returns the function installing a source of Math.random, or restoring the engine's one for null.
+const randomScript = `(() => {
+	const original = Math.random;
+	return (source) => {
+		const random = source ? function random() {
+			return source();
+		} : original;
+		Object.defineProperty(Math, "random", { value: random, writable: true, configurable: true });
+	};
+})()`
+
+// SetRandomSource makes Math.random of the context return the numbers of the source, like WithRandomSource for this context only;
+// use nil to restore the engine's generator. The source is called on the goroutine of the context and is kept by Reset.
+func (ctx *Context) SetRandomSource(source func() float64) error {
+	if ctx.randomInstaller == nil {
+		if source == nil {
+			ctx.randomSource = nil
+			return nil
+		}
+		installer, err := ctx.eval(randomScript, EvalFileName("<random>"))
+		if err != nil {
+			return err
+		}
+		installer.keep()
+		ctx.randomInstaller = &installer
+	}
+
+	fn := ctx.Null()
+	if source != nil {
+		fn = ctx.NamedFunction("source", 0, func(ctx *Context, this Value, args []Value) Value {
+			return ctx.Float64(source())
+		})
+	}
+	defer fn.Free()
+
+	ret := ctx.Invoke(*ctx.randomInstaller, ctx.Null(), fn)
+	defer ret.Free()
+	if ret.IsException() {
+		return ctx.exceptionError()
+	}
+	ctx.randomSource = source
+	return nil
+}
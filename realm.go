@@ -0,0 +1,146 @@
+package quickjs
+
+/*
+#include "bridge.h"
+*/
+import "C"
+import (
+	"errors"
+	"unsafe"
+)
+
+// ErrRealmClosed is the error of evaluating code in a closed realm.
+var ErrRealmClosed = errors.New("quickjs: realm closed")
+
+// Realm is a global environment of its own within a Context: its scripts have their own global object and intrinsics,
+// e.g. their own Object.prototype, so they cannot see nor pollute the globals of the context or of the other realms.
+// Its values are values of the context, freed like them; the methods of a closed realm returning values return the exception of ErrRealmClosed.
+type Realm struct {
+	ctx *Context
+	ref *C.JSContext
+}
+
+// NewRealm returns a new realm of the context, sharing its runtime, e.g. to isolate plugins more cheaply than with a context each:
+// a realm only has the standard intrinsics, not the globals, modules and settings the package adds to contexts, such as setTimeout,
+// the std and os modules, the locale or Lockdown. The scripts of the realm and of the context only share the values shared explicitly,
+// see Share. The realm is closed with the context, and kept by Reset.
+func (ctx *Context) NewRealm() (*Realm, error) {
+	if err := ctx.checkGoroutine(); err != nil {
+		return nil, err
+	}
+	ref := C.JS_NewContext(ctx.runtime.ref)
+	if ref == nil {
+		return nil, errors.New("quickjs: cannot create realm")
+	}
+	addFeatures(ref, ctx.runtime.options.features)
+	// the promise rejections and uncaught exceptions of the realm are reported as the context's
+	C.SetContextHandle(ref, C.uintptr_t(ctx.handle))
+
+	r := &Realm{ctx: ctx, ref: ref}
+	if ctx.realms == nil {
+		ctx.realms = make(map[*Realm]struct{})
+	}
+	ctx.realms[r] = struct{}{}
+	return r, nil
+}
+
+// Context returns the context of the realm.
+func (r *Realm) Context() *Context {
+	return r.ctx
+}
+
+// Eval evaluates the code in the realm, like Context.Eval; the hooks of the runtime observe it as an evaluation of the context.
+func (r *Realm) Eval(code string, opts ...EvalOption) (val Value, err error) {
+	ctx := r.ctx
+	if t := ctx.runtime.thread; t.remote() {
+		t.do(func() { val, err = r.Eval(code, opts...) })
+		return val, err
+	}
+	if err := ctx.checkGoroutine(); err != nil {
+		return ctx.Undefined(), err
+	}
+	if r.ref == nil {
+		return ctx.Undefined(), ErrRealmClosed
+	}
+	opts = ctx.strictOptions(opts)
+	options := newEvalOptions(opts)
+	info := EvalInfo{Context: ctx, Filename: options.filename, Origin: ctx.originOf(options), Compile: options.flags()&C.JS_EVAL_FLAG_COMPILE_ONLY != 0}
+	return observeEval(info, func(info *EvalInfo) (Value, error) {
+		return ctx.evalIn(r.ref, code, nil, opts...)
+	})
+}
+
+// Globals returns the global object of the realm.
+func (r *Realm) Globals() Value {
+	if r.ref == nil {
+		return r.ctx.ThrowError(ErrRealmClosed)
+	}
+	return r.ctx.newValue(C.JS_GetGlobalObject(r.ref))
+}
+
+// Share defines the global of the name in the realm as the value, which the realm then shares with its owner; it does not take ownership
+// of the value. An object or function shares its prototype chain too, so through its constructor the realm reaches the Function constructor
+// of the realm which created it, and its global object: to keep the realm isolated, share primitives, the data copied by ParseJSON
+// and the functions of Function, or wrap the objects of the context in functions of the realm.
+func (r *Realm) Share(name string, val Value) error {
+	if r.ref == nil {
+		return ErrRealmClosed
+	}
+	namePtr := C.CString(name)
+	defer C.free(unsafe.Pointer(namePtr))
+
+	global := C.JS_GetGlobalObject(r.ref)
+	defer C.JS_FreeValue(r.ref, global)
+	if C.JS_DefinePropertyValueStr(r.ref, global, namePtr, C.JS_DupValue(r.ref, val.ref), C.JS_PROP_C_W_E) < 0 {
+		return r.ctx.exceptionError()
+	}
+	return nil
+}
+
+// Function returns a function of the realm calling fn, like Context.NamedFunction; its prototype chain is the one of the functions of the realm.
+func (r *Realm) Function(name string, length int, fn func(ctx *Context, this Value, args []Value) Value) Value {
+	ctx := r.ctx
+	if r.ref == nil {
+		return ctx.ThrowError(ErrRealmClosed)
+	}
+	val := ctx.proxyFunctionIn(r.ref, &hostFunction{name: name, fn: fn})
+	ctx.defineReadOnly(val, "name", ctx.String(name))
+	ctx.defineReadOnly(val, "length", ctx.Int32(int32(length)))
+	return val
+}
+
+// ParseJSON parses the JSON string into a value of the realm, e.g. to copy data from the context into the realm.
+func (r *Realm) ParseJSON(v string) Value {
+	if r.ref == nil {
+		return r.ctx.ThrowError(ErrRealmClosed)
+	}
+	ptr := C.CString(v)
+	defer C.free(unsafe.Pointer(ptr))
+
+	filenamePtr := C.CString("")
+	defer C.free(unsafe.Pointer(filenamePtr))
+
+	return r.ctx.newValue(C.JS_ParseJSON(r.ref, ptr, C.size_t(len(v)), filenamePtr))
+}
+
+// Close closes the realm; its values remain valid until they are freed.
+func (r *Realm) Close() {
+	if t := r.ctx.runtime.thread; t.remote() {
+		t.do(r.Close)
+		return
+	}
+	if r.ref == nil {
+		return
+	}
+	delete(r.ctx.realms, r)
+	C.SetContextHandle(r.ref, 0)
+	C.JS_FreeContext(r.ref)
+	r.ref = nil
+}
+
+// closeRealms closes the realms of the context.
+func (ctx *Context) closeRealms() {
+	for r := range ctx.realms {
+		r.Close()
+	}
+}
@@ -0,0 +1,90 @@
+package quickjs
+
+/*
+#include "bridge.h"
+*/
+import "C"
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+// ErrPendingJobs is the error of Reset when the pending jobs keep queueing new jobs.
+var ErrPendingJobs = errors.New("quickjs: pending jobs keep being queued")
+
+// maxResetJobs bounds the pending jobs run by Reset.
+const maxResetJobs = 100000
+
+// Reset replaces the global object of the context with a pristine one, as returned by NewContext, without recreating the runtime.
+//
+// User-defined globals, including top-level let and const declarations, are dropped and the pending timers are cleared.
+// Pending promise jobs are run first, against the previous global object, so none of them leaks into the next use;
+// the engine has a single job queue, so the pending jobs of the other contexts of the runtime run too. If the jobs keep queueing
+// new ones, e.g. a promise callback chaining itself, Reset stops after a bound and returns ErrPendingJobs without resetting the context.
+// The settings of the context are kept: handlers, tag, user data, bytecode cache, locale, storages, random source, global fallback and pollution handlers, whether eval is enabled and Lockdown,
+// which freezes the new intrinsics again.
+// Values obtained before Reset remain valid but belong to the previous global object; they must still be freed.
+// If the settings no longer fit, e.g. under a tight memory limit, the context fails closed like NewContext and Reset returns the error.
+// The OnReset functions are called last.
+func (ctx *Context) Reset() (err error) {
+	if t := ctx.runtime.thread; t.remote() {
+		t.do(func() { err = ctx.Reset() })
+		return err
+	}
+	if err := ctx.flushJobs(time.Time{}); err != nil {
+		return err
+	}
+	ctx.clearTimers()
+	ctx.FreePending()
+
+	evalEnabled := ctx.EvalEnabled()
+	ctx.freeInternals()
+
+	C.SetContextHandle(ctx.ref, 0)
+	C.JS_FreeContext(ctx.ref)
+	ctx.ref = ctx.runtime.newContextRef()
+
+	ctx.setupErr = nil
+	if err := ctx.resetup(evalEnabled); err != nil {
+		ctx.discardSetup(err)
+		return ctx.setupErr
+	}
+	ctx.runResetHooks()
+	return nil
+}
+
+// resetup applies the settings of the context to its new global object.
+func (ctx *Context) resetup(evalEnabled bool) error {
+	if err := ctx.setup(); err != nil {
+		return err
+	}
+	if err := ctx.SetEvalEnabled(evalEnabled); err != nil {
+		return err
+	}
+	if ctx.lockdown != nil {
+		if _, err := ctx.lockdownWith(*ctx.lockdown); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// flushJobs runs the pending jobs of the runtime until the queue is empty, dropping their exceptions,
+// or returns ErrPendingJobs after maxResetJobs jobs, or context.DeadlineExceeded past the deadline, if not zero.
+func (ctx *Context) flushJobs(deadline time.Time) error {
+	var jobCtx *C.JSContext
+	for i := 0; i < maxResetJobs; i++ {
+		if !deadline.IsZero() && time.Now().After(deadline) {
+			return context.DeadlineExceeded
+		}
+		ret := C.JS_ExecutePendingJob(ctx.runtime.ref, &jobCtx)
+		if ret == 0 {
+			return nil
+		}
+		if ret < 0 {
+			C.JS_FreeValue(jobCtx, C.JS_GetException(jobCtx))
+		}
+	}
+	return ErrPendingJobs
+}
@@ -7,22 +7,60 @@ package quickjs
 import "C"
 import (
 	"runtime"
-	"unsafe"
+	"runtime/cgo"
+	"sync"
+	"time"
 )
 
+// classIDsOnce guards the allocation of the process-wide class ids used by the bridge.
+var classIDsOnce sync.Once
+
 // Runtime represents a Javascript runtime corresponding to an object heap. Several runtimes can exist at the same time but they cannot exchange objects. Inside a given runtime, no multi-threading is supported.
 type Runtime struct {
 	ref     *C.JSRuntime
 	options *Options
+	gcInfo  *GCInfo
+
+	interrupts  *interruptState
+	thread      *thread // see WithDedicatedThread
+	gcHooks     *gcHooks
+	userData    *userData // see SetUserData
+	bridgeDepth *int      // the nesting of host function calls, see SetMaxBridgeDepth
 }
 
 type Options struct {
-	timeout      uint64
-	memoryLimit  uint64
-	gcThreshold  uint64
-	maxStackSize uint64
-	canBlock     bool
-	moduleImport bool
+	timeout        uint64
+	memoryLimit    uint64
+	gcThreshold    uint64
+	maxStackSize   uint64
+	maxBridgeDepth int
+	maxAwait       int
+	maxString      int
+	maxArray       int64
+	maxHandles     int
+	canBlock       bool
+	moduleImport   bool
+	valueTracking  bool
+	freeCheck      bool
+	leakHandler    func(*LeakReport)
+	bytecodeCache  BytecodeCache
+	repanic        bool
+	threadGuard    bool
+	hooks          *Hooks
+	logger         Logger
+	limits         *Limits
+	features       Feature
+	strict         bool
+	randomSource   func() float64
+	deterministic  *DeterministicMode
+
+	dedicatedThread bool
+	jobQueueSize    int
+
+	disableAtomics   bool
+	atomicsWaitLimit time.Duration
+
+	promiseRejectionHandler PromiseRejectionHandler
 }
 
 type Option func(*Options)
@@ -55,6 +93,13 @@ func WithMaxStackSize(maxStackSize uint64) Option {
 	}
 }
 
+// WithMaxBridgeDepth will set the runtime's maximum bridge depth, see SetMaxBridgeDepth; default is 0, no limit.
+func WithMaxBridgeDepth(depth int) Option {
+	return func(o *Options) {
+		o.maxBridgeDepth = depth
+	}
+}
+
 // WithCanBlock will set the runtime's can block; default is true
 func WithCanBlock(canBlock bool) Option {
 	return func(o *Options) {
@@ -68,9 +113,59 @@ func WithModuleImport(moduleImport bool) Option {
 	}
 }
 
+// WithValueTracking will record the creation stack of every value and report the values not freed when a context is closed; default is false.
+// Tracking has a noticeable cost and is meant for debugging leaks.
+func WithValueTracking(tracking bool) Option {
+	return func(o *Options) {
+		o.valueTracking = tracking
+	}
+}
+
+// WithFreeCheck will remember where the values whose last reference is freed were freed, so that a later Free or method call
+// on them panics with the Free call site instead of corrupting memory; default is false. It also counts the references owned by Go,
+// so that freeing a value more often than Go owns it, e.g. with a deferred Free after Set took its ownership, panics before
+// the reference count of its other owner is decremented. Like WithValueTracking, it has a noticeable cost and is meant for debugging.
+func WithFreeCheck(check bool) Option {
+	return func(o *Options) {
+		o.freeCheck = check
+	}
+}
+
+// WithLeakHandler will set the handler receiving the leak report of closed contexts; default logs the report to the logger, if any, or else writes it to stderr.
+func WithLeakHandler(handler func(*LeakReport)) Option {
+	return func(o *Options) {
+		o.leakHandler = handler
+	}
+}
+
+// WithBytecodeCache will set the bytecode cache shared by the runtime's contexts; default is no cache.
+func WithBytecodeCache(cache BytecodeCache) Option {
+	return func(o *Options) {
+		o.bytecodeCache = cache
+	}
+}
+
+// WithRepanic will re-panic the panics of Go callbacks, e.g. to get their stack trace while debugging;
+// default is false, which recovers them and throws an InternalError to the calling script.
+func WithRepanic(repanic bool) Option {
+	return func(o *Options) {
+		o.repanic = repanic
+	}
+}
+
+// WithThreadGuard will make the contexts check that they are used from the goroutine which created them:
+// their methods running scripts return or throw ErrWrongGoroutine otherwise, and Close panics,
+// as it also does when called while the context runs, e.g. from a Go callback; default is false.
+// The check costs about a microsecond per call, so it is meant for development and tests.
+func WithThreadGuard(enabled bool) Option {
+	return func(o *Options) {
+		o.threadGuard = enabled
+	}
+}
+
 // NewRuntime creates a new quickjs runtime.
 func NewRuntime(opts ...Option) Runtime {
-	runtime.LockOSThread() // prevent multiple quickjs runtime from being created
+	classIDsOnce.Do(func() { C.InitClassIDs() })
 
 	options := &Options{
 		timeout:      0,
@@ -79,12 +174,28 @@ func NewRuntime(opts ...Option) Runtime {
 		maxStackSize: 0,
 		canBlock:     true,
 		moduleImport: false,
+		features:     FeatureAll,
+		jobQueueSize: defaultJobQueueSize,
 	}
 	for _, opt := range opts {
 		opt(options)
 	}
 
-	rt := Runtime{ref: C.JS_NewRuntime(), options: options}
+	if !options.dedicatedThread {
+		runtime.LockOSThread() // prevent multiple quickjs runtime from being created
+		return newRuntime(options)
+	}
+	t := newThread()
+	var rt Runtime
+	t.do(func() { rt = newRuntime(options) })
+	rt.thread = t
+	return rt
+}
+
+// newRuntime creates a runtime with the options, on the calling thread.
+func newRuntime(options *Options) Runtime {
+	rt := Runtime{ref: C.JS_NewRuntime(), options: options, gcInfo: &GCInfo{Threshold: defaultGCThreshold}, interrupts: &interruptState{}, gcHooks: &gcHooks{}, userData: &userData{}, bridgeDepth: new(int)}
+	rt.interrupts.handle = cgo.NewHandle(rt.interrupts)
 
 	if rt.options.timeout > 0 {
 		rt.SetExecuteTimeout(rt.options.timeout)
@@ -98,20 +209,50 @@ func NewRuntime(opts ...Option) Runtime {
 	if rt.options.maxStackSize > 0 {
 		rt.SetMaxStackSize(rt.options.maxStackSize)
 	}
+	if limits := rt.options.limits; limits != nil {
+		rt.interrupts.limits = limits
+		if limits.WallTime > 0 || limits.MaxInterrupts > 0 {
+			rt.interrupts.install(rt.ref)
+		}
+	}
 	if rt.options.canBlock {
 		C.JS_SetCanBlock(rt.ref, C.int(1))
 	}
+	if rt.options.promiseRejectionHandler != nil || rt.options.logger != nil {
+		rt.updatePromiseRejectionTracker()
+	}
 	return rt
 }
 
 // RunGC will call quickjs's garbage collector.
 func (r Runtime) RunGC() {
+	if r.thread.remote() {
+		r.thread.do(r.RunGC)
+		return
+	}
+	before := r.MemoryUsage()
+	start := time.Now()
 	C.JS_RunGC(r.ref)
+	duration := time.Since(start)
+	after := r.MemoryUsage()
+
+	r.gcInfo.Runs++
+	r.gcInfo.ObjectsBefore, r.gcInfo.ObjectsAfter = before.ObjCount, after.ObjCount
+	r.gcInfo.MemoryBefore, r.gcInfo.MemoryAfter = before.MemoryUsedSize, after.MemoryUsedSize
+	r.gcInfo.Duration = duration
+	r.gcHooks.run(*r.gcInfo)
 }
 
 // Close will free the runtime pointer.
 func (r Runtime) Close() {
+	if t := r.thread; t.remote() {
+		t.do(r.Close)
+		t.stop()
+		return
+	}
+	C.FreeStdHandlers(r.ref)
 	C.JS_FreeRuntime(r.ref)
+	r.interrupts.handle.Delete()
 }
 
 // SetCanBlock will set the runtime's can block; default is true
@@ -125,42 +266,130 @@ func (r Runtime) SetCanBlock(canBlock bool) {
 
 // SetMemoryLimit the runtime memory limit; if not set, it will be unlimit.
 func (r Runtime) SetMemoryLimit(limit uint64) {
+	r.options.memoryLimit = limit
 	C.JS_SetMemoryLimit(r.ref, C.size_t(limit))
 }
 
 // SetGCThreshold the runtime's GC threshold; use -1 to disable automatic GC.
 func (r Runtime) SetGCThreshold(threshold uint64) {
+	r.gcInfo.Threshold = threshold
 	C.JS_SetGCThreshold(r.ref, C.size_t(threshold))
 }
 
 // SetMaxStackSize will set max runtime's stack size; default is 255
 func (r Runtime) SetMaxStackSize(stack_size uint64) {
+	r.options.maxStackSize = stack_size
 	C.JS_SetMaxStackSize(r.ref, C.size_t(stack_size))
 }
 
+// SetMaxBridgeDepth sets the maximum nesting of host function calls, as when JS calls Go which calls JS which calls Go again;
+// the call nested deeper throws a RangeError instead of calling the host function, before the alternation exhausts the C stack,
+// whose use per level the engine cannot account for. Use 0 to remove the limit.
+func (r Runtime) SetMaxBridgeDepth(depth int) {
+	r.options.maxBridgeDepth = depth
+}
+
+// enterBridge records the call of a host function until exitBridge is called; past the maximum bridge depth,
+// it returns the RangeError thrown instead of calling the function.
+func (ctx *Context) enterBridge() (C.JSValue, bool) {
+	r := ctx.runtime
+	if max := r.options.maxBridgeDepth; max > 0 && *r.bridgeDepth >= max {
+		exception := ctx.ThrowRangeError("maximum bridge depth of %d exceeded", max)
+		exception.untrack()
+		return exception.ref, true
+	}
+	*r.bridgeDepth++
+	return C.JS_NewUndefined(), false
+}
+
+// exitBridge records the return of a host function call recorded by enterBridge.
+func (ctx *Context) exitBridge() {
+	*ctx.runtime.bridgeDepth--
+}
+
 // SetExecuteTimeout will set the runtime's execute timeout; default is 0
+// It is counted from the call in seconds, and applies besides the interrupt handlers and WithLimits.
 func (r Runtime) SetExecuteTimeout(timeout uint64) {
-	C.SetExecuteTimeout(r.ref, C.time_t(timeout))
+	r.interrupts.timeout = time.Duration(timeout) * time.Second
+	r.interrupts.timeoutStarted = time.Now()
+	r.interrupts.install(r.ref)
 }
 
 // NewContext creates a new JavaScript context.
 // enable BigFloat/BigDecimal support and enable .
 // enable operator overloading.
-func (r Runtime) NewContext() *Context {
-	C.js_std_init_handlers(r.ref)
+// If the globals and settings the package adds to contexts do not fit, e.g. under a tight memory limit, the context fails closed:
+// it has no intrinsics and its evaluations return the error, which is also logged to the runtime's logger, if any.
+// Use NewContextErr to get the error instead.
+func (r Runtime) NewContext() (ctx *Context) {
+	if r.thread.remote() {
+		r.thread.do(func() { ctx = r.NewContext() })
+		return ctx
+	}
+	ctx, err := r.newContext()
+	if err != nil {
+		if logger := r.options.logger; logger != nil {
+			logger.Log(LogLevelWarn, "quickjs: context setup failed", map[string]interface{}{"error": err.Error()})
+		}
+	}
+	return ctx
+}
+
+// NewContextErr is NewContext returning the error of the setup of the context, in which case no context is created.
+func (r Runtime) NewContextErr() (ctx *Context, err error) {
+	if r.thread.remote() {
+		r.thread.do(func() { ctx, err = r.NewContextErr() })
+		return ctx, err
+	}
+	ctx, err = r.newContext()
+	if err != nil {
+		ctx.Close()
+		return nil, err
+	}
+	return ctx, nil
+}
+
+// newContext creates a context, failing closed if its setup fails, see discardSetup.
+func (r Runtime) newContext() (*Context, error) {
+	C.InitStdHandlers(r.ref)
+
+	ctx := &Context{ref: r.newContextRef(), runtime: &r, freeQueue: &freeQueue{}, jobQueue: newJobQueue(r.options.jobQueueSize)}
+	ctx.handle = cgo.NewHandle(ctx)
+	ctx.randomSource = r.options.randomSource
+	if mode := r.options.deterministic; mode != nil {
+		ctx.newDeterministic(mode)
+	}
+	if r.options.valueTracking {
+		ctx.tracker = newValueTracker()
+	}
+	if r.options.freeCheck {
+		ctx.freed = newFreedValues()
+	}
+	err := ctx.setup()
+	if err != nil {
+		ctx.discardSetup(err)
+	}
+	ctx.bytecodeCache = r.options.bytecodeCache
+	ctx.strict = r.options.strict
+	if r.options.threadGuard {
+		ctx.owner = goroutineID()
+	}
+	return ctx, ctx.setupErr
+}
 
+// newContextRef creates a context with the intrinsics and globals shared by all the contexts of the runtime.
+func (r Runtime) newContextRef() *C.JSContext {
 	// create a new context (heap, global object and context stack
 	ctx_ref := C.JS_NewContext(r.ref)
 
-	C.JS_AddIntrinsicBigFloat(ctx_ref)
-	C.JS_AddIntrinsicBigDecimal(ctx_ref)
-	C.JS_AddIntrinsicOperators(ctx_ref)
-	C.JS_EnableBignumExt(ctx_ref, C.int(1))
+	addFeatures(ctx_ref, r.options.features)
 
-	// set the module loader for support dynamic import
+	// set the module normalizer, guarding the std and os modules, and the module loader for support dynamic import
+	moduleImport := 0
 	if r.options.moduleImport {
-		C.JS_SetModuleLoaderFunc(r.ref, (*C.JSModuleNormalizeFunc)(unsafe.Pointer(nil)), (*C.JSModuleLoaderFunc)(C.js_module_loader), unsafe.Pointer(nil))
+		moduleImport = 1
 	}
+	C.SetModuleLoader(r.ref, C.int(moduleImport))
 
 	// import the 'std' and 'os' modules
 	C.js_init_module_std(ctx_ref, C.CString("std"))
@@ -177,5 +406,5 @@ func (r Runtime) NewContext() *Context {
 	C.JS_FreeValue(ctx_ref, init_run)
 	// C.js_std_loop(ctx_ref)
 
-	return &Context{ref: ctx_ref, runtime: &r}
+	return ctx_ref
 }
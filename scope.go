@@ -0,0 +1,73 @@
+package quickjs
+
+// Scope collects values and frees all of them at once when closed, similar to a V8 HandleScope.
+//
+//	s := ctx.NewScope()
+//	defer s.Close()
+//	obj := s.Track(ctx.Object())
+//	ret, err := s.Eval(`1 + 1`)
+type Scope struct {
+	ctx    *Context
+	parent *Scope
+	values []Value
+}
+
+// NewScope returns a new scope bound to the context.
+func (ctx *Context) NewScope() *Scope {
+	return &Scope{ctx: ctx}
+}
+
+// NewScope returns a nested scope; values escaped from it are promoted to s.
+func (s *Scope) NewScope() *Scope {
+	return &Scope{ctx: s.ctx, parent: s}
+}
+
+// Context returns the context of the scope.
+func (s *Scope) Context() *Context {
+	return s.ctx
+}
+
+// Track adds the value to the scope and returns it, so it is freed on Close.
+func (s *Scope) Track(v Value) Value {
+	s.values = append(s.values, v)
+	return v
+}
+
+// Eval evaluates code like Context.Eval and tracks the result in the scope.
+func (s *Scope) Eval(code string, opts ...EvalOption) (Value, error) {
+	val, err := s.ctx.Eval(code, opts...)
+	return s.Track(val), err
+}
+
+// Len returns the number of values tracked by the scope.
+func (s *Scope) Len() int {
+	return len(s.values)
+}
+
+// Close frees all values tracked by the scope in reverse order of creation.
+func (s *Scope) Close() {
+	for i := len(s.values) - 1; i >= 0; i-- {
+		s.values[i].Free()
+	}
+	s.values = nil
+}
+
+// release removes the value from the scope without freeing it.
+func (s *Scope) release(v Value) bool {
+	for i := len(s.values) - 1; i >= 0; i-- {
+		if s.values[i].ref == v.ref {
+			s.values = append(s.values[:i], s.values[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
+
+// Escape promotes the value out of the scope so it is not freed when the scope closes.
+// For a nested scope the value is moved to the parent scope, otherwise the caller owns it and must Free it.
+func (v Value) Escape(s *Scope) Value {
+	if s.release(v) && s.parent != nil {
+		s.parent.Track(v)
+	}
+	return v
+}
@@ -0,0 +1,86 @@
+package quickjs
+
+/*
+#include "bridge.h"
+*/
+import "C"
+import "unsafe"
+
+// scriptBindingsName is the hidden global through which a Script reaches the bindings of the current Run.
+const scriptBindingsName = "__quickjsScriptBindings"
+
+// Script is code compiled once and run many times with different bindings, e.g. by template or rules engines.
+type Script struct {
+	ctx    *Context
+	fn     Value
+	origin string // see EvalOrigin
+}
+
+// CompileScript compiles the code of a global script for repeated runs.
+// The bindings given to Run are visible to the code as variables; top-level let, const and class declarations
+// are scoped to a single run, while var and function declarations still define globals.
+// The code runs in sloppy mode, as bindings are provided by a with statement.
+func (ctx *Context) CompileScript(code string, opts ...EvalOption) (*Script, error) {
+	options := newEvalOptions(opts)
+	// keep the code on the first line, so that line numbers of errors are unchanged
+	wrapped := "with (globalThis." + scriptBindingsName + ") { " + code + "\n}"
+
+	codePtr := C.CString(wrapped)
+	defer C.free(unsafe.Pointer(codePtr))
+	filenamePtr := C.CString(options.filename)
+	defer C.free(unsafe.Pointer(filenamePtr))
+
+	fn := ctx.newValue(C.JS_Eval(ctx.ref, codePtr, C.size_t(len(wrapped)), filenamePtr, C.JS_EVAL_TYPE_GLOBAL|C.JS_EVAL_FLAG_COMPILE_ONLY))
+	if fn.IsException() {
+		return nil, ctx.exceptionError()
+	}
+	return &Script{ctx: ctx, fn: fn, origin: options.origin}, nil
+}
+
+// Run runs the script with the bindings converted by Marshal, and returns its completion value, which must be freed.
+func (s *Script) Run(bindings map[string]interface{}) (Value, error) {
+	ctx := s.ctx
+	if err := ctx.checkGoroutine(); err != nil {
+		return ctx.Undefined(), err
+	}
+	defer ctx.enter()()
+	defer ctx.withOrigin(s.origin)()
+	ctx.FreePending()
+
+	scope := ctx.newValue(C.JS_NewObjectProto(ctx.ref, C.JS_NewNull()))
+	for _, name := range sortedKeys(bindings) {
+		val, err := ctx.Marshal(bindings[name])
+		if err != nil {
+			scope.Free()
+			return ctx.Undefined(), err
+		}
+		scope.Set(name, val)
+	}
+
+	// runs may nest through host functions, so restore the bindings of the outer run
+	globals := ctx.Globals()
+	outer := globals.Get(scriptBindingsName)
+	defer func() {
+		ctx.defineHidden(globals, scriptBindingsName, outer)
+	}()
+	ctx.defineHidden(globals, scriptBindingsName, scope)
+
+	ret := ctx.newValue(C.JS_EvalFunction(ctx.ref, C.JS_DupValue(ctx.ref, s.fn.ref)))
+	if ret.IsException() {
+		return ret, ctx.exceptionError()
+	}
+	return ret, nil
+}
+
+// Free frees the compiled script.
+func (s *Script) Free() {
+	s.fn.Free()
+}
+
+// defineHidden defines a non-enumerable property of the object, taking ownership of val.
+func (ctx *Context) defineHidden(obj Value, name string, val Value) {
+	namePtr := C.CString(name)
+	defer C.free(unsafe.Pointer(namePtr))
+	val.untrack()
+	C.JS_DefinePropertyValueStr(ctx.ref, obj.ref, namePtr, val.ref, C.JS_PROP_CONFIGURABLE|C.JS_PROP_WRITABLE)
+}
@@ -0,0 +1,99 @@
+package quickjs
+
+import (
+	"fmt"
+	"os"
+	"time"
+)
+
+// CloseWithTimeout closes the context once its pending work is done, waiting for it at most for the timeout.
+// It stops accepting jobs, see Schedule, then runs the queued jobs, the promise jobs and the timers in order,
+// waiting for the timers due before the timeout. The work left at the timeout is dropped: the queued jobs fail
+// with ErrContextClosed and the timers are cleared. Finally it closes the context like Close, calling the OnClose functions.
+// It reports whether the shutdown was clean, i.e. all the pending work ran; a job or a timer running past the timeout is not interrupted.
+func (ctx *Context) CloseWithTimeout(timeout time.Duration) (clean bool) {
+	if t := ctx.runtime.thread; t.remote() {
+		t.do(func() { clean = ctx.CloseWithTimeout(timeout) })
+		return clean
+	}
+	ctx.checkClose()
+	clean = ctx.drain(time.Now().Add(timeout))
+	ctx.Close()
+	return clean
+}
+
+// drain runs the pending work of the context until the deadline, dropping the work left, and reports whether none is left.
+func (ctx *Context) drain(deadline time.Time) bool {
+	jobs := ctx.jobQueue.close()
+	for i, j := range jobs {
+		if time.Now().After(deadline) {
+			for _, j := range jobs[i:] {
+				if j.cancel != nil {
+					j.cancel(ErrContextClosed)
+				}
+			}
+			ctx.clearTimers()
+			return false
+		}
+		j.run(ctx)
+	}
+
+	for {
+		if err := ctx.flushJobs(deadline); err != nil {
+			ctx.clearTimers()
+			return false
+		}
+		delay, ok := ctx.nextTimer()
+		if !ok {
+			return true
+		}
+		if ctx.clock != nil {
+			// virtual timers fire at once, see WithDeterministicMode
+			delay = 0
+		}
+		if time.Now().Add(delay).After(deadline) {
+			ctx.clearTimers()
+			return false
+		}
+		if ctx.fireVirtualTimer() {
+			continue
+		}
+		time.Sleep(delay)
+		if err := ctx.fireTimer(); err != nil {
+			// like the event loop, print the exceptions left unhandled by SetUncaughtExceptionHandler
+			fmt.Fprintln(os.Stderr, err)
+		}
+	}
+}
+
+// clearTimers clears the pending timers of the context.
+func (ctx *Context) clearTimers() {
+	if ctx.timers != nil {
+		ret := ctx.timers.Call("clear")
+		ret.Free()
+	}
+}
+
+// nextTimer returns the delay of the next pending timer of the context, if any.
+func (ctx *Context) nextTimer() (time.Duration, bool) {
+	if ctx.timers == nil {
+		return 0, false
+	}
+	ret := ctx.timers.Call("next")
+	defer ret.Free()
+	ms := ret.Float64()
+	if ret.IsException() || ms < 0 {
+		return 0, false
+	}
+	return time.Duration(ms * float64(time.Millisecond)), true
+}
+
+// fireTimer runs the next pending timer of the context now, returning its unhandled exception.
+func (ctx *Context) fireTimer() error {
+	ret := ctx.timers.Call("fire")
+	defer ret.Free()
+	if ret.IsException() {
+		return ctx.Exception()
+	}
+	return nil
+}
@@ -0,0 +1,297 @@
+package quickjs
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+)
+
+// DefaultStorageQuota is the quota of the storages installed by EnableStorage, like the one of browsers.
+const DefaultStorageQuota = 5 << 20
+
+// Storage is the store of the localStorage or sessionStorage of scripts, see EnableStorage; embedders implement it
+// to keep the items of scripts in memory, see NewMemoryStorage, or in a database. It must be safe for concurrent use
+// if it is shared by several contexts.
+type Storage interface {
+	// Get returns the value of the key, and whether it is set.
+	Get(key string) (string, bool, error)
+	// Set sets the value of the key.
+	Set(key, value string) error
+	// Delete deletes the key, if it is set.
+	Delete(key string) error
+	// Keys returns the keys set, in a stable order, as scripts read them by index.
+	Keys() ([]string, error)
+}
+
+// MemoryStorage is a Storage keeping the items in memory.
+type MemoryStorage struct {
+	mu    sync.Mutex
+	items map[string]string
+}
+
+// NewMemoryStorage returns an empty MemoryStorage.
+func NewMemoryStorage() *MemoryStorage {
+	return &MemoryStorage{items: make(map[string]string)}
+}
+
+// Get implements Storage.
+func (s *MemoryStorage) Get(key string) (string, bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	value, ok := s.items[key]
+	return value, ok, nil
+}
+
+// Set implements Storage.
+func (s *MemoryStorage) Set(key, value string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.items[key] = value
+	return nil
+}
+
+// Delete implements Storage.
+func (s *MemoryStorage) Delete(key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.items, key)
+	return nil
+}
+
+// Keys implements Storage, returning the keys in lexical order.
+func (s *MemoryStorage) Keys() ([]string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	keys := make([]string, 0, len(s.items))
+	for key := range s.items {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys, nil
+}
+
+// StorageOption configures the storages installed by EnableStorage.
+type StorageOption func(*storageOptions)
+
+type storageOptions struct {
+	session Storage
+	quota   int
+}
+
+// StorageSession sets the store of sessionStorage; default is a new MemoryStorage, kept until the context is closed.
+func StorageSession(store Storage) StorageOption {
+	return func(options *storageOptions) {
+		options.session = store
+	}
+}
+
+// StorageQuota sets the quota of each storage, in bytes of the UTF-8 keys and values; default is DefaultStorageQuota,
+// and 0 or less means no quota. A quota makes setItem read all the items of the store to sum their size.
+func StorageQuota(bytes int) StorageOption {
+	return func(options *storageOptions) {
+		options.quota = bytes
+	}
+}
+
+// storageScript returns the function defining a Storage global of the given name, calling the Go functions get(key),
+// returning the value or null, set(key, value), remove(key), keys() and clear().
+const storageScript = `((name, get, set, remove, keys, clear) => {
+	const methods = {
+		getItem(key) {
+			return get(String(key));
+		},
+		setItem(key, value) {
+			set(String(key), String(value));
+		},
+		removeItem(key) {
+			remove(String(key));
+		},
+		clear() {
+			clear();
+		},
+		key(index) {
+			const k = keys()[index >>> 0];
+			return k === undefined ? null : k;
+		},
+		get length() {
+			return keys().length;
+		},
+	};
+	Object.defineProperty(methods, Symbol.toStringTag, { value: "Storage", configurable: true });
+	const own = (prop) => typeof prop === "string" && !(prop in methods) && get(prop) !== null;
+	const storage = new Proxy(methods, {
+		get(target, prop, receiver) {
+			if (typeof prop === "symbol" || prop in target) {
+				return Reflect.get(target, prop, receiver);
+			}
+			const value = get(prop);
+			return value === null ? undefined : value;
+		},
+		set(target, prop, value) {
+			if (typeof prop === "symbol" || prop in target) {
+				return Reflect.set(target, prop, value);
+			}
+			set(prop, String(value));
+			return true;
+		},
+		has(target, prop) {
+			return prop in target || own(prop);
+		},
+		deleteProperty(target, prop) {
+			if (typeof prop === "symbol" || prop in target) {
+				return Reflect.deleteProperty(target, prop);
+			}
+			remove(prop);
+			return true;
+		},
+		ownKeys() {
+			return keys();
+		},
+		getOwnPropertyDescriptor(target, prop) {
+			if (!own(prop)) {
+				return undefined;
+			}
+			return { value: get(prop), writable: true, enumerable: true, configurable: true };
+		},
+		defineProperty() {
+			return false;
+		},
+	});
+	Object.defineProperty(globalThis, name, { value: storage, writable: true, configurable: true });
+})`
+
+// storageState is the storages enabled by EnableStorage, installed again by Reset.
+type storageState struct {
+	local, session Storage
+	quota          int
+}
+
+// EnableStorage installs the localStorage and sessionStorage globals of the context, so that scripts ported from browsers
+// keep their items in the store of the host; use nil to remove them. The items are strings, accessed with getItem, setItem,
+// removeItem, clear, key and length, or as properties, e.g. localStorage.theme. Setting an item beyond the quota throws
+// an Error named QuotaExceededError; the errors of the store are thrown as Errors. The storages are kept by Reset.
+func (ctx *Context) EnableStorage(store Storage, opts ...StorageOption) error {
+	if store == nil {
+		ctx.storage = nil
+		ret, err := ctx.eval(`delete globalThis.localStorage; delete globalThis.sessionStorage;`, EvalFileName("<storage>"))
+		ret.Free()
+		return err
+	}
+	options := storageOptions{quota: DefaultStorageQuota}
+	for _, opt := range opts {
+		opt(&options)
+	}
+	if options.session == nil {
+		options.session = NewMemoryStorage()
+	}
+	ctx.storage = &storageState{local: store, session: options.session, quota: options.quota}
+	return ctx.installStorage()
+}
+
+// installStorage defines the globals of the enabled storages.
+func (ctx *Context) installStorage() error {
+	define, err := ctx.eval(storageScript, EvalFileName("<storage>"))
+	if err != nil {
+		return err
+	}
+	defer define.Free()
+
+	s := ctx.storage
+	for _, global := range []struct {
+		name  string
+		store Storage
+	}{{"localStorage", s.local}, {"sessionStorage", s.session}} {
+		args := append([]Value{ctx.String(global.name)}, ctx.storageFunctions(global.store, s.quota)...)
+		ret := ctx.Invoke(define, ctx.Null(), args...)
+		freeValues(args)
+		if ret.IsException() {
+			return ctx.exceptionError()
+		}
+		ret.Free()
+	}
+	return nil
+}
+
+// storageFunctions returns the get, set, remove, keys and clear functions of storageScript for the store.
+func (ctx *Context) storageFunctions(store Storage, quota int) []Value {
+	get := ctx.NamedFunction("get", 1, func(ctx *Context, this Value, args []Value) Value {
+		value, ok, err := store.Get(args[0].String())
+		if err != nil {
+			return ctx.ThrowError(err)
+		}
+		if !ok {
+			return ctx.Null()
+		}
+		return ctx.String(value)
+	})
+	set := ctx.NamedFunction("set", 2, func(ctx *Context, this Value, args []Value) Value {
+		key, value := args[0].String(), args[1].String()
+		if quota > 0 {
+			used, err := storageUsage(store, key)
+			if err != nil {
+				return ctx.ThrowError(err)
+			}
+			if used+len(key)+len(value) > quota {
+				exception := ctx.Error(fmt.Errorf("quickjs: storage quota of %d bytes exceeded", quota))
+				exception.Set("name", ctx.String("QuotaExceededError"))
+				return ctx.Throw(exception)
+			}
+		}
+		if err := store.Set(key, value); err != nil {
+			return ctx.ThrowError(err)
+		}
+		return ctx.Undefined()
+	})
+	remove := ctx.NamedFunction("remove", 1, func(ctx *Context, this Value, args []Value) Value {
+		if err := store.Delete(args[0].String()); err != nil {
+			return ctx.ThrowError(err)
+		}
+		return ctx.Undefined()
+	})
+	keys := ctx.NamedFunction("keys", 0, func(ctx *Context, this Value, args []Value) Value {
+		keys, err := store.Keys()
+		if err != nil {
+			return ctx.ThrowError(err)
+		}
+		val, err := ctx.Marshal(keys)
+		if err != nil {
+			return ctx.ThrowError(err)
+		}
+		return val
+	})
+	clear := ctx.NamedFunction("clear", 0, func(ctx *Context, this Value, args []Value) Value {
+		keys, err := store.Keys()
+		if err != nil {
+			return ctx.ThrowError(err)
+		}
+		for _, key := range keys {
+			if err := store.Delete(key); err != nil {
+				return ctx.ThrowError(err)
+			}
+		}
+		return ctx.Undefined()
+	})
+	return []Value{get, set, remove, keys, clear}
+}
+
+// storageUsage returns the size of the items of the store, but the one of the key being set.
+func storageUsage(store Storage, except string) (int, error) {
+	keys, err := store.Keys()
+	if err != nil {
+		return 0, err
+	}
+	used := 0
+	for _, key := range keys {
+		if key == except {
+			continue
+		}
+		value, ok, err := store.Get(key)
+		if err != nil {
+			return 0, err
+		}
+		if ok {
+			used += len(key) + len(value)
+		}
+	}
+	return used, nil
+}
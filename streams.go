@@ -0,0 +1,497 @@
+package quickjs
+
+import (
+	"errors"
+	"io"
+	"sync/atomic"
+)
+
+// defaultStreamChunkSize is the size of the chunks read by NewReadableStream.
+const defaultStreamChunkSize = 64 << 10
+
+// streamScript returns the functions making the stream objects of NewReadableStream and NewWritableStream:
+// readable(pull, cancel) and writable(write, close, abort) return a stream calling the Go functions, which start
+// the operation of the id they are given; settle(id, ok, value) then resolves or rejects the promise of the operation.
+const streamScript = `(() => {
+	const state = Symbol("state");
+	const ops = new Map();
+	let seq = 0;
+	const start = (fn, ...args) => new Promise((resolve, reject) => {
+		const id = ++seq;
+		ops.set(id, { resolve, reject });
+		try {
+			fn(id, ...args);
+		} catch (e) {
+			ops.delete(id);
+			reject(e);
+		}
+	});
+	const deferred = () => {
+		const d = {};
+		d.promise = new Promise((resolve, reject) => {
+			d.resolve = resolve;
+			d.reject = reject;
+		});
+		d.promise.catch(() => {});
+		return d;
+	};
+
+	class ReadableStreamDefaultReader {
+		constructor(stream) {
+			const s = stream[state];
+			if (s.reader !== undefined) {
+				throw new TypeError("ReadableStream is locked");
+			}
+			s.reader = this;
+			Object.defineProperty(this, state, { value: stream });
+		}
+		get closed() {
+			return this[state][state].closed.promise;
+		}
+		read() {
+			const stream = this[state];
+			if (stream[state].reader !== this) {
+				return Promise.reject(new TypeError("reader released"));
+			}
+			return stream[state].read();
+		}
+		cancel(reason) {
+			const stream = this[state];
+			if (stream[state].reader !== this) {
+				return Promise.reject(new TypeError("reader released"));
+			}
+			return stream[state].cancel(reason);
+		}
+		releaseLock() {
+			const s = this[state][state];
+			if (s.reader === this) {
+				s.reader = undefined;
+			}
+		}
+		get [Symbol.toStringTag]() {
+			return "ReadableStreamDefaultReader";
+		}
+	}
+
+	class ReadableStream {
+		get locked() {
+			return this[state].reader !== undefined;
+		}
+		getReader() {
+			return new ReadableStreamDefaultReader(this);
+		}
+		cancel(reason) {
+			if (this.locked) {
+				return Promise.reject(new TypeError("ReadableStream is locked"));
+			}
+			return this[state].cancel(reason);
+		}
+		values({ preventCancel = false } = {}) {
+			const reader = this.getReader();
+			return {
+				next: () => reader.read().then((result) => {
+					if (result.done) {
+						reader.releaseLock();
+					}
+					return result;
+				}, (e) => {
+					reader.releaseLock();
+					throw e;
+				}),
+				return: async (value) => {
+					if (!preventCancel) {
+						await reader.cancel(value);
+					}
+					reader.releaseLock();
+					return { value, done: true };
+				},
+				[Symbol.asyncIterator]() {
+					return this;
+				},
+			};
+		}
+		[Symbol.asyncIterator](options) {
+			return this.values(options);
+		}
+		async pipeTo(dest, { preventClose = false, preventAbort = false, preventCancel = false } = {}) {
+			const reader = this.getReader();
+			const writer = dest.getWriter();
+			try {
+				for (;;) {
+					const { value, done } = await reader.read();
+					if (done) {
+						break;
+					}
+					await writer.write(value);
+				}
+			} catch (e) {
+				if (!preventAbort) {
+					await writer.abort(e).catch(() => {});
+				}
+				if (!preventCancel) {
+					await reader.cancel(e).catch(() => {});
+				}
+				throw e;
+			} finally {
+				reader.releaseLock();
+				writer.releaseLock();
+			}
+			if (!preventClose) {
+				await dest.close();
+			}
+		}
+		get [Symbol.toStringTag]() {
+			return "ReadableStream";
+		}
+	}
+
+	const readable = (pull, cancel) => {
+		const stream = Object.create(ReadableStream.prototype);
+		const s = { reader: undefined, done: false, error: undefined, last: Promise.resolve(), closed: deferred() };
+		const finish = () => {
+			s.done = true;
+			s.closed.resolve();
+			return { value: undefined, done: true };
+		};
+		s.read = () => {
+			const result = s.last.then(() => {
+				if (s.error !== undefined) {
+					throw s.error.e;
+				}
+				if (s.done) {
+					return { value: undefined, done: true };
+				}
+				return start(pull).then((buffer) => {
+					if (buffer === undefined || s.done) {
+						return finish();
+					}
+					return { value: new Uint8Array(buffer), done: false };
+				}, (e) => {
+					if (s.done) {
+						return finish();
+					}
+					s.error = { e };
+					s.closed.reject(e);
+					throw e;
+				});
+			});
+			s.last = result.catch(() => {});
+			return result;
+		};
+		s.cancel = (reason) => {
+			if (s.error !== undefined) {
+				return Promise.reject(s.error.e);
+			}
+			if (s.done) {
+				return Promise.resolve();
+			}
+			finish();
+			return start(cancel, reason).then(() => {});
+		};
+		Object.defineProperty(stream, state, { value: s });
+		return stream;
+	};
+
+	const locked = (writer, fn) => {
+		const s = writer[state][state];
+		if (s.writer !== writer) {
+			return Promise.reject(new TypeError("writer released"));
+		}
+		return fn(s);
+	};
+
+	class WritableStreamDefaultWriter {
+		constructor(stream) {
+			const s = stream[state];
+			if (s.writer !== undefined) {
+				throw new TypeError("WritableStream is locked");
+			}
+			s.writer = this;
+			Object.defineProperty(this, state, { value: stream });
+		}
+		get closed() {
+			return this[state][state].closed.promise;
+		}
+		get ready() {
+			return this[state][state].ready.promise;
+		}
+		get desiredSize() {
+			const s = this[state][state];
+			return s.error !== undefined ? null : s.closing ? 0 : 1 - s.queued;
+		}
+		write(chunk) {
+			return locked(this, (s) => s.write(chunk));
+		}
+		close() {
+			return locked(this, (s) => s.close());
+		}
+		abort(reason) {
+			return locked(this, (s) => s.abort(reason));
+		}
+		releaseLock() {
+			const s = this[state][state];
+			if (s.writer === this) {
+				s.writer = undefined;
+			}
+		}
+		get [Symbol.toStringTag]() {
+			return "WritableStreamDefaultWriter";
+		}
+	}
+
+	class WritableStream {
+		get locked() {
+			return this[state].writer !== undefined;
+		}
+		getWriter() {
+			return new WritableStreamDefaultWriter(this);
+		}
+		close() {
+			if (this.locked) {
+				return Promise.reject(new TypeError("WritableStream is locked"));
+			}
+			return this[state].close();
+		}
+		abort(reason) {
+			if (this.locked) {
+				return Promise.reject(new TypeError("WritableStream is locked"));
+			}
+			return this[state].abort(reason);
+		}
+		get [Symbol.toStringTag]() {
+			return "WritableStream";
+		}
+	}
+
+	const bytes = (chunk) => {
+		if (typeof chunk === "string" || chunk instanceof ArrayBuffer) {
+			return chunk;
+		}
+		if (ArrayBuffer.isView(chunk)) {
+			return chunk.buffer.slice(chunk.byteOffset, chunk.byteOffset + chunk.byteLength);
+		}
+		throw new TypeError("chunk must be a string, an ArrayBuffer or an ArrayBuffer view");
+	};
+
+	const writable = (write, close, abort) => {
+		const stream = Object.create(WritableStream.prototype);
+		const s = { writer: undefined, queued: 0, closing: false, error: undefined, last: Promise.resolve(), closed: deferred(), ready: deferred() };
+		s.ready.resolve();
+		const fail = (e) => {
+			if (s.error === undefined) {
+				s.error = { e };
+				s.closed.reject(e);
+				s.ready = deferred();
+				s.ready.reject(e);
+			}
+		};
+		const enqueue = (op) => {
+			if (s.queued++ === 0 && s.error === undefined) {
+				s.ready = deferred();
+			}
+			const result = s.last.then(() => {
+				if (s.error !== undefined) {
+					throw s.error.e;
+				}
+				return op();
+			}).then(() => {}, (e) => {
+				fail(e);
+				throw e;
+			}).finally(() => {
+				if (--s.queued === 0 && s.error === undefined) {
+					s.ready.resolve();
+				}
+			});
+			s.last = result.catch(() => {});
+			return result;
+		};
+		s.write = (chunk) => {
+			if (s.closing) {
+				return Promise.reject(new TypeError("WritableStream is closed"));
+			}
+			let data;
+			try {
+				data = bytes(chunk);
+			} catch (e) {
+				return Promise.reject(e);
+			}
+			return enqueue(() => start(write, data));
+		};
+		s.close = () => {
+			if (s.closing) {
+				return Promise.reject(new TypeError("WritableStream is closed"));
+			}
+			s.closing = true;
+			return enqueue(() => start(close).then(() => s.closed.resolve()));
+		};
+		s.abort = (reason) => {
+			if (s.error !== undefined) {
+				return Promise.resolve();
+			}
+			s.closing = true;
+			fail(reason);
+			return start(abort, reason).then(() => {});
+		};
+		Object.defineProperty(stream, state, { value: s });
+		return stream;
+	};
+
+	return {
+		readable,
+		writable,
+		settle(id, ok, value) {
+			const op = ops.get(id);
+			if (op !== undefined) {
+				ops.delete(id);
+				ok ? op.resolve(value) : op.reject(value);
+			}
+		},
+	};
+})()`
+
+// NewReadableStream returns a ReadableStream reading the reader in chunks of 64 KiB, see NewReadableStreamSize.
+func (ctx *Context) NewReadableStream(r io.Reader) (Value, error) {
+	return ctx.NewReadableStreamSize(r, defaultStreamChunkSize)
+}
+
+// NewReadableStreamSize returns a ReadableStream reading the reader in chunks of at most size bytes, delivered as Uint8Arrays,
+// so that scripts process large payloads incrementally. The stream implements the reader of the Streams API, async iteration
+// and pipeTo a stream of NewWritableStream; there is no ReadableStream constructor.
+//
+// The reader is only read when a script reads the stream, one chunk at a time, which lets the scripts apply backpressure.
+// Each read runs on its own goroutine and completes with a job scheduled on the context, see Schedule: Loop waits for the
+// reads in progress, but Await and EvalAwait do not, so the scripts reading streams must run from Loop.
+// Cancelling the stream closes the reader if it is an io.Closer; an error of the reader errors the stream.
+func (ctx *Context) NewReadableStreamSize(r io.Reader, size int) (Value, error) {
+	if size <= 0 {
+		return ctx.Undefined(), errors.New("quickjs: stream chunk size must be positive")
+	}
+	var readErr error
+	pull := ctx.NamedFunction("pull", 1, func(ctx *Context, this Value, args []Value) Value {
+		ctx.startStreamOp(args[0].Int64(), func() (func(ctx *Context) Value, error) {
+			if readErr != nil {
+				return nil, readErr
+			}
+			buf := make([]byte, size)
+			for {
+				n, err := r.Read(buf)
+				if n > 0 {
+					readErr = err
+					return func(ctx *Context) Value { return ctx.ArrayBuffer(buf[:n]) }, nil
+				}
+				if err == io.EOF {
+					return func(ctx *Context) Value { return ctx.Undefined() }, nil
+				}
+				if err != nil {
+					return nil, err
+				}
+			}
+		})
+		return ctx.Undefined()
+	})
+	cancel := ctx.NamedFunction("cancel", 2, func(ctx *Context, this Value, args []Value) Value {
+		ctx.startStreamOp(args[0].Int64(), func() (func(ctx *Context) Value, error) {
+			return nil, closeStream(r)
+		})
+		return ctx.Undefined()
+	})
+	return ctx.newStream("readable", pull, cancel)
+}
+
+// NewWritableStream returns a WritableStream writing to the writer the chunks written by scripts: strings as UTF-8,
+// ArrayBuffers and ArrayBuffer views as their bytes. The stream implements the writer of the Streams API,
+// whose ready promise and desiredSize tell scripts to wait for the previous write; there is no WritableStream constructor.
+//
+// Each write runs on its own goroutine and completes with a job scheduled on the context, like the reads of NewReadableStreamSize.
+// Closing or aborting the stream closes the writer if it is an io.Closer; an error of the writer errors the stream.
+func (ctx *Context) NewWritableStream(w io.Writer) (Value, error) {
+	write := ctx.NamedFunction("write", 2, func(ctx *Context, this Value, args []Value) Value {
+		var data []byte
+		if args[1].IsString() {
+			data = []byte(args[1].String())
+		} else {
+			var err error
+			if data, err = args[1].ToByteArray(uint(args[1].ByteLen())); err != nil {
+				return ctx.ThrowError(err)
+			}
+		}
+		ctx.startStreamOp(args[0].Int64(), func() (func(ctx *Context) Value, error) {
+			_, err := w.Write(data)
+			return nil, err
+		})
+		return ctx.Undefined()
+	})
+	closeFn := func(ctx *Context, this Value, args []Value) Value {
+		ctx.startStreamOp(args[0].Int64(), func() (func(ctx *Context) Value, error) {
+			return nil, closeStream(w)
+		})
+		return ctx.Undefined()
+	}
+	closeWriter := ctx.NamedFunction("close", 1, closeFn)
+	abort := ctx.NamedFunction("abort", 2, closeFn)
+	return ctx.newStream("writable", write, closeWriter, abort)
+}
+
+// newStream calls the maker of streamScript with the functions, which it frees.
+func (ctx *Context) newStream(maker string, fns ...Value) (Value, error) {
+	defer freeValues(fns)
+	if ctx.streams == nil {
+		streams, err := ctx.eval(streamScript, EvalFileName("<streams>"))
+		if err != nil {
+			return ctx.Undefined(), err
+		}
+		streams.keep()
+		ctx.streams = &streams
+	}
+	stream := ctx.streams.Call(maker, fns...)
+	if stream.IsException() {
+		return stream, ctx.exceptionError()
+	}
+	return stream, nil
+}
+
+// startStreamOp runs op on a new goroutine, then settles the stream operation of the id in a job: with the value made
+// by the function returned by op, or undefined if nil, or else with its error. Loop waits for the operations in progress.
+func (ctx *Context) startStreamOp(id int64, op func() (func(ctx *Context) Value, error)) {
+	streams := ctx.streams
+	atomic.AddInt64(&ctx.streamOps, 1)
+	done := func() { atomic.AddInt64(&ctx.streamOps, -1) }
+	go func() {
+		value, opErr := op()
+		err := ctx.schedule(job{
+			run: func(ctx *Context) {
+				done()
+				if ctx.streams != streams {
+					// the context was reset since
+					return
+				}
+				ok := opErr == nil
+				var val Value
+				switch {
+				case !ok:
+					val = ctx.Error(opErr)
+				case value != nil:
+					val = value(ctx)
+				default:
+					val = ctx.Undefined()
+				}
+				args := []Value{ctx.Int64(id), ctx.Bool(ok), val}
+				defer freeValues(args)
+				ret := ctx.streams.Call("settle", args...)
+				ret.Free()
+			},
+			cancel: func(error) { done() },
+		}, ctx.jobQueue.done)
+		if err != nil {
+			done()
+		}
+	}()
+}
+
+// closeStream closes the reader or writer of a stream if it is an io.Closer.
+func closeStream(v interface{}) error {
+	if c, ok := v.(io.Closer); ok {
+		return c.Close()
+	}
+	return nil
+}
@@ -0,0 +1,142 @@
+package quickjs
+
+// thenableScript returns the functions keeping the callbacks given to the then methods of thenables until they are settled from Go:
+// register(id, onFulfilled, onRejected) keeps them under the id, and settle(id, fulfilled, value) calls one of them with the value, once.
+const thenableScript = `(() => {
+	const pending = new Map();
+	return {
+		register(id, onFulfilled, onRejected) {
+			pending.set(id, { onFulfilled, onRejected });
+		},
+		settle(id, fulfilled, value) {
+			const callbacks = pending.get(id);
+			if (callbacks === undefined) {
+				return;
+			}
+			pending.delete(id);
+			const callback = fulfilled ? callbacks.onFulfilled : callbacks.onRejected;
+			if (typeof callback === "function") {
+				callback(value);
+			}
+		},
+	};
+})()`
+
+// installThenables evaluates thenableScript, once.
+func (ctx *Context) installThenables() error {
+	if ctx.thenables != nil {
+		return nil
+	}
+	thenables, err := ctx.eval(thenableScript, EvalFileName("<thenable>"))
+	if err != nil {
+		return err
+	}
+	thenables.keep()
+	ctx.thenables = &thenables
+	return nil
+}
+
+// NewThenable returns an object whose then method calls fn with the functions settling the promise awaiting it, which a script
+// can await, or pass to Promise.resolve, without the promise and resolving functions of AsyncFunction being created up front.
+// Like the executor of a promise, fn is called each time the object is awaited, and the first call of resolve or reject settles it;
+// they may be called later, e.g. by a job scheduled from another goroutine, but only with the context, see Schedule.
+// They do not take ownership of the value; nil stands for undefined. The callbacks not settled are dropped when the context is reset or closed.
+func (ctx *Context) NewThenable(fn func(resolve, reject func(*Value))) Value {
+	if err := ctx.installThenables(); err != nil {
+		return ctx.ThrowError(err)
+	}
+	then := ctx.NamedFunction("then", 2, func(ctx *Context, this Value, args []Value) Value {
+		callbacks := []Value{ctx.Undefined(), ctx.Undefined()}
+		copy(callbacks, args)
+		ctx.thenableSeq++
+		id := ctx.thenableSeq
+		ret := ctx.thenables.Call("register", ctx.Int64(id), callbacks[0], callbacks[1])
+		if ret.IsException() {
+			return ret
+		}
+		ret.Free()
+
+		thenables := ctx.thenables
+		settle := func(fulfilled bool) func(*Value) {
+			return func(val *Value) {
+				if ctx.thenables != thenables {
+					// reset or closed since
+					return
+				}
+				value := ctx.Undefined()
+				if val != nil {
+					value = *val
+				}
+				ret := thenables.Call("settle", ctx.Int64(id), ctx.Bool(fulfilled), value)
+				defer ret.Free()
+				if ret.IsException() {
+					ctx.reportUncaught(ctx.exceptionError().(*Error))
+				}
+			}
+		}
+		fn(settle(true), settle(false))
+		return ctx.Undefined()
+	})
+	obj := ctx.Object()
+	obj.Set("then", then)
+	return obj
+}
+
+// NewThenableFunc returns a thenable, see NewThenable, running fn on a goroutine of its own when it is first awaited:
+// its result, converted with Marshal, fulfills the promises awaiting the thenable, or its error rejects them.
+// The result is delivered by a job scheduled on the context, see Schedule, so the awaiting script resumes in Await or Loop.
+func (ctx *Context) NewThenableFunc(fn func() (interface{}, error)) Value {
+	var (
+		started bool
+		done    bool
+		result  interface{}
+		err     error
+		waiters []func()
+	)
+	return ctx.NewThenable(func(resolve, reject func(*Value)) {
+		settle := func() {
+			if err != nil {
+				reason := ctx.Error(err)
+				defer reason.Free()
+				reject(&reason)
+				return
+			}
+			val, err := ctx.Marshal(result)
+			if err != nil {
+				reason := ctx.Error(err)
+				defer reason.Free()
+				reject(&reason)
+				return
+			}
+			defer val.Free()
+			resolve(&val)
+		}
+		if done {
+			settle()
+			return
+		}
+		waiters = append(waiters, settle)
+		if started {
+			return
+		}
+		started = true
+		go func() {
+			r, e := fn()
+			ctx.schedule(job{run: func(ctx *Context) {
+				result, err, done = r, e, true
+				for _, settle := range waiters {
+					settle()
+				}
+				waiters = nil
+			}}, ctx.jobQueue.done)
+		}()
+	})
+}
+
+// NewThenableChan returns a thenable, see NewThenableFunc, fulfilled with the first value received from the channel,
+// or with null if it is closed first.
+func (ctx *Context) NewThenableChan(ch <-chan interface{}) Value {
+	return ctx.NewThenableFunc(func() (interface{}, error) {
+		return <-ch, nil
+	})
+}
@@ -0,0 +1,97 @@
+package quickjs
+
+import "runtime"
+
+// WithDedicatedThread will run the runtime and its contexts on a goroutine locked to an OS thread of their own; default is false,
+// which runs them on the calling goroutines, locking the thread of the one calling NewRuntime.
+//
+// The methods NewContext, Close and RunGC of the runtime, and Eval, Invoke, Await, Loop, Reset, Close and Do of its contexts,
+// as well as Value.Free, are proxied to the thread when called from another goroutine, so they may be called concurrently;
+// other methods, e.g. to read a value returned by Eval, must run within Do, as the engine is not thread-safe and measures
+// its stack on the thread. Proxying costs a few microseconds per call.
+// Go callbacks of scripts run on the thread and call the context directly.
+func WithDedicatedThread(dedicated bool) Option {
+	return func(o *Options) {
+		o.dedicatedThread = dedicated
+	}
+}
+
+// thread runs the functions given to it on a goroutine locked to an OS thread, see WithDedicatedThread.
+type thread struct {
+	jobs chan func()
+	quit chan struct{}
+	id   uint64 // the id of the goroutine
+}
+
+// newThread starts a thread, which runs until it is stopped.
+func newThread() *thread {
+	t := &thread{jobs: make(chan func()), quit: make(chan struct{})}
+	started := make(chan struct{})
+	go func() {
+		runtime.LockOSThread()
+		t.id = goroutineID()
+		close(started)
+		for {
+			select {
+			case job := <-t.jobs:
+				job()
+			case <-t.quit:
+				return
+			}
+		}
+	}()
+	<-started
+	return t
+}
+
+// remote reports whether the caller runs on another goroutine than the thread, so that its calls must be proxied by do;
+// it is false without a dedicated thread.
+func (t *thread) remote() bool {
+	return t != nil && goroutineID() != t.id
+}
+
+// do runs fn on the thread and waits for it, re-panicking its panic on the calling goroutine; it panics if the thread is stopped.
+func (t *thread) do(fn func()) {
+	var p interface{}
+	done := make(chan struct{})
+	job := func() {
+		defer func() {
+			p = recover()
+			close(done)
+		}()
+		fn()
+	}
+	select {
+	case t.jobs <- job:
+	case <-t.quit:
+		panic("quickjs: Runtime used after Close")
+	}
+	<-done
+	if p != nil {
+		panic(p)
+	}
+}
+
+// post runs fn on the thread without waiting for it; fn is dropped if the thread stops first.
+func (t *thread) post(fn func()) {
+	go func() {
+		select {
+		case t.jobs <- fn:
+		case <-t.quit:
+		}
+	}()
+}
+
+// stop ends the thread once its running job returns.
+func (t *thread) stop() {
+	close(t.quit)
+}
+
+// Do runs fn with the context, on the dedicated thread of the runtime if any, see WithDedicatedThread.
+func (ctx *Context) Do(fn func(ctx *Context)) {
+	if t := ctx.runtime.thread; t.remote() {
+		t.do(func() { fn(ctx) })
+		return
+	}
+	fn(ctx)
+}
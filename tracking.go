@@ -0,0 +1,137 @@
+package quickjs
+
+/*
+#include "bridge.h"
+*/
+import "C"
+import (
+	"fmt"
+	"runtime"
+	"sort"
+	"strings"
+	"unsafe"
+)
+
+// LeakSite groups the unfreed values created at the same call site.
+type LeakSite struct {
+	Location string // the first caller outside of this package, as file:line
+	Stack    string // the creation stack of one of the values
+	Count    int
+}
+
+// LeakReport describes the values which were created but not freed.
+type LeakReport struct {
+	Total int
+	Sites []LeakSite
+}
+
+// String returns a human readable report, one call site per line.
+func (r *LeakReport) String() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "quickjs: %d value(s) not freed\n", r.Total)
+	for _, site := range r.Sites {
+		fmt.Fprintf(&b, "  %d at %s\n", site.Count, site.Location)
+	}
+	return b.String()
+}
+
+// valueTracker records the creation stack of every reference counted value of a context.
+type valueTracker struct {
+	live map[unsafe.Pointer][][]uintptr
+}
+
+func newValueTracker() *valueTracker {
+	return &valueTracker{live: make(map[unsafe.Pointer][][]uintptr)}
+}
+
+// track records a new reference to the value; skip is the number of frames to drop from the stack.
+func (t *valueTracker) track(ref C.JSValue, skip int) {
+	ptr := C.ValueGetPtr(ref)
+	if ptr == nil {
+		return
+	}
+	pcs := make([]uintptr, 32)
+	n := runtime.Callers(skip+2, pcs)
+	t.live[ptr] = append(t.live[ptr], pcs[:n])
+}
+
+// release forgets the most recent reference to the value, when the value is freed or its ownership is transferred.
+func (t *valueTracker) release(ref C.JSValue) {
+	ptr := C.ValueGetPtr(ref)
+	if ptr == nil {
+		return
+	}
+	stacks := t.live[ptr]
+	if len(stacks) <= 1 {
+		delete(t.live, ptr)
+		return
+	}
+	t.live[ptr] = stacks[:len(stacks)-1]
+}
+
+func (t *valueTracker) report() *LeakReport {
+	report := &LeakReport{}
+	sites := make(map[string]*LeakSite)
+	for _, stacks := range t.live {
+		for _, pcs := range stacks {
+			location, stack := describeStack(pcs)
+			site, ok := sites[location]
+			if !ok {
+				site = &LeakSite{Location: location, Stack: stack}
+				sites[location] = site
+			}
+			site.Count++
+			report.Total++
+		}
+	}
+	for _, site := range sites {
+		report.Sites = append(report.Sites, *site)
+	}
+	sort.Slice(report.Sites, func(i, j int) bool {
+		if report.Sites[i].Count != report.Sites[j].Count {
+			return report.Sites[i].Count > report.Sites[j].Count
+		}
+		return report.Sites[i].Location < report.Sites[j].Location
+	})
+	return report
+}
+
+// describeStack returns the first frame outside of this package and the formatted stack.
+func describeStack(pcs []uintptr) (string, string) {
+	var location string
+	var b strings.Builder
+	frames := runtime.CallersFrames(pcs)
+	for {
+		frame, more := frames.Next()
+		fmt.Fprintf(&b, "%s\n\t%s:%d\n", frame.Function, frame.File, frame.Line)
+		if location == "" && !strings.HasPrefix(frame.Function, "github.com/buke/quickjs-go.") {
+			location = fmt.Sprintf("%s:%d", frame.File, frame.Line)
+		}
+		if !more {
+			break
+		}
+	}
+	if location == "" {
+		location = "unknown"
+	}
+	return location, b.String()
+}
+
+// newValue wraps a reference owned by the caller, recording it when value tracking is enabled.
+func (ctx *Context) newValue(ref C.JSValue) Value {
+	if ctx.tracker != nil {
+		ctx.tracker.track(ref, 1)
+	}
+	if ctx.freed != nil {
+		ctx.freed.acquire(ref)
+	}
+	return Value{ctx: ctx, ref: ref}
+}
+
+// LeakReport returns the values created but not yet freed; it returns nil if value tracking is disabled.
+func (ctx *Context) LeakReport() *LeakReport {
+	if ctx.tracker == nil {
+		return nil
+	}
+	return ctx.tracker.report()
+}
@@ -0,0 +1,129 @@
+package quickjs
+
+/*
+#include "bridge.h"
+*/
+import "C"
+import (
+	"fmt"
+	"os"
+)
+
+// wrapTimersScript routes the exceptions thrown by setTimeout callbacks to the reporter.
+// An exception the reporter does not handle is rethrown, so the event loop prints it as before.
+// It returns the functions managing the pending timers: clear, used by Reset, and next and fire, used by CloseWithTimeout
+// to run the timers one by one: next returns the delay of the next timer in milliseconds, or -1 if none, and fire runs it now.
+const wrapTimersScript = `((report) => {
+	const originalSetTimeout = globalThis.setTimeout;
+	const originalClearTimeout = globalThis.clearTimeout;
+	const timers = new Map(); // timer => {run, due}
+	globalThis.setTimeout = function setTimeout(func, delay) {
+		if (typeof func !== "function") {
+			return originalSetTimeout(func, delay);
+		}
+		const run = () => {
+			timers.delete(timer);
+			try {
+				func();
+			} catch (e) {
+				if (!report(e)) {
+					throw e;
+				}
+			}
+		};
+		const timer = originalSetTimeout(run, delay);
+		timers.set(timer, { run, due: Date.now() + (+delay || 0) });
+		return timer;
+	};
+	globalThis.clearTimeout = function clearTimeout(timer) {
+		timers.delete(timer);
+		return originalClearTimeout(timer);
+	};
+	const first = () => {
+		let next;
+		timers.forEach((entry, timer) => {
+			if (next === undefined || entry.due < next.entry.due) {
+				next = { timer, entry };
+			}
+		});
+		return next;
+	};
+	return {
+		clear() {
+			timers.forEach((entry, timer) => originalClearTimeout(timer));
+			timers.clear();
+		},
+		next() {
+			const next = first();
+			return next === undefined ? -1 : Math.max(0, next.entry.due - Date.now());
+		},
+		fire() {
+			const next = first();
+			if (next !== undefined) {
+				originalClearTimeout(next.timer);
+				next.entry.run();
+			}
+		},
+	};
+})`
+
+// setupUncaughtExceptions installs the setTimeout wrapper reporting uncaught exceptions to the context.
+func (ctx *Context) setupUncaughtExceptions() error {
+	wrap, err := ctx.eval(wrapTimersScript, EvalFileName("<timers>"))
+	if err != nil {
+		return err
+	}
+	defer wrap.Free()
+
+	reporter := ctx.newValue(C.NewUncaughtExceptionReporter(ctx.ref))
+	defer reporter.Free()
+
+	timers := ctx.Invoke(wrap, ctx.Null(), reporter)
+	if timers.IsException() {
+		return ctx.Exception()
+	}
+	timers.keep()
+	ctx.timers = &timers
+	return nil
+}
+
+// SetUncaughtExceptionHandler sets the handler called with the uncaught exceptions of the code run by Loop and Await:
+// the ones thrown by setTimeout and queueMicrotask callbacks, by the listeners of events and abort signals, and by the jobs of the job queue,
+// e.g. when a job is interrupted; use nil to restore the default, which logs them to the runtime's logger, if any, or else prints them to stderr.
+// Exceptions thrown by the callbacks of promises reject the promise they return instead, see Runtime.SetPromiseRejectionHandler.
+func (ctx *Context) SetUncaughtExceptionHandler(handler func(*Error)) {
+	ctx.uncaughtExceptionHandler = handler
+}
+
+// executePendingJob runs the next job of the job queue of the runtime, reporting its exception like an uncaught exception
+// of the context which queued it, and reports whether there was a job to run.
+func (ctx *Context) executePendingJob() bool {
+	var jobCtx *C.JSContext
+	ret := C.JS_ExecutePendingJob(ctx.runtime.ref, &jobCtx)
+	if ret < 0 {
+		owner := contextFromRef(jobCtx)
+		if owner == nil {
+			C.js_std_dump_error(jobCtx)
+			return true
+		}
+		exception := owner.newValue(C.JS_GetException(jobCtx))
+		defer exception.Free()
+		owner.reportUncaught(exception.toError())
+	}
+	return ret != 0
+}
+
+// reportUncaught reports the exception of a script run by the context on its own, e.g. by a scheduled job,
+// like the uncaught exceptions of setTimeout callbacks: to the handler, or else the logger, or else stderr.
+func (ctx *Context) reportUncaught(err *Error) {
+	if handler := ctx.uncaughtExceptionHandler; handler != nil {
+		defer ctx.recoverPanic(nil)
+		handler(err)
+		return
+	}
+	if logger := ctx.runtime.options.logger; logger != nil {
+		logger.Log(LogLevelError, "quickjs: uncaught exception", errorFields(err))
+		return
+	}
+	fmt.Fprintln(os.Stderr, err)
+}
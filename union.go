@@ -0,0 +1,136 @@
+package quickjs
+
+import (
+	"fmt"
+	"reflect"
+)
+
+// TypeRegistry holds the tagged unions converted by Marshal with MarshalTypes and Unmarshal with UnmarshalTypes, see RegisterUnion.
+// It must not be modified while it is used.
+type TypeRegistry struct {
+	unions  map[reflect.Type]*union      // by interface type
+	members map[reflect.Type]unionMember // by struct type
+}
+
+// union is the tagged union of an interface type.
+type union struct {
+	field string
+	types map[string]reflect.Type // the registered types, by tag
+}
+
+// unionMember is the discriminator of a struct type registered in a union.
+type unionMember struct {
+	field string
+	tag   string
+}
+
+// NewTypeRegistry returns an empty registry.
+func NewTypeRegistry() *TypeRegistry {
+	return &TypeRegistry{unions: make(map[reflect.Type]*union), members: make(map[reflect.Type]unionMember)}
+}
+
+// RegisterUnion registers the members, structs or pointers to structs implementing the interface I, as a tagged union:
+// Marshal defines the field of their objects to the name of their type, e.g. {"kind": "Circle", "radius": 1},
+// and Unmarshal converts an object to I as the member named by its field, e.g. Circle or *Circle as registered.
+//
+//	quickjs.RegisterUnion[Shape](registry, "kind", Circle{}, Square{})
+func RegisterUnion[I any](r *TypeRegistry, field string, members ...I) error {
+	iface := reflect.TypeOf((*I)(nil)).Elem()
+	if iface.Kind() != reflect.Interface {
+		return fmt.Errorf("quickjs: union type %s is not an interface", iface)
+	}
+	if _, ok := r.unions[iface]; ok {
+		return fmt.Errorf("quickjs: union %s is already registered", iface)
+	}
+
+	u := &union{field: field, types: make(map[string]reflect.Type, len(members))}
+	for _, member := range members {
+		t := reflect.TypeOf(member)
+		if t == nil {
+			return fmt.Errorf("quickjs: nil member of union %s", iface)
+		}
+		st := t
+		if st.Kind() == reflect.Pointer {
+			st = st.Elem()
+		}
+		if st.Kind() != reflect.Struct {
+			return fmt.Errorf("quickjs: member %s of union %s is not a struct", t, iface)
+		}
+		if _, ok := u.types[st.Name()]; ok {
+			return fmt.Errorf("quickjs: duplicate member %s of union %s", st.Name(), iface)
+		}
+		if m, ok := r.members[st]; ok && m.field != field {
+			return fmt.Errorf("quickjs: member %s is already registered with field %s", st, m.field)
+		}
+		u.types[st.Name()] = t
+	}
+
+	r.unions[iface] = u
+	for tag, t := range u.types {
+		if t.Kind() == reflect.Pointer {
+			t = t.Elem()
+		}
+		r.members[t] = unionMember{field: field, tag: tag}
+	}
+	return nil
+}
+
+// MarshalTypes makes Marshal define the discriminator field of the members of the registry's unions.
+func MarshalTypes(r *TypeRegistry) MarshalOption {
+	return func(options *MarshalOptions) {
+		options.types = r
+	}
+}
+
+// UnmarshalTypes makes Unmarshal convert objects to the interfaces of the registry's unions as the member named by their discriminator field;
+// an object without a discriminator or with an unknown one fails to unmarshal.
+func UnmarshalTypes(r *TypeRegistry) UnmarshalOption {
+	return func(options *UnmarshalOptions) {
+		options.types = r
+	}
+}
+
+// member returns the discriminator of the struct type, if it is registered in a union.
+func (r *TypeRegistry) member(t reflect.Type) (unionMember, bool) {
+	if r == nil {
+		return unionMember{}, false
+	}
+	m, ok := r.members[t]
+	return m, ok
+}
+
+// union returns the union of the interface type, if any.
+func (r *TypeRegistry) union(t reflect.Type) *union {
+	if r == nil {
+		return nil
+	}
+	return r.unions[t]
+}
+
+// unmarshalUnion stores in rv the member of the union named by the discriminator of the object.
+func (v Value) unmarshalUnion(rv reflect.Value, u *union, options *UnmarshalOptions) error {
+	if v.IsNull() || v.IsUndefined() {
+		rv.Set(reflect.Zero(rv.Type()))
+		return nil
+	}
+	if !v.IsObject() {
+		return v.unmarshalTypeError(rv.Type())
+	}
+
+	tag := v.Get(u.field)
+	defer tag.Free()
+	if !tag.IsString() {
+		return fmt.Errorf("quickjs: missing %s of union %s", u.field, rv.Type())
+	}
+	t, ok := u.types[tag.String()]
+	if !ok {
+		return fmt.Errorf("quickjs: unknown %s %q of union %s", u.field, tag.String(), rv.Type())
+	}
+
+	member := reflect.New(t).Elem()
+	if err := v.unmarshal(member, options); err != nil {
+		return err
+	}
+	rv.Set(member)
+	return nil
+}
@@ -0,0 +1,34 @@
+package quickjs
+
+import "sync"
+
+// userData is the host data of a runtime, shared by its copies.
+type userData struct {
+	mu sync.RWMutex
+	v  interface{}
+}
+
+// SetUserData associates host state with the context, e.g. the request it serves or the configuration of its tenant,
+// so that host functions retrieve it with UserData instead of looking the context up in a map. It is kept by Reset.
+func (ctx *Context) SetUserData(v interface{}) {
+	ctx.userData = v
+}
+
+// UserData returns the host state set by SetUserData, or nil.
+func (ctx *Context) UserData() interface{} {
+	return ctx.userData
+}
+
+// SetUserData associates host state with the runtime, shared by its contexts; it is safe for concurrent use.
+func (r Runtime) SetUserData(v interface{}) {
+	r.userData.mu.Lock()
+	defer r.userData.mu.Unlock()
+	r.userData.v = v
+}
+
+// UserData returns the host state set by SetUserData, or nil.
+func (r Runtime) UserData() interface{} {
+	r.userData.mu.RLock()
+	defer r.userData.mu.RUnlock()
+	return r.userData.v
+}
@@ -0,0 +1,136 @@
+package quickjs
+
+/*
+#include "bridge.h"
+*/
+import "C"
+import (
+	"errors"
+	"unicode/utf8"
+	"unsafe"
+)
+
+// ErrLoneSurrogate is the error of ToString for a string holding a lone surrogate with LoneSurrogatesReject.
+var ErrLoneSurrogate = errors.New("quickjs: string holds a lone surrogate")
+
+// LoneSurrogates is how ToString converts the lone surrogates of a string, the UTF-16 code units of the range
+// U+D800 to U+DFFF not paired, which UTF-8 cannot encode, e.g. in strings holding binary data or truncated in the middle of a pair.
+type LoneSurrogates int
+
+const (
+	// LoneSurrogatesPreserve encodes them as WTF-8, as String does: the result is not valid UTF-8, but Context.String
+	// converts it back to the same string.
+	LoneSurrogatesPreserve LoneSurrogates = iota
+	// LoneSurrogatesReplace replaces them with U+FFFD, as String.prototype.toWellFormed does, so the result is valid UTF-8.
+	LoneSurrogatesReplace
+	// LoneSurrogatesReject fails the conversion with ErrLoneSurrogate.
+	LoneSurrogatesReject
+)
+
+// StringOption configures ToString.
+type StringOption func(*stringOptions)
+
+type stringOptions struct {
+	loneSurrogates LoneSurrogates
+}
+
+// StringLoneSurrogates sets how ToString converts the lone surrogates; default is LoneSurrogatesPreserve.
+func StringLoneSurrogates(mode LoneSurrogates) StringOption {
+	return func(options *stringOptions) {
+		options.loneSurrogates = mode
+	}
+}
+
+// ToString returns the string representation of the value like String, but returns the exception of the conversion
+// instead of an empty string, and converts the lone surrogates as the options set, see StringLoneSurrogates.
+// A string longer than WithMaxStringLength fails with a *LimitError.
+func (v Value) ToString(opts ...StringOption) (string, error) {
+	var options stringOptions
+	for _, opt := range opts {
+		opt(&options)
+	}
+	// a string has at least as many bytes as UTF-16 code units, so one with too many is not converted at all
+	if v.IsString() {
+		if err := v.ctx.checkStringLength(int(v.StringLen())); err != nil {
+			return "", err
+		}
+	}
+	var size C.size_t
+	ptr := C.JS_ToCStringLen(v.ctx.ref, &size, v.ref)
+	if ptr == nil {
+		return "", v.ctx.exceptionError()
+	}
+	defer C.JS_FreeCString(v.ctx.ref, ptr)
+	if err := v.ctx.checkStringLength(int(size)); err != nil {
+		return "", err
+	}
+	s := C.GoStringN(ptr, C.int(size))
+	if options.loneSurrogates == LoneSurrogatesPreserve || utf8.ValidString(s) {
+		return s, nil
+	}
+
+	// the engine pairs the surrogates it can, so the 3-byte sequences of surrogates left are lone
+	buf := make([]byte, 0, len(s))
+	for i := 0; i < len(s); {
+		if i+2 < len(s) && s[i] == 0xed && s[i+1] >= 0xa0 {
+			if options.loneSurrogates == LoneSurrogatesReject {
+				return "", ErrLoneSurrogate
+			}
+			buf = utf8.AppendRune(buf, utf8.RuneError)
+			i += 3
+			continue
+		}
+		buf = append(buf, s[i])
+		i++
+	}
+	return string(buf), nil
+}
+
+// ToUTF16 returns the UTF-16 code units of the string representation of the value, lone surrogates included, e.g. for the protocols
+// storing binary data in strings one code unit per 16 bits; it returns nil if the conversion throws.
+func (v Value) ToUTF16() []uint16 {
+	var size C.size_t
+	// CESU-8 encodes each code unit on its own, surrogates included
+	ptr := C.JS_ToCStringLen2(v.ctx.ref, &size, v.ref, 1)
+	if ptr == nil {
+		C.JS_FreeValue(v.ctx.ref, C.JS_GetException(v.ctx.ref))
+		return nil
+	}
+	defer C.JS_FreeCString(v.ctx.ref, ptr)
+	b := unsafe.Slice((*byte)(unsafe.Pointer(ptr)), int(size))
+
+	units := make([]uint16, 0, len(b))
+	for i := 0; i < len(b); {
+		switch c := b[i]; {
+		case c < 0x80:
+			units = append(units, uint16(c))
+			i++
+		case c < 0xe0 && i+1 < len(b):
+			units = append(units, uint16(c&0x1f)<<6|uint16(b[i+1]&0x3f))
+			i += 2
+		case i+2 < len(b):
+			units = append(units, uint16(c&0x0f)<<12|uint16(b[i+1]&0x3f)<<6|uint16(b[i+2]&0x3f))
+			i += 3
+		default:
+			i = len(b)
+		}
+	}
+	return units
+}
+
+// NewStringUTF16 returns a string value of the UTF-16 code units, lone surrogates included, the reverse of ToUTF16.
+func (ctx *Context) NewStringUTF16(units []uint16) Value {
+	// the engine decodes the 3-byte sequences of surrogates into code units of their own
+	buf := make([]byte, 0, len(units)*3)
+	for _, u := range units {
+		switch {
+		case u < 0x80:
+			buf = append(buf, byte(u))
+		case u < 0x800:
+			buf = append(buf, 0xc0|byte(u>>6), 0x80|byte(u&0x3f))
+		default:
+			buf = append(buf, 0xe0|byte(u>>12), 0x80|byte(u>>6&0x3f), 0x80|byte(u&0x3f))
+		}
+	}
+	return ctx.NewStringLen(buf)
+}
@@ -6,6 +6,8 @@ package quickjs
 import "C"
 import (
 	"errors"
+	"fmt"
+	"math"
 	"math/big"
 	"unsafe"
 )
@@ -13,10 +15,17 @@ import (
 type Error struct {
 	Cause string
 	Stack string
+	// Err is the cause property of the JS error converted to an error, if it has one.
+	Err error
+	// Origin is the origin of the code which raised the error, see EvalOrigin.
+	Origin string
 }
 
 func (err Error) Error() string { return err.Cause }
 
+// Unwrap returns the error of the cause property, so that errors.Unwrap follows the chain of JS causes.
+func (err Error) Unwrap() error { return err.Err }
+
 // Object property names and some strings are stored as Atoms (unique strings) to save memory and allow fast comparison. Atoms are represented as a 32 bit integer. Half of the atom range is reserved for immediate integer literals from 0 to 2^{31}-1.
 type Atom struct {
 	ctx *Context
@@ -37,7 +46,7 @@ func (a Atom) String() string {
 
 // Value returns the value of the Atom object.
 func (a Atom) Value() Value {
-	return Value{ctx: a.ctx, ref: C.JS_AtomToValue(a.ctx.ref, a.ref)}
+	return a.ctx.newValue(C.JS_AtomToValue(a.ctx.ref, a.ref))
 }
 
 // propertyEnum is a wrapper around JSAtom.
@@ -50,6 +59,12 @@ type propertyEnum struct {
 func (p propertyEnum) String() string { return p.atom.String() }
 
 // JSValue represents a Javascript value which can be a primitive type or an object. Reference counting is used, so it is important to explicitly duplicate (JS_DupValue(), increment the reference count) or free (JS_FreeValue(), decrement the reference count) JSValues.
+//
+// A Value is a reference owned by its holder: the values returned by the methods must be freed, except Context.Globals and
+// the arguments and this given to a Go function, which are borrowed. A method taking ownership of a value, as Set, SetIdx,
+// SetAtom, SetPath, Context.Throw and Context.Await do, frees it in place of its holder, which must not free nor use it afterwards;
+// the other methods, e.g. Call and Context.Invoke, only borrow their arguments. Use Dup to keep a value given away, and
+// WithFreeCheck to detect misuses.
 type Value struct {
 	ctx *Context
 	ref C.JSValue
@@ -57,9 +72,62 @@ type Value struct {
 
 // Free the value.
 func (v Value) Free() {
+	if t := v.ctx.runtime.thread; t.remote() {
+		t.do(v.Free)
+		return
+	}
+	v.untrack()
+	if v.ctx.freed != nil {
+		v.ctx.freed.markFreed(v.ref)
+	}
 	C.JS_FreeValue(v.ctx.ref, v.ref)
 }
 
+// keep forgets the value in the tracker without releasing it, for the values held by the context itself, which are not leaks.
+func (v Value) keep() {
+	if v.ctx.tracker != nil {
+		v.ctx.tracker.release(v.ref)
+	}
+}
+
+// untrack forgets the value in the tracker, when it is freed or its ownership is transferred to the engine.
+func (v Value) untrack() {
+	if v.ctx.tracker != nil {
+		v.ctx.tracker.release(v.ref)
+	}
+	if v.ctx.freed != nil {
+		v.ctx.freed.release(v.ref, 1)
+	}
+}
+
+// Migrate returns a new reference to the value owned by the context dst, which must be of the same runtime, e.g. to keep a value
+// of a context about to be closed; the value itself must still be freed. It returns ErrForeignValue if the value belongs
+// to another runtime or to a closed context, which the methods of a context taking values return or throw too.
+func (v Value) Migrate(dst *Context) (*Value, error) {
+	if v.ctx == nil || dst.closed || dst.checkValues(v) != nil {
+		return nil, ErrForeignValue
+	}
+	val := dst.newValue(C.JS_DupValue(dst.ref, v.ref))
+	return &val, nil
+}
+
+// Dup returns a new reference to the value, which must be freed independently of v, e.g. to keep a value given to Set
+// or to keep a borrowed argument of a Go function.
+func (v Value) Dup() Value {
+	if t := v.ctx.runtime.thread; t.remote() {
+		var val Value
+		t.do(func() { val = v.Dup() })
+		return val
+	}
+	v.checkFreed()
+	return v.dup()
+}
+
+// dup returns a new reference to the value.
+func (v Value) dup() Value {
+	return v.ctx.newValue(C.JS_DupValue(v.ctx.ref, v.ref))
+}
+
 // Context represents a Javascript context.
 func (v Value) Context() *Context {
 	return v.ctx
@@ -72,23 +140,86 @@ func (v Value) Bool() bool {
 
 // String returns the string representation of the value.
 func (v Value) String() string {
-	ptr := C.JS_ToCString(v.ctx.ref, v.ref)
+	v.checkFreed()
+	var size C.size_t
+	ptr := C.JS_ToCStringLen(v.ctx.ref, &size, v.ref)
+	if ptr == nil {
+		// the conversion threw, e.g. for a symbol or an object with a throwing toString
+		C.JS_FreeValue(v.ctx.ref, C.JS_GetException(v.ctx.ref))
+		return ""
+	}
 	defer C.JS_FreeCString(v.ctx.ref, ptr)
-	return C.GoString(ptr)
+	return C.GoStringN(ptr, C.int(size))
+}
+
+// StringLen returns the length of the string in UTF-16 code units, like its length property, without converting it to Go;
+// it returns -1 if the value is not a string.
+func (v Value) StringLen() int64 {
+	if !v.IsString() {
+		return -1
+	}
+	length := v.GetAtom(v.ctx.InternAtom("length"))
+	defer length.Free()
+	return length.Int64()
+}
+
+// StringSlice returns the string value of the UTF-16 code units of the string from start up to end excluded, like String.prototype.slice:
+// negative indexes count from the end. Only the slice is copied, so converting it with String is cheap even for a very large string,
+// e.g. to extract a line of a log. It throws a TypeError if the value is not a string.
+func (v Value) StringSlice(start, end int64) Value {
+	if !v.IsString() {
+		return v.ctx.ThrowTypeError("not a string")
+	}
+	slice := v.GetAtom(v.ctx.InternAtom("slice"))
+	defer slice.Free()
+	return v.ctx.Invoke(slice, v, v.ctx.Int64(start), v.ctx.Int64(end))
 }
 
 // JSONString returns the JSON string representation of the value.
 func (v Value) JSONStringify() string {
+	v.checkFreed()
 	ref := C.JS_JSONStringify(v.ctx.ref, v.ref, C.JS_NewNull(), C.JS_NewNull())
 	ptr := C.JS_ToCString(v.ctx.ref, ref)
 	defer C.JS_FreeCString(v.ctx.ref, ptr)
 	return C.GoString(ptr)
 }
 
+// stableStringifyScript stringifies a value with the keys of its objects sorted.
+const stableStringifyScript = `(value) => JSON.stringify(value, (key, val) => {
+	if (val === null || typeof val !== "object" || Array.isArray(val)) {
+		return val;
+	}
+	const sorted = {};
+	for (const k of Object.keys(val).sort()) {
+		sorted[k] = val[k];
+	}
+	return sorted;
+})`
+
+// JSONStringifyStable returns the JSON string representation of the value with the keys of its objects sorted,
+// so that the output does not depend on property creation order. As objects enumerate integer keys first,
+// those come first in ascending numeric order, followed by the other keys in lexical order.
+func (v Value) JSONStringifyStable() (string, error) {
+	stringify, err := v.ctx.eval(stableStringifyScript, EvalFileName("<json>"))
+	if err != nil {
+		return "", err
+	}
+	defer stringify.Free()
+	ret := v.ctx.Invoke(stringify, v.ctx.Null(), v)
+	defer ret.Free()
+	if ret.IsException() {
+		return "", v.ctx.exceptionError()
+	}
+	return ret.String(), nil
+}
+
 func (v Value) ToByteArray(size uint) ([]byte, error) {
 	if v.ByteLen() < int64(size) {
 		return nil, errors.New("exceeds the maximum length of the current binary array")
 	}
+	if err := v.ctx.checkArrayLength(int64(size)); err != nil {
+		return nil, err
+	}
 	cSize := C.size_t(size)
 	outBuf := C.JS_GetArrayBuffer(v.ctx.ref, &cSize, v.ref)
 	return C.GoBytes(unsafe.Pointer(outBuf), C.int(size)), nil
@@ -127,6 +258,51 @@ func (v Value) Float64() float64 {
 	return float64(val)
 }
 
+// ToInt64Checked returns the int64 value of a number or BigInt, or an error if the value is not a number,
+// is NaN or infinite, has a fractional part or is out of the int64 range.
+func (v Value) ToInt64Checked() (int64, error) {
+	if v.IsBigInt() {
+		n := v.BigInt()
+		if n == nil || !n.IsInt64() {
+			return 0, fmt.Errorf("quickjs: bigint %s overflows int64", v.String())
+		}
+		return n.Int64(), nil
+	}
+	f, err := v.ToFloat64Checked()
+	if err != nil {
+		return 0, err
+	}
+	if math.IsNaN(f) || math.IsInf(f, 0) || f != math.Trunc(f) {
+		return 0, fmt.Errorf("quickjs: number %v is not an integer", f)
+	}
+	// float64(math.MaxInt64) rounds up to 2^63, which is out of range
+	if f < math.MinInt64 || f >= math.MaxInt64 {
+		return 0, fmt.Errorf("quickjs: number %v overflows int64", f)
+	}
+	return int64(f), nil
+}
+
+// ToInt32Checked returns the int32 value of a number, or an error if the conversion would lose information, see ToInt64Checked.
+func (v Value) ToInt32Checked() (int32, error) {
+	n, err := v.ToInt64Checked()
+	if err != nil {
+		return 0, err
+	}
+	if n < math.MinInt32 || n > math.MaxInt32 {
+		return 0, fmt.Errorf("quickjs: number %d overflows int32", n)
+	}
+	return int32(n), nil
+}
+
+// ToFloat64Checked returns the float64 value of a number, or an error if the value is not a number.
+// Unlike Float64, it does not convert other types, e.g. a string or undefined to NaN.
+func (v Value) ToFloat64Checked() (float64, error) {
+	if !v.IsNumber() {
+		return 0, fmt.Errorf("quickjs: %s is not a number", v.typeName())
+	}
+	return v.Float64(), nil
+}
+
 // BigInt returns the big.Int value of the value.
 func (v Value) BigInt() *big.Int {
 	if !v.IsBigInt() {
@@ -139,6 +315,23 @@ func (v Value) BigInt() *big.Int {
 	return val
 }
 
+// ToBigInt returns the exact big.Int value of a BigInt or of an integral number.
+func (v Value) ToBigInt() (*big.Int, error) {
+	switch {
+	case v.IsBigInt():
+		if val := v.BigInt(); val != nil {
+			return val, nil
+		}
+	case v.IsNumber():
+		f := v.Float64()
+		if f == math.Trunc(f) && !math.IsInf(f, 0) {
+			val, _ := big.NewFloat(f).Int(nil)
+			return val, nil
+		}
+	}
+	return nil, fmt.Errorf("quickjs: cannot convert %s to big.Int", v.String())
+}
+
 // BigFloat returns the big.Float value of the value.
 func (v Value) BigFloat() *big.Float {
 	if !v.IsBigDecimal() && !v.IsBigFloat() {
@@ -207,32 +400,54 @@ func (v Value) ByteLen() int64 {
 	return v.Get("byteLength").Int64()
 }
 
-// Set sets the value of the property with the given name.
+// Set sets the value of the property with the given name, taking ownership of val.
+// A value of another runtime is freed instead, see ErrForeignValue.
 func (v Value) Set(name string, val Value) {
+	v.checkFreed()
+	if v.ctx.dropForeign(val) {
+		return
+	}
 	namePtr := C.CString(name)
 	defer C.free(unsafe.Pointer(namePtr))
+	val.untrack()
 	C.JS_SetPropertyStr(v.ctx.ref, v.ref, namePtr, val.ref)
 }
 
-// SetIdx sets the value of the property with the given index.
+// SetIdx sets the value of the property with the given index, taking ownership of val.
+// A value of another runtime is freed instead, see ErrForeignValue.
 func (v Value) SetIdx(idx int64, val Value) {
+	v.checkFreed()
+	if v.ctx.dropForeign(val) {
+		return
+	}
+	val.untrack()
 	C.JS_SetPropertyUint32(v.ctx.ref, v.ref, C.uint32_t(idx), val.ref)
 }
 
 // Get returns the value of the property with the given name.
 func (v Value) Get(name string) Value {
+	v.checkFreed()
 	namePtr := C.CString(name)
 	defer C.free(unsafe.Pointer(namePtr))
-	return Value{ctx: v.ctx, ref: C.JS_GetPropertyStr(v.ctx.ref, v.ref, namePtr)}
+	return v.ctx.newValue(C.JS_GetPropertyStr(v.ctx.ref, v.ref, namePtr))
 }
 
 // GetIdx returns the value of the property with the given index.
 func (v Value) GetIdx(idx int64) Value {
-	return Value{ctx: v.ctx, ref: C.JS_GetPropertyUint32(v.ctx.ref, v.ref, C.uint32_t(idx))}
+	v.checkFreed()
+	return v.ctx.newValue(C.JS_GetPropertyUint32(v.ctx.ref, v.ref, C.uint32_t(idx)))
 }
 
-// Call calls the function with the given arguments.
+// Call calls the function with the given arguments; it does not take ownership of them.
 func (v Value) Call(fname string, args ...Value) Value {
+	v.checkFreed()
+	if exception, ok := v.ctx.throwGoroutine(); ok {
+		return exception
+	}
+	if exception, ok := v.ctx.throwForeign(args...); ok {
+		return exception
+	}
+	defer v.ctx.enter()()
 	if !v.IsObject() {
 		return v.ctx.Error(errors.New("Object not a object"))
 	}
@@ -249,9 +464,9 @@ func (v Value) Call(fname string, args ...Value) Value {
 		cargs = append(cargs, x.ref)
 	}
 	if len(cargs) == 0 {
-		return Value{ctx: v.ctx, ref: C.JS_Call(v.ctx.ref, fn.ref, v.ref, C.int(0), nil)}
+		return v.ctx.newValue(C.JS_Call(v.ctx.ref, fn.ref, v.ref, C.int(0), nil))
 	}
-	return Value{ctx: v.ctx, ref: C.JS_Call(v.ctx.ref, fn.ref, v.ref, C.int(len(cargs)), &cargs[0])}
+	return v.ctx.newValue(C.JS_Call(v.ctx.ref, fn.ref, v.ref, C.int(len(cargs)), &cargs[0]))
 }
 
 // Call Class Constructor
@@ -261,6 +476,13 @@ func (v Value) New(args ...Value) Value {
 
 // Call calls the constructor with the given arguments.
 func (v Value) CallConstructor(args ...Value) Value {
+	if exception, ok := v.ctx.throwGoroutine(); ok {
+		return exception
+	}
+	if exception, ok := v.ctx.throwForeign(args...); ok {
+		return exception
+	}
+	defer v.ctx.enter()()
 	if !v.IsConstructor() {
 		return v.ctx.Error(errors.New("Object not a constructor"))
 	}
@@ -270,9 +492,9 @@ func (v Value) CallConstructor(args ...Value) Value {
 		cargs = append(cargs, x.ref)
 	}
 	if len(cargs) == 0 {
-		return Value{ctx: v.ctx, ref: C.JS_CallConstructor(v.ctx.ref, v.ref, C.int(0), nil)}
+		return v.ctx.newValue(C.JS_CallConstructor(v.ctx.ref, v.ref, C.int(0), nil))
 	}
-	return Value{ctx: v.ctx, ref: C.JS_CallConstructor(v.ctx.ref, v.ref, C.int(len(cargs)), &cargs[0])}
+	return v.ctx.newValue(C.JS_CallConstructor(v.ctx.ref, v.ref, C.int(len(cargs)), &cargs[0]))
 }
 
 // Error returns the error value of the value.
@@ -280,15 +502,63 @@ func (v Value) Error() error {
 	if !v.IsError() {
 		return nil
 	}
-	cause := v.String()
+	return v.errorChain(0)
+}
+
+// maxErrorCauses bounds the cause chain converted by Error, which may be cyclic.
+const maxErrorCauses = 32
+
+// errorChain converts the Error object and its cause property, recursively, to an *Error.
+func (v Value) errorChain(depth int) *Error {
+	err := &Error{Cause: v.errorString()}
 
 	stack := v.Get("stack")
 	defer stack.Free()
+	if !stack.IsUndefined() {
+		err.Stack = stack.String()
+	}
+
+	if depth < maxErrorCauses && v.Has("cause") {
+		cause := v.Get("cause")
+		defer cause.Free()
+		if cause.IsError() {
+			err.Err = cause.errorChain(depth + 1)
+		} else {
+			err.Err = &Error{Cause: cause.String()}
+		}
+	}
+	return err
+}
+
+// errorString returns the string conversion of the Error object, or else its name and message,
+// e.g. when its toString throws or fails after the engine ran out of memory.
+func (v Value) errorString() string {
+	if str := v.String(); str != "" {
+		return str
+	}
+	name, message := v.Get("name"), v.Get("message")
+	defer name.Free()
+	defer message.Free()
+	if message.IsUndefined() || message.String() == "" {
+		return name.String()
+	}
+	return name.String() + ": " + message.String()
+}
+
+// toError converts a thrown value to an *Error, using its string conversion if it is not an Error object.
+// withOrigin sets the origin of the error, unless it has one, and returns it.
+func (err *Error) withOrigin(origin string) *Error {
+	if err.Origin == "" {
+		err.Origin = origin
+	}
+	return err
+}
 
-	if stack.IsUndefined() {
-		return &Error{Cause: cause}
+func (v Value) toError() *Error {
+	if err, ok := v.Error().(*Error); ok {
+		return err
 	}
-	return &Error{Cause: cause, Stack: stack.String()}
+	return &Error{Cause: v.String()}
 }
 
 // propertyEnum is a wrapper around JSValue.
@@ -328,6 +598,7 @@ func (v Value) PropertyNames() ([]string, error) {
 
 // Has returns true if the value has the property with the given name.
 func (v Value) Has(name string) bool {
+	v.checkFreed()
 	prop := v.ctx.Atom(name)
 	defer prop.Free()
 	return C.JS_HasProperty(v.ctx.ref, v.ref, prop.ref) == 1
@@ -342,6 +613,7 @@ func (v Value) HasIdx(idx int64) bool {
 
 // Delete deletes the property with the given name.
 func (v Value) Delete(name string) bool {
+	v.checkFreed()
 	prop := v.ctx.Atom(name)
 	defer prop.Free()
 	return C.JS_DeleteProperty(v.ctx.ref, v.ref, prop.ref, C.int(1)) == 1
@@ -0,0 +1,79 @@
+package quickjs
+
+/*
+#include <stdint.h>
+#include "bridge.h"
+*/
+import "C"
+import (
+	"errors"
+	"runtime/cgo"
+)
+
+// WeakValue is a weak reference from Go to a JS object. It does not keep the object alive, so Go-side caches of JS objects don't prevent QuickJS GC.
+type WeakValue struct {
+	ctx    *Context
+	ref    C.JSValue
+	target *weakTarget
+}
+
+// weakTarget is the liveness of an object referenced weakly, shared by its weak references.
+// It is cleared by the finalizer of a sentinel held only by a private slot of the object, see privateSlotScript.
+type weakTarget struct {
+	alive bool
+}
+
+// NewWeakRef returns a weak reference to the given object value.
+// The caller keeps ownership of v; the weak reference does not increment its reference count.
+//
+// The collection of the object is tracked by a sentinel stored in a private field of the object, which scripts cannot reach.
+// The object must be extensible and cannot be a Proxy.
+func (ctx *Context) NewWeakRef(v Value) (*WeakValue, error) {
+	if !v.IsObject() {
+		return nil, errors.New("weak reference target must be an object")
+	}
+	if C.IsProxy(v.ref) != 0 {
+		return nil, errors.New("weak reference target cannot be a Proxy")
+	}
+
+	existing, err := ctx.getPrivate(&ctx.weakRefSlot, v)
+	if err != nil {
+		return nil, err
+	}
+	defer existing.Free()
+	if handle := C.GetWeakRefHandle(existing.ref); handle != 0 {
+		return &WeakValue{ctx: ctx, ref: v.ref, target: cgo.Handle(handle).Value().(*weakTarget)}, nil
+	}
+
+	if C.JS_IsExtensible(ctx.ref, v.ref) != 1 {
+		return nil, errors.New("weak reference target is not extensible")
+	}
+
+	// the sentinel is only referenced by the target, so its finalizer runs when the target is collected.
+	target := &weakTarget{alive: true}
+	handle := cgo.NewHandle(target)
+	sentinel := ctx.newValue(C.NewWeakRefSentinel(ctx.ref, C.uintptr_t(handle)))
+	if sentinel.IsException() {
+		handle.Delete()
+		return nil, ctx.exceptionError()
+	}
+	defer sentinel.Free()
+	if err := ctx.definePrivate(&ctx.weakRefSlot, v, sentinel); err != nil {
+		return nil, err
+	}
+	return &WeakValue{ctx: ctx, ref: v.ref, target: target}, nil
+}
+
+// Deref returns the referenced object and true if it is still alive.
+// The returned value is a new reference and must be freed by the caller.
+func (w *WeakValue) Deref() (Value, bool) {
+	if !w.target.alive {
+		return w.ctx.Undefined(), false
+	}
+	return w.ctx.newValue(C.JS_DupValue(w.ctx.ref, w.ref)), true
+}
+
+// Alive returns true if the referenced object has not been collected yet.
+func (w *WeakValue) Alive() bool {
+	return w.target.alive
+}